@@ -0,0 +1,45 @@
+package blobstore
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key that is not stored
+var ErrNotFound = errors.New("blob not found")
+
+// Store is the adapter every blob store implementation satisfies. Keys are
+// plain file names (no slashes); callers name blobs after their content, so
+// a key is never overwritten with different data.
+type Store interface {
+	// Name identifies the store in logs
+	Name() string
+	// Put stores data under key
+	Put(key, contentType string, data []byte) error
+	// Get returns the data and content type stored under key
+	Get(key string) ([]byte, string, error)
+}
+
+// NewFromEnv builds the store selected by IMAGE_STORE ("disk" or "memory").
+// The disk store keeps files in IMAGE_STORE_DIR (default data/images).
+func NewFromEnv() Store {
+	switch os.Getenv("IMAGE_STORE") {
+	case "memory":
+		log.Println("IMAGE_STORE=memory, uploaded images are lost on restart")
+		return NewMemoryStore()
+	}
+
+	dir := os.Getenv("IMAGE_STORE_DIR")
+	if dir == "" {
+		dir = filepath.Join("data", "images")
+	}
+	return NewDiskStore(dir)
+}
+
+// validKey rejects keys that could escape a store's directory
+func validKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.ContainsAny(key, `/\`)
+}
@@ -0,0 +1,64 @@
+package blobstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DiskStore keeps blobs as files in a directory. The content type is kept
+// in a sidecar file next to each blob.
+type DiskStore struct {
+	Dir string
+}
+
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{Dir: dir}
+}
+
+func (s *DiskStore) Name() string {
+	return "disk"
+}
+
+// Put writes the blob through a temporary file so readers never see a
+// partly written one
+func (s *DiskStore) Put(key, contentType string, data []byte) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, key+".type"), []byte(contentType), 0o644); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, key))
+}
+
+func (s *DiskStore) Get(key string) ([]byte, string, error) {
+	if !validKey(key) {
+		return nil, "", ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, key))
+	if os.IsNotExist(err) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contentType, _ := os.ReadFile(filepath.Join(s.Dir, key+".type"))
+	return data, string(contentType), nil
+}
@@ -0,0 +1,39 @@
+package blobstore
+
+import "sync"
+
+// MemoryStore keeps blobs in memory, for local development
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]blob
+}
+
+type blob struct {
+	data        []byte
+	contentType string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string]blob)}
+}
+
+func (s *MemoryStore) Name() string {
+	return "memory"
+}
+
+func (s *MemoryStore) Put(key, contentType string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = blob{data: append([]byte(nil), data...), contentType: contentType}
+	return nil
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	return b.data, b.contentType, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -69,22 +70,27 @@ func ConnectAstraDB() (*AstraDBClient, error) {
 		},
 	}
 
-	client := &AstraDBClient{
+	client := NewAstraDBClient(baseURL, dataAPIURL, token, &http.Client{
+		Timeout:   120 * time.Second, // Overall timeout 2 minutes
+		Transport: transport,
+	})
+	client.Keyspace = keyspace
+
+	DBClient = client
+	return client, nil
+}
+
+// NewAstraDBClient builds a client for the given REST and Data API base URLs
+func NewAstraDBClient(baseURL, dataAPIURL, token string, httpClient *http.Client) *AstraDBClient {
+	return &AstraDBClient{
 		BaseURL:    baseURL,
 		DataAPIURL: dataAPIURL,
 		Token:      token,
-		Keyspace:   keyspace,
-		Client: &http.Client{
-			Timeout:   120 * time.Second, // Overall timeout 2 minutes
-			Transport: transport,
-		},
+		Client:     httpClient,
 		cache: &cache{
 			data: make(map[string]*cacheEntry),
 		},
 	}
-
-	DBClient = client
-	return client, nil
 }
 
 // getFromCache retrieves data from cache if not expired
@@ -235,6 +241,9 @@ func (c *AstraDBClient) InsertDocument(collection string, document map[string]in
 	if resp.StatusCode >= 400 {
 		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
 	}
+	if err := dataAPIError(respBody); err != nil {
+		return nil, err
+	}
 
 	return respBody, nil
 }
@@ -283,10 +292,119 @@ func (c *AstraDBClient) UpdateDocument(collection string, filter map[string]inte
 	if resp.StatusCode >= 400 {
 		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(updateRespBody))
 	}
+	if err := dataAPIError(updateRespBody); err != nil {
+		return nil, err
+	}
 
 	return updateRespBody, nil
 }
 
+// UpsertDocument updates a document matching filter, inserting it when none exists
+func (c *AstraDBClient) UpsertDocument(collection string, filter map[string]interface{}, update map[string]interface{}) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s", c.DataAPIURL, collection)
+
+	body := map[string]interface{}{
+		"findOneAndUpdate": map[string]interface{}{
+			"filter": filter,
+			"update": map[string]interface{}{
+				"$set": update,
+			},
+			"options": map[string]interface{}{
+				"returnDocument": "after",
+				"upsert":         true,
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Token", c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if err := dataAPIError(respBody); err != nil {
+		return nil, err
+	}
+
+	return respBody, nil
+}
+
+// IncrementDocument atomically adds by to a numeric field of the document
+// matching filter, creating the document when none exists, and returns the
+// updated document
+func (c *AstraDBClient) IncrementDocument(collection string, filter map[string]interface{}, field string, by int) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s", c.DataAPIURL, collection)
+
+	body := map[string]interface{}{
+		"findOneAndUpdate": map[string]interface{}{
+			"filter": filter,
+			"update": map[string]interface{}{
+				"$inc": map[string]interface{}{field: by},
+			},
+			"options": map[string]interface{}{
+				"returnDocument": "after",
+				"upsert":         true,
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Token", c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if err := dataAPIError(respBody); err != nil {
+		return nil, err
+	}
+
+	return respBody, nil
+}
+
 // FindDocuments finds documents in a collection using Data API with filter
 func (c *AstraDBClient) FindDocuments(collection string, filter map[string]interface{}, options map[string]interface{}) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s", c.DataAPIURL, collection)
@@ -358,6 +476,44 @@ func (c *AstraDBClient) FindDocuments(collection string, filter map[string]inter
 	if resp.StatusCode >= 400 {
 		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
 	}
+	if err := dataAPIError(respBody); err != nil {
+		return nil, err
+	}
 
 	return respBody, nil
 }
+
+// DataAPIError is an error the Data API reports in the body of a 200
+// response, e.g. a duplicate _id on insert
+type DataAPIError struct {
+	Code    string
+	Message string
+}
+
+func (e *DataAPIError) Error() string {
+	if e.Code == "" {
+		return "data API error: " + e.Message
+	}
+	return fmt.Sprintf("data API error %s: %s", e.Code, e.Message)
+}
+
+// IsDuplicateDocument reports whether err is the Data API rejecting an
+// insert because a document with the same _id exists
+func IsDuplicateDocument(err error) bool {
+	var apiErr *DataAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == "DOCUMENT_ALREADY_EXISTS"
+}
+
+// dataAPIError returns the first error listed in a Data API response body
+func dataAPIError(body []byte) error {
+	var response struct {
+		Errors []struct {
+			ErrorCode string `json:"errorCode"`
+			Message   string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Errors) == 0 {
+		return nil
+	}
+	return &DataAPIError{Code: response.Errors[0].ErrorCode, Message: response.Errors[0].Message}
+}
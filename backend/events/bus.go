@@ -0,0 +1,175 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Domain event types
+const (
+	TransactionSaved   = "transaction.saved"
+	TransactionVoided  = "transaction.voided"
+	VoucherRedeemed    = "voucher.redeemed"
+	OrderStatusChanged = "order.status_changed"
+	MenuItemChanged    = "menu.item_changed" // outlet availability or price override
+	KitchenItemChanged = "kitchen.item_changed"
+	ShiftClosed        = "shift.closed"
+)
+
+// Event is a domain event. IDs are "<boot>-<seq>" so a client resuming after
+// a server restart can tell its last ID belongs to an earlier process.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	OutletID  string      `json:"outlet_id,omitempty"`
+	Kemitraan string      `json:"kemitraan,omitempty"`
+	At        string      `json:"at"`
+	Data      interface{} `json:"data"`
+
+	seq uint64
+}
+
+// Filter selects the events a subscriber receives. An empty outlet or
+// kemitraan matches any; Types limits the event types.
+type Filter struct {
+	OutletID  string
+	Kemitraan string
+	Types     []string
+}
+
+// Matches reports whether an event passes the filter
+func (f Filter) Matches(e Event) bool {
+	if f.OutletID != "" && f.OutletID != e.OutletID {
+		return false
+	}
+	if f.Kemitraan != "" && !strings.EqualFold(f.Kemitraan, e.Kemitraan) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives live events matching its filter
+type Subscription struct {
+	Events chan Event
+	filter Filter
+}
+
+// Bus is an in-process publish/subscribe bus that keeps the most recent
+// events so reconnecting clients can resume
+type Bus struct {
+	mu     sync.Mutex
+	boot   string
+	seq    uint64
+	buffer []Event // ring of the last len(buffer) events
+	subs   map[*Subscription]struct{}
+}
+
+// NewBus creates a bus that retains up to size events for resuming
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Bus{
+		boot:   strconv.FormatInt(time.Now().Unix(), 36),
+		buffer: make([]Event, 0, size),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish records an event and delivers it to matching subscribers. A
+// subscriber that is not keeping up misses live events; it can resume from
+// its last event ID after reconnecting.
+func (b *Bus) Publish(eventType, outletID, kemitraan string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event{
+		ID:        fmt.Sprintf("%s-%d", b.boot, b.seq),
+		Type:      eventType,
+		OutletID:  outletID,
+		Kemitraan: kemitraan,
+		At:        time.Now().Format(time.RFC3339),
+		Data:      data,
+		seq:       b.seq,
+	}
+
+	if len(b.buffer) < cap(b.buffer) {
+		b.buffer = append(b.buffer, event)
+	} else {
+		b.buffer[int((b.seq-1)%uint64(cap(b.buffer)))] = event
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.Events <- event:
+		default:
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscriber and returns the retained events after
+// lastEventID that match the filter. complete is false when events after
+// lastEventID were already dropped (buffer overrun or server restart).
+func (b *Bus) Subscribe(filter Filter, lastEventID string) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{Events: make(chan Event, 256), filter: filter}
+	b.subs[sub] = struct{}{}
+
+	complete = true
+	if lastEventID == "" {
+		return sub, nil, complete
+	}
+
+	var after uint64
+	boot, seq, ok := strings.Cut(lastEventID, "-")
+	if n, err := strconv.ParseUint(seq, 10, 64); ok && err == nil && boot == b.boot {
+		after = n
+	} else {
+		complete = false
+	}
+
+	ordered := b.ordered()
+	if complete && len(ordered) > 0 && ordered[0].seq > after+1 {
+		complete = false
+	}
+	for _, e := range ordered {
+		if e.seq > after && filter.Matches(e) {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Unsubscribe stops delivering events to a subscriber
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+}
+
+// ordered returns the retained events oldest first; callers hold b.mu
+func (b *Bus) ordered() []Event {
+	if len(b.buffer) < cap(b.buffer) {
+		return append([]Event{}, b.buffer...)
+	}
+	start := int(b.seq % uint64(cap(b.buffer)))
+	return append(append([]Event{}, b.buffer[start:]...), b.buffer[:start]...)
+}
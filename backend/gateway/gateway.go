@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Charge statuses, normalized across gateways
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+// ChargeRequest asks the gateway for a dynamic QRIS charge
+type ChargeRequest struct {
+	OrderID       string // our payment reference, unique per attempt
+	Amount        int64  // whole rupiah
+	ExpiryMinutes int
+}
+
+// Charge is the gateway's view of a QRIS payment
+type Charge struct {
+	OrderID   string
+	GatewayID string // the gateway's own transaction ID
+	Amount    int64
+	Status    string
+	QRString  string
+	ExpiresAt time.Time
+}
+
+// Notification is a verified payment notification (webhook) from a gateway
+type Notification struct {
+	OrderID   string `json:"order_id"`
+	GatewayID string `json:"gateway_id"`
+	Amount    int64  `json:"amount"`
+	Status    string `json:"status"`
+}
+
+// Gateway is the adapter every payment gateway implementation satisfies
+type Gateway interface {
+	// Name identifies the gateway in stored charges
+	Name() string
+	// CreateQRIS creates a dynamic QRIS charge and returns the QR string
+	CreateQRIS(req ChargeRequest) (*Charge, error)
+	// GetStatus queries the current status of a charge by order ID
+	GetStatus(orderID string) (*Charge, error)
+	// ParseNotification verifies a webhook's signature and decodes it.
+	// header returns the value of a request header.
+	ParseNotification(body []byte, header func(string) string) (*Notification, error)
+}
+
+// ErrNotConfigured is returned by NewFromEnv when no gateway is configured;
+// the server then runs without QRIS payments
+var ErrNotConfigured = errors.New("no payment gateway configured: set MIDTRANS_SERVER_KEY, or PAYMENT_GATEWAY=fake for development")
+
+// NewFromEnv builds the gateway selected by PAYMENT_GATEWAY ("midtrans" or
+// "fake"). Without it, Midtrans is used when MIDTRANS_SERVER_KEY is set. The
+// fake gateway marks charges paid on request, so it is never picked silently:
+// it must be selected, or ENV must be development, and it needs its own
+// FAKE_GATEWAY_SECRET. Nothing configured is ErrNotConfigured; a gateway
+// that is selected but incomplete is another error.
+func NewFromEnv() (Gateway, error) {
+	serverKey := os.Getenv("MIDTRANS_SERVER_KEY")
+	switch selected := os.Getenv("PAYMENT_GATEWAY"); selected {
+	case "midtrans":
+		if serverKey == "" {
+			return nil, fmt.Errorf("PAYMENT_GATEWAY=midtrans requires MIDTRANS_SERVER_KEY")
+		}
+		return NewHTTPGateway(os.Getenv("MIDTRANS_BASE_URL"), serverKey), nil
+	case "fake":
+		return fakeFromEnv()
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_GATEWAY %q (expected midtrans or fake)", selected)
+	}
+
+	if serverKey != "" {
+		return NewHTTPGateway(os.Getenv("MIDTRANS_BASE_URL"), serverKey), nil
+	}
+	if os.Getenv("ENV") == "development" {
+		log.Println("PAYMENT_GATEWAY not configured, using fake QRIS gateway (ENV=development)")
+		return fakeFromEnv()
+	}
+	return nil, ErrNotConfigured
+}
+
+func fakeFromEnv() (Gateway, error) {
+	secret := os.Getenv("FAKE_GATEWAY_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("the fake payment gateway requires FAKE_GATEWAY_SECRET")
+	}
+	if os.Getenv("ENV") != "development" {
+		log.Println("WARNING: using the fake QRIS gateway outside development; charges can be marked paid without payment")
+	}
+	return NewFakeGateway(secret), nil
+}
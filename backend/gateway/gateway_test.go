@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string // gateway name, "" for an error, "-" for ErrNotConfigured
+	}{
+		{"nothing configured", map[string]string{}, "-"},
+		{"server key", map[string]string{"MIDTRANS_SERVER_KEY": "key"}, "midtrans"},
+		{"midtrans without key", map[string]string{"PAYMENT_GATEWAY": "midtrans"}, ""},
+		{"development falls back to fake", map[string]string{"ENV": "development", "FAKE_GATEWAY_SECRET": "s"}, "fake"},
+		{"development fake needs a secret", map[string]string{"ENV": "development"}, ""},
+		{"production does not fall back to fake", map[string]string{"ENV": "production", "FAKE_GATEWAY_SECRET": "s"}, "-"},
+		{"fake selected", map[string]string{"PAYMENT_GATEWAY": "fake", "FAKE_GATEWAY_SECRET": "s"}, "fake"},
+		{"fake selected without secret", map[string]string{"PAYMENT_GATEWAY": "fake"}, ""},
+		{"unknown gateway", map[string]string{"PAYMENT_GATEWAY": "xendit", "MIDTRANS_SERVER_KEY": "key"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"PAYMENT_GATEWAY", "MIDTRANS_SERVER_KEY", "MIDTRANS_BASE_URL", "FAKE_GATEWAY_SECRET", "ENV"} {
+				t.Setenv(key, tt.env[key])
+			}
+			g, err := NewFromEnv()
+			if tt.want == "" || tt.want == "-" {
+				if err == nil {
+					t.Fatalf("got gateway %s, want an error", g.Name())
+				}
+				if notConfigured := errors.Is(err, ErrNotConfigured); notConfigured != (tt.want == "-") {
+					t.Errorf("error %v: ErrNotConfigured %v", err, notConfigured)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Name() != tt.want {
+				t.Errorf("got %s, want %s", g.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayNotificationsAreSigned(t *testing.T) {
+	g := NewFakeGateway("secret")
+	if _, err := g.CreateQRIS(ChargeRequest{OrderID: "P1", Amount: 10000}); err != nil {
+		t.Fatal(err)
+	}
+	body, signature, err := g.Pay("P1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := g.ParseNotification(body, func(string) string { return signature })
+	if err != nil || n.Status != StatusPaid || n.Amount != 10000 {
+		t.Fatalf("notification %+v, err %v", n, err)
+	}
+	other := NewFakeGateway("other")
+	if _, err := other.ParseNotification(body, func(string) string { return signature }); err == nil {
+		t.Error("notification signed with another secret accepted")
+	}
+}
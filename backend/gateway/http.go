@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMidtransURL = "https://api.sandbox.midtrans.com"
+
+// HTTPGateway talks to a Midtrans-style Core API: POST /v2/charge to create
+// a QRIS charge, GET /v2/{order_id}/status to poll it, and SHA-512 signed
+// notifications.
+type HTTPGateway struct {
+	BaseURL   string
+	ServerKey string
+	Client    *http.Client
+}
+
+func NewHTTPGateway(baseURL, serverKey string) *HTTPGateway {
+	if baseURL == "" {
+		baseURL = defaultMidtransURL
+	}
+	return &HTTPGateway{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		ServerKey: serverKey,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *HTTPGateway) Name() string {
+	return "midtrans"
+}
+
+// chargeResponse covers the fields we use from charge and status responses
+type chargeResponse struct {
+	StatusCode        string `json:"status_code"`
+	StatusMessage     string `json:"status_message"`
+	TransactionID     string `json:"transaction_id"`
+	OrderID           string `json:"order_id"`
+	GrossAmount       string `json:"gross_amount"`
+	TransactionStatus string `json:"transaction_status"`
+	QRString          string `json:"qr_string"`
+	ExpiryTime        string `json:"expiry_time"`
+}
+
+// CreateQRIS creates a dynamic QRIS charge
+func (g *HTTPGateway) CreateQRIS(req ChargeRequest) (*Charge, error) {
+	expiry := req.ExpiryMinutes
+	if expiry <= 0 {
+		expiry = 15
+	}
+
+	body := map[string]interface{}{
+		"payment_type": "qris",
+		"transaction_details": map[string]interface{}{
+			"order_id":     req.OrderID,
+			"gross_amount": req.Amount,
+		},
+		"custom_expiry": map[string]interface{}{
+			"expiry_duration": expiry,
+			"unit":            "minute",
+		},
+	}
+
+	var resp chargeResponse
+	if err := g.do("POST", "/v2/charge", body, &resp); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(resp.StatusCode, "2") {
+		return nil, fmt.Errorf("gateway rejected charge (%s): %s", resp.StatusCode, resp.StatusMessage)
+	}
+
+	charge := g.toCharge(resp)
+	if charge.ExpiresAt.IsZero() {
+		charge.ExpiresAt = time.Now().Add(time.Duration(expiry) * time.Minute)
+	}
+	return charge, nil
+}
+
+// GetStatus queries the status of a charge
+func (g *HTTPGateway) GetStatus(orderID string) (*Charge, error) {
+	var resp chargeResponse
+	if err := g.do("GET", "/v2/"+orderID+"/status", nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == "404" {
+		return nil, fmt.Errorf("charge %s not found at gateway", orderID)
+	}
+	return g.toCharge(resp), nil
+}
+
+// ParseNotification verifies signature_key = SHA512(order_id + status_code +
+// gross_amount + server key) and decodes the notification
+func (g *HTTPGateway) ParseNotification(body []byte, header func(string) string) (*Notification, error) {
+	var n struct {
+		chargeResponse
+		SignatureKey string `json:"signature_key"`
+	}
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("invalid notification body: %v", err)
+	}
+
+	sum := sha512.Sum512([]byte(n.OrderID + n.StatusCode + n.GrossAmount + g.ServerKey))
+	expected := hex.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(n.SignatureKey))) != 1 {
+		return nil, fmt.Errorf("invalid notification signature")
+	}
+
+	return &Notification{
+		OrderID:   n.OrderID,
+		GatewayID: n.TransactionID,
+		Amount:    parseAmount(n.GrossAmount),
+		Status:    mapMidtransStatus(n.TransactionStatus),
+	}, nil
+}
+
+func (g *HTTPGateway) toCharge(resp chargeResponse) *Charge {
+	charge := &Charge{
+		OrderID:   resp.OrderID,
+		GatewayID: resp.TransactionID,
+		Amount:    parseAmount(resp.GrossAmount),
+		Status:    mapMidtransStatus(resp.TransactionStatus),
+		QRString:  resp.QRString,
+	}
+	// Midtrans reports times in WIB as "2006-01-02 15:04:05"
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", resp.ExpiryTime, time.FixedZone("WIB", 7*60*60)); err == nil {
+		charge.ExpiresAt = t
+	}
+	return charge
+}
+
+func (g *HTTPGateway) do(method, path string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %v", err)
+		}
+		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, g.BaseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(g.ServerKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("gateway request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse gateway response: %v", err)
+	}
+	return nil
+}
+
+// mapMidtransStatus normalizes Midtrans transaction_status values
+func mapMidtransStatus(status string) string {
+	switch status {
+	case "settlement", "capture":
+		return StatusPaid
+	case "pending":
+		return StatusPending
+	case "expire":
+		return StatusExpired
+	default:
+		return StatusFailed
+	}
+}
+
+// parseAmount parses gross amounts such as "10000.00" into whole rupiah
+func parseAmount(s string) int64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f + 0.5)
+}
@@ -0,0 +1,655 @@
+package handlers
+
+import (
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Open bills are orders tied to a dine-in table. Items can be added in
+// rounds until the bill is settled into a transaction.
+
+// AppendBillItems adds a round of items to an open bill
+func (h *OrderHandler) AppendBillItems(c *fiber.Ctx) error {
+	var req models.UpdateOrderItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "At least one item is required"})
+	}
+	for i := range req.Items {
+		req.Items[i].LineID = ""
+	}
+	if err := prepareOrderItems(req.Items); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	order, status, err := h.loadActiveOrder(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := checkAvailable(h.dbClient, order.OutletID, orderMenuIDs(req.Items)); err != nil {
+		return c.Status(availabilityStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items := append(append([]models.OrderItem{}, order.Items...), req.Items...)
+	ok, err := saveOrderItems(h.dbClient, order, items)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+	}
+
+	// Later rounds go straight to the kitchen once the bill has been sent
+	if order.Status != models.OrderStatusOpen {
+		routeToKitchen(h.dbClient, order, req.Items)
+	}
+	return c.JSON(order)
+}
+
+// RemoveBillItem removes a line, or ?quantity= units of it, from an open bill.
+// Lines the kitchen has started or finished cannot be removed.
+func (h *OrderHandler) RemoveBillItem(c *fiber.Ctx) error {
+	lineID := c.Params("line_id")
+	quantity := 0
+	if q := c.Query("quantity"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "quantity must be a positive number"})
+		}
+		quantity = n
+	}
+
+	order, status, err := h.loadActiveOrder(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items, _, err := takeOrderLines(order.Items, []models.SplitLine{{LineID: lineID, Quantity: quantity}})
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if order.Status != models.OrderStatusOpen {
+		started, err := kitchenStarted(h.dbClient, order.ID, lineID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if started {
+			return c.Status(409).JSON(fiber.Map{"error": "Line " + lineID + " is already being prepared or served"})
+		}
+	}
+	ok, err := saveOrderItems(h.dbClient, order, items)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+	}
+
+	// A line removed entirely no longer needs to be cooked, one partly
+	// removed needs less
+	removed, remaining := true, 0
+	for _, item := range items {
+		if item.LineID == lineID {
+			removed, remaining = false, item.Quantity
+		}
+	}
+	if order.Status != models.OrderStatusOpen {
+		if removed {
+			voidKitchenItems(h.dbClient, order.ID, lineID)
+		} else {
+			resizeKitchenLine(h.dbClient, order.ID, lineID, remaining)
+		}
+	}
+	return c.JSON(order)
+}
+
+// TransferBill moves an open bill to another table; the old table goes to
+// cleaning
+func (h *OrderHandler) TransferBill(c *fiber.Ctx) error {
+	var req models.TransferBillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.TableNumber == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "table_number is required"})
+	}
+
+	order, status, err := h.loadActiveOrder(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if order.TableNumber == req.TableNumber {
+		return c.JSON(order)
+	}
+
+	existing, err := activeBillForTable(h.dbClient, order.OutletID, req.TableNumber)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if existing != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Table " + req.TableNumber + " already has an open bill; merge the bills instead", "order_id": existing.ID})
+	}
+
+	now := time.Now().In(wib)
+	update := map[string]interface{}{"table_number": req.TableNumber, "updated_at": now}
+	filter := map[string]interface{}{
+		"_id":        order.ID,
+		"updated_at": order.UpdatedAt,
+		"settling":   map[string]interface{}{"$ne": true},
+	}
+	ok, err := updateDocumentIf(h.dbClient, "pos_order", filter, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+	}
+
+	fmt.Printf("Bill %s moved from table %s to %s by %s\n", order.ID, order.TableNumber, req.TableNumber, req.Actor)
+	previous := order.TableNumber
+	order.TableNumber = req.TableNumber
+	order.UpdatedAt = now
+	if err := occupyTableForBill(h.dbClient, order.OutletID, order.TableNumber); err != nil {
+		fmt.Printf("Warning: Bill %s moved but table %s was not seated: %v\n", order.ID, order.TableNumber, err)
+	}
+	if err := vacateTableForBill(h.dbClient, order.OutletID, previous); err != nil {
+		fmt.Printf("Warning: Bill %s moved but table %s was not released: %v\n", order.ID, previous, err)
+	}
+	return c.JSON(order)
+}
+
+// MergeBill moves all items of the source bill into this bill and cancels
+// the source bill. The items are saved on this bill first and taken back if
+// the source cannot be cancelled, so neither bill loses them. The source
+// bill's kitchen items move along; its table goes to cleaning.
+func (h *OrderHandler) MergeBill(c *fiber.Ctx) error {
+	var req models.MergeBillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.SourceID == "" || req.Actor == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "source_id and actor are required"})
+	}
+	if req.SourceID == c.Params("id") {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot merge a bill into itself"})
+	}
+
+	target, status, err := h.loadActiveOrder(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	source, status, err := h.loadActiveOrder(req.SourceID)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if source.OutletID != target.OutletID {
+		return c.Status(400).JSON(fiber.Map{"error": "Bills belong to different outlets"})
+	}
+
+	previous := target.Items
+	items := append(append([]models.OrderItem{}, target.Items...), source.Items...)
+	ok, err := saveOrderItems(h.dbClient, target, items)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+	}
+
+	// The source must still hold the items that were just copied
+	match := map[string]interface{}{"updated_at": source.UpdatedAt, "settling": map[string]interface{}{"$ne": true}}
+	ok, err = transitionOrderIf(h.dbClient, source, models.OrderStatusCancelled, req.Actor, "merged into "+target.ID, match, map[string]interface{}{"merged_into": target.ID})
+	if err != nil || !ok {
+		if undone, undoErr := saveOrderItems(h.dbClient, target, previous); undoErr != nil || !undone {
+			fmt.Printf("Error: Bill %s could not be cancelled and its items could not be taken off %s: %v\n", source.ID, target.ID, undoErr)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to merge bills; the items of the source bill were left on both bills", "source_id": source.ID})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(409).JSON(fiber.Map{"error": "Source bill was changed concurrently, reload and try again"})
+	}
+
+	// Items the kitchen already has follow the bill; items not yet sent are
+	// sent now if this bill has been
+	if source.Status != models.OrderStatusOpen {
+		moveKitchenItems(h.dbClient, source.ID, target)
+	} else if target.Status != models.OrderStatusOpen {
+		routeToKitchen(h.dbClient, target, source.Items)
+	}
+	if source.TableNumber != target.TableNumber {
+		if err := vacateTableForBill(h.dbClient, source.OutletID, source.TableNumber); err != nil {
+			fmt.Printf("Warning: Bill %s merged but table %s was not released: %v\n", source.ID, source.TableNumber, err)
+		}
+	}
+	return c.JSON(target)
+}
+
+// SplitBill splits a bill. With items the given lines move to a new bill on
+// the same table; with ways the bill total is divided into equal shares that
+// can be paid as separate payment legs when settling.
+func (h *OrderHandler) SplitBill(c *fiber.Ctx) error {
+	var req models.SplitBillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if (len(req.Items) == 0) == (req.Ways == 0) {
+		return c.Status(400).JSON(fiber.Map{"error": "Either items or ways is required"})
+	}
+
+	order, status, err := h.loadActiveOrder(c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if req.Ways != 0 {
+		return h.splitBillEqually(c, order, req.Ways)
+	}
+
+	remaining, moved, err := takeOrderLines(order.Items, req.Items)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(remaining) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot move every item to a new bill"})
+	}
+
+	now := time.Now().In(wib)
+	orderNumber, err := issueNumber(h.dbClient, models.SequenceOrder, order.OutletID, "", now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue order number: " + err.Error()})
+	}
+	split := models.Order{
+		ID:            uuid.New().String(),
+		OrderNumber:   orderNumber.Number,
+		OutletID:      order.OutletID,
+		CustomerID:    order.CustomerID,
+		TableNumber:   order.TableNumber,
+		Type:          order.Type,
+		Items:         moved,
+		TotalAmount:   orderTotal(moved),
+		Status:        order.Status,
+		PaymentMethod: order.PaymentMethod,
+		StatusTimes:   order.StatusTimes,
+		History: append(append([]models.OrderTransition{}, order.History...), models.OrderTransition{
+			From:   order.Status,
+			To:     order.Status,
+			Actor:  req.Actor,
+			At:     now.Format(time.RFC3339),
+			Reason: "split from " + order.ID,
+		}),
+		CreatedBy: req.Actor,
+		SplitFrom: order.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	document, err := toDocument(split)
+	if err != nil {
+		releaseNumber(h.dbClient, orderNumber)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	document["_id"] = split.ID
+
+	// Shrink the original first; a concurrent change aborts the split
+	ok, err := saveOrderItems(h.dbClient, order, remaining)
+	if err != nil || !ok {
+		releaseNumber(h.dbClient, orderNumber)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+	}
+	if _, err := h.dbClient.InsertDocument("pos_order", document); err != nil {
+		fmt.Printf("Error: Items split off bill %s could not be saved: %v\n", order.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if order.Status != models.OrderStatusOpen {
+		splitKitchenLines(h.dbClient, order, &split, req.Items, moved)
+	}
+
+	return c.Status(201).JSON(fiber.Map{"order": order, "split": split})
+}
+
+// splitBillEqually prices the bill and divides the total into equal shares;
+// the first shares absorb the remainder
+func (h *OrderHandler) splitBillEqually(c *fiber.Ctx, order *models.Order, ways int) error {
+	if ways < 2 || ways > 50 {
+		return c.Status(400).JSON(fiber.Map{"error": "ways must be between 2 and 50"})
+	}
+
+	quote, err := priceCart(h.dbClient, billCartRequest(order, "", "", ""), time.Now())
+	if err != nil {
+		if _, ok := err.(*cartError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	shares := make([]models.Money, ways)
+	base := quote.Total / models.Money(ways)
+	remainder := quote.Total - base*models.Money(ways)
+	for i := range shares {
+		shares[i] = base
+		if models.Money(i) < remainder {
+			shares[i]++
+		}
+	}
+
+	update := map[string]interface{}{"split_shares": shares}
+	if _, err := h.dbClient.UpdateDocument("pos_order", map[string]interface{}{"_id": order.ID}, update); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	order.SplitShares = shares
+
+	return c.JSON(fiber.Map{"order": order, "total": quote.Total, "shares": shares})
+}
+
+// SettleBill prices the bill's items server-side, saves them as a
+// transaction through the same path as SaveTransaction and marks the bill
+// paid. The bill is first claimed as settling with its trx_id, so it cannot
+// change or be settled twice meanwhile; settling it again after a failure
+// finishes with the same trx_id.
+func (h *OrderHandler) SettleBill(c *fiber.Ctx) error {
+	var req models.SettleBillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Actor == "" {
+		req.Actor = req.Cashier
+	}
+
+	order, err := loadOrder(h.dbClient, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if order == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if !models.CanTransition(order.Status, models.OrderStatusPaid) {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   fmt.Sprintf("Cannot settle an order that is %s", order.Status),
+			"allowed": models.NextOrderStatuses(order.Status),
+			"trx_id":  order.TrxID,
+		})
+	}
+
+	resuming := order.Settling
+	allocated := false
+	if !resuming {
+		if req.TrxID == "" {
+			trxID, err := allocateTrxID(h.dbClient, order.OutletID, req.DeviceID, time.Now())
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to allocate trx_id: " + err.Error()})
+			}
+			req.TrxID = trxID
+			allocated = true
+		}
+		ok, err := claimBill(h.dbClient, order, req.TrxID)
+		if err != nil || !ok {
+			if allocated {
+				releaseTrxID(h.dbClient, order.OutletID, req.TrxID)
+			}
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+		}
+	} else if req.TrxID != "" && req.TrxID != order.TrxID {
+		return c.Status(409).JSON(fiber.Map{"error": "Bill is being settled as " + order.TrxID, "trx_id": order.TrxID})
+	}
+
+	// A transaction saved by an earlier attempt only needs the bill marked paid
+	var saved []map[string]interface{}
+	if resuming {
+		saved, err = findDocuments(h.dbClient, "order", map[string]interface{}{"_id": order.TrxID}, nil, 1)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	var response fiber.Map
+	if len(saved) > 0 {
+		response = fiber.Map{
+			"message":  "Transaction saved successfully",
+			"trx_id":   order.TrxID,
+			"db_saved": true,
+			"total":    toMoney(saved[0]["total"]),
+			"changes":  toMoney(saved[0]["changes"]),
+		}
+	} else {
+		status, saveResponse, err := h.saveBillTransaction(order, &req)
+		if err != nil || status != 201 {
+			// An allocated trx_id is issued again once the bill lets go of
+			// it, unless another transaction turned out to hold it (409)
+			trxID := order.TrxID
+			if releaseBill(h.dbClient, order) && allocated && status != 409 {
+				releaseTrxID(h.dbClient, order.OutletID, trxID)
+			}
+			if err != nil {
+				return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(status).JSON(saveResponse)
+		}
+		response = saveResponse
+	}
+
+	claimed := map[string]interface{}{"settling": true, "trx_id": order.TrxID}
+	ok, err := transitionOrderIf(h.dbClient, order, models.OrderStatusPaid, req.Actor, "settled as "+order.TrxID, claimed, map[string]interface{}{"settling": false})
+	if err != nil || !ok {
+		fmt.Printf("Error: Transaction %s saved but bill %s could not be marked paid: %v\n", order.TrxID, order.ID, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":  "Transaction saved but the bill could not be marked paid; settle it again to finish",
+			"trx_id": order.TrxID,
+		})
+	}
+	order.Settling = false
+
+	response["order"] = order
+	return c.Status(201).JSON(response)
+}
+
+// saveBillTransaction prices the bill and saves it as the transaction the
+// bill was claimed for. It returns the status and response of the save, or
+// an error with the status to respond with if pricing fails.
+func (h *OrderHandler) saveBillTransaction(order *models.Order, req *models.SettleBillRequest) (int, fiber.Map, error) {
+	method := paymentMethodOf(req.Method, req.Payments)
+	quote, err := priceCart(h.dbClient, billCartRequest(order, method, req.VoucherCode, req.MemberID), time.Now())
+	if err != nil {
+		if _, ok := err.(*cartError); ok {
+			return 400, nil, err
+		}
+		return 500, nil, err
+	}
+	quoteID, err := signQuote(quote)
+	if err != nil {
+		return 500, nil, err
+	}
+
+	// Items are taken from the quote, which resolved default variants
+	items := make([]models.TransactionItem, 0, len(quote.Lines))
+	for _, l := range quote.Lines {
+		items = append(items, models.TransactionItem{MenuID: l.MenuID, MenuName: l.Name, Qty: l.Qty, Variant: l.Variant, Modifiers: l.Modifiers})
+	}
+	transaction := models.Transaction{
+		TrxID:      order.TrxID,
+		DeviceID:   req.DeviceID,
+		OutletID:   order.OutletID,
+		OutletName: req.OutletName,
+		Items:      items,
+		Cashier:    req.Cashier,
+		Customer:   req.Customer,
+		Note:       req.Note,
+		Type:       quote.Type,
+		Method:     req.Method,
+		Payments:   req.Payments,
+		QuoteID:    quoteID,
+	}
+
+	status, response := h.saveTransaction(&transaction)
+	if response["duplicate"] == true {
+		// Not a retry of this bill, which would still be settling
+		return 409, nil, fmt.Errorf("trx_id %s is already used by another transaction", transaction.TrxID)
+	}
+	if status == 201 {
+		response["total"] = transaction.Total
+		response["changes"] = transaction.Changes
+	}
+	return status, response, nil
+}
+
+// claimBill marks a bill as being settled as trxID, provided it has not
+// changed since it was loaded
+func claimBill(dbClient *config.AstraDBClient, order *models.Order, trxID string) (bool, error) {
+	now := time.Now().In(wib)
+	filter := map[string]interface{}{
+		"_id":        order.ID,
+		"status":     order.Status,
+		"updated_at": order.UpdatedAt,
+		"settling":   map[string]interface{}{"$ne": true},
+	}
+	update := map[string]interface{}{"settling": true, "trx_id": trxID, "updated_at": now}
+	ok, err := updateDocumentIf(dbClient, "pos_order", filter, update)
+	if err != nil || !ok {
+		return ok, err
+	}
+	order.Settling = true
+	order.TrxID = trxID
+	order.UpdatedAt = now
+	return true, nil
+}
+
+// releaseBill undoes claimBill after the transaction could not be saved and
+// reports whether it did
+func releaseBill(dbClient *config.AstraDBClient, order *models.Order) bool {
+	now := time.Now().In(wib)
+	update := map[string]interface{}{"settling": false, "trx_id": "", "updated_at": now}
+	ok, err := updateDocumentIf(dbClient, "pos_order", map[string]interface{}{"_id": order.ID, "settling": true}, update)
+	if err != nil || !ok {
+		fmt.Printf("Warning: Failed to release bill %s after a failed settle: %v\n", order.ID, err)
+		return false
+	}
+	order.Settling = false
+	order.TrxID = ""
+	order.UpdatedAt = now
+	return true
+}
+
+// loadActiveOrder fetches an order that can still be changed, returning the
+// HTTP status to respond with on failure
+func (h *OrderHandler) loadActiveOrder(id string) (*models.Order, int, error) {
+	order, err := loadOrder(h.dbClient, id)
+	if err != nil {
+		return nil, 500, err
+	}
+	if order == nil {
+		return nil, 404, fmt.Errorf("Order not found")
+	}
+	if !order.IsActive() {
+		return nil, 409, fmt.Errorf("Order %s is %s", order.ID, order.Status)
+	}
+	if order.Settling {
+		return nil, 409, fmt.Errorf("Order %s is being settled as %s", order.ID, order.TrxID)
+	}
+	return order, 0, nil
+}
+
+// takeOrderLines removes the requested quantities from items and returns the
+// remaining and the taken lines. A partially taken line keeps its ID on the
+// remaining side; the taken part gets a new line ID.
+func takeOrderLines(items []models.OrderItem, take []models.SplitLine) (remaining, taken []models.OrderItem, err error) {
+	remaining = append([]models.OrderItem{}, items...)
+	for _, t := range take {
+		idx := -1
+		for i, item := range remaining {
+			if item.LineID == t.LineID {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, nil, fmt.Errorf("Line %s not found on the bill", t.LineID)
+		}
+
+		line := remaining[idx]
+		qty := t.Quantity
+		if qty == 0 || qty == line.Quantity {
+			taken = append(taken, line)
+			remaining = append(remaining[:idx], remaining[idx+1:]...)
+			continue
+		}
+		if qty < 0 || qty > line.Quantity {
+			return nil, nil, fmt.Errorf("Line %s has only %d items", t.LineID, line.Quantity)
+		}
+
+		part := line
+		part.LineID = newLineID()
+		part.Quantity = qty
+		part.Subtotal = part.Price.Times(qty)
+		taken = append(taken, part)
+
+		line.Quantity -= qty
+		line.Subtotal = line.Price.Times(line.Quantity)
+		remaining[idx] = line
+	}
+	return remaining, taken, nil
+}
+
+// billCartRequest turns a bill into a cart for server-side pricing; the
+// product IDs of bill items are menu IDs
+func billCartRequest(order *models.Order, method, voucherCode, memberID string) models.CartQuoteRequest {
+	// Lines of the same menu item and options are priced together
+	index := make(map[string]int)
+	var items []models.CartItemRequest
+	for _, item := range order.Items {
+		key := optionsKey(item.ProductID, item.VariantID, item.ModifierIDs)
+		if i, ok := index[key]; ok {
+			items[i].Qty += item.Quantity
+			continue
+		}
+		index[key] = len(items)
+		items = append(items, models.CartItemRequest{
+			MenuID:      item.ProductID,
+			VariantID:   item.VariantID,
+			ModifierIDs: item.ModifierIDs,
+			Qty:         item.Quantity,
+		})
+	}
+
+	orderType := order.Type
+	if orderType == "" {
+		orderType = "dine_in"
+	}
+	return models.CartQuoteRequest{
+		OutletID:    order.OutletID,
+		Type:        orderType,
+		Method:      strings.ToLower(method),
+		VoucherCode: voucherCode,
+		MemberID:    memberID,
+		Items:       items,
+	}
+}
+
+// activeBillForTable returns the unpaid bill on a table, if any
+func activeBillForTable(dbClient *config.AstraDBClient, outletID, tableNumber string) (*models.Order, error) {
+	filter := map[string]interface{}{
+		"outlet_id":    outletID,
+		"table_number": tableNumber,
+		"status": map[string]interface{}{
+			"$nin": []string{models.OrderStatusPaid, models.OrderStatusCancelled},
+		},
+	}
+	orders, err := findOrders(dbClient, filter)
+	if err != nil || len(orders) == 0 {
+		return nil, err
+	}
+	return &orders[0], nil
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// billApp serves the bill endpoints over a fake DB with one menu item M1 at
+// 5000
+func billApp(t *testing.T) (*fakeDB, *fiber.App) {
+	t.Helper()
+	inTempDir(t)
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		if path == menuRowsPath {
+			return 200, `{"data":[{"id":"M1","name":"Es Teh","price":5000}]}`
+		}
+		return 404, `{"description":"not found"}`
+	}
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Post("/orders/:id/items", h.AppendBillItems)
+	app.Delete("/orders/:id/items/:line_id", h.RemoveBillItem)
+	app.Post("/orders/:id/settle", h.SettleBill)
+	app.Post("/orders/:id/transfer", h.TransferBill)
+	app.Post("/orders/:id/merge", h.MergeBill)
+	app.Post("/orders/:id/split", h.SplitBill)
+	app.Patch("/orders/:id/status", h.UpdateOrderStatus)
+	return db, app
+}
+
+// seedBill stores a bill for table 5 with the given lines of M1
+func seedBill(db *fakeDB, id, status string, lines ...string) {
+	bill := models.Order{
+		ID:          id,
+		OrderNumber: "ORD-" + id,
+		OutletID:    "BILLTEST",
+		TableNumber: "5",
+		Type:        "dine_in",
+		Status:      status,
+		CreatedAt:   time.Date(2024, 5, 15, 18, 0, 0, 0, wib),
+		UpdatedAt:   time.Date(2024, 5, 15, 18, 30, 0, 0, wib),
+	}
+	for _, line := range lines {
+		bill.Items = append(bill.Items, models.OrderItem{LineID: line, ProductID: "M1", Name: "Es Teh", Quantity: 2, Price: 5000, Subtotal: 10000})
+		bill.TotalAmount += 10000
+	}
+	document := jsonMap(bill)
+	document["_id"] = id
+	db.insert("pos_order", document)
+}
+
+func TestSettleBillSavesOnce(t *testing.T) {
+	db, app := billApp(t)
+	seedBill(db, "B1", models.OrderStatusServed, "L1")
+	settle := map[string]interface{}{"cashier": "Ani", "method": "cash", "payments": []models.Payment{{Method: "cash", Amount: 50000}}}
+
+	status, body := do(t, app, "POST", "/orders/B1/settle", settle)
+	if status != 201 {
+		t.Fatalf("settle: status %d %v", status, body)
+	}
+	trxID, _ := body["trx_id"].(string)
+	bill := db.find("pos_order", map[string]interface{}{"_id": "B1"})[0]
+	if bill["status"] != models.OrderStatusPaid || bill["trx_id"] != trxID || bill["settling"] != false {
+		t.Fatalf("settled bill: %v", bill)
+	}
+	if len(db.find("order", map[string]interface{}{"_id": trxID})) != 1 {
+		t.Fatalf("transaction %s not saved", trxID)
+	}
+
+	if status, _ := do(t, app, "POST", "/orders/B1/settle", settle); status != 409 {
+		t.Errorf("second settle: status %d, want 409", status)
+	}
+	if got := len(db.find("order", map[string]interface{}{})); got != 1 {
+		t.Errorf("%d transactions after settling twice, want 1", got)
+	}
+}
+
+func TestSettleBillReleasesOrResumesTheClaim(t *testing.T) {
+	db, app := billApp(t)
+	seedBill(db, "B1", models.OrderStatusServed, "L1")
+
+	// Payments that do not cover the total save nothing and free the bill
+	short := map[string]interface{}{"cashier": "Ani", "method": "cash", "payments": []models.Payment{{Method: "cash", Amount: 1000}}}
+	if status, body := do(t, app, "POST", "/orders/B1/settle", short); status != 422 {
+		t.Fatalf("short payment: status %d %v, want 422", status, body)
+	}
+	bill := db.find("pos_order", map[string]interface{}{"_id": "B1"})[0]
+	if bill["settling"] != false || bill["trx_id"] != "" || bill["status"] != models.OrderStatusServed {
+		t.Fatalf("bill not released: %v", bill)
+	}
+	if status, body := do(t, app, "POST", "/orders/B1/items", map[string]interface{}{"items": []models.OrderItem{{ProductID: "M1", Name: "Es Teh", Quantity: 1, Price: 5000}}}); status != 200 {
+		t.Fatalf("append after release: status %d %v", status, body)
+	}
+
+	// A bill left settling by a failed attempt cannot change, and settling
+	// it again finishes with the transaction already saved
+	seedBill(db, "B2", models.OrderStatusServed, "L1")
+	db.update("pos_order", map[string]interface{}{
+		"filter": map[string]interface{}{"_id": "B2"},
+		"update": map[string]interface{}{"$set": map[string]interface{}{"settling": true, "trx_id": "T-B2"}},
+	})
+	db.insert("order", map[string]interface{}{"_id": "T-B2", "trx_id": "T-B2", "total": 11100, "changes": 0})
+
+	if status, _ := do(t, app, "POST", "/orders/B2/items", map[string]interface{}{"items": []models.OrderItem{{ProductID: "M1", Name: "Es Teh", Quantity: 1, Price: 5000}}}); status != 409 {
+		t.Errorf("append while settling: status %d, want 409", status)
+	}
+	if status, _ := do(t, app, "POST", "/orders/B2/settle", map[string]interface{}{"cashier": "Ani", "trx_id": "OTHER"}); status != 409 {
+		t.Errorf("settle as another trx_id: status %d, want 409", status)
+	}
+	status, body := do(t, app, "POST", "/orders/B2/settle", map[string]interface{}{"cashier": "Ani", "method": "cash"})
+	if status != 201 || body["trx_id"] != "T-B2" || body["total"] != float64(11100) {
+		t.Fatalf("resume: status %d %v", status, body)
+	}
+	bill = db.find("pos_order", map[string]interface{}{"_id": "B2"})[0]
+	if bill["status"] != models.OrderStatusPaid || bill["settling"] != false {
+		t.Fatalf("resumed bill: %v", bill)
+	}
+	if got := len(db.find("order", map[string]interface{}{"_id": "T-B2"})); got != 1 {
+		t.Errorf("%d transactions T-B2, want 1", got)
+	}
+}
+
+func TestRemoveBillItemRespectsKitchenState(t *testing.T) {
+	db, app := billApp(t)
+	seedBill(db, "B1", models.OrderStatusSentToKitchen, "L1", "L2")
+	db.insert("kitchen_item",
+		models.KitchenItem{ID: "B1:L1", OrderID: "B1", OutletID: "BILLTEST", LineID: "L1", MenuID: "M1", Quantity: 2, Status: models.KitchenStarted},
+		models.KitchenItem{ID: "B1:L2", OrderID: "B1", OutletID: "BILLTEST", LineID: "L2", MenuID: "M1", Quantity: 2, Status: models.KitchenQueued},
+	)
+
+	if status, _ := do(t, app, "DELETE", "/orders/B1/items/L1", nil); status != 409 {
+		t.Errorf("remove started line: status %d, want 409", status)
+	}
+	if status, _ := do(t, app, "DELETE", "/orders/B1/items/L1?quantity=1", nil); status != 409 {
+		t.Errorf("remove part of a started line: status %d, want 409", status)
+	}
+	if status, body := do(t, app, "DELETE", "/orders/B1/items/L2", nil); status != 200 {
+		t.Fatalf("remove queued line: status %d %v", status, body)
+	}
+
+	items := db.find("pos_order", map[string]interface{}{"_id": "B1"})[0]["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["line_id"] != "L1" {
+		t.Errorf("bill items %v, want only L1", items)
+	}
+	if ki := db.find("kitchen_item", map[string]interface{}{"_id": "B1:L2"})[0]; ki["status"] != models.KitchenVoided {
+		t.Errorf("removed line still in the kitchen: %v", ki)
+	}
+}
+
+func TestTransferAndMergeReleaseTheSourceTable(t *testing.T) {
+	db, app := billApp(t)
+	table := func(code, status string) models.Table {
+		return models.Table{ID: tableID("BILLTEST", code), OutletID: "BILLTEST", Code: code, Status: status, Active: true}
+	}
+	db.insert("outlet_table", table("5", models.TableOccupied), table("7", models.TableFree), table("8", models.TableOccupied))
+	tableStatus := func(code string) interface{} {
+		return db.find("outlet_table", map[string]interface{}{"_id": tableID("BILLTEST", code)})[0]["status"]
+	}
+	seedBill(db, "B1", models.OrderStatusServed, "L1")
+	seedBill(db, "B2", models.OrderStatusServed, "L2")
+	db.update("pos_order", map[string]interface{}{
+		"filter": map[string]interface{}{"_id": "B2"},
+		"update": map[string]interface{}{"$set": map[string]interface{}{"table_number": "8"}},
+	})
+
+	if status, body := do(t, app, "POST", "/orders/B1/transfer", map[string]string{"table_number": "7", "actor": "spv"}); status != 200 {
+		t.Fatalf("transfer: status %d %v", status, body)
+	}
+	if tableStatus("5") != models.TableCleaning || tableStatus("7") != models.TableOccupied {
+		t.Errorf("after transfer: table 5 %v, table 7 %v", tableStatus("5"), tableStatus("7"))
+	}
+
+	if status, body := do(t, app, "POST", "/orders/B1/merge", map[string]string{"source_id": "B2", "actor": "spv"}); status != 200 {
+		t.Fatalf("merge: status %d %v", status, body)
+	}
+	if tableStatus("8") != models.TableCleaning || tableStatus("7") != models.TableOccupied {
+		t.Errorf("after merge: table 8 %v, table 7 %v", tableStatus("8"), tableStatus("7"))
+	}
+}
+
+func TestSettleBillBeforeItIsServed(t *testing.T) {
+	db, app := billApp(t)
+	settle := map[string]interface{}{"cashier": "Ani", "method": "cash", "payments": []models.Payment{{Method: "cash", Amount: 50000}}}
+	for i, status := range []string{models.OrderStatusOpen, models.OrderStatusSentToKitchen, models.OrderStatusPreparing, models.OrderStatusReady} {
+		id := fmt.Sprintf("E%d", i)
+		seedBill(db, id, status, "L1")
+		if code, body := do(t, app, "POST", "/orders/"+id+"/settle", settle); code != 201 {
+			t.Errorf("settle %s bill: status %d %v", status, code, body)
+		}
+		if bill := db.find("pos_order", map[string]interface{}{"_id": id})[0]; bill["status"] != models.OrderStatusPaid {
+			t.Errorf("%s bill became %v", status, bill["status"])
+		}
+	}
+}
+
+func TestMergeBillMovesItemsAndKitchenItems(t *testing.T) {
+	db, app := billApp(t)
+	seedBill(db, "B1", models.OrderStatusOpen, "L1")
+	seedBill(db, "B2", models.OrderStatusSentToKitchen, "L2")
+	db.insert("kitchen_item", models.KitchenItem{ID: "B2:L2", OrderID: "B2", OrderNumber: "ORD-B2", OutletID: "BILLTEST", LineID: "L2", MenuID: "M1", Quantity: 2, Status: models.KitchenStarted})
+
+	if status, body := do(t, app, "POST", "/orders/B1/merge", map[string]string{"source_id": "B2", "actor": "spv"}); status != 200 {
+		t.Fatalf("merge: status %d %v", status, body)
+	}
+	if source := db.find("pos_order", map[string]interface{}{"_id": "B2"})[0]; source["status"] != models.OrderStatusCancelled || source["merged_into"] != "B1" {
+		t.Errorf("source bill: %v", source)
+	}
+	if items := db.find("pos_order", map[string]interface{}{"_id": "B1"})[0]["items"].([]interface{}); len(items) != 2 {
+		t.Errorf("target items %v, want L1 and L2", items)
+	}
+	if ki := db.find("kitchen_item", map[string]interface{}{"_id": "B2:L2"})[0]; ki["order_id"] != "B1" || ki["order_number"] != "ORD-B1" || ki["status"] != models.KitchenStarted {
+		t.Errorf("kitchen item not moved: %v", ki)
+	}
+
+	// Sending the merged bill only routes the lines the kitchen does not have
+	if status, body := do(t, app, "PATCH", "/orders/B1/status", map[string]string{"status": models.OrderStatusSentToKitchen, "actor": "spv"}); status != 200 {
+		t.Fatalf("send: status %d %v", status, body)
+	}
+	routed := db.find("kitchen_item", map[string]interface{}{"order_id": "B1"})
+	if len(routed) != 2 || len(db.find("kitchen_item", map[string]interface{}{"line_id": "L2"})) != 1 {
+		t.Errorf("kitchen items after sending: %v", routed)
+	}
+}
+
+func TestMergeBillKeepsItemsWhenTheSourceCannotBeCancelled(t *testing.T) {
+	db, app := billApp(t)
+	seedBill(db, "B1", models.OrderStatusServed, "L1")
+	seedBill(db, "B2", models.OrderStatusServed, "L2")
+	db.intercept = func(collection, command string, args map[string]interface{}) string {
+		if filter, _ := args["filter"].(map[string]interface{}); collection == "pos_order" && filter["_id"] == "B2" {
+			return "SERVER_UNHANDLED_ERROR"
+		}
+		return ""
+	}
+
+	if status, _ := do(t, app, "POST", "/orders/B1/merge", map[string]string{"source_id": "B2", "actor": "spv"}); status != 500 {
+		t.Errorf("merge: status %d, want 500", status)
+	}
+	if items := db.find("pos_order", map[string]interface{}{"_id": "B1"})[0]["items"].([]interface{}); len(items) != 1 {
+		t.Errorf("target items %v, want only L1", items)
+	}
+	if source := db.find("pos_order", map[string]interface{}{"_id": "B2"})[0]; source["status"] != models.OrderStatusServed || len(source["items"].([]interface{})) != 1 {
+		t.Errorf("source bill: %v", source)
+	}
+}
+
+func TestSplitAndRemoveFollowTheKitchen(t *testing.T) {
+	db, app := billApp(t)
+	seedBill(db, "B1", models.OrderStatusSentToKitchen, "L1", "L2", "L3")
+	db.insert("kitchen_item",
+		models.KitchenItem{ID: "B1:L1", OrderID: "B1", OutletID: "BILLTEST", LineID: "L1", MenuID: "M1", Quantity: 2, Status: models.KitchenStarted, StartedAt: "2024-05-15T18:40:00+07:00"},
+		models.KitchenItem{ID: "B1:L2", OrderID: "B1", OutletID: "BILLTEST", LineID: "L2", MenuID: "M1", Quantity: 2, Status: models.KitchenQueued},
+		models.KitchenItem{ID: "B1:L3", OrderID: "B1", OutletID: "BILLTEST", LineID: "L3", MenuID: "M1", Quantity: 2, Status: models.KitchenQueued},
+	)
+	kitchenItem := func(id string) map[string]interface{} {
+		return db.find("kitchen_item", map[string]interface{}{"_id": id})[0]
+	}
+
+	split := map[string]interface{}{"actor": "spv", "items": []models.SplitLine{{LineID: "L1", Quantity: 1}, {LineID: "L2"}}}
+	status, body := do(t, app, "POST", "/orders/B1/split", split)
+	if status != 201 {
+		t.Fatalf("split: status %d %v", status, body)
+	}
+	newBill := body["split"].(map[string]interface{})
+	splitID := newBill["id"].(string)
+	var partLine string
+	for _, item := range newBill["items"].([]interface{}) {
+		if line := item.(map[string]interface{})["line_id"].(string); line != "L2" {
+			partLine = line
+		}
+	}
+
+	if ki := kitchenItem("B1:L1"); ki["order_id"] != "B1" || ki["quantity"] != float64(1) {
+		t.Errorf("split line left on the bill: %v", ki)
+	}
+	part := kitchenItem(splitID + ":" + partLine)
+	if part["quantity"] != float64(1) || part["status"] != models.KitchenStarted || part["started_at"] != "2024-05-15T18:40:00+07:00" {
+		t.Errorf("split-off part: %v", part)
+	}
+	if ki := kitchenItem("B1:L2"); ki["order_id"] != splitID || ki["quantity"] != float64(2) {
+		t.Errorf("line moved whole: %v", ki)
+	}
+
+	if status, body := do(t, app, "DELETE", "/orders/B1/items/L3?quantity=1", nil); status != 200 {
+		t.Fatalf("remove part of L3: status %d %v", status, body)
+	}
+	if ki := kitchenItem("B1:L3"); ki["quantity"] != float64(1) || ki["status"] != models.KitchenQueued {
+		t.Errorf("partly removed line: %v", ki)
+	}
+}
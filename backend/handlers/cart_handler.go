@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CartHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewCartHandler(dbClient *config.AstraDBClient) *CartHandler {
+	return &CartHandler{dbClient: dbClient}
+}
+
+// Quote prices a cart server-side and returns a signed quote ID that
+// SaveTransaction accepts to guarantee the same numbers
+func (h *CartHandler) Quote(c *fiber.Ctx) error {
+	var req models.CartQuoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Method == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Payment method is required; the quote is only valid for it"})
+	}
+
+	menuIDs := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		menuIDs = append(menuIDs, item.MenuID)
+	}
+	if err := checkAvailable(h.dbClient, req.OutletID, menuIDs); err != nil {
+		return c.Status(availabilityStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	quote, err := priceCart(h.dbClient, req, time.Now())
+	if err != nil {
+		if _, ok := err.(*cartError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	quoteID, err := signQuote(quote)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	quote.QuoteID = quoteID
+
+	return c.JSON(quote)
+}
@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Categories belong to a scope: a subBrand, or the kemitraan itself for
+// items without a subBrand. Names are unique per scope, case-insensitively.
+
+// categoryIndex is every category of the menu_category collection, with the
+// kategori schedules set before categories existed for items not linked yet
+type categoryIndex struct {
+	byID   map[string]models.Category
+	byName map[string]string           // categoryNameKey -> ID
+	legacy map[string]*models.Schedule // categoryScheduleID -> schedule
+}
+
+// Categories are read with every menu listing; they are cached like the menu
+// itself and dropped from the cache when changed through this server
+var categoryCache struct {
+	mu      sync.Mutex
+	index   *categoryIndex
+	expires time.Time
+}
+
+func categoryScope(kemitraan, subBrand string) string {
+	return menuKey(kemitraan) + "/" + menuKey(subBrand)
+}
+
+func categoryNameKey(kemitraan, subBrand, name string) string {
+	return categoryScope(kemitraan, subBrand) + "/" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// forMenu finds a menu item's category by categoryId, or for items not
+// linked yet by kategori name within the item's subBrand
+func (ix *categoryIndex) forMenu(menu models.Menu) (models.Category, bool) {
+	if menu.CategoryID != "" {
+		cat, ok := ix.byID[menu.CategoryID]
+		return cat, ok
+	}
+	id, ok := ix.byName[categoryNameKey(menu.Kemitraan, menu.SubBrand, menu.Kategori)]
+	if !ok {
+		return models.Category{}, false
+	}
+	return ix.byID[id], true
+}
+
+// sellable reports whether a menu item's category and its parents are active
+// and on schedule. Items without a category only follow a legacy schedule.
+func (ix *categoryIndex) sellable(menu models.Menu, at time.Time) bool {
+	cat, ok := ix.forMenu(menu)
+	if !ok {
+		return ix.legacy[categoryScheduleID(menu.Kemitraan, menu.Kategori)].Allows(at)
+	}
+	return ix.allows(cat, at)
+}
+
+// scheduleFor returns the schedule of a menu item's category, for devices
+// that check schedules offline
+func (ix *categoryIndex) scheduleFor(menu models.Menu) *models.Schedule {
+	if cat, ok := ix.forMenu(menu); ok {
+		return cat.Schedule
+	}
+	return ix.legacy[categoryScheduleID(menu.Kemitraan, menu.Kategori)]
+}
+
+func (ix *categoryIndex) allows(cat models.Category, at time.Time) bool {
+	for depth := 0; depth < 10; depth++ {
+		if !cat.Active || !cat.Schedule.Allows(at) {
+			return false
+		}
+		parent, ok := ix.byID[cat.ParentID]
+		if cat.ParentID == "" || !ok {
+			return true
+		}
+		cat = parent
+	}
+	return true
+}
+
+// inScope counts the categories of a subBrand (or kemitraan)
+func (ix *categoryIndex) inScope(kemitraan, subBrand string) int {
+	scope := categoryScope(kemitraan, subBrand)
+	n := 0
+	for _, cat := range ix.byID {
+		if categoryScope(cat.Kemitraan, cat.SubBrand) == scope {
+			n++
+		}
+	}
+	return n
+}
+
+// sorted returns categories by display order, then name
+func (ix *categoryIndex) sorted(keep func(models.Category) bool) []models.Category {
+	list := []models.Category{}
+	for _, cat := range ix.byID {
+		if keep(cat) {
+			list = append(list, cat)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Order != list[j].Order {
+			return list[i].Order < list[j].Order
+		}
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+// CreateCategory adds a category to a subBrand (or kemitraan)
+func (h *MenuHandler) CreateCategory(c *fiber.Ctx) error {
+	var req models.CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	req.Kemitraan = strings.TrimSpace(req.Kemitraan)
+	req.SubBrand = strings.TrimSpace(req.SubBrand)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Kemitraan == "" || req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "kemitraan and name are required"})
+	}
+
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, exists := ix.byName[categoryNameKey(req.Kemitraan, req.SubBrand, req.Name)]; exists {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Category %s already exists", req.Name)})
+	}
+
+	now := time.Now().In(wib).Format(time.RFC3339)
+	cat := models.Category{
+		ID:        uuid.New().String(),
+		Kemitraan: req.Kemitraan,
+		SubBrand:  req.SubBrand,
+		Name:      req.Name,
+		Order:     ix.inScope(req.Kemitraan, req.SubBrand),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	applyCategoryRequest(&cat, req)
+	if err := validateCategoryParent(ix, cat); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := insertCategory(h.dbClient, cat); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(cat)
+}
+
+// UpdateCategory changes a category. A new name is written to the kategori
+// of its menu items as well.
+func (h *MenuHandler) UpdateCategory(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req models.CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	cat, ok := ix.byID[id]
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Category not found"})
+	}
+	oldName := cat.Name
+
+	if name := strings.TrimSpace(req.Name); name != "" && name != cat.Name {
+		if other, exists := ix.byName[categoryNameKey(cat.Kemitraan, cat.SubBrand, name)]; exists && other != id {
+			return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Category %s already exists", name)})
+		}
+		cat.Name = name
+	}
+	applyCategoryRequest(&cat, req)
+	if err := validateCategoryParent(ix, cat); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	cat.UpdatedAt = time.Now().In(wib).Format(time.RFC3339)
+
+	_, err = h.dbClient.UpdateDocument("menu_category", map[string]interface{}{"_id": id}, map[string]interface{}{
+		"name":      cat.Name,
+		"parentId":  cat.ParentID,
+		"order":     cat.Order,
+		"icon":      cat.Icon,
+		"imageUrl":  cat.ImageURL,
+		"active":    cat.Active,
+		"updatedAt": cat.UpdatedAt,
+	})
+	invalidateCategories()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	renamed := 0
+	if cat.Name != oldName {
+		renamed, err = renameCategoryItems(h.dbClient, ix, cat, cat.UpdatedAt, req.Actor)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Category renamed but items were not all updated: " + err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{"category": cat, "items_renamed": renamed})
+}
+
+// ReorderCategories sets the display order of categories to their position
+// in the request
+func (h *MenuHandler) ReorderCategories(c *fiber.Ctx) error {
+	var req models.ReorderCategoriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, id := range req.IDs {
+		if _, ok := ix.byID[id]; !ok {
+			return c.Status(404).JSON(fiber.Map{"error": fmt.Sprintf("Category %s not found", id)})
+		}
+	}
+
+	now := time.Now().In(wib).Format(time.RFC3339)
+	defer invalidateCategories()
+	for i, id := range req.IDs {
+		if _, err := h.dbClient.UpdateDocument("menu_category", map[string]interface{}{"_id": id}, map[string]interface{}{"order": i, "updatedAt": now}); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	return c.JSON(fiber.Map{"message": "Categories reordered", "count": len(req.IDs)})
+}
+
+// MigrateCategories builds categories from the kategori values of existing
+// menu items, links the items to them and copies kategori schedules. It can
+// be run again; existing categories are kept. ?dry_run=true only reports.
+func (h *MenuHandler) MigrateCategories(c *fiber.Ctx) error {
+	dryRun := c.Query("dry_run") == "true"
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Walk items in a stable order so categories are numbered alphabetically
+	ids := make([]string, 0, len(menus))
+	for id := range menus {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := strings.ToLower(menus[ids[i]].Kategori), strings.ToLower(menus[ids[j]].Kategori)
+		if a != b {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+
+	result := models.CategoryMigration{DryRun: dryRun, Created: []models.Category{}}
+	seen := make(map[string]bool)
+	now := time.Now().In(wib).Format(time.RFC3339)
+	if !dryRun {
+		defer invalidateCategories()
+		defer invalidateMenuCache(h.dbClient)
+	}
+
+	for _, id := range ids {
+		menu := menus[id]
+		if strings.TrimSpace(menu.Kategori) == "" || menu.CategoryID != "" {
+			continue
+		}
+
+		key := categoryNameKey(menu.Kemitraan, menu.SubBrand, menu.Kategori)
+		catID, ok := ix.byName[key]
+		if ok && !seen[catID] {
+			result.Existing++
+		}
+		if !ok {
+			cat := models.Category{
+				ID:        uuid.New().String(),
+				Kemitraan: menu.Kemitraan,
+				SubBrand:  menu.SubBrand,
+				Name:      strings.TrimSpace(menu.Kategori),
+				Order:     ix.inScope(menu.Kemitraan, menu.SubBrand),
+				Active:    true,
+				Schedule:  ix.legacy[categoryScheduleID(menu.Kemitraan, menu.Kategori)],
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if cat.Schedule != nil {
+				result.SchedulesCopied++
+			}
+			if !dryRun {
+				if err := insertCategory(h.dbClient, cat); err != nil {
+					return c.Status(500).JSON(fiber.Map{"error": err.Error(), "result": result})
+				}
+			}
+			ix.byID[cat.ID] = cat
+			ix.byName[key] = cat.ID
+			result.Created = append(result.Created, cat)
+			catID = cat.ID
+		}
+		seen[catID] = true
+
+		if !dryRun {
+			if _, _, err := writeMenu(h.dbClient, map[string]interface{}{"_id": menu.ID},
+				map[string]interface{}{"categoryId": catID}, menuEdit{action: models.MenuActionCategory}); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error(), "result": result})
+			}
+		}
+		result.ItemsLinked++
+	}
+
+	return c.JSON(result)
+}
+
+// ensureCategory returns the ID of a kategori's category, creating the
+// category when the kategori is new. Keeps menu writes and categories in step.
+func ensureCategory(dbClient *config.AstraDBClient, ix *categoryIndex, kemitraan, subBrand, kategori string) (string, error) {
+	if id, ok := ix.byName[categoryNameKey(kemitraan, subBrand, kategori)]; ok {
+		return id, nil
+	}
+	now := time.Now().In(wib).Format(time.RFC3339)
+	cat := models.Category{
+		ID:        uuid.New().String(),
+		Kemitraan: kemitraan,
+		SubBrand:  subBrand,
+		Name:      kategori,
+		Order:     ix.inScope(kemitraan, subBrand),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := insertCategory(dbClient, cat); err != nil {
+		return "", err
+	}
+	ix.byID[cat.ID] = cat
+	ix.byName[categoryNameKey(kemitraan, subBrand, kategori)] = cat.ID
+	return cat.ID, nil
+}
+
+// renameCategoryItems writes a category's new name into the kategori of its
+// menu items
+func renameCategoryItems(dbClient *config.AstraDBClient, ix *categoryIndex, cat models.Category, now, actor string) (int, error) {
+	menus, err := loadMenus(dbClient)
+	if err != nil {
+		return 0, err
+	}
+	defer invalidateMenuCache(dbClient)
+
+	renamed := 0
+	for _, menu := range menus {
+		linked, ok := ix.forMenu(menu)
+		if !ok || linked.ID != cat.ID || menu.Kategori == cat.Name {
+			continue
+		}
+		if _, _, err := writeMenu(dbClient, map[string]interface{}{"_id": menu.ID},
+			map[string]interface{}{"kategori": cat.Name, "categoryId": cat.ID, "updatedAt": now},
+			menuEdit{action: models.MenuActionCategory, actor: actor}); err != nil {
+			return renamed, err
+		}
+		renamed++
+	}
+	return renamed, nil
+}
+
+// applyCategoryRequest copies the optional fields of a request
+func applyCategoryRequest(cat *models.Category, req models.CategoryRequest) {
+	if req.ParentID != nil {
+		cat.ParentID = *req.ParentID
+	}
+	if req.Order != nil {
+		cat.Order = *req.Order
+	}
+	if req.Icon != nil {
+		cat.Icon = *req.Icon
+	}
+	if req.ImageURL != nil {
+		cat.ImageURL = *req.ImageURL
+	}
+	if req.Active != nil {
+		cat.Active = *req.Active
+	}
+}
+
+// validateCategoryParent checks that a parent is in the same scope and that
+// parents do not form a loop
+func validateCategoryParent(ix *categoryIndex, cat models.Category) error {
+	seen := map[string]bool{cat.ID: true}
+	for parentID := cat.ParentID; parentID != ""; {
+		parent, ok := ix.byID[parentID]
+		if !ok {
+			return fmt.Errorf("parent category %s not found", parentID)
+		}
+		if categoryScope(parent.Kemitraan, parent.SubBrand) != categoryScope(cat.Kemitraan, cat.SubBrand) {
+			return fmt.Errorf("parent category belongs to another subBrand")
+		}
+		if seen[parent.ID] {
+			return fmt.Errorf("category cannot be its own parent")
+		}
+		seen[parent.ID] = true
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+func insertCategory(dbClient *config.AstraDBClient, cat models.Category) error {
+	document, err := toDocument(cat)
+	if err != nil {
+		return err
+	}
+	_, err = dbClient.InsertDocument("menu_category", document)
+	invalidateCategories()
+	return err
+}
+
+func invalidateCategories() {
+	categoryCache.mu.Lock()
+	categoryCache.index = nil
+	categoryCache.mu.Unlock()
+}
+
+// loadCategories returns every category
+func loadCategories(dbClient *config.AstraDBClient) (*categoryIndex, error) {
+	categoryCache.mu.Lock()
+	defer categoryCache.mu.Unlock()
+	if categoryCache.index != nil && time.Now().Before(categoryCache.expires) {
+		return categoryCache.index.clone(), nil
+	}
+
+	ix := &categoryIndex{byID: make(map[string]models.Category), byName: make(map[string]string), legacy: make(map[string]*models.Schedule)}
+	for _, doc := range fetchDocuments(dbClient, "menu_category", nil, nil, 5) {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		var cat models.Category
+		if err := json.Unmarshal(data, &cat); err != nil {
+			return nil, fmt.Errorf("failed to parse category: %v", err)
+		}
+		ix.byID[cat.ID] = cat
+		ix.byName[categoryNameKey(cat.Kemitraan, cat.SubBrand, cat.Name)] = cat.ID
+	}
+	for _, doc := range fetchDocuments(dbClient, "category_schedule", nil, nil, 5) {
+		cs, err := categoryScheduleFromDocument(doc)
+		if err != nil {
+			return nil, err
+		}
+		if cs.Schedule != nil {
+			ix.legacy[categoryScheduleID(cs.Kemitraan, cs.Kategori)] = cs.Schedule
+		}
+	}
+
+	categoryCache.index = ix
+	categoryCache.expires = time.Now().Add(menuCacheTTL)
+	return ix.clone(), nil
+}
+
+// clone copies the index so callers can add to it without touching the cache
+func (ix *categoryIndex) clone() *categoryIndex {
+	out := &categoryIndex{byID: make(map[string]models.Category, len(ix.byID)), byName: make(map[string]string, len(ix.byName)), legacy: ix.legacy}
+	for k, v := range ix.byID {
+		out.byID[k] = v
+	}
+	for k, v := range ix.byName {
+		out.byName[k] = v
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestMigrateCategories(t *testing.T) {
+	db, _, app := menuWriteApp(t)
+	db.insert("menu_makanan",
+		map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "MIGRATETEST", "kategori": "Minuman", "price": 5000},
+		map[string]interface{}{"_id": "M2", "id": "M2", "name": "Nasi Goreng", "kemitraan": "MIGRATETEST", "kategori": "Makanan", "price": 20000},
+		map[string]interface{}{"_id": "M3", "id": "M3", "name": "Mie Goreng", "kemitraan": "MIGRATETEST", "kategori": "makanan", "price": 18000},
+		map[string]interface{}{"_id": "M4", "id": "M4", "name": "Kerupuk", "kemitraan": "MIGRATETEST", "kategori": "", "price": 2000},
+	)
+	db.insert("category_schedule", models.CategorySchedule{
+		ID: categoryScheduleID("MIGRATETEST", "Makanan"), Kemitraan: "MIGRATETEST", Kategori: "Makanan",
+		Schedule: &models.Schedule{Windows: []models.TimeWindow{{Start: "10:00", End: "22:00"}}},
+	})
+
+	status, body := do(t, app, "POST", "/menu/categories/migrate?dry_run=true", nil)
+	if status != 200 {
+		t.Fatalf("dry run: status %d %v", status, body)
+	}
+	if created := body["created"].([]interface{}); len(created) != 2 || body["items_linked"] != 3.0 || body["schedules_copied"] != 1.0 {
+		t.Errorf("dry run %v, want 2 categories, 3 items linked and 1 schedule copied", body)
+	}
+	if len(db.find("menu_category", nil)) != 0 || len(db.find("menu_makanan", map[string]interface{}{"categoryId": map[string]interface{}{"$exists": true}})) != 0 {
+		t.Fatal("dry run wrote to the database")
+	}
+
+	if status, body = do(t, app, "POST", "/menu/categories/migrate", nil); status != 200 {
+		t.Fatalf("migrate: status %d %v", status, body)
+	}
+	// Categories are numbered alphabetically and keep the first spelling
+	categories := map[string]float64{}
+	ids := map[string]string{}
+	for _, doc := range db.find("menu_category", nil) {
+		categories[doc["name"].(string)] = doc["order"].(float64)
+		ids[doc["name"].(string)] = doc["_id"].(string)
+	}
+	if len(categories) != 2 || categories["Makanan"] != 0 || categories["Minuman"] != 1 {
+		t.Errorf("categories %v, want Makanan 0 and Minuman 1", categories)
+	}
+	if docs := db.find("menu_category", map[string]interface{}{"name": "Makanan"}); len(docs) != 1 || docs[0]["schedule"] == nil {
+		t.Error("kategori schedule not copied to its category")
+	}
+	for menuID, name := range map[string]string{"M1": "Minuman", "M2": "Makanan", "M3": "Makanan"} {
+		if docs := db.find("menu_makanan", map[string]interface{}{"_id": menuID, "categoryId": ids[name]}); len(docs) != 1 {
+			t.Errorf("%s not linked to %s", menuID, name)
+		}
+	}
+
+	// Running it again finds nothing left to do
+	if status, body = do(t, app, "POST", "/menu/categories/migrate", nil); status != 200 || len(body["created"].([]interface{})) != 0 || body["items_linked"] != 0.0 {
+		t.Errorf("second run: status %d %v, want nothing created or linked", status, body)
+	}
+	if n := len(db.find("menu_category", nil)); n != 2 {
+		t.Errorf("%d categories after the second run, want 2", n)
+	}
+}
+
+func TestCategoriesFollowTheirDisplayOrder(t *testing.T) {
+	db, _, app := menuWriteApp(t)
+	db.insert("menu_category",
+		models.Category{ID: "C1", Kemitraan: "ORDERTEST", Name: "Makanan", Order: 0, Active: true},
+		models.Category{ID: "C2", Kemitraan: "ORDERTEST", Name: "Minuman", Order: 1, Active: true},
+		models.Category{ID: "C3", Kemitraan: "ORDERTEST", Name: "Camilan", Order: 2, Active: true},
+	)
+	db.insert("menu_makanan",
+		map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "ORDERTEST", "kategori": "Minuman", "categoryId": "C2", "price": 5000},
+		map[string]interface{}{"_id": "M2", "id": "M2", "name": "Nasi Goreng", "kemitraan": "ORDERTEST", "kategori": "Makanan", "categoryId": "C1", "price": 20000},
+		map[string]interface{}{"_id": "M3", "id": "M3", "name": "Kerupuk", "kemitraan": "ORDERTEST", "kategori": "Camilan", "categoryId": "C3", "price": 2000},
+		map[string]interface{}{"_id": "M4", "id": "M4", "name": "Sambal", "kemitraan": "ORDERTEST", "kategori": "Tambahan", "price": 1000},
+	)
+
+	names := func() []interface{} {
+		t.Helper()
+		status, body := do(t, app, "GET", "/menu/categories?kemitraan=ORDERTEST&all=true", nil)
+		if status != 200 {
+			t.Fatalf("categories: status %d %v", status, body)
+		}
+		return body["categories"].([]interface{})
+	}
+	// Kategori without a category come last
+	if got := names(); len(got) != 4 || got[0] != "Makanan" || got[1] != "Minuman" || got[2] != "Camilan" || got[3] != "Tambahan" {
+		t.Errorf("categories %v, want Makanan, Minuman, Camilan, Tambahan", got)
+	}
+
+	if status, body := do(t, app, "PUT", "/menu/categories/order", models.ReorderCategoriesRequest{IDs: []string{"C3", "C2", "C1"}}); status != 200 {
+		t.Fatalf("reorder: status %d %v", status, body)
+	}
+	if got := names(); len(got) != 4 || got[0] != "Camilan" || got[1] != "Minuman" || got[2] != "Makanan" || got[3] != "Tambahan" {
+		t.Errorf("categories after reorder %v, want Camilan, Minuman, Makanan, Tambahan", got)
+	}
+
+	if status, _ := do(t, app, "PUT", "/menu/categories/order", models.ReorderCategoriesRequest{IDs: []string{"C1", "nope"}}); status != 404 {
+		t.Errorf("reorder with an unknown category: status %d, want 404", status)
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/events"
+	"sagawa_pos_backend/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Stream tokens are issued at login and valid for a working day
+const streamTokenTTL = 12 * time.Hour
+
+// eventBus carries domain events of this server process to dashboards.
+// EVENT_BUFFER_SIZE events are kept for clients resuming after a reconnect.
+var eventBus = events.NewBus(eventBufferSize())
+
+func eventBufferSize() int {
+	if n, err := strconv.Atoi(os.Getenv("EVENT_BUFFER_SIZE")); err == nil && n > 0 {
+		return n
+	}
+	return 1000
+}
+
+// streamClaims are the signed contents of a stream token
+type streamClaims struct {
+	KasirID   string `json:"kasir_id"`
+	Role      string `json:"role"`
+	OutletID  string `json:"outlet_id"`
+	Kemitraan string `json:"kemitraan"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// canWatchKemitraan reports whether the token holder may follow every
+// outlet of their kemitraan rather than only their own outlet
+func (s streamClaims) canWatchKemitraan() bool {
+	return strings.EqualFold(s.Role, "owner") || strings.EqualFold(s.Role, "admin")
+}
+
+// issueStreamToken signs a token scoping a kasir to their outlet/kemitraan
+func issueStreamToken(k models.Kasir) string {
+	payload, err := json.Marshal(streamClaims{
+		KasirID:   k.ID,
+		Role:      k.Role,
+		OutletID:  k.Outlet,
+		Kemitraan: k.Kemitraan,
+		ExpiresAt: time.Now().Add(streamTokenTTL).Unix(),
+	})
+	if err != nil {
+		return ""
+	}
+	return signPayload(streamKey, payload)
+}
+
+// verifyStreamToken checks a stream token's signature and expiry
+func verifyStreamToken(token string) (*streamClaims, error) {
+	payload, err := openSignedPayload(streamKey, token)
+	if err != nil {
+		return nil, err
+	}
+	var claims streamClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	return &claims, nil
+}
+
+type EventHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewEventHandler(dbClient *config.AstraDBClient) *EventHandler {
+	return &EventHandler{dbClient: dbClient}
+}
+
+// Stream is a Server-Sent Events feed of domain events for an outlet
+// (?outlet_id=) or a whole kemitraan (?kemitraan=, owners only). The stream
+// token from login is sent as ?token= or "Authorization: Bearer". Clients
+// resume with the Last-Event-ID header (or ?last_event_id=); a "reset"
+// event means some events were lost and the dashboard should reload.
+func (h *EventHandler) Stream(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if auth := c.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	claims, err := verifyStreamToken(token)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid stream token: " + err.Error()})
+	}
+
+	filter, err := h.streamFilter(claims, c.Query("outlet_id"), c.Query("kemitraan"))
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if types := c.Query("types"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub, missed, complete := eventBus.Subscribe(filter, lastEventID)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer eventBus.Unsubscribe(sub)
+
+		if !complete {
+			fmt.Fprintf(w, "event: reset\ndata: {\"last_event_id\":%q}\n\n", lastEventID)
+		}
+		for _, event := range missed {
+			writeEvent(w, event)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(kitchenHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event := <-sub.Events:
+				writeEvent(w, event)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// streamFilter limits a subscription to what the token holder may see:
+// their own outlet, or for owners any outlet of their kemitraan
+func (h *EventHandler) streamFilter(claims *streamClaims, outletID, kemitraan string) (events.Filter, error) {
+	switch {
+	case outletID != "":
+		if outletID == claims.OutletID {
+			return events.Filter{OutletID: outletID}, nil
+		}
+		if claims.canWatchKemitraan() && claims.Kemitraan != "" &&
+			strings.EqualFold(outletKemitraan(h.dbClient, outletID), claims.Kemitraan) {
+			return events.Filter{OutletID: outletID}, nil
+		}
+		return events.Filter{}, fmt.Errorf("Not allowed to follow outlet %s", outletID)
+
+	case kemitraan != "":
+		if claims.canWatchKemitraan() && strings.EqualFold(kemitraan, claims.Kemitraan) {
+			return events.Filter{Kemitraan: kemitraan}, nil
+		}
+		return events.Filter{}, fmt.Errorf("Not allowed to follow kemitraan %s", kemitraan)
+
+	case claims.canWatchKemitraan() && claims.Kemitraan != "":
+		return events.Filter{Kemitraan: claims.Kemitraan}, nil
+
+	case claims.OutletID != "":
+		return events.Filter{OutletID: claims.OutletID}, nil
+	}
+	return events.Filter{}, fmt.Errorf("Token is not linked to an outlet")
+}
+
+// writeEvent writes one SSE message with its ID for resuming
+func writeEvent(w *bufio.Writer, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// publishEvent publishes a domain event for an outlet, tagged with the
+// outlet's kemitraan so owners following the kemitraan receive it too
+func publishEvent(dbClient *config.AstraDBClient, eventType, outletID string, data interface{}) {
+	eventBus.Publish(eventType, outletID, outletKemitraan(dbClient, outletID), data)
+}
+
+// Outlet kemitraan lookups are cached; events are published on hot paths
+const kemitraanCacheTTL = 5 * time.Minute
+
+type kemitraanEntry struct {
+	kemitraan string
+	expires   time.Time
+}
+
+var kemitraanCache sync.Map // outlet ID -> kemitraanEntry
+
+// outletKemitraan returns the kemitraan set in an outlet's settings, or
+// when none is set, the kemitraan of the outlet's kasir accounts. Failed
+// lookups are not cached.
+func outletKemitraan(dbClient *config.AstraDBClient, outletID string) string {
+	if outletID == "" {
+		return ""
+	}
+	if v, ok := kemitraanCache.Load(outletID); ok {
+		if entry := v.(kemitraanEntry); time.Now().Before(entry.expires) {
+			return entry.kemitraan
+		}
+	}
+
+	settings, err := loadOutletSettings(dbClient, outletID)
+	if err != nil {
+		return ""
+	}
+	kemitraan := settings.Kemitraan
+	if kemitraan == "" {
+		if kemitraan, err = kasirKemitraan(dbClient, outletID); err != nil {
+			fmt.Printf("Warning: Failed to look up the kemitraan of outlet %s: %v\n", outletID, err)
+			return ""
+		}
+	}
+	kemitraanCache.Store(outletID, kemitraanEntry{kemitraan: kemitraan, expires: time.Now().Add(kemitraanCacheTTL)})
+	return kemitraan
+}
+
+// kasirKemitraan returns the kemitraan recorded on the kasir_pos accounts of
+// an outlet, for outlets whose settings do not name one
+func kasirKemitraan(dbClient *config.AstraDBClient, outletID string) (string, error) {
+	respData, err := dbClient.ExecuteQuery("GET", "/kasir_pos/rows", nil)
+	if err != nil {
+		return "", err
+	}
+	var raw interface{}
+	if err := json.Unmarshal(respData, &raw); err != nil {
+		return "", fmt.Errorf("failed to parse kasir response: %v", err)
+	}
+
+	var rows []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		rows = v
+	case map[string]interface{}:
+		if arr, ok := v["value"].([]interface{}); ok {
+			rows = arr
+		} else if arr, ok := v["data"].([]interface{}); ok {
+			rows = arr
+		} else if arr, ok := v["rows"].([]interface{}); ok {
+			rows = arr
+		} else if arr, ok := v["values"].([]interface{}); ok {
+			rows = arr
+		}
+	}
+
+	for _, r := range rows {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		row := parseRowToMap(m)
+		kemitraan := toString(extractVal(row["kemitraan"]))
+		if strings.EqualFold(toString(extractVal(row["outlet"])), outletID) && kemitraan != "" {
+			return kemitraan, nil
+		}
+	}
+	return "", nil
+}
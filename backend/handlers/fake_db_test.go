@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"sagawa_pos_backend/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeDB is an in-memory stand-in for the Astra Data API, enough of it for
+// the filters and updates the handlers send: equality, $ne, $in, $nin,
+// $gte, $lte and $exists filters; $set and $inc updates; upserts; sorting on
+// one field. REST (table) requests go to the rest hook, 404 by default.
+type fakeDB struct {
+	mu          sync.Mutex
+	collections map[string][]map[string]interface{}
+	failing     map[string]string // "collection" or "collection command" -> errorCode reported with a 200
+	rest        func(method, path string, body []byte) (int, string)
+
+	// intercept, when set, sees every command not failed by failing and
+	// fails it by returning an errorCode
+	intercept func(collection, command string, args map[string]interface{}) string
+}
+
+func newFakeDB(t *testing.T) (*fakeDB, *config.AstraDBClient) {
+	t.Helper()
+	db := &fakeDB{
+		collections: map[string][]map[string]interface{}{},
+		failing:     map[string]string{},
+	}
+	server := httptest.NewServer(http.HandlerFunc(db.serve))
+	t.Cleanup(server.Close)
+	return db, config.NewAstraDBClient(server.URL+"/rest", server.URL+"/data", "token", server.Client())
+}
+
+// insert seeds a collection, round-tripping through JSON like the real API
+func (db *fakeDB) insert(collection string, docs ...interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, doc := range docs {
+		db.collections[collection] = append(db.collections[collection], jsonMap(doc))
+	}
+}
+
+// find returns the documents of a collection matching filter
+func (db *fakeDB) find(collection string, filter map[string]interface{}) []map[string]interface{} {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var found []map[string]interface{}
+	for _, doc := range db.collections[collection] {
+		if fakeMatches(doc, jsonMap(filter)) {
+			found = append(found, doc)
+		}
+	}
+	return found
+}
+
+func (db *fakeDB) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(r.URL.Path, "/rest") {
+		status, response := 404, `{"description":"not found"}`
+		if db.rest != nil {
+			status, response = db.rest(r.Method, strings.TrimPrefix(r.URL.Path, "/rest"), body)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+		return
+	}
+
+	collection := strings.TrimPrefix(r.URL.Path, "/data/")
+	var command map[string]map[string]interface{}
+	if err := json.Unmarshal(body, &command); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for name := range command {
+		code, ok := db.failing[collection+" "+name]
+		if !ok {
+			code, ok = db.failing[collection]
+		}
+		if !ok && db.intercept != nil {
+			code = db.intercept(collection, name, command[name])
+			ok = code != ""
+		}
+		if ok {
+			fmt.Fprintf(w, `{"errors":[{"errorCode":%q,"message":"injected failure"}]}`, code)
+			return
+		}
+	}
+
+	var response interface{}
+	switch {
+	case command["insertOne"] != nil:
+		doc, _ := command["insertOne"]["document"].(map[string]interface{})
+		if id, ok := doc["_id"]; ok && db.indexOf(collection, map[string]interface{}{"_id": id}) >= 0 {
+			fmt.Fprintf(w, `{"errors":[{"errorCode":"DOCUMENT_ALREADY_EXISTS","message":"Document already exists with the given _id"}]}`)
+			return
+		}
+		db.collections[collection] = append(db.collections[collection], doc)
+		response = map[string]interface{}{"status": map[string]interface{}{"insertedIds": []interface{}{doc["_id"]}}}
+	case command["findOneAndUpdate"] != nil:
+		response = map[string]interface{}{"data": map[string]interface{}{"document": db.update(collection, command["findOneAndUpdate"])}}
+	case command["find"] != nil:
+		filter, _ := command["find"]["filter"].(map[string]interface{})
+		var docs []map[string]interface{}
+		for _, doc := range db.collections[collection] {
+			if fakeMatches(doc, filter) {
+				docs = append(docs, doc)
+			}
+		}
+		if order, ok := command["find"]["sort"].(map[string]interface{}); ok {
+			for field, dir := range order {
+				desc := dir.(float64) < 0
+				sort.SliceStable(docs, func(i, j int) bool {
+					if desc {
+						return fakeCompare(docs[j][field], docs[i][field]) < 0
+					}
+					return fakeCompare(docs[i][field], docs[j][field]) < 0
+				})
+			}
+		}
+		if docs == nil {
+			docs = []map[string]interface{}{}
+		}
+		response = map[string]interface{}{"data": map[string]interface{}{"documents": docs}}
+	default:
+		http.Error(w, "unsupported command", 400)
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (db *fakeDB) indexOf(collection string, filter map[string]interface{}) int {
+	for i, doc := range db.collections[collection] {
+		if fakeMatches(doc, filter) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (db *fakeDB) update(collection string, command map[string]interface{}) map[string]interface{} {
+	filter, _ := command["filter"].(map[string]interface{})
+	update, _ := command["update"].(map[string]interface{})
+	options, _ := command["options"].(map[string]interface{})
+
+	i := db.indexOf(collection, filter)
+	if i < 0 {
+		if upsert, _ := options["upsert"].(bool); !upsert {
+			return nil
+		}
+		doc := map[string]interface{}{}
+		for k, v := range filter {
+			if _, isOperator := v.(map[string]interface{}); !isOperator {
+				doc[k] = v
+			}
+		}
+		db.collections[collection] = append(db.collections[collection], doc)
+		i = len(db.collections[collection]) - 1
+	}
+
+	doc := db.collections[collection][i]
+	if set, ok := update["$set"].(map[string]interface{}); ok {
+		for k, v := range set {
+			doc[k] = v
+		}
+	}
+	if inc, ok := update["$inc"].(map[string]interface{}); ok {
+		for k, v := range inc {
+			current, _ := doc[k].(float64)
+			doc[k] = current + v.(float64)
+		}
+	}
+	return doc
+}
+
+func fakeMatches(doc, filter map[string]interface{}) bool {
+	for field, want := range filter {
+		value, present := doc[field]
+		ops, isOperator := want.(map[string]interface{})
+		if !isOperator {
+			if !present || fakeCompare(value, want) != 0 {
+				return false
+			}
+			continue
+		}
+		for op, arg := range ops {
+			var ok bool
+			switch op {
+			case "$ne":
+				ok = !present || fakeCompare(value, arg) != 0
+			case "$in", "$nin":
+				for _, candidate := range arg.([]interface{}) {
+					if present && fakeCompare(value, candidate) == 0 {
+						ok = true
+					}
+				}
+				if op == "$nin" {
+					ok = !ok
+				}
+			case "$gte":
+				ok = present && fakeCompare(value, arg) >= 0
+			case "$lte":
+				ok = present && fakeCompare(value, arg) <= 0
+			case "$exists":
+				ok = present == arg.(bool)
+			default:
+				panic("fakeDB: unsupported filter operator " + op)
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fakeCompare orders two JSON values of the same kind; values of different
+// kinds compare unequal
+func fakeCompare(a, b interface{}) int {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if string(ja) == string(jb) {
+		return 0
+	}
+	return 1
+}
+
+func jsonMap(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// do sends a JSON request through app and decodes the JSON response
+func do(t *testing.T, app *fiber.App, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = strings.NewReader(string(data))
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var decoded map[string]interface{}
+	data, _ := io.ReadAll(resp.Body)
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s %s: bad JSON response %s", method, path, data)
+		}
+	}
+	return resp.StatusCode, decoded
+}
+
+// inTempDir runs the rest of the test in an empty directory, so files the
+// handlers write (e.g. the transaction backup) stay out of the tree
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -3,8 +3,15 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"time"
 )
 
+// wib is the fixed Western Indonesia timezone (UTC+7) used for all
+// business-day calculations, regardless of server location
+var wib = time.FixedZone("WIB", 7*60*60)
+
 // toString converts various types into string safely
 func toString(v interface{}) string {
     if v == nil {
@@ -20,6 +27,11 @@ func toString(v interface{}) string {
     }
 }
 
+// toMoney converts a numeric document value into whole rupiah
+func toMoney(v interface{}) models.Money {
+    return models.NewMoney(toFloat(v))
+}
+
 // extractVal unwraps nested value shapes that AstraDB REST may return.
 func extractVal(v interface{}) interface{} {
     if v == nil {
@@ -40,6 +52,39 @@ func extractVal(v interface{}) interface{} {
     return v
 }
 
+// toDocument converts a model into a Data API document using its JSON tags
+func toDocument(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// updateDocumentIf applies update to the document matching filter and reports
+// whether one matched. Filters that include the expected current values make
+// this a compare-and-set.
+func updateDocumentIf(dbClient *config.AstraDBClient, collection string, filter, update map[string]interface{}) (bool, error) {
+	respBody, err := dbClient.UpdateDocument(collection, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	var response struct {
+		Data struct {
+			Document map[string]interface{} `json:"document"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return false, fmt.Errorf("failed to parse update response: %v", err)
+	}
+	return response.Data.Document != nil, nil
+}
+
 // parseRowToMap normalizes various AstraDB row shapes into a simple map
 func parseRowToMap(m map[string]interface{}) map[string]interface{} {
     // 1) doc_json
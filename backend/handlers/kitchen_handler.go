@@ -0,0 +1,578 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/events"
+	"sagawa_pos_backend/models"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Keep-alive interval of the kitchen feed
+const kitchenHeartbeat = 15 * time.Second
+
+type KitchenHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewKitchenHandler(dbClient *config.AstraDBClient) *KitchenHandler {
+	return &KitchenHandler{dbClient: dbClient}
+}
+
+// GetItems lists kitchen items of an outlet, by default those still queued
+// or started. Filter with ?station= and ?status=.
+func (h *KitchenHandler) GetItems(c *fiber.Ctx) error {
+	filter := kitchenFilter(c.Params("outlet_id"), c.Query("station"))
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	items, err := findKitchenItems(h.dbClient, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"count": len(items), "items": items})
+}
+
+// Stream is a Server-Sent Events feed for a kitchen display. It starts with
+// the open items of the outlet (or ?station=) and then pushes every change.
+func (h *KitchenHandler) Stream(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	station := c.Query("station")
+
+	items, err := findKitchenItems(h.dbClient, kitchenFilter(outletID, station))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub, _, _ := eventBus.Subscribe(events.Filter{OutletID: outletID, Types: []string{events.KitchenItemChanged}}, "")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer eventBus.Unsubscribe(sub)
+
+		for _, item := range items {
+			writeKitchenEvent(w, models.KitchenEvent{Type: models.KitchenEventQueued, Item: item})
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(kitchenHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case e := <-sub.Events:
+				event, ok := e.Data.(models.KitchenEvent)
+				if !ok || (station != "" && event.Item.Station != station) {
+					continue
+				}
+				writeKitchenEvent(w, event)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// A failed flush means the display disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// StartItem bumps a queued item to started
+func (h *KitchenHandler) StartItem(c *fiber.Ctx) error {
+	return h.bump(c, models.KitchenStarted)
+}
+
+// DoneItem bumps an item to done and records its timings. When every item
+// of the order is done the order becomes ready.
+func (h *KitchenHandler) DoneItem(c *fiber.Ctx) error {
+	return h.bump(c, models.KitchenDone)
+}
+
+func (h *KitchenHandler) bump(c *fiber.Ctx, to string) error {
+	var req models.BumpKitchenItemRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+	if req.Actor == "" {
+		req.Actor = "kitchen"
+	}
+
+	item, err := loadKitchenItem(h.dbClient, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if item == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Kitchen item not found"})
+	}
+
+	from := item.Status
+	allowed := from == models.KitchenQueued || (to == models.KitchenDone && from == models.KitchenStarted)
+	if !allowed {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Cannot bump an item that is %s to %s", from, to), "status": from})
+	}
+
+	now := time.Now().In(wib)
+	stamp := now.Format(time.RFC3339)
+	update := map[string]interface{}{"status": to}
+	if item.StartedAt == "" {
+		// Bumping straight to done counts as started at the same moment
+		item.StartedAt = stamp
+		item.StartedBy = req.Actor
+		update["started_at"] = item.StartedAt
+		update["started_by"] = item.StartedBy
+	}
+	if to == models.KitchenDone {
+		item.DoneAt = stamp
+		item.DoneBy = req.Actor
+		item.WaitSeconds = secondsBetween(item.QueuedAt, item.StartedAt)
+		item.PrepSeconds = secondsBetween(item.StartedAt, item.DoneAt)
+		item.TicketSeconds = secondsBetween(item.QueuedAt, item.DoneAt)
+		update["done_at"] = item.DoneAt
+		update["done_by"] = item.DoneBy
+		update["wait_seconds"] = item.WaitSeconds
+		update["prep_seconds"] = item.PrepSeconds
+		update["ticket_seconds"] = item.TicketSeconds
+	}
+
+	ok, err := updateDocumentIf(h.dbClient, "kitchen_item", map[string]interface{}{"_id": item.ID, "status": from}, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Item was bumped concurrently, reload and try again"})
+	}
+	item.Status = to
+
+	eventType := models.KitchenEventStarted
+	if to == models.KitchenDone {
+		eventType = models.KitchenEventDone
+	}
+	publishKitchenEvent(h.dbClient, eventType, *item)
+
+	h.advanceOrder(item.OrderID, req.Actor)
+	return c.JSON(item)
+}
+
+// advanceOrder moves an order to preparing once the kitchen starts on it and
+// to ready once every routed item is done
+func (h *KitchenHandler) advanceOrder(orderID, actor string) {
+	order, err := loadOrder(h.dbClient, orderID)
+	if err != nil || order == nil {
+		return
+	}
+
+	if order.Status == models.OrderStatusSentToKitchen {
+		if ok, err := transitionOrder(h.dbClient, order, models.OrderStatusPreparing, actor, "kitchen started"); err != nil || !ok {
+			return
+		}
+	}
+	if order.Status != models.OrderStatusPreparing {
+		return
+	}
+
+	pending := map[string]interface{}{
+		"order_id": orderID,
+		"status":   map[string]interface{}{"$in": []string{models.KitchenQueued, models.KitchenStarted}},
+	}
+	open, err := findKitchenItems(h.dbClient, pending)
+	if err != nil || len(open) > 0 {
+		return
+	}
+	if _, err := transitionOrder(h.dbClient, order, models.OrderStatusReady, actor, "all items done"); err != nil {
+		fmt.Printf("Warning: Failed to mark order %s ready: %v\n", orderID, err)
+	}
+}
+
+// GetMetrics reports ticket times per station and per menu item for an
+// outlet on a day (?date=YYYY-MM-DD, default today)
+func (h *KitchenHandler) GetMetrics(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	date := c.Query("date")
+	if date == "" {
+		date = time.Now().In(wib).Format("2006-01-02")
+	}
+
+	filter := map[string]interface{}{
+		"outlet_id": outletID,
+		"queued_at": map[string]interface{}{
+			"$gte": date + "T00:00:00Z",
+			"$lte": date + "T23:59:59Z",
+		},
+	}
+	if station := c.Query("station"); station != "" {
+		filter["station"] = station
+	}
+	items, err := findKitchenItems(h.dbClient, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	stations, menus := summarizeKitchenTimes(items)
+	return c.JSON(fiber.Map{
+		"outlet_id": outletID,
+		"date":      date,
+		"stations":  stations,
+		"menus":     menus,
+	})
+}
+
+// summarizeKitchenTimes averages the timings of done items per station and
+// per menu item
+func summarizeKitchenTimes(items []models.KitchenItem) ([]models.StationMetrics, []models.MenuTicketMetrics) {
+	type totals struct {
+		wait, prep, ticket int
+	}
+	stations := make(map[string]*models.StationMetrics)
+	stationTotals := make(map[string]*totals)
+	menus := make(map[string]*models.MenuTicketMetrics)
+	menuTotals := make(map[string]int)
+
+	for _, item := range items {
+		if item.Status == models.KitchenVoided {
+			continue
+		}
+		row, ok := stations[item.Station]
+		if !ok {
+			row = &models.StationMetrics{Station: item.Station}
+			stations[item.Station] = row
+			stationTotals[item.Station] = &totals{}
+		}
+		row.Items++
+		if item.Status != models.KitchenDone {
+			continue
+		}
+
+		row.Done++
+		t := stationTotals[item.Station]
+		t.wait += item.WaitSeconds
+		t.prep += item.PrepSeconds
+		t.ticket += item.TicketSeconds
+		if item.TicketSeconds > row.MaxTicketSeconds {
+			row.MaxTicketSeconds = item.TicketSeconds
+		}
+
+		key := item.Station + "|" + item.MenuID
+		menu, ok := menus[key]
+		if !ok {
+			menu = &models.MenuTicketMetrics{MenuID: item.MenuID, Name: item.Name, Station: item.Station}
+			menus[key] = menu
+		}
+		menu.Done++
+		menuTotals[key] += item.TicketSeconds
+	}
+
+	stationRows := make([]models.StationMetrics, 0, len(stations))
+	for name, row := range stations {
+		if row.Done > 0 {
+			t := stationTotals[name]
+			row.AvgWaitSeconds = t.wait / row.Done
+			row.AvgPrepSeconds = t.prep / row.Done
+			row.AvgTicketSeconds = t.ticket / row.Done
+		}
+		stationRows = append(stationRows, *row)
+	}
+	sort.Slice(stationRows, func(i, j int) bool {
+		return stationRows[i].Station < stationRows[j].Station
+	})
+
+	menuRows := make([]models.MenuTicketMetrics, 0, len(menus))
+	for key, menu := range menus {
+		menu.AvgTicketSeconds = menuTotals[key] / menu.Done
+		menuRows = append(menuRows, *menu)
+	}
+	sort.Slice(menuRows, func(i, j int) bool {
+		return menuRows[i].AvgTicketSeconds > menuRows[j].AvgTicketSeconds
+	})
+
+	return stationRows, menuRows
+}
+
+// routeToKitchen creates kitchen items for order lines, routed to stations
+// by menu kategori through the outlet's settings, and pushes them to the
+// kitchen displays
+func routeToKitchen(dbClient *config.AstraDBClient, order *models.Order, lines []models.OrderItem) {
+	if len(lines) == 0 {
+		return
+	}
+	menus, err := loadMenus(dbClient)
+	if err != nil {
+		fmt.Printf("Warning: Failed to load menus for kitchen routing: %v\n", err)
+		menus = map[string]models.Menu{}
+	}
+	settings, err := loadOutletSettings(dbClient, order.OutletID)
+	if err != nil {
+		settings = defaultOutletSettings(order.OutletID)
+	}
+	// Lines merged in from a bill the kitchen already had are not sent again
+	routed := make(map[string]bool)
+	if existing, err := findKitchenItems(dbClient, map[string]interface{}{"order_id": order.ID}); err == nil {
+		for _, item := range existing {
+			routed[item.LineID] = true
+		}
+	}
+
+	now := time.Now().In(wib).Format(time.RFC3339)
+	for _, line := range lines {
+		if routed[line.LineID] {
+			continue
+		}
+		kategori := menus[line.ProductID].Kategori
+		item := models.KitchenItem{
+			ID:          order.ID + ":" + line.LineID,
+			OrderID:     order.ID,
+			OrderNumber: order.OrderNumber,
+			OutletID:    order.OutletID,
+			Station:     settings.StationFor(kategori),
+			TableNumber: order.TableNumber,
+			OrderType:   order.Type,
+			LineID:      line.LineID,
+			MenuID:      line.ProductID,
+			Name:        line.Name,
+			Kategori:    kategori,
+			Quantity:    line.Quantity,
+			Note:        line.Note,
+			Status:      models.KitchenQueued,
+			QueuedAt:    now,
+		}
+
+		document, err := toDocument(item)
+		if err != nil {
+			continue
+		}
+		if _, err := dbClient.InsertDocument("kitchen_item", document); err != nil {
+			fmt.Printf("Warning: Failed to route %s to the kitchen: %v\n", item.ID, err)
+			continue
+		}
+		publishKitchenEvent(dbClient, models.KitchenEventQueued, item)
+	}
+}
+
+// voidKitchenItems takes unfinished items of an order (or of one line when
+// lineID is set) off the kitchen displays, e.g. when the order is cancelled
+func voidKitchenItems(dbClient *config.AstraDBClient, orderID, lineID string) {
+	filter := map[string]interface{}{
+		"order_id": orderID,
+		"status":   map[string]interface{}{"$in": []string{models.KitchenQueued, models.KitchenStarted}},
+	}
+	if lineID != "" {
+		filter["line_id"] = lineID
+	}
+	items, err := findKitchenItems(dbClient, filter)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		if _, err := dbClient.UpdateDocument("kitchen_item", map[string]interface{}{"_id": item.ID}, map[string]interface{}{"status": models.KitchenVoided}); err != nil {
+			fmt.Printf("Warning: Failed to void kitchen item %s: %v\n", item.ID, err)
+			continue
+		}
+		item.Status = models.KitchenVoided
+		publishKitchenEvent(dbClient, models.KitchenEventVoided, item)
+	}
+}
+
+// moveKitchenItems hands the kitchen items of a merged bill to the bill it
+// was merged into. Items keep their ID.
+func moveKitchenItems(dbClient *config.AstraDBClient, fromOrderID string, to *models.Order) {
+	items, err := findKitchenItems(dbClient, map[string]interface{}{"order_id": fromOrderID})
+	if err != nil {
+		fmt.Printf("Warning: Failed to load kitchen items of %s to move them to %s: %v\n", fromOrderID, to.ID, err)
+		return
+	}
+	for _, item := range items {
+		update := map[string]interface{}{
+			"order_id":     to.ID,
+			"order_number": to.OrderNumber,
+			"table_number": to.TableNumber,
+		}
+		if _, err := dbClient.UpdateDocument("kitchen_item", map[string]interface{}{"_id": item.ID}, update); err != nil {
+			fmt.Printf("Warning: Failed to move kitchen item %s to %s: %v\n", item.ID, to.ID, err)
+			continue
+		}
+		if item.Status == models.KitchenQueued || item.Status == models.KitchenStarted {
+			item.OrderID = to.ID
+			item.OrderNumber = to.OrderNumber
+			item.TableNumber = to.TableNumber
+			publishKitchenEvent(dbClient, models.KitchenEventUpdated, item)
+		}
+	}
+}
+
+// splitKitchenLines follows a bill split in the kitchen. Lines moved whole
+// take their kitchen items to the new bill; a line split in two keeps its
+// item for the part left on the bill and the part that moved gets a copy
+// with the same status. taken[i] is the part taken for take[i].
+func splitKitchenLines(dbClient *config.AstraDBClient, from, to *models.Order, take []models.SplitLine, taken []models.OrderItem) {
+	for i, t := range take {
+		part := taken[i]
+		filter := map[string]interface{}{
+			"order_id": from.ID,
+			"line_id":  t.LineID,
+			"status":   map[string]interface{}{"$ne": models.KitchenVoided},
+		}
+		items, err := findKitchenItems(dbClient, filter)
+		if err != nil {
+			fmt.Printf("Warning: Failed to load kitchen items of %s line %s to split them: %v\n", from.ID, t.LineID, err)
+			continue
+		}
+
+		for _, item := range items {
+			if part.LineID == t.LineID {
+				update := map[string]interface{}{"order_id": to.ID, "order_number": to.OrderNumber}
+				if _, err := dbClient.UpdateDocument("kitchen_item", map[string]interface{}{"_id": item.ID}, update); err != nil {
+					fmt.Printf("Warning: Failed to move kitchen item %s to %s: %v\n", item.ID, to.ID, err)
+					continue
+				}
+				item.OrderID = to.ID
+				item.OrderNumber = to.OrderNumber
+				publishKitchenEvent(dbClient, models.KitchenEventUpdated, item)
+				continue
+			}
+
+			copied := item
+			copied.ID = to.ID + ":" + part.LineID
+			copied.OrderID = to.ID
+			copied.OrderNumber = to.OrderNumber
+			copied.LineID = part.LineID
+			copied.Quantity = part.Quantity
+			document, err := toDocument(copied)
+			if err != nil {
+				continue
+			}
+			if _, err := dbClient.InsertDocument("kitchen_item", document); err != nil {
+				fmt.Printf("Warning: Failed to route %s to the kitchen: %v\n", copied.ID, err)
+				continue
+			}
+			publishKitchenEvent(dbClient, models.KitchenEventUpdated, copied)
+			resizeKitchenItem(dbClient, item, item.Quantity-part.Quantity)
+		}
+	}
+}
+
+// resizeKitchenLine sets the quantity of the unfinished kitchen items of an
+// order line
+func resizeKitchenLine(dbClient *config.AstraDBClient, orderID, lineID string, quantity int) {
+	filter := map[string]interface{}{
+		"order_id": orderID,
+		"line_id":  lineID,
+		"status":   map[string]interface{}{"$in": []string{models.KitchenQueued, models.KitchenStarted}},
+	}
+	items, err := findKitchenItems(dbClient, filter)
+	if err != nil {
+		fmt.Printf("Warning: Failed to load kitchen items of %s line %s: %v\n", orderID, lineID, err)
+		return
+	}
+	for _, item := range items {
+		resizeKitchenItem(dbClient, item, quantity)
+	}
+}
+
+// resizeKitchenItem sets the quantity of a kitchen item, e.g. after part of
+// its line was removed or split off
+func resizeKitchenItem(dbClient *config.AstraDBClient, item models.KitchenItem, quantity int) {
+	if _, err := dbClient.UpdateDocument("kitchen_item", map[string]interface{}{"_id": item.ID}, map[string]interface{}{"quantity": quantity}); err != nil {
+		fmt.Printf("Warning: Failed to change the quantity of kitchen item %s: %v\n", item.ID, err)
+		return
+	}
+	item.Quantity = quantity
+	publishKitchenEvent(dbClient, models.KitchenEventUpdated, item)
+}
+
+// kitchenStarted reports whether the kitchen has started or finished any
+// part of an order line
+func kitchenStarted(dbClient *config.AstraDBClient, orderID, lineID string) (bool, error) {
+	filter := map[string]interface{}{
+		"order_id": orderID,
+		"line_id":  lineID,
+		"status":   map[string]interface{}{"$in": []string{models.KitchenStarted, models.KitchenDone}},
+	}
+	items, err := findKitchenItems(dbClient, filter)
+	return len(items) > 0, err
+}
+
+// kitchenFilter selects the open items of an outlet, optionally one station
+func kitchenFilter(outletID, station string) map[string]interface{} {
+	filter := map[string]interface{}{
+		"outlet_id": outletID,
+		"status":    map[string]interface{}{"$in": []string{models.KitchenQueued, models.KitchenStarted}},
+	}
+	if station != "" {
+		filter["station"] = station
+	}
+	return filter
+}
+
+// publishKitchenEvent puts a kitchen item change on the event bus, which
+// feeds the kitchen displays as well as dashboards. A display that is not
+// keeping up misses the event rather than blocking the kitchen.
+func publishKitchenEvent(dbClient *config.AstraDBClient, eventType string, item models.KitchenItem) {
+	publishEvent(dbClient, events.KitchenItemChanged, item.OutletID, models.KitchenEvent{Type: eventType, Item: item})
+}
+
+// writeKitchenEvent writes one SSE message
+func writeKitchenEvent(w *bufio.Writer, event models.KitchenEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+// secondsBetween returns the seconds between two RFC3339 timestamps
+func secondsBetween(from, to string) int {
+	start, err1 := time.Parse(time.RFC3339, from)
+	end, err2 := time.Parse(time.RFC3339, to)
+	if err1 != nil || err2 != nil || end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start).Seconds())
+}
+
+// loadKitchenItem fetches a kitchen item by ID; nil if it does not exist
+func loadKitchenItem(dbClient *config.AstraDBClient, id string) (*models.KitchenItem, error) {
+	items, err := findKitchenItems(dbClient, map[string]interface{}{"_id": id})
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// findKitchenItems fetches kitchen items matching a filter, oldest first
+func findKitchenItems(dbClient *config.AstraDBClient, filter map[string]interface{}) ([]models.KitchenItem, error) {
+	docs, err := findDocuments(dbClient, "kitchen_item", filter, nil, 10)
+	if err != nil {
+		return nil, err
+	}
+	items := []models.KitchenItem{}
+	for _, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var item models.KitchenItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, fmt.Errorf("failed to parse kitchen item: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].QueuedAt < items[j].QueuedAt
+	})
+	return items, nil
+}
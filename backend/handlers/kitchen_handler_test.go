@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/events"
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestKitchenChangesArePublishedOnTheEventBus(t *testing.T) {
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Post("/kitchen/items/:id/start", NewKitchenHandler(client).StartItem)
+	db.insert("kitchen_item", models.KitchenItem{ID: "K1:L1", OrderID: "K1", OutletID: "KITCHENTEST", Station: "drinks", LineID: "L1", Quantity: 1, Status: models.KitchenQueued})
+
+	sub, _, _ := eventBus.Subscribe(events.Filter{OutletID: "KITCHENTEST", Types: []string{events.KitchenItemChanged}}, "")
+	defer eventBus.Unsubscribe(sub)
+
+	if status, body := do(t, app, "POST", "/kitchen/items/K1:L1/start", nil); status != 200 {
+		t.Fatalf("start: status %d %v", status, body)
+	}
+	select {
+	case e := <-sub.Events:
+		event, ok := e.Data.(models.KitchenEvent)
+		if !ok || event.Type != models.KitchenEventStarted || event.Item.ID != "K1:L1" || event.Item.Status != models.KitchenStarted {
+			t.Errorf("event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no kitchen event published")
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type MemberHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewMemberHandler(dbClient *config.AstraDBClient) *MemberHandler {
+	return &MemberHandler{dbClient: dbClient}
+}
+
+// GetMembers lists members, optionally by phone number
+func (h *MemberHandler) GetMembers(c *fiber.Ctx) error {
+	filter := map[string]interface{}{}
+	if phone := c.Query("phone"); phone != "" {
+		filter["phone"] = phone
+	}
+	members, err := findMembers(h.dbClient, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(members)
+}
+
+// GetMember returns a member by ID
+func (h *MemberHandler) GetMember(c *fiber.Ctx) error {
+	members, err := findMembers(h.dbClient, map[string]interface{}{"_id": c.Params("id")})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(members) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Member not found"})
+	}
+	return c.JSON(members[0])
+}
+
+// CreateMember registers an active member
+func (h *MemberHandler) CreateMember(c *fiber.Ctx) error {
+	var member models.Member
+	if err := c.BodyParser(&member); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	member.Name = strings.TrimSpace(member.Name)
+	if member.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "name is required"})
+	}
+
+	now := time.Now().In(wib).Format(time.RFC3339)
+	member.ID = uuid.New().String()
+	member.Active = true
+	member.CreatedAt = now
+	member.UpdatedAt = now
+
+	document, err := toDocument(member)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := h.dbClient.InsertDocument("member", document); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(member)
+}
+
+// DeleteMember deactivates a member; member-only promotions stop applying
+func (h *MemberHandler) DeleteMember(c *fiber.Ctx) error {
+	update := map[string]interface{}{
+		"active":     false,
+		"updated_at": time.Now().In(wib).Format(time.RFC3339),
+	}
+	ok, err := updateDocumentIf(h.dbClient, "member", map[string]interface{}{"_id": c.Params("id")}, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Member not found"})
+	}
+	return c.JSON(fiber.Map{"message": "Member deactivated successfully"})
+}
+
+// isActiveMember reports whether memberID belongs to an active member
+func isActiveMember(dbClient *config.AstraDBClient, memberID string) (bool, error) {
+	if memberID == "" {
+		return false, nil
+	}
+	members, err := findMembers(dbClient, map[string]interface{}{"_id": memberID, "active": true})
+	if err != nil {
+		return false, err
+	}
+	return len(members) > 0, nil
+}
+
+func findMembers(dbClient *config.AstraDBClient, filter map[string]interface{}) ([]models.Member, error) {
+	docs, err := findDocuments(dbClient, "member", filter, nil, 10)
+	if err != nil {
+		return nil, err
+	}
+	members := []models.Member{}
+	for _, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var member models.Member
+		if err := json.Unmarshal(data, &member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"sagawa_pos_backend/blobstore"
 	"sagawa_pos_backend/config"
 	"sagawa_pos_backend/models"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,19 +15,31 @@ import (
 
 type MenuHandler struct {
 	dbClient *config.AstraDBClient
+	images   blobstore.Store
 }
 
-func NewMenuHandler(dbClient *config.AstraDBClient) *MenuHandler {
-	return &MenuHandler{dbClient: dbClient}
+func NewMenuHandler(dbClient *config.AstraDBClient, images blobstore.Store) *MenuHandler {
+	return &MenuHandler{dbClient: dbClient, images: images}
 }
 
 // Menu cache TTL - 5 minutes
 const menuCacheTTL = 5 * time.Minute
 
-// GetAllMenu retrieves all items from menu_makanan
+// menuRowsPath is the REST path of all menu rows, also the menu cache key
+const menuRowsPath = "/menu_makanan/rows"
+
+// GetAllMenu retrieves the items of menu_makanan that are on schedule now
+// (or at ?at=; ?all=true lists everything). With ?outlet_id= the outlet's
+// price overrides and sold-out items are applied. The X-Menu-Version token
+// can be sent back as ?since= to get only what changed.
 func (h *MenuHandler) GetAllMenu(c *fiber.Ctx) error {
+	at, all, err := menuListTime(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Use cached query for better performance
-	respData, err := h.dbClient.ExecuteQueryWithCache("GET", "/menu_makanan/rows", nil, menuCacheTTL)
+	respData, err := h.dbClient.ExecuteQueryWithCache("GET", menuRowsPath, nil, menuCacheTTL)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -90,19 +104,13 @@ func (h *MenuHandler) GetAllMenu(c *fiber.Ctx) error {
 			// Normalize the row into a simple map[string]interface{}
 			norm := parseRowToMap(m)
 
-			// Create Menu from normalized map
-			menu := models.Menu{
-				ID:          toString(extractVal(norm["id"])),
-				Name:        toString(extractVal(norm["name"])),
-				Description: toString(extractVal(norm["description"])),
-				Kemitraan:   toString(extractVal(norm["kemitraan"])),
-				SubBrand:    toString(extractVal(norm["subBrand"])),
-				Kategori:    toString(extractVal(norm["kategori"])),
-				Price:       toFloat(extractVal(norm["price"])),
-				ImageURL:    toString(extractVal(norm["imageUrl"])),
-				ImageID:     toString(extractVal(norm["imageId"])),
-				ImageData:   toString(extractVal(norm["imageData"])),
+			// Create Menu from normalized map; soft-deleted items are hidden.
+			// Images are sent as URLs only, inline imageData stays out.
+			menu := menuFromMap(norm)
+			if menu.Deleted {
+				continue
 			}
+			menu.ImageData = ""
 			// apply server-side filter if query provided
 			if qSubBrand != "" {
 				if normalize(menu.SubBrand) == normalize(qSubBrand) {
@@ -120,12 +128,59 @@ func (h *MenuHandler) GetAllMenu(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.JSON(menus)
+	// Leave out items that are off schedule at the requested time or whose
+	// category is inactive
+	categories, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	sellable := menus[:0]
+	for _, menu := range menus {
+		if !menuSellable(menu, categories, at) {
+			if !all {
+				continue
+			}
+			menu.OffSchedule = true
+		}
+		sellable = append(sellable, menu)
+	}
+	menus = sellable
+
+	// Apply an outlet's availability and prices, leaving out hidden items
+	if outletID := c.Query("outlet_id"); outletID != "" {
+		overrides, err := loadMenuOverrides(h.dbClient, outletID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		visible := menus[:0]
+		for _, menu := range menus {
+			if o, ok := overrides[menu.ID]; ok {
+				applyMenuOverride(&menu, o, at)
+			}
+			if !menu.Hidden {
+				visible = append(visible, menu)
+			}
+		}
+		menus = visible
+	}
+
+	// Listings for another moment are not versioned
+	if c.Query("at") != "" {
+		return sendWithETag(c, menus, time.Time{})
+	}
+	query := menuQueryKey(c, "kemitraan", "subBrand", "outlet_id", "all")
+	version := recordMenuVersion(query, menuItemHashes(menus))
+	c.Set("X-Menu-Version", version.token())
+	if since := c.Query("since"); since != "" {
+		known, _ := findMenuVersion(query, since)
+		return sendWithETag(c, menuListDelta(version, known, menus), version.at)
+	}
+	return sendWithETag(c, menus, version.at)
 }
 
 // GetRaw returns the raw response body from AstraDB for debugging
 func (h *MenuHandler) GetRaw(c *fiber.Ctx) error {
-	respData, err := h.dbClient.ExecuteQueryWithCache("GET", "/menu_makanan/rows", nil, menuCacheTTL)
+	respData, err := h.dbClient.ExecuteQueryWithCache("GET", menuRowsPath, nil, menuCacheTTL)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -136,7 +191,7 @@ func (h *MenuHandler) GetRaw(c *fiber.Ctx) error {
 
 // GetAllMenuRaw returns the raw response body from AstraDB (for debugging)
 func (h *MenuHandler) GetAllMenuRaw(c *fiber.Ctx) error {
-	respData, err := h.dbClient.ExecuteQueryWithCache("GET", "/menu_makanan/rows", nil, menuCacheTTL)
+	respData, err := h.dbClient.ExecuteQueryWithCache("GET", menuRowsPath, nil, menuCacheTTL)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -146,7 +201,8 @@ func (h *MenuHandler) GetAllMenuRaw(c *fiber.Ctx) error {
 
 // RefreshMenuCache invalidates the menu cache (call this when menu is updated)
 func (h *MenuHandler) RefreshMenuCache(c *fiber.Ctx) error {
-	h.dbClient.InvalidateCache("/menu_makanan/rows")
+	invalidateMenuCache(h.dbClient)
+	invalidateMenuSearch()
 	return c.JSON(fiber.Map{"message": "Menu cache refreshed"})
 }
 
@@ -194,31 +250,47 @@ func (h *MenuHandler) GetMenu(c *fiber.Ctx) error {
 		// Normalize using the same logic as GetAllMenu
 		obj = parseRowToMap(obj)
 
-		menu := models.Menu{
-			ID:          toString(extractVal(obj["id"])),
-			Name:        toString(extractVal(obj["name"])),
-			Description: toString(extractVal(obj["description"])),
-			Kemitraan:   toString(extractVal(obj["kemitraan"])),
-			SubBrand:    toString(extractVal(obj["subBrand"])),
-			Kategori:    toString(extractVal(obj["kategori"])),
-			Price:       toFloat(extractVal(obj["price"])),
-			ImageURL:    toString(extractVal(obj["imageUrl"])),
-			ImageID:     toString(extractVal(obj["imageId"])),
-			ImageData:   toString(extractVal(obj["imageData"])),
+		menu := menuFromMap(obj)
+		if menu.Deleted && c.Query("include_deleted") != "true" {
+			return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
 		}
-		return c.JSON(menu)
+		if outletID := c.Query("outlet_id"); outletID != "" {
+			overrides, err := loadMenuOverrides(h.dbClient, outletID)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			if o, ok := overrides[menu.ID]; ok {
+				applyMenuOverride(&menu, o, time.Now())
+			}
+			if menu.Hidden {
+				return c.Status(404).JSON(fiber.Map{"error": "Menu item not offered at this outlet"})
+			}
+		}
+		return sendWithETag(c, menu, menuModifiedAt(menu))
 	}
 
 	return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
 }
 
-// GetCategories retrieves unique categories based on kemitraan and subBrand
+// GetCategories retrieves unique categories based on kemitraan and subBrand,
+// limited to those with items on schedule (same ?at= / ?all= as GetAllMenu).
+// Names come in category display order; items holds the categories
+// themselves once they have been created.
 func (h *MenuHandler) GetCategories(c *fiber.Ctx) error {
+	at, all, err := menuListTime(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	qKemitraan := c.Query("kemitraan")
 	qSubBrand := c.Query("subBrand")
 
 	// Use cached query for better performance
-	respData, err := h.dbClient.ExecuteQueryWithCache("GET", "/menu_makanan/rows", nil, menuCacheTTL)
+	respData, err := h.dbClient.ExecuteQueryWithCache("GET", menuRowsPath, nil, menuCacheTTL)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -268,11 +340,22 @@ func (h *MenuHandler) GetCategories(c *fiber.Ctx) error {
 	// Use map to collect unique categories
 	categorySet := make(map[string]bool)
 	var categories []string
+	items := []models.Category{}
+	listed := make(map[string]bool)
 
 	for _, r := range rows {
 		if m := toMap(r); m != nil {
 			norm := parseRowToMap(m)
 
+			if isDeletedFlag(norm["deleted"]) {
+				continue
+			}
+			// A kategori is listed while at least one of its items is on schedule
+			menu := menuFromMap(norm)
+			if !all && !menuSellable(menu, ix, at) {
+				continue
+			}
+
 			itemKemitraan := toString(extractVal(norm["kemitraan"]))
 			itemSubBrand := toString(extractVal(norm["subBrand"]))
 			itemKategori := toString(extractVal(norm["kategori"]))
@@ -300,15 +383,125 @@ func (h *MenuHandler) GetCategories(c *fiber.Ctx) error {
 				categorySet[itemKategori] = true
 				categories = append(categories, itemKategori)
 			}
+			if cat, ok := ix.forMenu(menu); ok && !listed[cat.ID] {
+				listed[cat.ID] = true
+				items = append(items, cat)
+			}
 		}
 	}
 
-	return c.JSON(fiber.Map{
+	// Order by the categories' display order; kategori without a category
+	// follow in the order they were found
+	position := make(map[string]int, len(items))
+	for i, cat := range ix.sorted(func(cat models.Category) bool { return listed[cat.ID] }) {
+		items[i] = cat
+		position[cat.Name] = i
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		pi, iok := position[categories[i]]
+		pj, jok := position[categories[j]]
+		if iok != jok {
+			return iok
+		}
+		return iok && pi < pj
+	})
+
+	response := fiber.Map{
 		"categories": categories,
+		"items":      items,
 		"count":      len(categories),
 		"kemitraan":  qKemitraan,
 		"subBrand":   qSubBrand,
-	})
+	}
+	if c.Query("at") != "" {
+		return sendWithETag(c, response, time.Time{})
+	}
+	hashes := map[string]string{"": fmt.Sprint(categories)}
+	for _, cat := range items {
+		hashes[cat.ID] = cat.UpdatedAt
+	}
+	version := recordMenuVersion(menuQueryKey(c, "kemitraan", "subBrand", "all"), hashes)
+	return sendWithETag(c, response, version.at)
+}
+
+// menuFromMap builds a Menu from a row normalized by parseRowToMap
+func menuFromMap(norm map[string]interface{}) models.Menu {
+	menu := models.Menu{
+		ID:          toString(extractVal(norm["id"])),
+		Name:        toString(extractVal(norm["name"])),
+		Description: toString(extractVal(norm["description"])),
+		Kemitraan:   toString(extractVal(norm["kemitraan"])),
+		SubBrand:    toString(extractVal(norm["subBrand"])),
+		Kategori:    toString(extractVal(norm["kategori"])),
+		CategoryID:  toString(extractVal(norm["categoryId"])),
+		Price:       toMoney(extractVal(norm["price"])),
+		ImageURL:    toString(extractVal(norm["imageUrl"])),
+		ImageID:     toString(extractVal(norm["imageId"])),
+		ImageData:   toString(extractVal(norm["imageData"])),
+		UpdatedAt:   toString(extractVal(norm["updatedAt"])),
+		Deleted:     isDeletedFlag(norm["deleted"]),
+		DeletedAt:   toString(extractVal(norm["deletedAt"])),
+		Version:     int(toFloat(extractVal(norm["version"]))),
+
+		ImageThumbURL: toString(extractVal(norm["imageThumbUrl"])),
+	}
+	decodeMenuField(norm["variants"], &menu.Variants)
+	decodeMenuField(norm["modifierGroups"], &menu.ModifierGroups)
+	decodeMenuField(norm["schedule"], &menu.Schedule)
+	return menu
+}
+
+// isDeletedFlag reads a soft-delete flag stored as a bool or a string
+func isDeletedFlag(v interface{}) bool {
+	switch t := extractVal(v).(type) {
+	case bool:
+		return t
+	case string:
+		return strings.EqualFold(t, "true")
+	}
+	return false
+}
+
+// loadMenus fetches every menu_makanan row (through the menu cache) and
+// returns them keyed by menu ID, without soft-deleted items. Used by pricing
+// and transaction validation.
+func loadMenus(dbClient *config.AstraDBClient) (map[string]models.Menu, error) {
+	respData, err := dbClient.ExecuteQueryWithCache("GET", menuRowsPath, nil, menuCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(respData, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse menu response: %v", err)
+	}
+
+	var rows []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		rows = v
+	case map[string]interface{}:
+		if arr, ok := v["value"].([]interface{}); ok {
+			rows = arr
+		} else if arr, ok := v["data"].([]interface{}); ok {
+			rows = arr
+		} else if arr, ok := v["rows"].([]interface{}); ok {
+			rows = arr
+		} else if arr, ok := v["values"].([]interface{}); ok {
+			rows = arr
+		}
+	}
+
+	menus := make(map[string]models.Menu, len(rows))
+	for _, r := range rows {
+		if m, ok := r.(map[string]interface{}); ok {
+			menu := menuFromMap(parseRowToMap(m))
+			if menu.ID != "" && !menu.Deleted {
+				menus[menu.ID] = menu
+			}
+		}
+	}
+	return menus, nil
 }
 
 func toFloat(v interface{}) float64 {
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Every write to a menu item moves the item to its next version, only while
+// it is still at the version the write read, and records the changed fields
+// in menu_version. Transactions keep the version of each item they sold.
+
+// menuWriteAttempts is how often a write is retried when another write moved
+// the item to a new version first
+const menuWriteAttempts = 3
+
+// errMenuConflict reports a write based on a version of a menu item that is
+// no longer current
+var errMenuConflict = errors.New("menu item was changed by someone else; reload it and try again")
+
+// priceScheduleClaimTimeout is how long a claimed price schedule may stay
+// applying before another run takes it over
+const priceScheduleClaimTimeout = 5 * time.Minute
+
+// Fields left out of version records: bookkeeping, and inline image data
+// that would make every record as large as the image
+var unversionedMenuFields = map[string]bool{
+	"updatedAt": true, "version": true, "imageData": true, "id": true, "_id": true, "createdAt": true,
+}
+
+// GetMenuHistory lists the versions of a menu item, newest first
+func (h *MenuHandler) GetMenuHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	versions := []models.MenuVersion{}
+	for _, doc := range fetchDocuments(h.dbClient, "menu_version", map[string]interface{}{"menu_id": id}, nil, 5) {
+		var v models.MenuVersion
+		data, err := json.Marshal(doc)
+		if err != nil || json.Unmarshal(data, &v) != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+
+	return c.JSON(fiber.Map{"menu_id": id, "versions": versions, "count": len(versions)})
+}
+
+// SchedulePrice sets a new price for a menu item from a future moment
+func (h *MenuHandler) SchedulePrice(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req models.SchedulePriceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Price <= 0 {
+		return c.Status(422).JSON(fiber.Map{"error": "price must be greater than 0"})
+	}
+	effectiveAt, err := time.Parse(time.RFC3339, req.EffectiveAt)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "effective_at must be an RFC3339 time"})
+	}
+	if !effectiveAt.After(time.Now()) {
+		return c.Status(422).JSON(fiber.Map{"error": "effective_at must be in the future; use PUT /menu/:id to change the price now"})
+	}
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	menu, ok := menus[id]
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+	for _, v := range menu.Variants {
+		if req.Price+v.PriceDelta <= 0 {
+			return c.Status(422).JSON(fiber.Map{"error": fmt.Sprintf("variant %s would cost %d; price must stay greater than 0", v.Name, req.Price+v.PriceDelta)})
+		}
+	}
+
+	schedule := models.MenuPriceSchedule{
+		ID:          uuid.New().String(),
+		MenuID:      id,
+		Price:       req.Price,
+		EffectiveAt: effectiveAt.In(wib).Format(time.RFC3339),
+		Status:      models.PriceSchedulePending,
+		Actor:       req.Actor,
+		CreatedAt:   time.Now().In(wib).Format(time.RFC3339),
+	}
+	document, err := toDocument(schedule)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := h.dbClient.InsertDocument("menu_price_schedule", document); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(schedule)
+}
+
+// GetPriceSchedules lists the price schedules of a menu item, soonest first
+// (?status= to filter)
+func (h *MenuHandler) GetPriceSchedules(c *fiber.Ctx) error {
+	filter := map[string]interface{}{"menu_id": c.Params("id")}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	schedules := findPriceSchedules(h.dbClient, filter)
+	return c.JSON(fiber.Map{"schedules": schedules, "count": len(schedules)})
+}
+
+// CancelPriceSchedule cancels a price schedule that has not taken effect
+func (h *MenuHandler) CancelPriceSchedule(c *fiber.Ctx) error {
+	ok, err := updateDocumentIf(h.dbClient, "menu_price_schedule",
+		map[string]interface{}{"_id": c.Params("schedule_id"), "menu_id": c.Params("id"), "status": models.PriceSchedulePending},
+		map[string]interface{}{"status": models.PriceScheduleCancelled})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "No pending price schedule with this ID"})
+	}
+	return c.JSON(fiber.Map{"message": "Price schedule cancelled"})
+}
+
+// ApplyPriceSchedules applies the price schedules that are due immediately
+func (h *MenuHandler) ApplyPriceSchedules(c *fiber.Ctx) error {
+	applied, failed := h.applyDuePriceSchedules(time.Now())
+	return c.JSON(fiber.Map{"applied": applied, "failed": failed})
+}
+
+// priceScheduleInterval reads MENU_PRICE_SCHEDULE_INTERVAL (e.g. "1m"); "0"
+// disables the background job
+func priceScheduleInterval() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("MENU_PRICE_SCHEDULE_INTERVAL"))
+	if raw == "" {
+		return time.Minute
+	}
+	if raw == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		fmt.Printf("Warning: Invalid MENU_PRICE_SCHEDULE_INTERVAL %q, using 1m\n", raw)
+		return time.Minute
+	}
+	return d
+}
+
+// StartPriceScheduler periodically applies scheduled price changes that
+// have become due
+func (h *MenuHandler) StartPriceScheduler() {
+	interval := priceScheduleInterval()
+	if interval == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			applied, failed := h.applyDuePriceSchedules(time.Now())
+			if applied > 0 || failed > 0 {
+				fmt.Printf("Menu price schedules: %d applied, %d failed\n", applied, failed)
+			}
+		}
+	}()
+}
+
+// applyDuePriceSchedules sets the price of every pending schedule whose
+// time has come. A schedule is claimed before the price is written, so two
+// servers never apply the same one, and is marked applied once the price is
+// written. A claim left by a server that stopped halfway is taken over after
+// priceScheduleClaimTimeout.
+func (h *MenuHandler) applyDuePriceSchedules(now time.Time) (applied, failed int) {
+	due := findPriceSchedules(h.dbClient, map[string]interface{}{
+		"status":       map[string]interface{}{"$in": []interface{}{models.PriceSchedulePending, models.PriceScheduleApplying}},
+		"effective_at": map[string]interface{}{"$lte": now.In(wib).Format(time.RFC3339)},
+	})
+
+	stamp := now.In(wib).Format(time.RFC3339)
+	for _, s := range due {
+		claim := map[string]interface{}{"_id": s.ID, "status": s.Status}
+		if s.Status == models.PriceScheduleApplying {
+			claimedAt, err := time.Parse(time.RFC3339, s.ClaimedAt)
+			if err == nil && now.Sub(claimedAt) < priceScheduleClaimTimeout {
+				continue
+			}
+			claim["claimed_at"] = s.ClaimedAt
+		}
+		claimed, err := updateDocumentIf(h.dbClient, "menu_price_schedule", claim,
+			map[string]interface{}{"status": models.PriceScheduleApplying, "claimed_at": stamp})
+		if err != nil || !claimed {
+			continue
+		}
+
+		version, err := h.applyPriceSchedule(s, stamp)
+		if err != nil {
+			h.dbClient.UpdateDocument("menu_price_schedule", map[string]interface{}{"_id": s.ID},
+				map[string]interface{}{"status": models.PriceScheduleFailed, "error": err.Error()})
+			failed++
+			continue
+		}
+
+		if _, err := h.dbClient.UpdateDocument("menu_price_schedule", map[string]interface{}{"_id": s.ID},
+			map[string]interface{}{"status": models.PriceScheduleApplied, "applied_at": stamp, "version": version}); err != nil {
+			// Taken over later, which finds the version already written
+			fmt.Printf("Warning: Failed to mark price schedule %s applied: %v\n", s.ID, err)
+		}
+		applied++
+	}
+	if applied > 0 {
+		invalidateMenuCache(h.dbClient)
+	}
+	return applied, failed
+}
+
+// applyPriceSchedule writes the price of a claimed schedule and returns the
+// menu version it created. A schedule taken over from a stopped run may have
+// been written already; its version is returned without writing again.
+func (h *MenuHandler) applyPriceSchedule(s models.MenuPriceSchedule, stamp string) (int, error) {
+	if s.Status == models.PriceScheduleApplying {
+		written, err := findDocuments(h.dbClient, "menu_version", map[string]interface{}{"schedule_id": s.ID}, nil, 1)
+		if err != nil {
+			return 0, err
+		}
+		if len(written) > 0 {
+			return int(toFloat(written[0]["version"])), nil
+		}
+	}
+
+	version, ok, err := writeMenu(h.dbClient,
+		map[string]interface{}{"_id": s.MenuID, "deleted": map[string]interface{}{"$ne": true}},
+		map[string]interface{}{"price": s.Price, "updatedAt": stamp},
+		menuEdit{action: models.MenuActionScheduledPrice, actor: s.Actor, scheduleID: s.ID})
+	if err == nil && !ok {
+		err = fmt.Errorf("menu item not found")
+	}
+	return version, err
+}
+
+// insertMenu stores a new menu item as its first version
+func insertMenu(dbClient *config.AstraDBClient, menu *models.Menu, actor string) error {
+	menu.Version = 1
+	document := menuDocument(*menu)
+	document["_id"] = menu.ID
+	document["createdAt"] = menu.CreatedAt.Format(time.RFC3339)
+	document["version"] = menu.Version
+	if _, err := dbClient.InsertDocument("menu_makanan", document); err != nil {
+		return err
+	}
+	saveMenuVersion(dbClient, menu.ID, menu.Version, menuFieldChanges(nil, document),
+		menuEdit{action: models.MenuActionCreate, actor: actor})
+	return nil
+}
+
+// menuEdit says who made a menu write and why, for its version record.
+// With based set the write was made from version of the item, and fails
+// with errMenuConflict once the item has moved on.
+type menuEdit struct {
+	action     string
+	actor      string
+	scheduleID string
+	based      bool
+	version    int
+}
+
+// writeMenu updates the menu item matched by filter (which names its _id)
+// under the item's next version and records the changes. The item is read
+// from the Data API rather than the menu cache, for its current version and
+// the old values of the fields being written, and is written only while it
+// is still at that version; a write that is not based on a version is
+// retried when another one got in first.
+func writeMenu(dbClient *config.AstraDBClient, filter, update map[string]interface{}, edit menuEdit) (int, bool, error) {
+	id, _ := filter["_id"].(string)
+	for attempt := 0; attempt < menuWriteAttempts; attempt++ {
+		docs, err := findDocuments(dbClient, "menu_makanan", filter, nil, 1)
+		if err != nil || len(docs) == 0 {
+			return 0, false, err
+		}
+		before := docs[0]
+		current := int(toFloat(before["version"]))
+		if edit.based && current != edit.version {
+			return 0, false, errMenuConflict
+		}
+
+		match := make(map[string]interface{}, len(filter)+1)
+		for k, v := range filter {
+			match[k] = v
+		}
+		// Items written before versioning have no version yet
+		match["version"] = current
+		if current == 0 {
+			match["version"] = map[string]interface{}{"$exists": false}
+		}
+		update["version"] = current + 1
+		ok, err := updateDocumentIf(dbClient, "menu_makanan", match, update)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			saveMenuVersion(dbClient, id, current+1, menuFieldChanges(before, update), edit)
+			return current + 1, true, nil
+		}
+		if edit.based {
+			break
+		}
+	}
+	return 0, false, errMenuConflict
+}
+
+// loadMenuDocument reads a menu item that is not deleted from the Data API,
+// bypassing the menu cache, for writes that build on its current values
+func loadMenuDocument(dbClient *config.AstraDBClient, id string) (models.Menu, bool, error) {
+	docs, err := findDocuments(dbClient, "menu_makanan", map[string]interface{}{"_id": id, "deleted": map[string]interface{}{"$ne": true}}, nil, 1)
+	if err != nil || len(docs) == 0 {
+		return models.Menu{}, false, err
+	}
+	menu := menuFromMap(parseRowToMap(docs[0]))
+	if menu.ID == "" {
+		menu.ID = id
+	}
+	return menu, true, nil
+}
+
+// saveMenuVersion records a version. A failure is logged rather than failing
+// the write that has already happened.
+func saveMenuVersion(dbClient *config.AstraDBClient, id string, version int, changes map[string]models.FieldChange, edit menuEdit) {
+	record := models.MenuVersion{
+		ID:         id + ":" + strconv.Itoa(version),
+		MenuID:     id,
+		Version:    version,
+		Action:     edit.action,
+		Actor:      edit.actor,
+		At:         time.Now().In(wib).Format(time.RFC3339),
+		Changes:    changes,
+		ScheduleID: edit.scheduleID,
+	}
+	document, err := toDocument(record)
+	if err == nil {
+		_, err = dbClient.InsertDocument("menu_version", document)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to record version %d of menu %s: %v\n", version, id, err)
+	}
+}
+
+// menuFieldChanges lists the fields of update whose value differs from
+// before. Values are compared in their JSON form, the way they are stored.
+func menuFieldChanges(before, update map[string]interface{}) map[string]models.FieldChange {
+	changes := make(map[string]models.FieldChange)
+	for field, value := range update {
+		if unversionedMenuFields[field] {
+			continue
+		}
+		old := jsonValue(before[field])
+		updated := jsonValue(value)
+		if !reflect.DeepEqual(old, updated) {
+			changes[field] = models.FieldChange{Old: old, New: updated}
+		}
+	}
+	return changes
+}
+
+// jsonValue converts a value to what it reads back as from JSON, so typed
+// and decoded values compare equal. Empty values become nil.
+func jsonValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	json.Unmarshal(data, &out)
+	switch t := out.(type) {
+	case string:
+		if t == "" {
+			return nil
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			return nil
+		}
+	}
+	return out
+}
+
+// stampMenuVersions records on each transaction item the menu ID and the
+// version it was sold at. Items sent without menu_id are matched by name
+// when exactly one menu item has that name.
+func stampMenuVersions(dbClient *config.AstraDBClient, trx *models.Transaction) {
+	menus, err := loadMenus(dbClient)
+	if err != nil {
+		return
+	}
+	byName := make(map[string]string)
+	for id, menu := range menus {
+		name := strings.ToLower(strings.TrimSpace(menu.Name))
+		if _, taken := byName[name]; taken {
+			byName[name] = "" // ambiguous
+			continue
+		}
+		byName[name] = id
+	}
+
+	for i := range trx.Items {
+		item := &trx.Items[i]
+		if item.MenuID == "" {
+			item.MenuID = byName[strings.ToLower(strings.TrimSpace(item.MenuName))]
+		}
+		if menu, ok := menus[item.MenuID]; ok {
+			item.MenuVersion = menu.Version
+		}
+	}
+}
+
+// findPriceSchedules queries menu_price_schedule, soonest first
+func findPriceSchedules(dbClient *config.AstraDBClient, filter map[string]interface{}) []models.MenuPriceSchedule {
+	schedules := []models.MenuPriceSchedule{}
+	for _, doc := range fetchDocuments(dbClient, "menu_price_schedule", filter, nil, 5) {
+		var s models.MenuPriceSchedule
+		data, err := json.Marshal(doc)
+		if err != nil || json.Unmarshal(data, &s) != nil {
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].EffectiveAt < schedules[j].EffectiveAt
+	})
+	return schedules
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+)
+
+// versionRecords returns the version records of a menu item keyed by version
+func versionRecords(db *fakeDB, menuID string) map[float64]map[string]interface{} {
+	records := map[float64]map[string]interface{}{}
+	for _, doc := range db.find("menu_version", map[string]interface{}{"menu_id": menuID}) {
+		records[doc["version"].(float64)] = doc
+	}
+	return records
+}
+
+func TestUpdateMenuRecordsVersions(t *testing.T) {
+	db, client, app := menuWriteApp(t)
+	db.insert("menu_makanan",
+		map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "VERSIONTEST", "kategori": "Minuman", "price": 5000},
+		map[string]interface{}{"_id": "M2", "id": "M2", "name": "Es Jeruk", "kemitraan": "VERSIONTEST", "kategori": "Minuman", "price": 6000, "version": 4},
+	)
+	update := func(id string, price models.Money, version int) (int, map[string]interface{}) {
+		return do(t, app, "PUT", "/menu/"+id, models.MenuRequest{Name: "Es", Kemitraan: "VERSIONTEST", Kategori: "Minuman", Price: price, Version: version})
+	}
+
+	// An item from before versioning gets version 1
+	if status, body := update("M1", 5500, 0); status != 200 || body["version"] != 1.0 {
+		t.Fatalf("update: status %d %v, want version 1", status, body)
+	}
+
+	// Old values come from the database, not from the cached menu
+	if _, err := loadMenus(client); err != nil {
+		t.Fatal(err)
+	}
+	db.update("menu_makanan", map[string]interface{}{
+		"filter": map[string]interface{}{"_id": "M2"},
+		"update": map[string]interface{}{"$set": map[string]interface{}{"price": 6500}},
+	})
+	if status, body := update("M2", 7000, 4); status != 200 || body["version"] != 5.0 {
+		t.Fatalf("update: status %d %v, want version 5", status, body)
+	}
+	record, ok := versionRecords(db, "M2")[5]
+	if !ok {
+		t.Fatal("no record of version 5")
+	}
+	price := record["changes"].(map[string]interface{})["price"].(map[string]interface{})
+	if price["old"] != 6500.0 || price["new"] != 7000.0 {
+		t.Errorf("price change %v, want 6500 -> 7000", price)
+	}
+
+	// An edit of an older version is refused
+	if status, body := update("M2", 8000, 4); status != 409 {
+		t.Errorf("stale update: status %d %v, want 409", status, body)
+	}
+	if docs := db.find("menu_makanan", map[string]interface{}{"_id": "M2"}); docs[0]["price"] != 7000.0 || docs[0]["version"] != 5.0 {
+		t.Errorf("stale update wrote %v", docs[0])
+	}
+}
+
+func TestWriteMenuChecksTheVersion(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.insert("menu_makanan", map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "price": 5000, "version": 2})
+	filter := map[string]interface{}{"_id": "M1"}
+
+	// Another write lands between the read and the write of the first attempt
+	raced := false
+	db.intercept = func(collection, command string, args map[string]interface{}) string {
+		if collection == "menu_makanan" && command == "findOneAndUpdate" && !raced {
+			raced = true
+			db.collections["menu_makanan"][0]["version"] = 3.0
+			db.collections["menu_makanan"][0]["name"] = "Es Teh Manis"
+		}
+		return ""
+	}
+	version, ok, err := writeMenu(client, filter, map[string]interface{}{"price": 5500}, menuEdit{action: models.MenuActionUpdate})
+	if err != nil || !ok || version != 4 {
+		t.Fatalf("retried write: version %d, %v, %v, want version 4", version, ok, err)
+	}
+	if doc := db.find("menu_makanan", filter)[0]; doc["price"] != 5500.0 || doc["name"] != "Es Teh Manis" {
+		t.Errorf("item %v, want both writes kept", doc)
+	}
+	if _, ok := versionRecords(db, "M1")[4]; !ok {
+		t.Error("no record of the retried write")
+	}
+
+	// A write based on a version does not retry
+	db.intercept = nil
+	if _, _, err := writeMenu(client, filter, map[string]interface{}{"price": 6000}, menuEdit{action: models.MenuActionUpdate, based: true, version: 3}); err != errMenuConflict {
+		t.Errorf("write based on version 3 of version 4: %v, want errMenuConflict", err)
+	}
+	if doc := db.find("menu_makanan", filter)[0]; doc["price"] != 5500.0 {
+		t.Errorf("conflicting write stored price %v", doc["price"])
+	}
+}
+
+func TestApplyDuePriceSchedules(t *testing.T) {
+	db, client := newFakeDB(t)
+	h := NewMenuHandler(client, nil)
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, wib)
+	stamp := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+	db.insert("menu_makanan",
+		map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "price": 5000, "version": 1},
+		map[string]interface{}{"_id": "M2", "id": "M2", "name": "Es Jeruk", "price": 6000, "version": 1, "deleted": true},
+		map[string]interface{}{"_id": "M3", "id": "M3", "name": "Kopi", "price": 12000, "version": 3},
+	)
+	db.insert("menu_price_schedule",
+		models.MenuPriceSchedule{ID: "S1", MenuID: "M1", Price: 5500, EffectiveAt: stamp(-time.Minute), Status: models.PriceSchedulePending},
+		models.MenuPriceSchedule{ID: "S2", MenuID: "M2", Price: 6500, EffectiveAt: stamp(-time.Minute), Status: models.PriceSchedulePending},
+		models.MenuPriceSchedule{ID: "S3", MenuID: "M1", Price: 9000, EffectiveAt: stamp(time.Hour), Status: models.PriceSchedulePending},
+		// Written by a run that stopped before marking it applied
+		models.MenuPriceSchedule{ID: "S4", MenuID: "M3", Price: 13000, EffectiveAt: stamp(-time.Hour), Status: models.PriceScheduleApplying, ClaimedAt: stamp(-time.Hour)},
+		// Still being applied by another run
+		models.MenuPriceSchedule{ID: "S5", MenuID: "M3", Price: 14000, EffectiveAt: stamp(-time.Minute), Status: models.PriceScheduleApplying, ClaimedAt: stamp(-time.Minute)},
+	)
+	db.insert("menu_version", models.MenuVersion{ID: "M3:3", MenuID: "M3", Version: 3, Action: models.MenuActionScheduledPrice, ScheduleID: "S4"})
+
+	status := func(id string) map[string]interface{} {
+		return db.find("menu_price_schedule", map[string]interface{}{"_id": id})[0]
+	}
+
+	// The claim is kept while the price write fails
+	db.failing["menu_makanan findOneAndUpdate"] = "SERVER_UNHANDLED_ERROR"
+	if applied, failed := h.applyDuePriceSchedules(now); applied != 1 || failed != 2 {
+		t.Fatalf("failing write: applied %d, failed %d, want S4 applied, S1 and S2 failed", applied, failed)
+	}
+	if s := status("S1"); s["status"] != models.PriceScheduleFailed || s["error"] == "" {
+		t.Errorf("S1 %v, want failed with the error", s)
+	}
+	if s := status("S4"); s["status"] != models.PriceScheduleApplied || s["version"] != 3.0 {
+		t.Errorf("S4 %v, want applied as version 3 without writing again", s)
+	}
+	if s := status("S5"); s["status"] != models.PriceScheduleApplying {
+		t.Errorf("S5 %v, want left to the run that claimed it", s)
+	}
+	if s := status("S2"); s["status"] != models.PriceScheduleFailed || s["error"] != "menu item not found" {
+		t.Errorf("S2 %v, want failed for the deleted item", s)
+	}
+
+	db.failing = map[string]string{}
+	db.update("menu_price_schedule", map[string]interface{}{
+		"filter": map[string]interface{}{"_id": "S1"},
+		"update": map[string]interface{}{"$set": map[string]interface{}{"status": models.PriceSchedulePending}},
+	})
+	if applied, failed := h.applyDuePriceSchedules(now); applied != 1 || failed != 0 {
+		t.Fatalf("applied %d, failed %d, want S1 applied", applied, failed)
+	}
+	if s := status("S1"); s["status"] != models.PriceScheduleApplied || s["version"] != 2.0 {
+		t.Errorf("S1 %v, want applied as version 2", s)
+	}
+	if doc := db.find("menu_makanan", map[string]interface{}{"_id": "M1"})[0]; doc["price"] != 5500.0 || doc["version"] != 2.0 {
+		t.Errorf("M1 %v, want price 5500 at version 2", doc)
+	}
+	if record := versionRecords(db, "M1")[2]; record == nil || record["schedule_id"] != "S1" {
+		t.Errorf("version record %v, want one for S1", record)
+	}
+	if s := status("S3"); s["status"] != models.PriceSchedulePending {
+		t.Errorf("S3 %v, want pending until it is due", s)
+	}
+}
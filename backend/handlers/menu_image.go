@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // registered for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"sagawa_pos_backend/blobstore"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Menu images are resized to a full and a thumbnail size, re-encoded as JPEG
+// and stored under the hash of the result, so a URL always points at the
+// same bytes and can be cached forever.
+const (
+	menuImageFullSize  = 1024 // longest edge in pixels
+	menuImageThumbSize = 240
+	menuImageQuality   = 85
+	maxMenuImageBytes  = 8 << 20
+	maxMenuImagePixels = 40_000_000 // guards against decompression bombs
+)
+
+// imageError is an image rejected because of its content
+type imageError struct {
+	msg string
+}
+
+func (e *imageError) Error() string {
+	return e.msg
+}
+
+// menuImageFile is one encoded size of a menu image
+type menuImageFile struct {
+	key           string
+	data          []byte
+	width, height int
+}
+
+// UploadMenuImage stores the image of a menu item from a multipart upload
+// (field "image") and points the item at it
+func (h *MenuHandler) UploadMenuImage(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, ok := menus[id]; !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "image file is required"})
+	}
+	if header.Size > maxMenuImageBytes {
+		return c.Status(413).JSON(fiber.Map{"error": fmt.Sprintf("image is larger than %d MB", maxMenuImageBytes>>20)})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxMenuImageBytes))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	img, err := storeMenuImage(h.images, data)
+	if err != nil {
+		return imageErrorResponse(c, err)
+	}
+
+	_, ok, err := writeMenu(h.dbClient,
+		map[string]interface{}{"_id": id, "deleted": map[string]interface{}{"$ne": true}},
+		menuImageUpdate(img),
+		menuEdit{action: models.MenuActionImage, actor: c.FormValue("actor")})
+	invalidateMenuCache(h.dbClient)
+	if err == errMenuConflict {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+
+	return c.JSON(fiber.Map{"id": id, "image": img})
+}
+
+// ServeImage serves a stored image. Names are content hashes, so responses
+// may be cached for good.
+func (h *MenuHandler) ServeImage(c *fiber.Ctx) error {
+	name := c.Params("name")
+	etag := `"` + name + `"`
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	data, contentType, err := h.images.Get(name)
+	if err == blobstore.ErrNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Image not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderETag, etag)
+	if contentType != "" {
+		c.Set(fiber.HeaderContentType, contentType)
+	}
+	return c.Send(data)
+}
+
+// MigrateMenuImages moves the inline imageData of menu items into the image
+// store. ?dry_run=true only checks that every image can be decoded.
+func (h *MenuHandler) MigrateMenuImages(c *fiber.Ctx) error {
+	dryRun := c.Query("dry_run") == "true"
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	ids := make([]string, 0, len(menus))
+	for id, menu := range menus {
+		if menu.ImageData != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	result := models.ImageMigration{DryRun: dryRun, Failed: map[string]string{}}
+	if !dryRun {
+		defer invalidateMenuCache(h.dbClient)
+	}
+	for _, id := range ids {
+		data, err := decodeImageData(menus[id].ImageData)
+		if err != nil {
+			result.Failed[id] = err.Error()
+			continue
+		}
+		if dryRun {
+			if _, _, err := encodeMenuImage(data); err != nil {
+				result.Failed[id] = err.Error()
+				continue
+			}
+			result.Migrated++
+			continue
+		}
+
+		img, err := storeMenuImage(h.images, data)
+		if err != nil {
+			result.Failed[id] = err.Error()
+			continue
+		}
+		_, ok, err := writeMenu(h.dbClient, map[string]interface{}{"_id": id},
+			menuImageUpdate(img), menuEdit{action: models.MenuActionImage})
+		if err != nil {
+			result.Failed[id] = err.Error()
+			continue
+		}
+		if !ok {
+			result.Failed[id] = "menu item not found"
+			continue
+		}
+		result.Migrated++
+	}
+
+	return c.JSON(result)
+}
+
+// storeRequestImage moves the base64 imageData of a menu write into the
+// image store
+func (h *MenuHandler) storeRequestImage(menu *models.Menu) error {
+	if menu.ImageData == "" {
+		return nil
+	}
+	data, err := decodeImageData(menu.ImageData)
+	if err != nil {
+		return err
+	}
+	img, err := storeMenuImage(h.images, data)
+	if err != nil {
+		return err
+	}
+	menu.ImageID = img.ID
+	menu.ImageURL = img.URL
+	menu.ImageThumbURL = img.ThumbURL
+	menu.ImageData = ""
+	return nil
+}
+
+// storeMenuImage resizes an uploaded image and stores both sizes
+func storeMenuImage(store blobstore.Store, data []byte) (*models.MenuImage, error) {
+	full, thumb, err := encodeMenuImage(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range []menuImageFile{full, thumb} {
+		if err := store.Put(f.key, "image/jpeg", f.data); err != nil {
+			return nil, fmt.Errorf("failed to store image: %v", err)
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return &models.MenuImage{
+		ID:          hex.EncodeToString(sum[:16]),
+		URL:         imageURL(full.key),
+		ThumbURL:    imageURL(thumb.key),
+		Width:       full.width,
+		Height:      full.height,
+		ThumbWidth:  thumb.width,
+		ThumbHeight: thumb.height,
+	}, nil
+}
+
+// encodeMenuImage decodes a JPEG, PNG or GIF and returns its full and
+// thumbnail sizes
+func encodeMenuImage(data []byte) (full, thumb menuImageFile, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return full, thumb, &imageError{"unsupported image (expected JPEG, PNG or GIF)"}
+	}
+	if cfg.Width*cfg.Height > maxMenuImagePixels {
+		return full, thumb, &imageError{fmt.Sprintf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)}
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return full, thumb, &imageError{fmt.Sprintf("failed to decode image: %v", err)}
+	}
+
+	// Flatten transparency onto white; JPEG has no alpha
+	flat := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, src.Bounds().Min, draw.Over)
+
+	if full, err = encodeImageSize(flat, menuImageFullSize); err != nil {
+		return full, thumb, err
+	}
+	thumb, err = encodeImageSize(flat, menuImageThumbSize)
+	return full, thumb, err
+}
+
+// encodeImageSize scales an image down so its longest edge fits in size and
+// encodes it as JPEG. Smaller images are not scaled up.
+func encodeImageSize(src *image.RGBA, size int) (menuImageFile, error) {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, shrinkImage(src, w, h), &jpeg.Options{Quality: menuImageQuality}); err != nil {
+		return menuImageFile{}, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return menuImageFile{
+		key:    hex.EncodeToString(sum[:16]) + ".jpg",
+		data:   buf.Bytes(),
+		width:  w,
+		height: h,
+	}, nil
+}
+
+// shrinkImage scales src down to w x h by averaging the source pixels that
+// fall into each destination pixel (a box filter)
+func shrinkImage(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw == w && sh == h {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// decodeImageData reads base64 image data, with or without a data: URL prefix
+func decodeImageData(s string) ([]byte, error) {
+	if i := strings.Index(s, ";base64,"); strings.HasPrefix(s, "data:") && i >= 0 {
+		s = s[i+len(";base64,"):]
+	}
+	s = strings.TrimSpace(s)
+	if data, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, &imageError{"imageData is not valid base64"}
+	}
+	return data, nil
+}
+
+// menuImageUpdate is the menu_makanan update pointing an item at an image;
+// inline imageData is dropped
+func menuImageUpdate(img *models.MenuImage) map[string]interface{} {
+	return map[string]interface{}{
+		"imageId":       img.ID,
+		"imageUrl":      img.URL,
+		"imageThumbUrl": img.ThumbURL,
+		"imageData":     "",
+		"updatedAt":     time.Now().In(wib).Format(time.RFC3339),
+	}
+}
+
+// imageURL is the public URL of a stored image; IMAGE_BASE_URL points it at
+// a CDN in front of the server
+func imageURL(key string) string {
+	base := strings.TrimRight(os.Getenv("IMAGE_BASE_URL"), "/")
+	if base == "" {
+		base = "/api/v1/images"
+	}
+	return base + "/" + key
+}
@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sagawa_pos_backend/spreadsheet"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Menu spreadsheets have one item per row under a header row. Export writes
+// every column; an import needs name, kemitraan, kategori and price, and a
+// column left out keeps the item's current value. Options and schedules are
+// JSON in their cells, as the API takes them.
+var menuSheetColumns = []string{
+	"id", "kemitraan", "subBrand", "kategori", "name", "description", "price",
+	"imageUrl", "variants", "modifierGroups", "schedule",
+}
+
+// Other header names accepted on import, in the form menuSheetColumn compares
+var menuSheetAliases = map[string]string{
+	"category":  "kategori",
+	"nama":      "name",
+	"harga":     "price",
+	"deskripsi": "description",
+}
+
+const (
+	maxMenuImportBytes = 5 << 20
+	maxMenuImportRows  = 2000
+)
+
+// Prices written with thousands separators, e.g. 25.000 or Rp 25,000
+var groupedPrice = regexp.MustCompile(`^\d{1,3}([.,]\d{3})+$`)
+
+// menuImportItem is a row that passed validation, with the item it becomes
+type menuImportItem struct {
+	row      int // index in MenuImport.Rows
+	menu     models.Menu
+	existing *models.Menu // nil for a new item
+}
+
+// ExportMenu downloads the menu as a spreadsheet (?format=csv or xlsx) in
+// the format ImportMenu reads; ?kemitraan= and ?subBrand= narrow it down
+func (h *MenuHandler) ExportMenu(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", spreadsheet.FormatCSV))
+	if format != spreadsheet.FormatCSV && format != spreadsheet.FormatXLSX {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be csv or xlsx"})
+	}
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	qKemitraan, qSubBrand := menuKey(c.Query("kemitraan")), menuKey(c.Query("subBrand"))
+	items := make([]models.Menu, 0, len(menus))
+	for _, menu := range menus {
+		switch {
+		case qSubBrand != "" && menuKey(menu.SubBrand) != qSubBrand:
+			continue
+		case qSubBrand == "" && qKemitraan != "" && menuKey(menu.Kemitraan) != qKemitraan:
+			continue
+		}
+		items = append(items, menu)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		for _, pair := range [][2]string{{a.Kemitraan, b.Kemitraan}, {a.SubBrand, b.SubBrand}, {a.Kategori, b.Kategori}, {a.Name, b.Name}} {
+			if x, y := strings.ToLower(pair[0]), strings.ToLower(pair[1]); x != y {
+				return x < y
+			}
+		}
+		return a.ID < b.ID
+	})
+
+	rows := [][]string{menuSheetColumns}
+	for _, menu := range items {
+		rows = append(rows, menuSheetRow(menu))
+	}
+
+	name := "menu"
+	for _, part := range []string{c.Query("kemitraan"), c.Query("subBrand")} {
+		if code := menuKey(part); code != "" {
+			name += "-" + code
+		}
+	}
+	name += "-" + time.Now().In(wib).Format("20060102") + "." + format
+
+	c.Set(fiber.HeaderContentType, spreadsheet.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	return spreadsheet.Write(c, format, "Menu", rows)
+}
+
+// ImportMenu creates and updates menu items from a spreadsheet (multipart
+// field "file", CSV or XLSX). Rows with an id update that item; other rows
+// update the item with the same name in the same kemitraan and subBrand, or
+// create one. Every row is checked like a single menu write. By default
+// (dry_run=true) only the plan is returned; with dry_run=false it is applied,
+// provided no row has errors.
+func (h *MenuHandler) ImportMenu(c *fiber.Ctx) error {
+	dryRun := c.FormValue("dry_run", c.Query("dry_run")) != "false"
+	actor := c.FormValue("actor", c.Query("actor"))
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Menu file is required"})
+	}
+	if fileHeader.Size > maxMenuImportBytes {
+		return c.Status(413).JSON(fiber.Map{"error": fmt.Sprintf("Menu file is larger than %d MB", maxMenuImportBytes>>20)})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxMenuImportBytes))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	rows, err := spreadsheet.Read(data)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	categories, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result, items, err := planMenuImport(rows, menus, categories)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	result.DryRun = dryRun
+	if dryRun {
+		return c.JSON(result)
+	}
+	if result.Errors > 0 {
+		return c.Status(422).JSON(fiber.Map{
+			"error":  fmt.Sprintf("%d rows have errors; nothing was imported", result.Errors),
+			"result": result,
+		})
+	}
+
+	defer invalidateMenuCache(h.dbClient)
+	for _, item := range items {
+		row := &result.Rows[item.row]
+		if err := applyMenuImport(h.dbClient, categories, item, actor); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":  fmt.Sprintf("Line %d: %v; rows before it were imported", row.Line, err),
+				"result": result,
+			})
+		}
+		row.ID = item.menu.ID
+		result.Applied++
+	}
+
+	return c.JSON(result)
+}
+
+// planMenuImport decides what to do with every row and validates it. Rows
+// are checked in order against the menu as earlier rows would leave it, so
+// a file can start a new subBrand.
+func planMenuImport(rows [][]string, menus map[string]models.Menu, categories *categoryIndex) (models.MenuImport, []menuImportItem, error) {
+	result := models.MenuImport{Rows: []models.MenuImportRow{}}
+	if len(rows) < 2 {
+		return result, nil, fmt.Errorf("Menu file has no rows")
+	}
+	if len(rows)-1 > maxMenuImportRows {
+		return result, nil, fmt.Errorf("Menu file has more than %d rows", maxMenuImportRows)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		if name == "" {
+			continue
+		}
+		column, ok := menuSheetColumn(name)
+		if !ok {
+			return result, nil, fmt.Errorf("Unknown column %q (expected %s)", name, strings.Join(menuSheetColumns, ", "))
+		}
+		if _, dup := columns[column]; dup {
+			return result, nil, fmt.Errorf("Column %s appears twice", column)
+		}
+		columns[column] = i
+	}
+	for _, required := range []string{"name", "kemitraan", "kategori", "price"} {
+		if _, ok := columns[required]; !ok {
+			return result, nil, fmt.Errorf("Menu file needs a %s column", required)
+		}
+	}
+
+	// Existing items by name within their kemitraan and subBrand
+	byName := make(map[string][]string)
+	for id, menu := range menus {
+		key := menuImportKey(menu.Kemitraan, menu.SubBrand, menu.Name)
+		byName[key] = append(byName[key], id)
+	}
+
+	working := make(map[string]models.Menu, len(menus))
+	for id, menu := range menus {
+		working[id] = menu
+	}
+	seen := make(map[string]int) // item ID or name key -> line
+
+	var items []menuImportItem
+	for i, record := range rows[1:] {
+		if blankRow(record) {
+			continue
+		}
+		line := i + 2
+		cell := func(column string) (string, bool) {
+			idx, ok := columns[column]
+			if !ok {
+				return "", false
+			}
+			if idx >= len(record) {
+				return "", true
+			}
+			return record[idx], true
+		}
+
+		id, _ := cell("id")
+		name, _ := cell("name")
+		kemitraan, _ := cell("kemitraan")
+		subBrand, _ := cell("subBrand")
+		row := models.MenuImportRow{Line: line, Name: name, Kemitraan: kemitraan, SubBrand: subBrand}
+		fail := func(format string, args ...interface{}) {
+			row.Errors = append(row.Errors, fmt.Sprintf(format, args...))
+		}
+
+		var existing *models.Menu
+		key := menuImportKey(kemitraan, subBrand, name)
+		if id != "" {
+			if menu, ok := menus[id]; ok {
+				existing = &menu
+			} else {
+				fail("unknown id %s", id)
+			}
+		} else if ids := byName[key]; len(ids) == 1 {
+			menu := menus[ids[0]]
+			existing = &menu
+		} else if len(ids) > 1 {
+			fail("%d items are named %s; add the id column to pick one", len(ids), name)
+		}
+		if existing != nil {
+			id = existing.ID
+			key = id
+			row.ID = id
+		}
+		if prev, ok := seen[key]; ok {
+			fail("same item as line %d", prev)
+		}
+		seen[key] = line
+
+		req := models.MenuRequest{NewKategori: true}
+		if existing != nil {
+			req = menuRequestFrom(*existing)
+		}
+		req.Name, req.Kemitraan = name, kemitraan
+		if v, ok := cell("subBrand"); ok {
+			req.SubBrand = v
+		}
+		if v, ok := cell("kategori"); ok {
+			req.Kategori = v
+		}
+		if v, ok := cell("description"); ok {
+			req.Description = v
+		}
+		if v, ok := cell("imageUrl"); ok && (existing == nil || v != existing.ImageURL) {
+			req.ImageURL, req.ImageID = v, ""
+		}
+		if v, _ := cell("price"); v == "" {
+			fail("price is required")
+		} else if price, err := parseImportPrice(v); err != nil {
+			fail("invalid price %q", v)
+		} else {
+			req.Price = price
+		}
+		for column, dst := range map[string]interface{}{"variants": &req.Variants, "modifierGroups": &req.ModifierGroups, "schedule": &req.Schedule} {
+			v, ok := cell(column)
+			if !ok {
+				continue
+			}
+			if v == "" {
+				v = "null"
+			}
+			if err := json.Unmarshal([]byte(v), dst); err != nil {
+				fail("%s is not valid JSON: %v", column, err)
+			}
+		}
+		if len(row.Errors) == 0 {
+			if err := validateMenuRequest(&req, id, working, categories); err != nil {
+				fail("%v", err)
+			}
+		}
+
+		if len(row.Errors) > 0 {
+			row.Action = models.ImportError
+			result.Errors++
+			result.Rows = append(result.Rows, row)
+			continue
+		}
+
+		menu := menuFromRequest(id, req)
+		if catID, ok := categories.byName[categoryNameKey(req.Kemitraan, req.SubBrand, req.Kategori)]; ok {
+			menu.CategoryID = catID
+		}
+		row.Name, row.Kemitraan, row.SubBrand = menu.Name, menu.Kemitraan, menu.SubBrand
+		if existing == nil {
+			row.Action = models.ImportCreate
+			result.Create++
+			working[fmt.Sprintf("line:%d", line)] = menu
+		} else {
+			menu.CreatedAt = existing.CreatedAt
+			if menu.ImageURL == existing.ImageURL {
+				menu.ImageThumbURL = existing.ImageThumbURL
+			}
+			// The kategori shows the change; its category is linked on apply
+			row.Changes = menuFieldChanges(menuDocument(*existing), menuDocument(menu))
+			delete(row.Changes, "categoryId")
+			if len(row.Changes) == 0 {
+				row.Action = models.ImportSkip
+				result.Skip++
+				result.Rows = append(result.Rows, row)
+				continue
+			}
+			row.Action = models.ImportUpdate
+			result.Update++
+			working[id] = menu
+		}
+		result.Rows = append(result.Rows, row)
+		items = append(items, menuImportItem{row: len(result.Rows) - 1, menu: menu, existing: existing})
+	}
+
+	if len(result.Rows) == 0 {
+		return result, nil, fmt.Errorf("Menu file has no rows")
+	}
+	return result, items, nil
+}
+
+// applyMenuImport writes one planned row
+func applyMenuImport(dbClient *config.AstraDBClient, categories *categoryIndex, item menuImportItem, actor string) error {
+	menu := &item.menu
+	var err error
+	if menu.CategoryID, err = ensureCategory(dbClient, categories, menu.Kemitraan, menu.SubBrand, menu.Kategori); err != nil {
+		return err
+	}
+	now := time.Now().In(wib)
+	menu.UpdatedAt = now.Format(time.RFC3339)
+
+	if item.existing == nil {
+		menu.ID = uuid.New().String()
+		menu.CreatedAt = now
+		return insertMenu(dbClient, menu, actor)
+	}
+
+	var ok bool
+	// The row was planned against the existing item; a change made since
+	// then fails the row instead of being overwritten
+	menu.Version, ok, err = writeMenu(dbClient,
+		map[string]interface{}{"_id": menu.ID, "deleted": map[string]interface{}{"$ne": true}},
+		menuDocument(*menu),
+		menuEdit{action: models.MenuActionUpdate, actor: actor, based: true, version: item.existing.Version})
+	if err == nil && !ok {
+		err = fmt.Errorf("menu item %s was deleted", menu.ID)
+	}
+	return err
+}
+
+// menuSheetRow is the spreadsheet row of a menu item
+func menuSheetRow(menu models.Menu) []string {
+	jsonCell := func(v interface{}, empty bool) string {
+		if empty {
+			return ""
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	return []string{
+		menu.ID,
+		menu.Kemitraan,
+		menu.SubBrand,
+		menu.Kategori,
+		menu.Name,
+		menu.Description,
+		fmt.Sprint(int64(menu.Price)),
+		menu.ImageURL,
+		jsonCell(menu.Variants, len(menu.Variants) == 0),
+		jsonCell(menu.ModifierGroups, len(menu.ModifierGroups) == 0),
+		jsonCell(menu.Schedule, menu.Schedule == nil),
+	}
+}
+
+// menuSheetColumn maps a header cell to its column, ignoring case, spaces
+// and underscores
+func menuSheetColumn(header string) (string, bool) {
+	key := strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(header))
+	for _, column := range menuSheetColumns {
+		if strings.ToLower(column) == key {
+			return column, true
+		}
+	}
+	column, ok := menuSheetAliases[key]
+	return column, ok
+}
+
+// menuRequestFrom is the request that would write a menu item as it is
+func menuRequestFrom(menu models.Menu) models.MenuRequest {
+	return models.MenuRequest{
+		Name:           menu.Name,
+		Description:    menu.Description,
+		Kemitraan:      menu.Kemitraan,
+		SubBrand:       menu.SubBrand,
+		Kategori:       menu.Kategori,
+		Price:          menu.Price,
+		ImageURL:       menu.ImageURL,
+		ImageID:        menu.ImageID,
+		ImageData:      menu.ImageData,
+		NewKategori:    true,
+		Variants:       menu.Variants,
+		ModifierGroups: menu.ModifierGroups,
+		Schedule:       menu.Schedule,
+	}
+}
+
+func menuImportKey(kemitraan, subBrand, name string) string {
+	return menuKey(kemitraan) + ":" + menuKey(subBrand) + ":" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// parseImportPrice reads a price cell: 25000, 25000.00, 25.000, Rp 25,000
+func parseImportPrice(s string) (models.Money, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && strings.EqualFold(s[:2], "rp") {
+		s = strings.TrimSpace(s[2:])
+	}
+	if groupedPrice.MatchString(s) {
+		s = strings.NewReplacer(".", "", ",", "").Replace(s)
+	}
+	var price models.Money
+	err := json.Unmarshal([]byte(`"`+s+`"`), &price)
+	return price, err
+}
+
+func blankRow(record []string) bool {
+	for _, cell := range record {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestParseImportPrice(t *testing.T) {
+	tests := []struct {
+		in   string
+		want models.Money
+	}{
+		{"25000", 25000},
+		{"25000.00", 25000},
+		{"25.000", 25000},
+		{"25,000", 25000},
+		{"1.250.000", 1250000},
+		{"Rp 25.000", 25000},
+		{"rp25,000", 25000},
+		{"RP 7500", 7500},
+		{" 18000 ", 18000},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseImportPrice(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseImportPrice(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"dua puluh ribu", "25.000,00", "25.00.0", "12,5k"} {
+		if got, err := parseImportPrice(in); err == nil {
+			t.Errorf("parseImportPrice(%q) = %d, want an error", in, got)
+		}
+	}
+}
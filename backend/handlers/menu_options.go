@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+)
+
+// normalizeMenuOptions checks the variants and modifier groups of a menu
+// item, giving options without an ID one derived from their name
+func normalizeMenuOptions(req *models.MenuRequest) error {
+	seen := make(map[string]bool)
+	defaults := 0
+	for i := range req.Variants {
+		v := &req.Variants[i]
+		v.Name = strings.TrimSpace(v.Name)
+		if v.Name == "" {
+			return fmt.Errorf("every variant needs a name")
+		}
+		if v.ID == "" {
+			v.ID = menuKey(v.Name)
+		}
+		if seen["variant:"+v.ID] {
+			return fmt.Errorf("duplicate variant %s", v.ID)
+		}
+		seen["variant:"+v.ID] = true
+		if req.Price+v.PriceDelta <= 0 {
+			return fmt.Errorf("variant %s would cost %d; price must stay greater than 0", v.Name, req.Price+v.PriceDelta)
+		}
+		if v.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("at most one variant can be the default")
+	}
+
+	for i := range req.ModifierGroups {
+		g := &req.ModifierGroups[i]
+		g.Name = strings.TrimSpace(g.Name)
+		if g.Name == "" {
+			return fmt.Errorf("every modifier group needs a name")
+		}
+		if g.ID == "" {
+			g.ID = menuKey(g.Name)
+		}
+		if seen["group:"+g.ID] {
+			return fmt.Errorf("duplicate modifier group %s", g.ID)
+		}
+		seen["group:"+g.ID] = true
+
+		if len(g.Options) == 0 {
+			return fmt.Errorf("modifier group %s has no options", g.Name)
+		}
+		for j := range g.Options {
+			o := &g.Options[j]
+			o.Name = strings.TrimSpace(o.Name)
+			if o.Name == "" {
+				return fmt.Errorf("every option of %s needs a name", g.Name)
+			}
+			if o.ID == "" {
+				o.ID = menuKey(o.Name)
+			}
+			// Lines name options by ID alone, so IDs are unique per menu item
+			if seen["option:"+o.ID] {
+				return fmt.Errorf("duplicate modifier option %s", o.ID)
+			}
+			seen["option:"+o.ID] = true
+			if o.PriceDelta < 0 {
+				return fmt.Errorf("option %s cannot lower the price", o.Name)
+			}
+		}
+
+		if g.Required && g.Min == 0 {
+			g.Min = 1
+		}
+		switch {
+		case g.Min < 0 || g.Max < 0:
+			return fmt.Errorf("min and max of %s cannot be negative", g.Name)
+		case g.Max > 0 && g.Max < g.Min:
+			return fmt.Errorf("max of %s is below its min", g.Name)
+		case g.Min > len(g.Options):
+			return fmt.Errorf("min of %s is more than its %d options", g.Name, len(g.Options))
+		}
+		g.Required = g.Min > 0
+	}
+	return nil
+}
+
+// resolveOptions looks up the variant and modifier options chosen for a menu
+// item and returns them with the resulting unit price
+func resolveOptions(menu models.Menu, variantID string, modifierIDs []string) (*models.SelectedOption, []models.SelectedOption, models.Money, error) {
+	price := menu.Price
+
+	var variant *models.SelectedOption
+	if len(menu.Variants) > 0 {
+		for _, v := range menu.Variants {
+			if v.ID == variantID || (variantID == "" && v.Default) {
+				variant = &models.SelectedOption{ID: v.ID, Name: v.Name, PriceDelta: v.PriceDelta}
+				break
+			}
+		}
+		if variant == nil {
+			if variantID == "" {
+				return nil, nil, 0, fmt.Errorf("%s needs a variant", menu.Name)
+			}
+			return nil, nil, 0, fmt.Errorf("%s has no variant %s", menu.Name, variantID)
+		}
+		price += variant.PriceDelta
+	} else if variantID != "" {
+		return nil, nil, 0, fmt.Errorf("%s has no variants", menu.Name)
+	}
+
+	chosen := make(map[string]bool, len(modifierIDs))
+	for _, id := range modifierIDs {
+		if chosen[id] {
+			return nil, nil, 0, fmt.Errorf("option %s chosen twice for %s", id, menu.Name)
+		}
+		chosen[id] = true
+	}
+
+	var modifiers []models.SelectedOption
+	for _, g := range menu.ModifierGroups {
+		count := 0
+		for _, o := range g.Options {
+			if !chosen[o.ID] {
+				continue
+			}
+			delete(chosen, o.ID)
+			count++
+			modifiers = append(modifiers, models.SelectedOption{GroupID: g.ID, ID: o.ID, Name: o.Name, PriceDelta: o.PriceDelta})
+			price += o.PriceDelta
+		}
+		if count < g.Min {
+			return nil, nil, 0, fmt.Errorf("choose at least %d %s for %s", g.Min, g.Name, menu.Name)
+		}
+		if g.Max > 0 && count > g.Max {
+			return nil, nil, 0, fmt.Errorf("choose at most %d %s for %s", g.Max, g.Name, menu.Name)
+		}
+	}
+	for id := range chosen {
+		return nil, nil, 0, fmt.Errorf("%s has no option %s", menu.Name, id)
+	}
+
+	return variant, modifiers, price, nil
+}
+
+// optionsKey identifies a menu item with a particular choice of options, so
+// lines that differ only in options are kept apart
+func optionsKey(menuID, variantID string, modifierIDs []string) string {
+	ids := append([]string{}, modifierIDs...)
+	sort.Strings(ids)
+	return menuID + "|" + variantID + "|" + strings.Join(ids, ",")
+}
+
+// selectedIDs returns the variant and modifier IDs of selected options
+func selectedIDs(variant *models.SelectedOption, modifiers []models.SelectedOption) (string, []string) {
+	variantID := ""
+	if variant != nil {
+		variantID = variant.ID
+	}
+	ids := make([]string, 0, len(modifiers))
+	for _, m := range modifiers {
+		ids = append(ids, m.ID)
+	}
+	return variantID, ids
+}
+
+// hasMenuItems reports whether any transaction item names a menu item
+func hasMenuItems(items []models.TransactionItem) bool {
+	for _, item := range items {
+		if item.MenuID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTransactionOptions fills in the names and price deltas of the
+// options of transaction items and checks each item's unit price against
+// them. Every item of a menu item with variants or modifier groups is
+// checked, so a required group cannot be skipped by sending no options;
+// other items are left as sent. Reports whether a price was filled in.
+func resolveTransactionOptions(menus map[string]models.Menu, trx *models.Transaction) (bool, error) {
+	repriced := false
+	for i := range trx.Items {
+		item := &trx.Items[i]
+		hasOptions := item.Variant != nil || len(item.Modifiers) > 0
+		menu, ok := menus[item.MenuID]
+		if !ok {
+			if hasOptions {
+				return false, fmt.Errorf("Menu item not found: %s", item.MenuID)
+			}
+			continue
+		}
+		if !hasOptions && len(menu.Variants) == 0 && len(menu.ModifierGroups) == 0 {
+			continue
+		}
+
+		variantID, modifierIDs := selectedIDs(item.Variant, item.Modifiers)
+		variant, modifiers, price, err := resolveOptions(menu, variantID, modifierIDs)
+		if err != nil {
+			return false, err
+		}
+		if item.Price != 0 && item.Price != price {
+			return false, fmt.Errorf("Price of %s with its options is %d, got %d", menu.Name, price, item.Price)
+		}
+		if item.Price != price {
+			repriced = true
+		}
+		item.Variant = variant
+		item.Modifiers = modifiers
+		item.Price = price
+		item.Subtotal = price.Times(item.Qty)
+	}
+	return repriced, nil
+}
+
+// decodeMenuField reads a structured field (variants, modifier groups,
+// schedule) from a menu row, where it may be stored as JSON or as a string
+func decodeMenuField(v interface{}, out interface{}) {
+	var data []byte
+	switch t := v.(type) {
+	case nil:
+		return
+	case string:
+		data = []byte(t)
+	default:
+		var err error
+		if data, err = json.Marshal(t); err != nil {
+			return
+		}
+	}
+	json.Unmarshal(data, out)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestResolveTransactionOptionsChecksEveryItem(t *testing.T) {
+	menus := map[string]models.Menu{
+		"KOPI": {ID: "KOPI", Name: "Kopi Susu", Price: 15000,
+			Variants: []models.MenuVariant{{ID: "reg", Name: "Regular", Default: true}, {ID: "large", Name: "Large", PriceDelta: 3000}}},
+		"ROTI": {ID: "ROTI", Name: "Roti Bakar", Price: 12000,
+			ModifierGroups: []models.ModifierGroup{{ID: "rasa", Name: "Rasa", Required: true, Min: 1, Max: 1, Options: []models.ModifierOption{
+				{ID: "coklat", Name: "Coklat"}, {ID: "keju", Name: "Keju", PriceDelta: 2000},
+			}}}},
+		"TEH": {ID: "TEH", Name: "Es Teh", Price: 5000},
+	}
+	trx := func(items ...models.TransactionItem) *models.Transaction {
+		return &models.Transaction{Items: items}
+	}
+
+	// A required group is checked even when no options are sent
+	if _, err := resolveTransactionOptions(menus, trx(models.TransactionItem{MenuID: "ROTI", Qty: 1, Price: 12000})); err == nil {
+		t.Error("item without its required modifier accepted")
+	}
+	if _, err := resolveTransactionOptions(menus, trx(models.TransactionItem{MenuID: "ROTI", Qty: 1, Modifiers: []models.SelectedOption{{ID: "coklat"}, {ID: "keju"}}})); err == nil {
+		t.Error("item over the group's max accepted")
+	}
+
+	// Items priced as sent are kept; the default variant is filled in
+	sale := trx(
+		models.TransactionItem{MenuID: "KOPI", Qty: 2, Price: 15000, Subtotal: 30000},
+		models.TransactionItem{MenuID: "TEH", Qty: 1, Price: 5000, Subtotal: 5000},
+		models.TransactionItem{MenuName: "Kerupuk", Qty: 1, Price: 2000, Subtotal: 2000},
+	)
+	repriced, err := resolveTransactionOptions(menus, sale)
+	if err != nil || repriced {
+		t.Fatalf("priced sale: repriced %v, %v", repriced, err)
+	}
+	if v := sale.Items[0].Variant; v == nil || v.ID != "reg" {
+		t.Errorf("variant %v, want the default", v)
+	}
+
+	// A price left to the server is filled in and reported
+	sale = trx(models.TransactionItem{MenuID: "ROTI", Qty: 2, Modifiers: []models.SelectedOption{{ID: "keju"}}})
+	repriced, err = resolveTransactionOptions(menus, sale)
+	if err != nil || !repriced {
+		t.Fatalf("unpriced sale: repriced %v, %v", repriced, err)
+	}
+	if item := sale.Items[0]; item.Price != 14000 || item.Subtotal != 28000 || item.Modifiers[0].Name != "Keju" {
+		t.Errorf("item %+v, want Keju at 14000", item)
+	}
+
+	if _, err := resolveTransactionOptions(menus, trx(models.TransactionItem{MenuID: "KOPI", Qty: 1, Price: 15000, Variant: &models.SelectedOption{ID: "large"}})); err == nil {
+		t.Error("price without the variant's delta accepted")
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/events"
+	"sagawa_pos_backend/models"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Outlet overrides are read on every cart quote; they are cached briefly
+// and dropped from the cache when changed through this server
+const menuOverrideCacheTTL = 30 * time.Second
+
+type menuOverrideEntry struct {
+	overrides map[string]models.MenuOverride
+	expires   time.Time
+}
+
+var menuOverrideCache sync.Map // outlet ID -> menuOverrideEntry
+
+// GetMenuOverrides lists the availability and price overrides of an outlet
+func (h *OutletHandler) GetMenuOverrides(c *fiber.Ctx) error {
+	overrides, err := loadMenuOverrides(h.dbClient, c.Params("outlet_id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	list := make([]models.MenuOverride, 0, len(overrides))
+	for _, o := range overrides {
+		list = append(list, o)
+	}
+	return c.JSON(fiber.Map{"overrides": list, "count": len(list)})
+}
+
+// SetMenuAvailability marks a menu item available, sold out (until a time,
+// or for the rest of the day) or hidden at an outlet
+func (h *OutletHandler) SetMenuAvailability(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	menuID := c.Params("menu_id")
+
+	var req models.SetAvailabilityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	now := time.Now().In(wib)
+	update := map[string]interface{}{"hidden": false, "sold_out": false, "sold_out_until": ""}
+	switch req.Status {
+	case models.AvailabilityAvailable:
+	case models.AvailabilityHidden:
+		update["hidden"] = true
+	case models.AvailabilitySoldOutToday:
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, wib)
+		update["sold_out"] = true
+		update["sold_out_until"] = tomorrow.Format(time.RFC3339)
+	case models.AvailabilitySoldOut:
+		update["sold_out"] = true
+		if req.Until != "" {
+			until, err := time.Parse(time.RFC3339, req.Until)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "until must be an RFC3339 time"})
+			}
+			if !until.After(now) {
+				return c.Status(400).JSON(fiber.Map{"error": "until must be in the future"})
+			}
+			update["sold_out_until"] = until.In(wib).Format(time.RFC3339)
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "status must be available, sold_out, sold_out_today or hidden"})
+	}
+
+	return h.saveMenuOverride(c, outletID, menuID, req.Actor, update)
+}
+
+// SetMenuPrice sets the price of a menu item at an outlet; a null price
+// goes back to the menu price
+func (h *OutletHandler) SetMenuPrice(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	menuID := c.Params("menu_id")
+
+	var req models.SetMenuPriceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		return c.Status(422).JSON(fiber.Map{"error": "price must be greater than 0"})
+	}
+
+	return h.saveMenuOverride(c, outletID, menuID, req.Actor, map[string]interface{}{"price": req.Price})
+}
+
+// saveMenuOverride writes part of an outlet's override of a menu item and
+// tells the outlet's devices about it
+func (h *OutletHandler) saveMenuOverride(c *fiber.Ctx, outletID, menuID, actor string, update map[string]interface{}) error {
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	menu, ok := menus[menuID]
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+	if price, ok := update["price"].(*models.Money); ok && price != nil {
+		for _, v := range menu.Variants {
+			if *price+v.PriceDelta <= 0 {
+				return c.Status(422).JSON(fiber.Map{"error": fmt.Sprintf("variant %s would cost %d", v.Name, *price+v.PriceDelta)})
+			}
+		}
+	}
+
+	update["outlet_id"] = outletID
+	update["menu_id"] = menuID
+	update["updated_at"] = time.Now().In(wib).Format(time.RFC3339)
+	update["updated_by"] = actor
+
+	respBody, err := h.dbClient.UpsertDocument("menu_override", map[string]interface{}{"_id": menuOverrideID(outletID, menuID)}, update)
+	menuOverrideCache.Delete(outletID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var response struct {
+		Data struct {
+			Document models.MenuOverride `json:"document"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to parse override"})
+	}
+	override := response.Data.Document
+
+	applyMenuOverride(&menu, override, time.Now())
+	publishEvent(h.dbClient, events.MenuItemChanged, outletID, fiber.Map{
+		"menu_id":        menuID,
+		"price":          menu.Price,
+		"hidden":         menu.Hidden,
+		"sold_out":       menu.SoldOut,
+		"sold_out_until": menu.SoldOutUntil,
+	})
+
+	return c.JSON(override)
+}
+
+// checkAvailable fails when one of the menu IDs is sold out or hidden at
+// the outlet. Only new sales are checked; bills already ordered still settle.
+func checkAvailable(dbClient *config.AstraDBClient, outletID string, menuIDs []string) error {
+	if outletID == "" {
+		return nil
+	}
+	menus, err := outletMenus(dbClient, outletID, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, id := range menuIDs {
+		menu, ok := menus[id]
+		switch {
+		case !ok:
+		case menu.Hidden:
+			return &cartError{fmt.Sprintf("%s is not offered at this outlet", menu.Name)}
+		case menu.SoldOut:
+			return &cartError{fmt.Sprintf("%s is sold out", menu.Name)}
+		}
+	}
+	return nil
+}
+
+// availabilityStatus maps a checkAvailable error to an HTTP status
+func availabilityStatus(err error) int {
+	if _, ok := err.(*cartError); ok {
+		return 409
+	}
+	return 500
+}
+
+func menuOverrideID(outletID, menuID string) string {
+	return outletID + ":" + menuID
+}
+
+// applyMenuOverride adjusts a menu item for an outlet
+func applyMenuOverride(menu *models.Menu, o models.MenuOverride, now time.Time) {
+	menu.Hidden = o.Hidden
+	menu.SoldOut = o.IsSoldOut(now)
+	menu.SoldOutUntil = ""
+	if menu.SoldOut {
+		menu.SoldOutUntil = o.SoldOutUntil
+	}
+	if o.Price != nil && *o.Price > 0 && *o.Price != menu.Price {
+		menu.BasePrice = menu.Price
+		menu.Price = *o.Price
+	}
+}
+
+// outletMenus is loadMenus with an outlet's overrides applied; without an
+// outlet it returns the plain menu
+func outletMenus(dbClient *config.AstraDBClient, outletID string, now time.Time) (map[string]models.Menu, error) {
+	menus, err := loadMenus(dbClient)
+	if err != nil || outletID == "" {
+		return menus, err
+	}
+	overrides, err := loadMenuOverrides(dbClient, outletID)
+	if err != nil {
+		return nil, err
+	}
+	for id, o := range overrides {
+		if menu, ok := menus[id]; ok {
+			applyMenuOverride(&menu, o, now)
+			menus[id] = menu
+		}
+	}
+	return menus, nil
+}
+
+// loadMenuOverrides returns an outlet's overrides keyed by menu ID
+func loadMenuOverrides(dbClient *config.AstraDBClient, outletID string) (map[string]models.MenuOverride, error) {
+	if v, ok := menuOverrideCache.Load(outletID); ok {
+		if entry := v.(menuOverrideEntry); time.Now().Before(entry.expires) {
+			return entry.overrides, nil
+		}
+	}
+
+	docs, err := findDocuments(dbClient, "menu_override", map[string]interface{}{"outlet_id": outletID}, nil, 5)
+	if err != nil {
+		// Not cached, so the next read asks again
+		return nil, err
+	}
+	overrides := make(map[string]models.MenuOverride)
+	for _, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		var o models.MenuOverride
+		if err := json.Unmarshal(data, &o); err != nil {
+			return nil, fmt.Errorf("failed to parse menu override: %v", err)
+		}
+		overrides[o.MenuID] = o
+	}
+
+	menuOverrideCache.Store(outletID, menuOverrideEntry{overrides: overrides, expires: time.Now().Add(menuOverrideCacheTTL)})
+	return overrides, nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMenuOverrideCache(t *testing.T) {
+	const outlet = "OVERRIDETEST"
+	menuOverrideCache.Delete(outlet)
+	t.Cleanup(func() { menuOverrideCache.Delete(outlet) })
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		if path == menuRowsPath {
+			return 200, `{"data":[{"id":"M1","name":"Es Teh","kemitraan":"OVERRIDETEST","kategori":"Minuman","price":5000}]}`
+		}
+		return 404, `{"description":"not found"}`
+	}
+	app := fiber.New()
+	app.Put("/outlets/:outlet_id/menu/:menu_id/price", NewOutletHandler(client).SetMenuPrice)
+
+	price := func() models.Money {
+		t.Helper()
+		menus, err := outletMenus(client, outlet, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return menus["M1"].Price
+	}
+
+	// A failed read is reported and not cached
+	db.failing["menu_override find"] = "SERVER_UNHANDLED_ERROR"
+	if _, err := loadMenuOverrides(client, outlet); err == nil {
+		t.Fatal("failed read of overrides not reported")
+	}
+	db.failing = map[string]string{}
+	db.insert("menu_override", models.MenuOverride{ID: menuOverrideID(outlet, "M1"), OutletID: outlet, MenuID: "M1", Price: moneyPtr(6000)})
+	if got := price(); got != 6000 {
+		t.Fatalf("price %d after a failed read, want the override 6000", got)
+	}
+
+	// Later reads come from the cache
+	db.update("menu_override", map[string]interface{}{
+		"filter": map[string]interface{}{"_id": menuOverrideID(outlet, "M1")},
+		"update": map[string]interface{}{"$set": map[string]interface{}{"price": 6500}},
+	})
+	if got := price(); got != 6000 {
+		t.Errorf("price %d, want the cached 6000", got)
+	}
+
+	// A write through the server drops the cache
+	if status, body := do(t, app, "PUT", "/outlets/"+outlet+"/menu/M1/price", map[string]interface{}{"price": 7000}); status != 200 {
+		t.Fatalf("set price: status %d %v", status, body)
+	}
+	if got := price(); got != 7000 {
+		t.Errorf("price %d after a write, want 7000", got)
+	}
+}
+
+func moneyPtr(m models.Money) *models.Money {
+	return &m
+}
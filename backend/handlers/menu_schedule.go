@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCategorySchedules lists the schedules of categories (?kemitraan= to
+// filter), followed by kategori schedules not yet copied onto a category
+func (h *MenuHandler) GetCategorySchedules(c *fiber.Ctx) error {
+	kemitraan := c.Query("kemitraan")
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	list := []models.CategorySchedule{}
+	covered := make(map[string]bool)
+	for _, cat := range ix.sorted(func(cat models.Category) bool {
+		return cat.Schedule != nil && (kemitraan == "" || menuKey(cat.Kemitraan) == menuKey(kemitraan))
+	}) {
+		list = append(list, models.CategorySchedule{
+			ID:        cat.ID,
+			Kemitraan: cat.Kemitraan,
+			Kategori:  cat.Name,
+			Schedule:  cat.Schedule,
+			UpdatedAt: cat.UpdatedAt,
+		})
+		covered[categoryScheduleID(cat.Kemitraan, cat.Name)] = true
+	}
+	filter := map[string]interface{}{}
+	if kemitraan != "" {
+		filter["kemitraan"] = kemitraan
+	}
+	for _, doc := range fetchDocuments(h.dbClient, "category_schedule", filter, nil, 5) {
+		if cs, err := categoryScheduleFromDocument(doc); err == nil && cs.Schedule != nil && !covered[cs.ID] {
+			list = append(list, cs)
+		}
+	}
+	return c.JSON(fiber.Map{"schedules": list, "count": len(list)})
+}
+
+// SetCategorySchedule sets when every item of a kategori can be sold. The
+// schedule is stored on the matching categories; a kategori without one
+// (before the category migration) keeps a schedule of its own.
+func (h *MenuHandler) SetCategorySchedule(c *fiber.Ctx) error {
+	var req models.SetCategoryScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Kemitraan == "" || req.Kategori == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "kemitraan and kategori are required"})
+	}
+	if err := validateSchedule(req.Schedule); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ix, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	now := time.Now().In(wib).Format(time.RFC3339)
+	matched := ix.sorted(func(cat models.Category) bool {
+		return menuKey(cat.Kemitraan) == menuKey(req.Kemitraan) &&
+			strings.EqualFold(cat.Name, strings.TrimSpace(req.Kategori)) &&
+			(req.SubBrand == "" || menuKey(cat.SubBrand) == menuKey(req.SubBrand))
+	})
+
+	defer invalidateCategories()
+	if len(matched) > 0 {
+		for i := range matched {
+			matched[i].Schedule = req.Schedule
+			matched[i].UpdatedAt = now
+			if _, err := h.dbClient.UpdateDocument("menu_category", map[string]interface{}{"_id": matched[i].ID}, map[string]interface{}{
+				"schedule":  req.Schedule,
+				"updatedAt": now,
+			}); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		return c.JSON(fiber.Map{"categories": matched, "count": len(matched)})
+	}
+
+	cs := models.CategorySchedule{
+		ID:        categoryScheduleID(req.Kemitraan, req.Kategori),
+		Kemitraan: req.Kemitraan,
+		Kategori:  req.Kategori,
+		Schedule:  req.Schedule,
+		UpdatedAt: now,
+	}
+	_, err = h.dbClient.UpsertDocument("category_schedule", map[string]interface{}{"_id": cs.ID}, map[string]interface{}{
+		"kemitraan":  cs.Kemitraan,
+		"kategori":   cs.Kategori,
+		"schedule":   cs.Schedule,
+		"updated_at": cs.UpdatedAt,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(cs)
+}
+
+// validateSchedule checks days, HH:MM windows and YYYY-MM-DD dates
+func validateSchedule(s *models.Schedule) error {
+	if s == nil {
+		return nil
+	}
+	for _, d := range s.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("days must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	for i, w := range s.Windows {
+		for _, t := range []string{w.Start, w.End} {
+			if _, err := time.Parse("15:04", t); err != nil {
+				return fmt.Errorf("Invalid time %q, expected HH:MM", t)
+			}
+		}
+		// Stored as HH:MM, so "9:00" is kept as "09:00"
+		w = models.TimeWindow{Start: clockHHMM(w.Start), End: clockHHMM(w.End)}
+		s.Windows[i] = w
+		if w.Start == w.End {
+			return fmt.Errorf("window %s - %s is empty", w.Start, w.End)
+		}
+	}
+	for _, d := range []string{s.ValidFrom, s.ValidUntil} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("Invalid date %q, expected YYYY-MM-DD", d)
+		}
+	}
+	if s.ValidFrom != "" && s.ValidUntil != "" && s.ValidUntil < s.ValidFrom {
+		return fmt.Errorf("validUntil is before validFrom")
+	}
+	return nil
+}
+
+// menuListTime reads the moment a menu listing is for: ?at= (RFC3339) or
+// now. With ?all=true nothing is filtered by schedule.
+func menuListTime(c *fiber.Ctx) (at time.Time, all bool, err error) {
+	at = time.Now()
+	if v := c.Query("at"); v != "" {
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			return at, false, fmt.Errorf("at must be an RFC3339 time")
+		}
+	}
+	return at.In(wib), c.Query("all") == "true", nil
+}
+
+// menuSellable reports whether a menu item is on schedule and its category
+// is active and on schedule
+func menuSellable(menu models.Menu, categories *categoryIndex, at time.Time) bool {
+	at = at.In(wib)
+	return menu.Schedule.Allows(at) && categories.sellable(menu, at)
+}
+
+// flagOffSchedule marks transaction items sold outside the schedule of the
+// item or its category, or while the category was inactive, and returns how
+// many were flagged. Items are still accepted: the sale has happened, the
+// flag is for the back office.
+func flagOffSchedule(dbClient *config.AstraDBClient, trx *models.Transaction, at time.Time) int {
+	menus, err := loadMenus(dbClient)
+	if err != nil {
+		return 0
+	}
+	categories, err := loadCategories(dbClient)
+	if err != nil {
+		return 0
+	}
+
+	flagged := 0
+	for i := range trx.Items {
+		menu, ok := menus[trx.Items[i].MenuID]
+		trx.Items[i].OffSchedule = ok && !menuSellable(menu, categories, at)
+		if trx.Items[i].OffSchedule {
+			flagged++
+		}
+	}
+	return flagged
+}
+
+func categoryScheduleID(kemitraan, kategori string) string {
+	return menuKey(kemitraan) + ":" + menuKey(kategori)
+}
+
+func categoryScheduleFromDocument(doc map[string]interface{}) (models.CategorySchedule, error) {
+	var cs models.CategorySchedule
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return cs, err
+	}
+	if err := json.Unmarshal(data, &cs); err != nil {
+		return cs, fmt.Errorf("failed to parse category schedule: %v", err)
+	}
+	return cs, nil
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestValidateScheduleNormalizesTimes(t *testing.T) {
+	s := &models.Schedule{Windows: []models.TimeWindow{{Start: "9:00", End: "17:30"}, {Start: "22:00", End: "2:00"}}}
+	if err := validateSchedule(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Windows[0] != (models.TimeWindow{Start: "09:00", End: "17:30"}) || s.Windows[1] != (models.TimeWindow{Start: "22:00", End: "02:00"}) {
+		t.Errorf("windows %v, want HH:MM", s.Windows)
+	}
+
+	invalid := map[string]*models.Schedule{
+		"day":          {Days: []int{7}},
+		"time":         {Windows: []models.TimeWindow{{Start: "25:00", End: "26:00"}}},
+		"empty window": {Windows: []models.TimeWindow{{Start: "9:00", End: "09:00"}}},
+		"date":         {ValidFrom: "15-05-2024"},
+		"date order":   {ValidFrom: "2024-05-16", ValidUntil: "2024-05-15"},
+	}
+	for name, s := range invalid {
+		if err := validateSchedule(s); err == nil {
+			t.Errorf("%s: accepted %+v", name, s)
+		}
+	}
+}
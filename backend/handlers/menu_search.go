@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Menu search runs on an in-memory index of the menu. The index remembers
+// the hash of the menu rows it was built from and is rebuilt whenever the
+// cached rows differ, i.e. after a cache refresh or a menu write.
+const (
+	popularityWindowDays = 30
+	popularityTTL        = 15 * time.Minute
+)
+
+// Field weights: a hit in the name counts more than one in the description
+var searchFieldWeights = [...]float64{3, 2, 1} // name, kategori, description
+
+// searchStopwords are left out of queries and the index
+var searchStopwords = map[string]bool{
+	"dan": true, "dengan": true, "pakai": true, "yang": true, "di": true,
+	"ke": true, "dari": true, "atau": true, "and": true, "with": true, "the": true,
+}
+
+// searchSpellings folds spelling variants and common English menu words
+// onto one form
+var searchSpellings = map[string]string{
+	"mie": "mi", "bakmie": "bakmi", "kwetiaw": "kwetiau", "kwetiauw": "kwetiau",
+	"satay": "sate", "tea": "teh",
+	"ice": "es", "iced": "es", "coffee": "kopi", "chicken": "ayam", "rice": "nasi",
+	"noodle": "mi", "noodles": "mi", "beef": "sapi", "fried": "goreng", "egg": "telur",
+	"telor": "telur", "fish": "ikan", "pedes": "pedas", "spicy": "pedas",
+}
+
+type searchDoc struct {
+	menu   models.Menu
+	fields [3][]string // tokens of name, kategori, description
+}
+
+type menuSearchIndex struct {
+	source string // hash of the menu rows the index was built from
+	docs   []searchDoc
+	terms  map[string][]int // token -> docs containing it
+}
+
+var menuSearch struct {
+	mu    sync.Mutex
+	index *menuSearchIndex
+}
+
+// Quantities sold per menu ID (and per lowercased name for items saved
+// without menu_id), refreshed in the background once stale
+var menuPopularity struct {
+	mu         sync.Mutex
+	byID       map[string]int
+	byName     map[string]int
+	loadedAt   time.Time
+	refreshing bool
+}
+
+// SearchMenu searches menu names, kategori and descriptions. It tolerates
+// typos, matches the last word as a prefix for type-ahead and ranks popular
+// items higher. Takes the filters of GetAllMenu (kemitraan, subBrand,
+// outlet_id, all) and limit (default 20).
+func (h *MenuHandler) SearchMenu(c *fiber.Ctx) error {
+	query := c.Query("q")
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "q is required"})
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	at, all, err := menuListTime(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	index, err := loadMenuSearchIndex(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	categories, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	var overrides map[string]models.MenuOverride
+	if outletID := c.Query("outlet_id"); outletID != "" {
+		if overrides, err = loadMenuOverrides(h.dbClient, outletID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	qKemitraan, qSubBrand := menuKey(c.Query("kemitraan")), menuKey(c.Query("subBrand"))
+	soldByID, soldByName := loadMenuPopularity(h.dbClient)
+
+	results := []models.MenuSearchResult{}
+	for _, hit := range index.search(tokens) {
+		menu := index.docs[hit.doc].menu
+		switch {
+		case qSubBrand != "" && menuKey(menu.SubBrand) != qSubBrand:
+			continue
+		case qSubBrand == "" && qKemitraan != "" && !strings.Contains(menuKey(menu.Kemitraan), qKemitraan):
+			continue
+		}
+		if !menuSellable(menu, categories, at) {
+			if !all {
+				continue
+			}
+			menu.OffSchedule = true
+		}
+		if o, ok := overrides[menu.ID]; ok {
+			applyMenuOverride(&menu, o, at)
+		}
+		if menu.Hidden {
+			continue
+		}
+
+		sold := soldByID[menu.ID] + soldByName[strings.ToLower(menu.Name)]
+		menu.ImageData = ""
+		results = append(results, models.MenuSearchResult{
+			Menu:  menu,
+			Score: math.Round((hit.score+0.3*math.Log1p(float64(sold)))*1000) / 1000,
+			Sold:  sold,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"query":   query,
+		"tokens":  tokens,
+		"results": results,
+		"count":   len(results),
+	})
+}
+
+type searchHit struct {
+	doc   int
+	score float64
+}
+
+// search returns the docs matching the query tokens with their text score.
+// Docs matching every token come first; when none does, docs matching the
+// most tokens are returned instead.
+func (ix *menuSearchIndex) search(tokens []string) []searchHit {
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+	for i, qt := range tokens {
+		last := i == len(tokens)-1
+		best := make(map[int]float64) // best match of this token per doc
+		for term, docs := range ix.terms {
+			quality := termMatch(qt, term, last)
+			if quality == 0 {
+				continue
+			}
+			for _, d := range docs {
+				for f, fieldTokens := range ix.docs[d].fields {
+					if containsString(fieldTokens, term) && quality*searchFieldWeights[f] > best[d] {
+						best[d] = quality * searchFieldWeights[f]
+					}
+				}
+			}
+		}
+		for d, s := range best {
+			scores[d] += s
+			matched[d]++
+		}
+	}
+
+	most := 0
+	for _, n := range matched {
+		if n > most {
+			most = n
+		}
+	}
+	hits := []searchHit{}
+	for d, s := range scores {
+		if matched[d] == most {
+			hits = append(hits, searchHit{doc: d, score: s})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return ix.docs[hits[i].doc].menu.Name < ix.docs[hits[j].doc].menu.Name
+	})
+	return hits
+}
+
+// termMatch rates how well an index term matches a query token: 1 for the
+// same word, less for a prefix or a word within typo distance
+func termMatch(query, term string, last bool) float64 {
+	if query == term {
+		return 1
+	}
+	// The word being typed matches as a prefix; earlier words need 3 letters
+	if strings.HasPrefix(term, query) && (last || len([]rune(query)) >= 3) {
+		if last {
+			return 0.8
+		}
+		return 0.6
+	}
+	n := len([]rune(query))
+	maxDist := 0
+	switch {
+	case n >= 8:
+		maxDist = 2
+	case n >= 4:
+		maxDist = 1
+	}
+	if maxDist == 0 {
+		return 0
+	}
+	switch d := editDistance(query, term, maxDist); {
+	case d > maxDist:
+		return 0
+	case d == 1:
+		return 0.6
+	default:
+		return 0.4
+	}
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment)
+// distance of a and b, or limit+1 once it is known to exceed limit
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	if prev[len(rb)] > limit {
+		return limit + 1
+	}
+	return prev[len(rb)]
+}
+
+// searchTokens splits text into lowercased words, folding Indonesian
+// reduplication ("ayam2", "mie-mie"), the -nya suffix and spelling variants
+func searchTokens(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := []string{}
+	seen := make(map[string]bool)
+	for _, w := range words {
+		// "ayam2" is written for "ayam-ayam"
+		if trimmed := strings.TrimRight(w, "2"); trimmed != w && trimmed != "" && !isDigits(trimmed) {
+			w = trimmed
+		}
+		if len(w) > 5 && strings.HasSuffix(w, "nya") {
+			w = strings.TrimSuffix(w, "nya")
+		}
+		if folded, ok := searchSpellings[w]; ok {
+			w = folded
+		}
+		if searchStopwords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+func isDigits(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func invalidateMenuSearch() {
+	menuSearch.mu.Lock()
+	menuSearch.index = nil
+	menuSearch.mu.Unlock()
+}
+
+// loadMenuSearchIndex returns the search index of the current menu rows,
+// rebuilding it when the rows changed
+func loadMenuSearchIndex(dbClient *config.AstraDBClient) (*menuSearchIndex, error) {
+	rows, err := dbClient.ExecuteQueryWithCache("GET", menuRowsPath, nil, menuCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(rows)
+	source := hex.EncodeToString(sum[:])
+
+	menuSearch.mu.Lock()
+	defer menuSearch.mu.Unlock()
+	if menuSearch.index != nil && menuSearch.index.source == source {
+		return menuSearch.index, nil
+	}
+
+	menus, err := loadMenus(dbClient)
+	if err != nil {
+		return nil, err
+	}
+	ix := &menuSearchIndex{source: source, terms: make(map[string][]int)}
+	for _, menu := range menus {
+		doc := searchDoc{menu: menu}
+		doc.fields[0] = searchTokens(menu.Name)
+		doc.fields[1] = searchTokens(menu.Kategori)
+		doc.fields[2] = searchTokens(menu.Description)
+
+		d := len(ix.docs)
+		ix.docs = append(ix.docs, doc)
+		indexed := make(map[string]bool)
+		for _, field := range doc.fields {
+			for _, t := range field {
+				if !indexed[t] {
+					indexed[t] = true
+					ix.terms[t] = append(ix.terms[t], d)
+				}
+			}
+		}
+	}
+
+	menuSearch.index = ix
+	return ix, nil
+}
+
+// loadMenuPopularity returns the quantities sold in the last 30 days. The
+// first call counts them; later calls return the counts at hand and refresh
+// them in the background once they are older than popularityTTL.
+func loadMenuPopularity(dbClient *config.AstraDBClient) (map[string]int, map[string]int) {
+	menuPopularity.mu.Lock()
+	loaded := menuPopularity.byID != nil
+	stale := time.Since(menuPopularity.loadedAt) > popularityTTL
+	if loaded && stale && !menuPopularity.refreshing {
+		menuPopularity.refreshing = true
+		go countMenuPopularity(dbClient)
+	}
+	byID, byName := menuPopularity.byID, menuPopularity.byName
+	menuPopularity.mu.Unlock()
+
+	if !loaded {
+		countMenuPopularity(dbClient)
+		menuPopularity.mu.Lock()
+		byID, byName = menuPopularity.byID, menuPopularity.byName
+		menuPopularity.mu.Unlock()
+	}
+	return byID, byName
+}
+
+func countMenuPopularity(dbClient *config.AstraDBClient) {
+	since := time.Now().In(wib).AddDate(0, 0, -popularityWindowDays).Format("2006-01-02")
+	filter := map[string]interface{}{"created_at": map[string]interface{}{"$gte": since + "T00:00:00Z"}}
+
+	byID := make(map[string]int)
+	byName := make(map[string]int)
+	for _, trx := range fetchTransactions(dbClient, filter, 20) {
+		items, _ := trx["items"].([]interface{})
+		for _, raw := range items {
+			item, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			qty := int(toFloat(item["qty"]))
+			if id := toString(item["menu_id"]); id != "" {
+				byID[id] += qty
+			} else if name := toString(item["menu_name"]); name != "" {
+				byName[strings.ToLower(name)] += qty
+			}
+		}
+	}
+
+	menuPopularity.mu.Lock()
+	menuPopularity.byID = byID
+	menuPopularity.byName = byName
+	menuPopularity.loadedAt = time.Now()
+	menuPopularity.refreshing = false
+	menuPopularity.mu.Unlock()
+}
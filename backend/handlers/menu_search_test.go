@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"kopi", "kopi", 2, 0},
+		{"kopi", "kopu", 2, 1},     // substitution
+		{"kopi", "kopii", 2, 1},    // insertion
+		{"kopi", "kpi", 2, 1},      // deletion
+		{"kopi", "kpoi", 2, 1},     // transposition counts once
+		{"goreng", "gornge", 2, 2}, // two transpositions
+		{"rendang", "rendnag", 1, 1},
+		{"es", "esteh", 2, 3}, // too long: limit+1
+		{"bakso", "soto", 1, 2},
+		{"", "teh", 3, 3},
+		{"café", "cafe", 1, 1}, // runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.b, tt.a, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Nasi Goreng Spesial", []string{"nasi", "goreng", "spesial"}},
+		{"ayam2 goreng", []string{"ayam", "goreng"}},
+		{"Mie-mie", []string{"mi"}},
+		{"sambalnya pedes", []string{"sambal", "pedas"}},
+		{"nya", []string{"nya"}}, // too short to be a suffix
+		{"Iced Coffee with Milk", []string{"es", "kopi", "milk"}},
+		{"kopi dan teh / tea", []string{"kopi", "teh"}},
+		{"Es Teh 2 gelas", []string{"es", "teh", "2", "gelas"}},
+		{"Paket 22", []string{"paket", "22"}},
+		{"  ", []string{}},
+	}
+	for _, tt := range tests {
+		if got := searchTokens(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchTokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTermMatch(t *testing.T) {
+	tests := []struct {
+		query, term string
+		last        bool
+		want        float64
+	}{
+		{"kopi", "kopi", false, 1},
+		{"ko", "kopi", true, 0.8},   // typed prefix
+		{"ko", "kopi", false, 0},    // earlier words need 3 letters
+		{"kop", "kopi", false, 0.6}, // prefix of an earlier word
+		{"kopu", "kopi", false, 0.6},
+		{"rendnag", "rendang", false, 0.6},
+		{"martabak", "matrabax", false, 0.4},
+		{"teh", "tah", false, 0}, // short words need to be exact
+		{"bakso", "soto", false, 0},
+	}
+	for _, tt := range tests {
+		if got := termMatch(tt.query, tt.term, tt.last); got != tt.want {
+			t.Errorf("termMatch(%q, %q, %v) = %v, want %v", tt.query, tt.term, tt.last, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Menu responses carry a version token. The server keeps the last few
+// versions of every distinct menu query (item ID -> hash of the item as
+// served), so GET /menu?since=<token> can answer with just the items that
+// changed. Versions live in memory: after a restart, or for a token older
+// than the kept versions, the delta falls back to the full list.
+const (
+	menuVersionsPerQuery  = 8
+	maxMenuVersionQueries = 512
+)
+
+// menuVersion is one version of a menu query's response
+type menuVersion struct {
+	seq     int64
+	at      time.Time // when this content was first served
+	content string    // hash over every item hash
+	hashes  map[string]string
+}
+
+var menuVersions = struct {
+	mu      sync.Mutex
+	boot    string
+	seq     int64
+	byQuery map[string][]*menuVersion // oldest first
+	used    map[string]time.Time
+}{
+	boot:    strings.ReplaceAll(uuid.New().String(), "-", "")[:8],
+	byQuery: make(map[string][]*menuVersion),
+	used:    make(map[string]time.Time),
+}
+
+// recordMenuVersion returns the version of a query's response, recording it
+// when the content differs from the latest one
+func recordMenuVersion(query string, hashes map[string]string) *menuVersion {
+	keys := make([]string, 0, len(hashes))
+	for k := range hashes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sum := sha256.New()
+	for _, k := range keys {
+		sum.Write([]byte(k + "=" + hashes[k] + "\n"))
+	}
+	content := hex.EncodeToString(sum.Sum(nil)[:16])
+
+	menuVersions.mu.Lock()
+	defer menuVersions.mu.Unlock()
+	now := time.Now()
+	menuVersions.used[query] = now
+
+	list := menuVersions.byQuery[query]
+	if n := len(list); n > 0 && list[n-1].content == content {
+		return list[n-1]
+	}
+
+	menuVersions.seq++
+	v := &menuVersion{seq: menuVersions.seq, at: now, content: content, hashes: hashes}
+	list = append(list, v)
+	if len(list) > menuVersionsPerQuery {
+		list = list[len(list)-menuVersionsPerQuery:]
+	}
+	menuVersions.byQuery[query] = list
+
+	// Forget the least recently used query when there are too many
+	if len(menuVersions.byQuery) > maxMenuVersionQueries {
+		oldest, oldestAt := "", now
+		for q, at := range menuVersions.used {
+			if at.Before(oldestAt) {
+				oldest, oldestAt = q, at
+			}
+		}
+		delete(menuVersions.byQuery, oldest)
+		delete(menuVersions.used, oldest)
+	}
+	return v
+}
+
+// findMenuVersion looks up the version a token names for a query
+func findMenuVersion(query, token string) (*menuVersion, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 3 || parts[0] != "m1" {
+		return nil, false
+	}
+	seq, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	menuVersions.mu.Lock()
+	defer menuVersions.mu.Unlock()
+	if parts[1] != menuVersions.boot {
+		return nil, false
+	}
+	for _, v := range menuVersions.byQuery[query] {
+		if v.seq == seq {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (v *menuVersion) token() string {
+	menuVersions.mu.Lock()
+	boot := menuVersions.boot
+	menuVersions.mu.Unlock()
+	return base64.RawURLEncoding.EncodeToString([]byte("m1:" + boot + ":" + strconv.FormatInt(v.seq, 10)))
+}
+
+// menuItemHashes hashes every menu item as it is served
+func menuItemHashes(menus []models.Menu) map[string]string {
+	hashes := make(map[string]string, len(menus))
+	for _, menu := range menus {
+		hashes[menu.ID] = menuHash(menu)
+	}
+	return hashes
+}
+
+// menuListDelta compares the served menu with the version a client has
+func menuListDelta(current *menuVersion, since *menuVersion, menus []models.Menu) models.MenuListDelta {
+	delta := models.MenuListDelta{
+		Version:   current.token(),
+		Full:      since == nil,
+		MenuDelta: models.MenuDelta{Upserted: []models.Menu{}, Deleted: []string{}},
+	}
+	for _, menu := range menus {
+		if since == nil || since.hashes[menu.ID] != current.hashes[menu.ID] {
+			delta.Upserted = append(delta.Upserted, menu)
+		}
+	}
+	if since != nil {
+		for id := range since.hashes {
+			if _, ok := current.hashes[id]; !ok {
+				delta.Deleted = append(delta.Deleted, id)
+			}
+		}
+		sort.Strings(delta.Deleted)
+	}
+	return delta
+}
+
+// menuQueryKey identifies the menu listing a request asks for
+func menuQueryKey(c *fiber.Ctx, parts ...string) string {
+	key := c.Path()
+	for _, p := range parts {
+		key += "|" + p + "=" + strings.ToLower(strings.TrimSpace(c.Query(p)))
+	}
+	return key
+}
+
+// sendWithETag writes v as JSON with a strong ETag of the body, answering
+// 304 Not Modified when If-None-Match already names it. Clients are asked to
+// revalidate every time, which costs one small request when nothing changed.
+func sendWithETag(c *fiber.Ctx, v interface{}, lastModified time.Time) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	if !lastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
+}
+
+// etagMatches reports whether an If-None-Match header names etag. As the
+// header asks for, weak validators compare equal to strong ones.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// menuModifiedAt is the latest update or creation time of a menu item
+func menuModifiedAt(menu models.Menu) time.Time {
+	if t, err := time.Parse(time.RFC3339, menu.UpdatedAt); err == nil {
+		return t
+	}
+	return menu.CreatedAt
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getMenu sends a GET with an optional If-None-Match and returns the status,
+// the ETag and menu version headers, and the raw body
+func getMenu(t *testing.T, app *fiber.App, path, ifNoneMatch string) (int, string, string, []byte) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set(fiber.HeaderIfNoneMatch, ifNoneMatch)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderETag), resp.Header.Get("X-Menu-Version"), body
+}
+
+func TestMenuETag(t *testing.T) {
+	db, _, app := menuWriteApp(t)
+	db.insert("menu_makanan", map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "ETAGTEST", "kategori": "Minuman", "price": 5000})
+	const path = "/menu?kemitraan=ETAGTEST"
+
+	status, etag, _, _ := getMenu(t, app, path, "")
+	if status != 200 || etag == "" {
+		t.Fatalf("menu: status %d, ETag %q", status, etag)
+	}
+	if status, _, _, body := getMenu(t, app, path, etag); status != 304 || len(body) != 0 {
+		t.Errorf("unchanged menu: status %d with %d bytes, want an empty 304", status, len(body))
+	}
+	if status, _, _, _ := getMenu(t, app, path, `"other", W/`+etag); status != 304 {
+		t.Errorf("weak ETag in a list: status %d, want 304", status)
+	}
+
+	if status, body := do(t, app, "PUT", "/menu/M1", models.MenuRequest{Name: "Es Teh", Kemitraan: "ETAGTEST", Kategori: "Minuman", Price: 6000, NewKategori: true}); status != 200 {
+		t.Fatalf("update: status %d %v", status, body)
+	}
+	status, changed, _, _ := getMenu(t, app, path, etag)
+	if status != 200 || changed == etag {
+		t.Errorf("changed menu: status %d, ETag %q, want 200 with a new ETag", status, changed)
+	}
+}
+
+func TestMenuSinceDelta(t *testing.T) {
+	db, _, app := menuWriteApp(t)
+	db.insert("menu_makanan",
+		map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "DELTATEST", "kategori": "Minuman", "price": 5000},
+		map[string]interface{}{"_id": "M2", "id": "M2", "name": "Es Jeruk", "kemitraan": "DELTATEST", "kategori": "Minuman", "price": 6000},
+	)
+	const path = "/menu?kemitraan=DELTATEST"
+	delta := func(since string) models.MenuListDelta {
+		t.Helper()
+		status, _, _, body := getMenu(t, app, path+"&since="+since, "")
+		if status != 200 {
+			t.Fatalf("since %s: status %d %s", since, status, body)
+		}
+		var d models.MenuListDelta
+		if err := json.Unmarshal(body, &d); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	_, _, v1, _ := getMenu(t, app, path, "")
+	if v1 == "" {
+		t.Fatal("no X-Menu-Version")
+	}
+	if d := delta(v1); d.Full || len(d.Upserted) != 0 || len(d.Deleted) != 0 || d.Version != v1 {
+		t.Errorf("delta from the current version %+v, want an empty delta", d)
+	}
+
+	if status, body := do(t, app, "PUT", "/menu/M1", models.MenuRequest{Name: "Es Teh", Kemitraan: "DELTATEST", Kategori: "Minuman", Price: 5500}); status != 200 {
+		t.Fatalf("update: status %d %v", status, body)
+	}
+	d := delta(v1)
+	if d.Full || len(d.Upserted) != 1 || d.Upserted[0].ID != "M1" || d.Upserted[0].Price != 5500 || len(d.Deleted) != 0 {
+		t.Errorf("delta after an update %+v, want M1 upserted", d)
+	}
+	v2 := d.Version
+
+	if status, body := do(t, app, "DELETE", "/menu/M2", nil); status != 200 {
+		t.Fatalf("delete: status %d %v", status, body)
+	}
+	if d := delta(v2); len(d.Upserted) != 0 || len(d.Deleted) != 1 || d.Deleted[0] != "M2" {
+		t.Errorf("delta after a delete %+v, want M2 deleted", d)
+	}
+	// The older version gets both changes
+	if d := delta(v1); len(d.Upserted) != 1 || len(d.Deleted) != 1 {
+		t.Errorf("delta from the first version %+v, want M1 upserted and M2 deleted", d)
+	}
+
+	// An unknown token falls back to the full list
+	if d := delta("bm90LWEtdG9rZW4"); !d.Full || len(d.Upserted) != 1 {
+		t.Errorf("delta from an unknown token %+v, want the full list", d)
+	}
+
+	// A delta is revalidated like the full list
+	_, etag, _, _ := getMenu(t, app, path+"&since="+v2, "")
+	if status, _, _, _ := getMenu(t, app, path+"&since="+v2, etag); status != 304 {
+		t.Errorf("unchanged delta: status %d, want 304", status)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Menu items are written through the Data API into the menu_makanan
+// collection; reads keep going through the cached REST rows, so every write
+// invalidates the menu cache.
+
+// invalidateMenuCache drops the cached menu rows after a write
+func invalidateMenuCache(dbClient *config.AstraDBClient) {
+	dbClient.InvalidateCache(menuRowsPath)
+}
+
+// CreateMenu adds a menu item
+func (h *MenuHandler) CreateMenu(c *fiber.Ctx) error {
+	var req models.MenuRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	categories, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validateMenuRequest(&req, "", menus, categories); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.CategoryID, err = ensureCategory(h.dbClient, categories, req.Kemitraan, req.SubBrand, req.Kategori); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now().In(wib)
+	menu := menuFromRequest(uuid.New().String(), req)
+	menu.CreatedAt = now
+	menu.UpdatedAt = now.Format(time.RFC3339)
+	if err := h.storeRequestImage(&menu); err != nil {
+		return imageErrorResponse(c, err)
+	}
+
+	if err := insertMenu(h.dbClient, &menu, req.Actor); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateMenuCache(h.dbClient)
+
+	return c.Status(201).JSON(menu)
+}
+
+// UpdateMenu replaces the editable fields of a menu item
+func (h *MenuHandler) UpdateMenu(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req models.MenuRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	// The item itself is read past the cache: the write is based on its
+	// current version
+	existing, ok, err := loadMenuDocument(h.dbClient, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+	if req.Version != 0 && req.Version != existing.Version {
+		return c.Status(409).JSON(fiber.Map{"error": errMenuConflict.Error(), "version": existing.Version})
+	}
+	menus, err := loadMenus(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	categories, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validateMenuRequest(&req, id, menus, categories); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.CategoryID, err = ensureCategory(h.dbClient, categories, req.Kemitraan, req.SubBrand, req.Kategori); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	menu := menuFromRequest(id, req)
+	menu.CreatedAt = existing.CreatedAt
+	menu.UpdatedAt = time.Now().In(wib).Format(time.RFC3339)
+	if menu.ImageURL == existing.ImageURL {
+		menu.ImageThumbURL = existing.ImageThumbURL
+	}
+	if err := h.storeRequestImage(&menu); err != nil {
+		return imageErrorResponse(c, err)
+	}
+
+	menu.Version, ok, err = writeMenu(h.dbClient,
+		map[string]interface{}{"_id": id, "deleted": map[string]interface{}{"$ne": true}},
+		menuDocument(menu),
+		menuEdit{action: models.MenuActionUpdate, actor: req.Actor, based: true, version: existing.Version})
+	invalidateMenuCache(h.dbClient)
+	if err == errMenuConflict {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+
+	return c.JSON(menu)
+}
+
+// DeleteMenu soft-deletes a menu item. It disappears from the menu and can
+// no longer be sold, but past transactions keep pointing at it.
+func (h *MenuHandler) DeleteMenu(c *fiber.Ctx) error {
+	return h.setMenuDeleted(c, true)
+}
+
+// RestoreMenu brings back a soft-deleted menu item
+func (h *MenuHandler) RestoreMenu(c *fiber.Ctx) error {
+	return h.setMenuDeleted(c, false)
+}
+
+func (h *MenuHandler) setMenuDeleted(c *fiber.Ctx, deleted bool) error {
+	id := c.Params("id")
+	now := time.Now().In(wib).Format(time.RFC3339)
+
+	update := map[string]interface{}{"deleted": deleted, "deletedAt": "", "updatedAt": now}
+	filter := map[string]interface{}{"_id": id, "deleted": true}
+	edit := menuEdit{action: models.MenuActionRestore, actor: c.Query("actor")}
+	if deleted {
+		update["deletedAt"] = now
+		filter["deleted"] = map[string]interface{}{"$ne": true}
+		edit.action = models.MenuActionDelete
+	}
+	// Only a change of state gets a version; repeating a delete or restore
+	// just touches the item
+	_, ok, err := writeMenu(h.dbClient, filter, update, edit)
+	if err == nil && !ok {
+		delete(update, "version")
+		ok, err = updateDocumentIf(h.dbClient, "menu_makanan", map[string]interface{}{"_id": id}, update)
+	}
+	invalidateMenuCache(h.dbClient)
+	if err == errMenuConflict {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Menu item not found"})
+	}
+
+	message := "Menu item restored"
+	if deleted {
+		message = "Menu item deleted"
+	}
+	return c.JSON(fiber.Map{"message": message, "id": id, "updatedAt": now})
+}
+
+// validateMenuRequest trims and checks a menu item against the other items
+// and categories: a categoryId must be a category of the item's subBrand,
+// otherwise the kategori must already be used within the kemitraan (unless
+// newKategori is set), and a subBrand may only belong to one kemitraan
+func validateMenuRequest(req *models.MenuRequest, id string, menus map[string]models.Menu, categories *categoryIndex) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Kemitraan = strings.TrimSpace(req.Kemitraan)
+	req.SubBrand = strings.TrimSpace(req.SubBrand)
+	req.Kategori = strings.TrimSpace(req.Kategori)
+
+	if req.CategoryID != "" {
+		cat, ok := categories.byID[req.CategoryID]
+		if !ok {
+			return fmt.Errorf("unknown categoryId %s", req.CategoryID)
+		}
+		if categoryScope(cat.Kemitraan, cat.SubBrand) != categoryScope(req.Kemitraan, req.SubBrand) {
+			return fmt.Errorf("category %s belongs to another subBrand", cat.Name)
+		}
+		req.Kategori = cat.Name
+	}
+
+	switch {
+	case req.Name == "":
+		return fmt.Errorf("name is required")
+	case req.Price <= 0:
+		return fmt.Errorf("price must be greater than 0")
+	case req.Kemitraan == "":
+		return fmt.Errorf("kemitraan is required")
+	case req.Kategori == "":
+		return fmt.Errorf("kategori is required")
+	}
+
+	knownKategori := false
+	for menuID, menu := range menus {
+		if menuID == id {
+			continue
+		}
+		sameKemitraan := menuKey(menu.Kemitraan) == menuKey(req.Kemitraan)
+		if req.SubBrand != "" && menuKey(menu.SubBrand) == menuKey(req.SubBrand) && !sameKemitraan {
+			return fmt.Errorf("subBrand %s belongs to kemitraan %s", req.SubBrand, menu.Kemitraan)
+		}
+		if sameKemitraan && req.CategoryID == "" && strings.EqualFold(menu.Kategori, req.Kategori) {
+			// Reuse the existing spelling
+			req.Kategori = menu.Kategori
+			knownKategori = true
+		}
+	}
+	if catID, ok := categories.byName[categoryNameKey(req.Kemitraan, req.SubBrand, req.Kategori)]; ok {
+		// The category's spelling wins over the items'
+		req.Kategori = categories.byID[catID].Name
+		knownKategori = true
+	}
+	if !knownKategori && !req.NewKategori {
+		return fmt.Errorf("unknown kategori %s for kemitraan %s (set newKategori to add it)", req.Kategori, req.Kemitraan)
+	}
+	if err := validateSchedule(req.Schedule); err != nil {
+		return err
+	}
+	return normalizeMenuOptions(req)
+}
+
+// imageErrorResponse answers a rejected image with 422 and a store failure
+// with 500
+func imageErrorResponse(c *fiber.Ctx, err error) error {
+	if _, ok := err.(*imageError); ok {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+}
+
+func menuFromRequest(id string, req models.MenuRequest) models.Menu {
+	return models.Menu{
+		ID:          id,
+		Name:        req.Name,
+		Description: req.Description,
+		Kemitraan:   req.Kemitraan,
+		SubBrand:    req.SubBrand,
+		Kategori:    req.Kategori,
+		CategoryID:  req.CategoryID,
+		Price:       req.Price,
+		ImageURL:    req.ImageURL,
+		ImageID:     req.ImageID,
+		ImageData:   req.ImageData,
+
+		Variants:       req.Variants,
+		ModifierGroups: req.ModifierGroups,
+		Schedule:       req.Schedule,
+	}
+}
+
+// menuDocument holds the fields written on create and update, using the
+// field names of the existing menu_makanan documents
+func menuDocument(menu models.Menu) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          menu.ID,
+		"name":        menu.Name,
+		"description": menu.Description,
+		"kemitraan":   menu.Kemitraan,
+		"subBrand":    menu.SubBrand,
+		"kategori":    menu.Kategori,
+		"categoryId":  menu.CategoryID,
+		"price":       menu.Price,
+		"imageUrl":    menu.ImageURL,
+		"imageId":     menu.ImageID,
+		"imageData":   menu.ImageData,
+		"updatedAt":   menu.UpdatedAt,
+		"deleted":     false,
+
+		"imageThumbUrl":  menu.ImageThumbURL,
+		"variants":       menu.Variants,
+		"modifierGroups": menu.ModifierGroups,
+		"schedule":       menu.Schedule,
+	}
+}
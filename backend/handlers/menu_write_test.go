@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// menuWriteApp serves the menu_makanan REST rows from the fake collection,
+// so reads see what the menu and category endpoints stored
+func menuWriteApp(t *testing.T) (*fakeDB, *config.AstraDBClient, *fiber.App) {
+	t.Helper()
+	invalidateCategories()
+	t.Cleanup(invalidateCategories)
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		if path != menuRowsPath {
+			return 404, `{"description":"not found"}`
+		}
+		data, _ := json.Marshal(map[string]interface{}{"data": db.find("menu_makanan", nil)})
+		return 200, string(data)
+	}
+	h := NewMenuHandler(client, nil)
+	app := fiber.New()
+	app.Post("/menu", h.CreateMenu)
+	app.Put("/menu/:id", h.UpdateMenu)
+	app.Delete("/menu/:id", h.DeleteMenu)
+	app.Post("/menu/:id/restore", h.RestoreMenu)
+	app.Get("/menu", h.GetAllMenu)
+	app.Get("/menu/categories", h.GetCategories)
+	app.Post("/menu/categories/migrate", h.MigrateCategories)
+	app.Put("/menu/categories/order", h.ReorderCategories)
+	return db, client, app
+}
+
+func TestCreateMenuValidates(t *testing.T) {
+	db, _, app := menuWriteApp(t)
+	db.insert("menu_makanan", map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "WRITETEST", "subBrand": "Teh Kita", "kategori": "Minuman", "price": 5000})
+
+	tests := []struct {
+		name string
+		req  models.MenuRequest
+	}{
+		{"no price", models.MenuRequest{Name: "Es Jeruk", Kemitraan: "WRITETEST", Kategori: "Minuman"}},
+		{"no name", models.MenuRequest{Name: " ", Kemitraan: "WRITETEST", Kategori: "Minuman", Price: 6000}},
+		{"unknown kategori", models.MenuRequest{Name: "Es Jeruk", Kemitraan: "WRITETEST", Kategori: "Jus", Price: 6000}},
+		{"subBrand of another kemitraan", models.MenuRequest{Name: "Es Jeruk", Kemitraan: "OTHERTEST", SubBrand: "Teh Kita", Kategori: "Minuman", Price: 6000, NewKategori: true}},
+		{"unknown categoryId", models.MenuRequest{Name: "Es Jeruk", Kemitraan: "WRITETEST", CategoryID: "nope", Price: 6000}},
+	}
+	for _, tt := range tests {
+		if status, body := do(t, app, "POST", "/menu", tt.req); status != 422 {
+			t.Errorf("%s: status %d %v, want 422", tt.name, status, body)
+		}
+	}
+	if n := len(db.find("menu_makanan", nil)); n != 1 {
+		t.Errorf("%d menu items stored, want only the seeded one", n)
+	}
+
+	// A known kategori is matched case-insensitively and keeps its spelling
+	status, body := do(t, app, "POST", "/menu", models.MenuRequest{Name: "Es Jeruk", Kemitraan: "WRITETEST", SubBrand: "Teh Kita", Kategori: "minuman", Price: 6000})
+	if status != 201 || body["kategori"] != "Minuman" {
+		t.Errorf("create: status %d %v, want 201 with kategori Minuman", status, body)
+	}
+}
+
+func TestMenuWritesInvalidateTheMenuCache(t *testing.T) {
+	db, client, app := menuWriteApp(t)
+	db.insert("menu_makanan", map[string]interface{}{"_id": "M1", "id": "M1", "name": "Es Teh", "kemitraan": "CACHETEST", "kategori": "Minuman", "price": 5000})
+
+	menus := func() map[string]models.Menu {
+		t.Helper()
+		menus, err := loadMenus(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return menus
+	}
+	if len(menus()) != 1 {
+		t.Fatal("seeded item not loaded")
+	}
+
+	status, body := do(t, app, "POST", "/menu", models.MenuRequest{Name: "Es Jeruk", Kemitraan: "CACHETEST", Kategori: "Minuman", Price: 6000})
+	if status != 201 {
+		t.Fatalf("create: status %d %v", status, body)
+	}
+	id, _ := body["id"].(string)
+	if _, ok := menus()[id]; !ok {
+		t.Fatal("created item missing from the menu after the write")
+	}
+
+	if status, body := do(t, app, "PUT", "/menu/"+id, models.MenuRequest{Name: "Es Jeruk Besar", Kemitraan: "CACHETEST", Kategori: "Minuman", Price: 8000}); status != 200 {
+		t.Fatalf("update: status %d %v", status, body)
+	}
+	if got := menus()[id]; got.Name != "Es Jeruk Besar" || got.Price != 8000 {
+		t.Errorf("menu after update has %s at %d", got.Name, got.Price)
+	}
+
+	// Soft delete hides the item but keeps the document
+	if status, body := do(t, app, "DELETE", "/menu/"+id, nil); status != 200 {
+		t.Fatalf("delete: status %d %v", status, body)
+	}
+	if _, ok := menus()[id]; ok {
+		t.Error("deleted item still on the menu")
+	}
+	if docs := db.find("menu_makanan", map[string]interface{}{"_id": id, "deleted": true}); len(docs) != 1 {
+		t.Error("deleted item not kept as a soft-deleted document")
+	}
+	if status, _ := do(t, app, "PUT", "/menu/"+id, models.MenuRequest{Name: "Es Jeruk", Kemitraan: "CACHETEST", Kategori: "Minuman", Price: 6000}); status != 404 {
+		t.Errorf("update of a deleted item: status %d, want 404", status)
+	}
+
+	if status, body := do(t, app, "POST", "/menu/"+id+"/restore", nil); status != 200 {
+		t.Fatalf("restore: status %d %v", status, body)
+	}
+	if _, ok := menus()[id]; !ok {
+		t.Error("restored item missing from the menu")
+	}
+}
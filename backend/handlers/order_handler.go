@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/events"
 	"sagawa_pos_backend/models"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -20,105 +22,361 @@ func NewOrderHandler(dbClient *config.AstraDBClient) *OrderHandler {
 	return &OrderHandler{dbClient: dbClient}
 }
 
-// GetAllOrders retrieves all orders
+// GetAllOrders retrieves orders, optionally filtered by outlet_id, status
+// and table_number
 func (h *OrderHandler) GetAllOrders(c *fiber.Ctx) error {
-	respData, err := h.dbClient.ExecuteQuery("GET", "/orders/rows", nil)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	filter := map[string]interface{}{}
+	if outletID := c.Query("outlet_id"); outletID != "" {
+		filter["outlet_id"] = outletID
 	}
-
-	var response struct {
-		Data []models.Order `json:"data"`
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
 	}
-	if err := json.Unmarshal(respData, &response); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to parse response"})
+	if table := c.Query("table_number"); table != "" {
+		filter["table_number"] = table
+	}
+
+	orders, err := findOrders(h.dbClient, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(response.Data)
+	return c.JSON(orders)
 }
 
 // GetOrder retrieves a single order by ID
 func (h *OrderHandler) GetOrder(c *fiber.Ctx) error {
-	id := c.Params("id")
-	path := fmt.Sprintf("/orders/%s", id)
-
-	respData, err := h.dbClient.ExecuteQuery("GET", path, nil)
+	order, err := loadOrder(h.dbClient, c.Params("id"))
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
-	}
-
-	var response struct {
-		Data models.Order `json:"data"`
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	if err := json.Unmarshal(respData, &response); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to parse response"})
+	if order == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
 	}
 
-	return c.JSON(response.Data)
+	return c.JSON(order)
 }
 
-// CreateOrder creates a new order
+// CreateOrder creates a new open order with its items
 func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
 	var order models.Order
 	if err := c.BodyParser(&order); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
+	if err := prepareOrderItems(order.Items); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := checkAvailable(h.dbClient, order.OutletID, orderMenuIDs(order.Items)); err != nil {
+		return c.Status(availabilityStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	if order.TableNumber != "" {
+		if order.Type == "" {
+			order.Type = "dine_in"
+		}
+		existing, err := activeBillForTable(h.dbClient, order.OutletID, order.TableNumber)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if existing != nil {
+			return c.Status(409).JSON(fiber.Map{"error": "Table " + order.TableNumber + " already has an open bill", "order_id": existing.ID})
+		}
+	}
+
+	now := time.Now().In(wib)
+	orderNumber, err := issueNumber(h.dbClient, models.SequenceOrder, order.OutletID, "", now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue order number: " + err.Error()})
+	}
+	var queueNumber *models.SequenceNumber
+	if order.TableNumber == "" {
+		queueNumber, err = issueNumber(h.dbClient, models.SequenceQueue, order.OutletID, "", now)
+		if err != nil {
+			releaseNumber(h.dbClient, orderNumber)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to issue queue number: " + err.Error()})
+		}
+		order.QueueNumber = queueNumber.Number
+	}
+	// Numbers of an order that is not stored are issued again
+	release := func() {
+		releaseNumber(h.dbClient, orderNumber)
+		releaseNumber(h.dbClient, queueNumber)
+	}
 
 	order.ID = uuid.New().String()
-	order.OrderNumber = fmt.Sprintf("ORD-%d", time.Now().Unix())
-	order.CreatedAt = time.Now()
-	order.UpdatedAt = time.Now()
-	order.Status = "pending"
-
-	// Calculate total
-	var total float64
-	for i := range order.Items {
-		order.Items[i].Subtotal = float64(order.Items[i].Quantity) * order.Items[i].Price
-		total += order.Items[i].Subtotal
-	}
-	order.TotalAmount = total
-
-	body := map[string]interface{}{
-		"id":             order.ID,
-		"order_number":   order.OrderNumber,
-		"customer_id":    order.CustomerID,
-		"total_amount":   order.TotalAmount,
-		"status":         order.Status,
-		"payment_method": order.PaymentMethod,
-		"created_at":     order.CreatedAt,
-		"updated_at":     order.UpdatedAt,
-	}
-
-	if _, err := h.dbClient.ExecuteQuery("POST", "/orders", body); err != nil {
+	order.OrderNumber = orderNumber.Number
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	order.Status = models.OrderStatusOpen
+	order.StatusTimes = map[string]string{models.OrderStatusOpen: now.Format(time.RFC3339)}
+	order.History = []models.OrderTransition{{
+		To:    models.OrderStatusOpen,
+		Actor: order.CreatedBy,
+		At:    now.Format(time.RFC3339),
+	}}
+	order.TotalAmount = orderTotal(order.Items)
+
+	document, err := toDocument(order)
+	if err != nil {
+		release()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	document["_id"] = order.ID
+
+	if _, err := h.dbClient.InsertDocument("pos_order", document); err != nil {
+		release()
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	if order.TableNumber != "" {
+		if err := occupyTableForBill(h.dbClient, order.OutletID, order.TableNumber); err != nil {
+			fmt.Printf("Warning: Bill %s opened but table %s was not seated: %v\n", order.ID, order.TableNumber, err)
+		}
+	}
 
 	return c.Status(201).JSON(order)
 }
 
-// UpdateOrderStatus updates the status of an order
-func (h *OrderHandler) UpdateOrderStatus(c *fiber.Ctx) error {
-	id := c.Params("id")
+// UpdateOrderItems replaces the items of an order. Items can only be changed
+// while the order is still open.
+func (h *OrderHandler) UpdateOrderItems(c *fiber.Ctx) error {
+	var req models.UpdateOrderItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := prepareOrderItems(req.Items); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	var reqBody struct {
-		Status string `json:"status"`
+	order, err := loadOrder(h.dbClient, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	if err := c.BodyParser(&reqBody); err != nil {
+	if order == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if order.Status != models.OrderStatusOpen {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Items can only be changed while the order is open (order is %s)", order.Status)})
+	}
+
+	ok, err := saveOrderItems(h.dbClient, order, req.Items)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Order was changed concurrently, reload and try again"})
+	}
+
+	return c.JSON(order)
+}
+
+// UpdateOrderStatus moves an order to its next state. Only transitions
+// allowed by the order state machine are accepted; others return 409.
+func (h *OrderHandler) UpdateOrderStatus(c *fiber.Ctx) error {
+	var req models.UpdateOrderStatusRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
+	req.Status = strings.ToLower(strings.TrimSpace(req.Status))
+	if !models.IsOrderStatus(req.Status) {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown order status: " + req.Status})
+	}
+	if req.Actor == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "actor is required"})
+	}
 
-	updatedAt := time.Now()
-	body := map[string]interface{}{
-		"status":     reqBody.Status,
-		"updated_at": updatedAt,
+	order, err := loadOrder(h.dbClient, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if order == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
 	}
 
-	path := fmt.Sprintf("/orders/%s", id)
-	if _, err := h.dbClient.ExecuteQuery("PATCH", path, body); err != nil {
+	ok, err := transitionOrder(h.dbClient, order, req.Status, req.Actor, req.Reason)
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   fmt.Sprintf("Cannot change order from %s to %s", order.Status, req.Status),
+			"status":  order.Status,
+			"allowed": models.NextOrderStatuses(order.Status),
+		})
+	}
+
+	switch order.Status {
+	case models.OrderStatusSentToKitchen:
+		routeToKitchen(h.dbClient, order, order.Items)
+	case models.OrderStatusCancelled:
+		voidKitchenItems(h.dbClient, order.ID, "")
+	}
+
+	return c.JSON(fiber.Map{"message": "Order status updated successfully", "status": order.Status, "order": order})
+}
+
+// transitionOrder moves an order to a new state, recording the time and
+// actor. It returns false if the transition is not allowed, the order
+// changed state concurrently or a bill is being settled.
+func transitionOrder(dbClient *config.AstraDBClient, order *models.Order, to, actor, reason string) (bool, error) {
+	return transitionOrderIf(dbClient, order, to, actor, reason, map[string]interface{}{"settling": map[string]interface{}{"$ne": true}}, nil)
+}
+
+// transitionOrderIf is transitionOrder with extra conditions on the stored
+// order and extra fields to set along with the new state
+func transitionOrderIf(dbClient *config.AstraDBClient, order *models.Order, to, actor, reason string, match, set map[string]interface{}) (bool, error) {
+	from := order.Status
+	if !models.CanTransition(from, to) {
+		return false, nil
+	}
+
+	now := time.Now().In(wib)
+	if order.StatusTimes == nil {
+		order.StatusTimes = make(map[string]string)
+	}
+	order.StatusTimes[to] = now.Format(time.RFC3339)
+	order.History = append(order.History, models.OrderTransition{
+		From:   from,
+		To:     to,
+		Actor:  actor,
+		At:     now.Format(time.RFC3339),
+		Reason: reason,
+	})
+
+	update := map[string]interface{}{
+		"status":       to,
+		"status_times": order.StatusTimes,
+		"history":      order.History,
+		"updated_at":   now,
+	}
+	for k, v := range set {
+		update[k] = v
+	}
+	filter := map[string]interface{}{"_id": order.ID, "status": from}
+	for k, v := range match {
+		filter[k] = v
+	}
+	ok, err := updateDocumentIf(dbClient, "pos_order", filter, update)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	order.Status = to
+	order.UpdatedAt = now
+
+	publishEvent(dbClient, events.OrderStatusChanged, order.OutletID, fiber.Map{
+		"order_id":     order.ID,
+		"order_number": order.OrderNumber,
+		"table_number": order.TableNumber,
+		"from":         from,
+		"to":           to,
+		"actor":        actor,
+	})
+	return true, nil
+}
+
+// saveOrderItems stores new items and total on an order, provided it has not
+// changed since it was loaded and is not being settled
+func saveOrderItems(dbClient *config.AstraDBClient, order *models.Order, items []models.OrderItem) (bool, error) {
+	previous := order.UpdatedAt
+	now := time.Now().In(wib)
+
+	update := map[string]interface{}{
+		"items":        items,
+		"total_amount": orderTotal(items),
+		"updated_at":   now,
+	}
+	filter := map[string]interface{}{
+		"_id":        order.ID,
+		"updated_at": previous,
+		"settling":   map[string]interface{}{"$ne": true},
+	}
+	ok, err := updateDocumentIf(dbClient, "pos_order", filter, update)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	order.Items = items
+	order.TotalAmount = orderTotal(items)
+	order.UpdatedAt = now
+	return true, nil
+}
+
+// prepareOrderItems validates items, computes their subtotals and gives new
+// lines an ID
+func prepareOrderItems(items []models.OrderItem) error {
+	now := time.Now().In(wib).Format(time.RFC3339)
+	for i := range items {
+		if items[i].LineID == "" {
+			items[i].LineID = newLineID()
+		}
+		if items[i].AddedAt == "" {
+			items[i].AddedAt = now
+		}
+		if items[i].Quantity <= 0 {
+			return fmt.Errorf("Item quantity must be > 0")
+		}
+		if items[i].Price < 0 {
+			return fmt.Errorf("Item price must not be negative")
+		}
+		items[i].Subtotal = items[i].Price.Times(items[i].Quantity)
+	}
+	return nil
+}
+
+// orderMenuIDs returns the menu IDs of order items
+func orderMenuIDs(items []models.OrderItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ProductID)
+	}
+	return ids
+}
+
+// newLineID returns a short ID for an order line
+func newLineID() string {
+	return strings.Split(uuid.New().String(), "-")[0]
+}
+
+// orderTotal sums the subtotals of order items
+func orderTotal(items []models.OrderItem) models.Money {
+	var total models.Money
+	for _, item := range items {
+		total += item.Subtotal
+	}
+	return total
+}
+
+// loadOrder fetches an order by ID; nil if it does not exist. Orders still
+// in the old orders table are read through from it.
+func loadOrder(dbClient *config.AstraDBClient, id string) (*models.Order, error) {
+	orders, err := findOrders(dbClient, map[string]interface{}{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return loadLegacyOrder(dbClient, id)
+	}
+	return &orders[0], nil
+}
 
-	return c.JSON(fiber.Map{"message": "Order status updated successfully", "status": reqBody.Status})
+// findOrders fetches orders matching a filter, newest first
+func findOrders(dbClient *config.AstraDBClient, filter map[string]interface{}) ([]models.Order, error) {
+	docs, err := findDocuments(dbClient, "pos_order", filter, map[string]interface{}{"created_at": -1}, 10)
+	if err != nil {
+		return nil, err
+	}
+	orders := []models.Order{}
+	for _, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var order models.Order
+		if err := json.Unmarshal(data, &order); err != nil {
+			return nil, fmt.Errorf("failed to parse order: %v", err)
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
 }
 
 // SaveTransaction saves a completed transaction to the database
@@ -127,25 +385,201 @@ func (h *OrderHandler) SaveTransaction(c *fiber.Ctx) error {
 	if err := c.BodyParser(&transaction); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
+	if transaction.IdempotencyKey == "" {
+		transaction.IdempotencyKey = c.Get("Idempotency-Key")
+	}
+
+	status, response := h.saveTransaction(&transaction)
+	return c.Status(status).JSON(response)
+}
+
+// saveTransaction validates, prices and stores a transaction, returning the
+// HTTP status and response body. Open bills are settled through it as well.
+func (h *OrderHandler) saveTransaction(transaction *models.Transaction) (int, fiber.Map) {
+	return h.saveTransactionAt(transaction, time.Now())
+}
 
-	// Validate required fields
+// saveTransactionAt is saveTransaction with the created_at to record;
+// transactions uploaded by offline devices keep the time they were rung up.
+// Those (with a device_seq) are checked against promotions at that time, and
+// promotion or QRIS checks that fail do not reject them: the sale already
+// happened, so it is saved with review_flags for the back office.
+func (h *OrderHandler) saveTransactionAt(transaction *models.Transaction, at time.Time) (int, fiber.Map) {
+	offline := transaction.DeviceSeq > 0
+	var flags []string
+	repriced := false
+
+	// Validate required fields; an empty trx_id is allocated by the server,
+	// once per idempotency key so a retried request gets the same one
 	if transaction.TrxID == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Transaction ID is required"})
+		if transaction.IdempotencyKey == "" {
+			return 400, fiber.Map{"error": "trx_id is required; allocate one with POST /transactions/ids or send an Idempotency-Key"}
+		}
+		trxID, err := idempotentTrxID(h.dbClient, transaction.OutletID, transaction.IdempotencyKey)
+		if err != nil {
+			return 500, fiber.Map{"error": err.Error()}
+		}
+		transaction.TrxID = trxID
+	}
+	if transaction.TrxID != "" {
+		if err := validateTrxID(transaction, time.Now()); err != nil {
+			return 400, fiber.Map{"error": err.Error()}
+		}
+
+		// A retry of a saved transaction is answered without saving it again
+		existing, err := findDocuments(h.dbClient, "order", map[string]interface{}{"_id": transaction.TrxID}, nil, 1)
+		if err != nil {
+			return 500, fiber.Map{"error": err.Error()}
+		}
+		if len(existing) > 0 {
+			return alreadySaved(transaction.TrxID)
+		}
 	}
 	if transaction.Cashier == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Cashier is required"})
+		return 400, fiber.Map{"error": "Cashier is required"}
 	}
 	if transaction.Type == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Order type is required"})
+		return 400, fiber.Map{"error": "Order type is required"}
+	}
+	if transaction.Method == "" && len(transaction.Payments) == 0 {
+		return 400, fiber.Map{"error": "Payment method is required"}
+	}
+
+	// A quote from POST /cart/quote fixes the numbers; otherwise re-run the
+	// promotions engine so clients cannot invent discounts
+	if transaction.QuoteID != "" {
+		quote, err := verifyQuote(transaction.QuoteID)
+		if err != nil {
+			return 422, fiber.Map{"error": err.Error()}
+		}
+		if err := applyQuote(transaction, quote); err != nil {
+			return 422, fiber.Map{"error": err.Error()}
+		}
+	} else {
+		// Options sent by ID are priced from the menu and recorded in full;
+		// lines the server priced change the subtotal
+		if hasMenuItems(transaction.Items) {
+			menus, err := outletMenus(h.dbClient, transaction.OutletID, at)
+			if err != nil {
+				return 500, fiber.Map{"error": err.Error()}
+			}
+			if repriced, err = resolveTransactionOptions(menus, transaction); err != nil {
+				return 422, fiber.Map{"error": err.Error()}
+			}
+			if repriced {
+				transaction.Subtotal = 0
+				for _, item := range transaction.Items {
+					transaction.Subtotal += item.Subtotal
+				}
+			}
+		}
+		if transaction.PromoDiscount > 0 || len(transaction.Promotions) > 0 {
+			if err := validateTransactionPromotions(h.dbClient, transaction, at); err != nil {
+				_, invalid := err.(*cartError)
+				switch {
+				case !invalid:
+					return 500, fiber.Map{"error": err.Error()}
+				case !offline:
+					return 422, fiber.Map{"error": err.Error()}
+				}
+				// The device already gave the discount; keep it for review
+				flags = append(flags, "promotions not verified: "+err.Error())
+			}
+		}
+	}
+
+	// Rounding applies to sales with a cash leg and is done before legacy
+	// legs are derived from the total
+	cash := paysCash(transaction)
+	if transaction.QuoteID == "" {
+		settings, err := loadOutletSettings(h.dbClient, transaction.OutletID)
+		if err != nil {
+			return 500, fiber.Map{"error": err.Error()}
+		}
+
+		// Service charge and tax follow the outlet's settings. A client that
+		// left prices to the server could not work them out.
+		if repriced {
+			applyCharges(transaction, settings)
+		} else if err := checkCharges(transaction, settings, cash); err != nil {
+			if !offline {
+				return 422, fiber.Map{"error": err.Error()}
+			}
+			// The device charged with the settings it had; keep them
+			flags = append(flags, "charges not verified: "+err.Error())
+		}
+
+		// Apply the outlet's cash rounding rule and record the adjustment
+		if rounded := settings.CashRounding.Apply(transaction.Total); cash && rounded != transaction.Total {
+			transaction.Rounding = rounded - transaction.Total
+			transaction.Total = rounded
+		}
+	}
+
+	legacyPayments := normalizePayments(transaction)
+
+	// QRIS legs paid through the gateway must be confirmed by its webhook.
+	// Offline sales were paid while the server could not be asked, so they
+	// are kept and flagged instead.
+	charges, err := verifyGatewayPayments(h.dbClient, transaction)
+	if err != nil {
+		if !offline {
+			return 422, fiber.Map{"error": err.Error()}
+		}
+		charges = nil
+		for i, p := range transaction.Payments {
+			if p.Method == models.PaymentQris && p.Reference != "" {
+				transaction.Payments[i].Status = models.PaymentStatusPaid
+			}
+		}
+		flags = append(flags, "QRIS not verified: "+err.Error())
 	}
-	if transaction.Method == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Payment method is required"})
+
+	// Payments must cover the total; change is computed from cash only
+	if err := settlePayments(transaction, legacyPayments); err != nil {
+		return 422, fiber.Map{"error": err.Error()}
 	}
 
 	// Set created_at timestamp with WIB timezone (UTC+7)
 	// Use fixed timezone to ensure consistency regardless of server location
-	wib := time.FixedZone("WIB", 7*60*60) // UTC+7
-	createdAt := time.Now().In(wib).Format(time.RFC3339)
+	createdAt := at.In(wib).Format(time.RFC3339)
+
+	if transaction.TrxID == "" {
+		trxID, err := allocateTrxID(h.dbClient, transaction.OutletID, transaction.DeviceID, at)
+		if err != nil {
+			return 400, fiber.Map{"error": "Transaction ID is required: " + err.Error()}
+		}
+		// A concurrent retry may have allocated first; both use its ID
+		if transaction.TrxID, err = recordIdempotentTrxID(h.dbClient, transaction.OutletID, transaction.IdempotencyKey, trxID); err != nil {
+			releaseTrxID(h.dbClient, transaction.OutletID, trxID)
+			return 500, fiber.Map{"error": err.Error()}
+		}
+		if transaction.TrxID != trxID {
+			releaseTrxID(h.dbClient, transaction.OutletID, trxID)
+		}
+	}
+
+	// A quote and its voucher pay for one transaction only
+	if transaction.QuoteID != "" {
+		redeemed, status, err := redeemQuote(h.dbClient, transaction, at)
+		if err != nil {
+			return status, fiber.Map{"error": err.Error()}
+		}
+		if redeemed {
+			publishEvent(h.dbClient, events.VoucherRedeemed, transaction.OutletID, fiber.Map{
+				"code_voucher": transaction.VoucherCode,
+				"nominal":      transaction.VoucherDiscount,
+				"redeemed_by":  transaction.Customer,
+				"trx_id":       transaction.TrxID,
+			})
+		}
+	}
+
+	// Items keep the menu version they were sold at
+	stampMenuVersions(h.dbClient, transaction)
+
+	// Items sold outside their menu schedule are recorded, but flagged
+	offSchedule := flagOffSchedule(h.dbClient, transaction, at)
 
 	// Prepare document for Data API (Collection)
 	document := map[string]interface{}{
@@ -165,34 +599,150 @@ func (h *OrderHandler) SaveTransaction(c *fiber.Ctx) error {
 		"total":       transaction.Total,
 		"qris":        transaction.Qris,
 		"changes":     transaction.Changes,
+		"payments":    transaction.Payments,
 		"created_at":  createdAt,
 		"status":      "completed",
 	}
+	if len(transaction.Promotions) > 0 {
+		document["member_id"] = transaction.MemberID
+		document["promo_discount"] = transaction.PromoDiscount
+		document["promotions"] = transaction.Promotions
+	}
+	if transaction.DeviceID != "" {
+		document["device_id"] = transaction.DeviceID
+	}
+	if offSchedule > 0 {
+		document["off_schedule_items"] = offSchedule
+	}
+	if len(flags) > 0 {
+		document["review_flags"] = flags
+	}
+	if transaction.DeviceSeq > 0 {
+		document["device_seq"] = transaction.DeviceSeq
+		document["synced_at"] = time.Now().In(wib).Format(time.RFC3339)
+	}
+	if transaction.Rounding != 0 {
+		document["rounding"] = transaction.Rounding
+	}
+	if transaction.QuoteID != "" {
+		document["quote_id"] = transaction.QuoteID
+		document["voucher_code"] = transaction.VoucherCode
+		document["voucher_discount"] = transaction.VoucherDiscount
+	}
+	if transaction.TaxName != "" {
+		document["service_charge"] = transaction.ServiceCharge
+		document["service_rate"] = transaction.ServiceRate
+		document["tax_name"] = transaction.TaxName
+		document["tax_rate"] = transaction.TaxRate
+		document["tax_inclusive"] = transaction.TaxInclusive
+	}
 
 	// Always save to local file as backup
 	if err := saveTransactionToFile(document); err != nil {
 		fmt.Printf("Warning: Failed to save transaction to local file: %v\n", err)
 	}
 
+	// Gateway charges cannot be reused once the transaction is recorded
+	finalizeCharges(h.dbClient, charges)
+
 	// Save to AstraDB using Data API (Collection: order)
 	respBody, dbErr := h.dbClient.InsertDocument("order", document)
+	if config.IsDuplicateDocument(dbErr) {
+		return alreadySaved(transaction.TrxID)
+	}
 	if dbErr != nil {
 		fmt.Printf("Warning: Failed to save to AstraDB: %v\n", dbErr)
 		// Still return success since we have local backup
-		return c.Status(201).JSON(fiber.Map{
+		return 201, fiber.Map{
 			"message":  "Transaction saved to local backup (DB temporarily unavailable)",
 			"trx_id":   transaction.TrxID,
 			"db_saved": false,
-		})
+		}
 	}
 
 	fmt.Printf("Transaction saved to AstraDB: %s\n", string(respBody))
 
-	return c.Status(201).JSON(fiber.Map{
+	// Dashboards only hear about transactions that are actually stored
+	publishEvent(h.dbClient, events.TransactionSaved, transaction.OutletID, fiber.Map{
+		"trx_id":     transaction.TrxID,
+		"type":       transaction.Type,
+		"method":     transaction.Method,
+		"cashier":    transaction.Cashier,
+		"items":      len(transaction.Items),
+		"total":      transaction.Total,
+		"created_at": createdAt,
+	})
+
+	response := fiber.Map{
 		"message":  "Transaction saved successfully",
 		"trx_id":   transaction.TrxID,
 		"db_saved": true,
+	}
+	if len(flags) > 0 {
+		response["review_flags"] = flags
+	}
+	return 201, response
+}
+
+// alreadySaved answers a retry of a transaction that is already stored
+func alreadySaved(trxID string) (int, fiber.Map) {
+	return 200, fiber.Map{
+		"message":   "Transaction already saved",
+		"trx_id":    trxID,
+		"db_saved":  true,
+		"duplicate": true,
+	}
+}
+
+// VoidTransaction marks a completed transaction as voided. Voided
+// transactions stay listed but no longer count in reports.
+func (h *OrderHandler) VoidTransaction(c *fiber.Ctx) error {
+	trxID := c.Params("trx_id")
+
+	var req struct {
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Actor == "" || req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "actor and reason are required"})
+	}
+
+	trx, err := findDocuments(h.dbClient, "order", map[string]interface{}{"_id": trxID}, nil, 1)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(trx) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Transaction not found"})
+	}
+
+	voidedAt := time.Now().In(wib).Format(time.RFC3339)
+	update := map[string]interface{}{
+		"status":      "voided",
+		"voided_at":   voidedAt,
+		"voided_by":   req.Actor,
+		"void_reason": req.Reason,
+	}
+	ok, err := updateDocumentIf(h.dbClient, "order", map[string]interface{}{"_id": trxID, "status": "completed"}, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Transaction is already voided"})
+	}
+
+	outletID, _ := trx[0]["outlet_id"].(string)
+	publishEvent(h.dbClient, events.TransactionVoided, outletID, fiber.Map{
+		"trx_id":    trxID,
+		"total":     toMoney(trx[0]["total"]),
+		"voided_by": req.Actor,
+		"reason":    req.Reason,
+		"voided_at": voidedAt,
 	})
+
+	return c.JSON(fiber.Map{"message": "Transaction voided", "trx_id": trxID, "voided_at": voidedAt})
 }
 
 // saveTransactionToFile saves transaction to a local JSON Lines file
@@ -547,65 +1097,15 @@ func (h *OrderHandler) GetYearlyRecap(c *fiber.Ctx) error {
 	}
 
 	// Fetch all transactions for the year (paginated internally)
-	var allTransactions []map[string]interface{}
-	pageState := ""
-	pageCount := 0
-	batchSize := 1000 // Increased for yearly recap
-
-	for {
-		options := map[string]interface{}{
-			"sort":  map[string]interface{}{"created_at": -1},
-			"limit": batchSize,
-		}
-		if pageState != "" {
-			options["pageState"] = pageState
-		}
-
-		respBody, err := h.dbClient.FindDocuments("order", filter, options)
-		if err != nil {
-			fmt.Printf("Error fetching transactions: %v\n", err)
-			break
-		}
-
-		var response struct {
-			Data struct {
-				Documents []map[string]interface{} `json:"documents"`
-			} `json:"data"`
-			Status struct {
-				PageState string `json:"pageState"`
-			} `json:"status"`
-		}
-
-		if err := json.Unmarshal(respBody, &response); err != nil {
-			fmt.Printf("Error parsing response: %v\n", err)
-			break
-		}
-
-		if len(response.Data.Documents) == 0 {
-			break
-		}
-
-		allTransactions = append(allTransactions, response.Data.Documents...)
-
-		// Check for next page
-		if response.Status.PageState == "" {
-			break
-		}
-		pageState = response.Status.PageState
-		pageCount++
-
-		// Safety limit: max 200 pages (200,000 transactions per year) - increased for yearly reporting
-		if pageCount >= 200 {
-			fmt.Printf("[WARNING] Reached max page limit of 200 pages for yearly recap. Total fetched: %d transactions\n", len(allTransactions))
-			break
-		}
-	}
+	// Safety limit: max 200 pages (200,000 transactions per year)
+	allTransactions := fetchTransactions(h.dbClient, filter, 200)
 
 	// Calculate summary statistics
-	var totalRevenue float64
-	var totalTax float64
+	var totalRevenue models.Money
+	var totalTax models.Money
+	var totalRounding models.Money
 	var totalTransactions int
-	monthlyRevenue := make(map[int]float64) // month -> revenue
+	monthlyRevenue := make(map[int]models.Money) // month -> revenue
 	monthlyCount := make(map[int]int)       // month -> transaction count
 	paymentMethods := make(map[string]int)  // method -> count
 	orderTypes := make(map[string]int)      // type -> count
@@ -613,23 +1113,17 @@ func (h *OrderHandler) GetYearlyRecap(c *fiber.Ctx) error {
 	for _, trx := range allTransactions {
 		totalTransactions++
 
-		// Get total
-		if total, ok := trx["total"].(float64); ok {
-			totalRevenue += total
-		}
-
-		// Get tax
-		if tax, ok := trx["tax"].(float64); ok {
-			totalTax += tax
-		}
+		// Sum in whole rupiah to avoid float drift over large volumes
+		total := toMoney(trx["total"])
+		totalRevenue += total
+		totalTax += toMoney(trx["tax"])
+		totalRounding += toMoney(trx["rounding"])
 
 		// Get month from created_at
 		if createdAt, ok := trx["created_at"].(string); ok {
 			if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
 				month := int(t.Month())
-				if total, ok := trx["total"].(float64); ok {
-					monthlyRevenue[month] += total
-				}
+				monthlyRevenue[month] += total
 				monthlyCount[month]++
 			}
 		}
@@ -665,14 +1159,101 @@ func (h *OrderHandler) GetYearlyRecap(c *fiber.Ctx) error {
 		"total_transactions": totalTransactions,
 		"total_revenue":      totalRevenue,
 		"total_tax":          totalTax,
-		"average_per_transaction": func() float64 {
+		"total_rounding":     totalRounding,
+		"average_per_transaction": func() models.Money {
 			if totalTransactions > 0 {
-				return totalRevenue / float64(totalTransactions)
+				return models.NewMoney(totalRevenue.Float64() / float64(totalTransactions))
 			}
 			return 0
 		}(),
 		"monthly_breakdown": monthlyBreakdown,
 		"payment_methods":   paymentMethods,
 		"order_types":       orderTypes,
+		"tax_breakdown":     summarizeTaxByRate(allTransactions),
+		"payment_breakdown": summarizePayments(allTransactions),
 	})
 }
+
+// fetchTransactions pages through the order collection for the given filter,
+// newest first, stopping after maxPages pages of 1000 documents. Voided
+// transactions are left out unless the filter asks for a status.
+func fetchTransactions(dbClient *config.AstraDBClient, filter map[string]interface{}, maxPages int) []map[string]interface{} {
+	if _, ok := filter["status"]; !ok {
+		withStatus := map[string]interface{}{"status": map[string]interface{}{"$ne": "voided"}}
+		for k, v := range filter {
+			withStatus[k] = v
+		}
+		filter = withStatus
+	}
+	return fetchDocuments(dbClient, "order", filter, map[string]interface{}{"created_at": -1}, maxPages)
+}
+
+// fetchDocuments pages through a collection using pageState, stopping after
+// maxPages pages of 1000 documents. Errors are logged and whatever was
+// fetched so far is returned; use findDocuments where a failed read must
+// not look like an empty one.
+func fetchDocuments(dbClient *config.AstraDBClient, collection string, filter, sort map[string]interface{}, maxPages int) []map[string]interface{} {
+	documents, err := findDocuments(dbClient, collection, filter, sort, maxPages)
+	if err != nil {
+		fmt.Printf("Error fetching %s documents: %v\n", collection, err)
+	}
+	return documents
+}
+
+// findDocuments is fetchDocuments that reports DB errors
+func findDocuments(dbClient *config.AstraDBClient, collection string, filter, sort map[string]interface{}, maxPages int) ([]map[string]interface{}, error) {
+	var allDocuments []map[string]interface{}
+	pageState := ""
+	pageCount := 0
+	batchSize := 1000
+
+	for {
+		options := map[string]interface{}{
+			"limit": batchSize,
+		}
+		if sort != nil {
+			options["sort"] = sort
+		}
+		if pageState != "" {
+			options["pageState"] = pageState
+		}
+
+		respBody, err := dbClient.FindDocuments(collection, filter, options)
+		if err != nil {
+			return allDocuments, err
+		}
+
+		var response struct {
+			Data struct {
+				Documents []map[string]interface{} `json:"documents"`
+			} `json:"data"`
+			Status struct {
+				PageState string `json:"pageState"`
+			} `json:"status"`
+		}
+
+		if err := json.Unmarshal(respBody, &response); err != nil {
+			return allDocuments, fmt.Errorf("error parsing %s documents: %v", collection, err)
+		}
+
+		if len(response.Data.Documents) == 0 {
+			break
+		}
+
+		allDocuments = append(allDocuments, response.Data.Documents...)
+
+		// Check for next page
+		if response.Status.PageState == "" {
+			break
+		}
+		pageState = response.Status.PageState
+		pageCount++
+
+		if pageCount >= maxPages {
+			fmt.Printf("[WARNING] Reached max page limit of %d pages. Total fetched: %d %s documents\n", maxPages, len(allDocuments), collection)
+			break
+		}
+	}
+
+	return allDocuments, nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/events"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestVoidTransactionReportsDBErrors(t *testing.T) {
+	db, client := newFakeDB(t)
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Post("/transactions/:trx_id/void", h.VoidTransaction)
+	db.insert("order", map[string]interface{}{"_id": "T1", "status": "completed", "outlet_id": "O1", "total": 10000})
+
+	void := map[string]string{"actor": "spv", "reason": "wrong item"}
+
+	// The Data API answers 200 with an errors body; that is a DB error, not
+	// a transaction that is already voided
+	db.failing["order findOneAndUpdate"] = "SERVER_UNHANDLED_ERROR"
+	if status, body := do(t, app, "POST", "/transactions/T1/void", void); status != 500 {
+		t.Fatalf("update error: status %d %v, want 500", status, body)
+	}
+	db.failing = map[string]string{"order": "SERVER_UNHANDLED_ERROR"}
+	if status, body := do(t, app, "POST", "/transactions/T1/void", void); status != 500 {
+		t.Fatalf("read error: status %d %v, want 500", status, body)
+	}
+
+	db.failing = map[string]string{}
+	if status, body := do(t, app, "POST", "/transactions/T1/void", void); status != 200 {
+		t.Fatalf("void: status %d %v", status, body)
+	}
+	if status, _ := do(t, app, "POST", "/transactions/T1/void", void); status != 409 {
+		t.Fatalf("second void: status %d, want 409", status)
+	}
+}
+
+func TestOrderReadsReportDBErrors(t *testing.T) {
+	db, client := newFakeDB(t)
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Get("/orders", h.GetAllOrders)
+	app.Get("/orders/:id", h.GetOrder)
+	db.failing["pos_order"] = "SERVER_UNHANDLED_ERROR"
+
+	if status, _ := do(t, app, "GET", "/orders", nil); status != 500 {
+		t.Errorf("list: status %d, want 500", status)
+	}
+	if status, _ := do(t, app, "GET", "/orders/A1", nil); status != 500 {
+		t.Errorf("get: status %d, want 500 rather than 404", status)
+	}
+}
+
+func TestLegacyOrdersAreReadThroughAndMigrated(t *testing.T) {
+	db, client := newFakeDB(t)
+	rows := `{"count":2,"data":[
+		{"id":"L1","order_number":"ORD-1","customer_id":"C1","total_amount":25000,"status":"pending","payment_method":"cash","created_at":"2024-05-01T03:00:00.000Z","updated_at":"2024-05-01T03:05:00.000Z"},
+		{"id":"L2","order_number":"ORD-2","total_amount":"12000","status":"completed","created_at":"2024-05-02T03:00:00Z","updated_at":"2024-05-02T03:00:00Z"}]}`
+	db.rest = func(method, path string, body []byte) (int, string) {
+		switch path {
+		case "/orders/rows":
+			return 200, rows
+		case "/orders/L1":
+			return 200, `{"count":1,"data":[{"id":"L1","order_number":"ORD-1","total_amount":25000,"status":"pending","created_at":"2024-05-01T03:00:00Z","updated_at":"2024-05-01T03:05:00Z"}]}`
+		}
+		return 200, `{"count":0,"data":[]}`
+	}
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Get("/orders/:id", h.GetOrder)
+	app.Post("/orders/migrate", h.MigrateOrders)
+
+	status, order := do(t, app, "GET", "/orders/L1", nil)
+	if status != 200 || order["status"] != "open" || order["total_amount"] != float64(25000) {
+		t.Fatalf("read-through: status %d %v", status, order)
+	}
+	if len(db.find("pos_order", map[string]interface{}{"_id": "L1"})) != 1 {
+		t.Fatal("read-through did not copy the order into pos_order")
+	}
+	if status, _ := do(t, app, "GET", "/orders/nope", nil); status != 404 {
+		t.Errorf("unknown order: status %d, want 404", status)
+	}
+
+	status, result := do(t, app, "POST", "/orders/migrate?dry_run=true", nil)
+	if status != 200 || result["migrated"] != float64(1) || result["skipped"] != float64(1) {
+		t.Fatalf("dry run: status %d %v", status, result)
+	}
+	if len(db.find("pos_order", map[string]interface{}{"_id": "L2"})) != 0 {
+		t.Fatal("dry run wrote an order")
+	}
+
+	status, result = do(t, app, "POST", "/orders/migrate", nil)
+	if status != 200 || result["migrated"] != float64(1) || result["skipped"] != float64(1) {
+		t.Fatalf("migrate: status %d %v", status, result)
+	}
+	migrated := db.find("pos_order", map[string]interface{}{"_id": "L2"})
+	if len(migrated) != 1 || migrated[0]["status"] != "paid" || migrated[0]["total_amount"] != float64(12000) {
+		t.Fatalf("migrated order: %v", migrated)
+	}
+}
+
+func TestTransactionSavedIsPublishedAfterTheInsert(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "0")
+	db, client := newFakeDB(t)
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Post("/orders/transaction", h.SaveTransaction)
+
+	sub, _, _ := eventBus.Subscribe(events.Filter{OutletID: "EVTTEST", Types: []string{events.TransactionSaved}}, "")
+	defer eventBus.Unsubscribe(sub)
+	published := func() []string {
+		var ids []string
+		for {
+			select {
+			case e := <-sub.Events:
+				ids = append(ids, e.Data.(fiber.Map)["trx_id"].(string))
+			default:
+				return ids
+			}
+		}
+	}
+	trx := func(trxID string) map[string]interface{} {
+		return map[string]interface{}{
+			"trx_id": trxID, "outlet_id": "EVTTEST", "cashier": "Ani", "type": "take_away", "method": "cash",
+			"nominal": 10000, "subtotal": 10000, "total": 10000,
+			"items": []map[string]interface{}{{"menu_name": "Es Teh", "qty": 2, "price": 5000, "subtotal": 10000}},
+		}
+	}
+
+	db.failing["order insertOne"] = "SERVER_UNHANDLED_ERROR"
+	if status, body := do(t, app, "POST", "/orders/transaction", trx("202405151030001")); status != 201 || body["db_saved"] != false {
+		t.Fatalf("failed insert: status %d %v", status, body)
+	}
+	if ids := published(); len(ids) != 0 {
+		t.Errorf("published %v for a failed insert", ids)
+	}
+
+	db.failing = map[string]string{}
+	if status, body := do(t, app, "POST", "/orders/transaction", trx("202405151030002")); status != 201 || body["db_saved"] != true {
+		t.Fatalf("insert: status %d %v", status, body)
+	}
+	if ids := published(); len(ids) != 1 || ids[0] != "202405151030002" {
+		t.Errorf("published %v, want the stored transaction", ids)
+	}
+}
+
+func TestSaveTransactionPricesOptionsAndTotals(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "10")
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		if path == menuRowsPath {
+			return 200, `{"data":[{"id":"ROTI","name":"Roti Bakar","kemitraan":"OPTTEST","kategori":"Makanan","price":12000,` +
+				`"modifierGroups":[{"id":"rasa","name":"Rasa","required":true,"min":1,"max":1,"options":[{"id":"coklat","name":"Coklat","priceDelta":0},{"id":"keju","name":"Keju","priceDelta":2000}]}]}]}`
+		}
+		return 404, `{"description":"not found"}`
+	}
+	app := fiber.New()
+	app.Post("/orders/transaction", NewOrderHandler(client).SaveTransaction)
+
+	sale := func(trxID string, item map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"trx_id": trxID, "outlet_id": "OPTTEST", "cashier": "Ani", "type": "take_away", "method": "cash",
+			"nominal": 50000, "subtotal": 12000, "tax": 1200, "total": 13200,
+			"items": []map[string]interface{}{item},
+		}
+	}
+
+	status, body := do(t, app, "POST", "/orders/transaction", sale("202405151030011", map[string]interface{}{"menu_id": "ROTI", "menu_name": "Roti Bakar", "qty": 1, "price": 12000, "subtotal": 12000}))
+	if status != 422 {
+		t.Errorf("sale without the required modifier: status %d %v, want 422", status, body)
+	}
+
+	status, body = do(t, app, "POST", "/orders/transaction", sale("202405151030012", map[string]interface{}{"menu_id": "ROTI", "menu_name": "Roti Bakar", "qty": 2, "modifiers": []map[string]interface{}{{"id": "keju"}}}))
+	if status != 201 {
+		t.Fatalf("sale priced by the server: status %d %v", status, body)
+	}
+	saved := db.find("order", map[string]interface{}{"_id": "202405151030012"})
+	if len(saved) != 1 {
+		t.Fatal("sale not saved")
+	}
+	if saved[0]["subtotal"] != 28000.0 || saved[0]["tax"] != 2800.0 || saved[0]["total"] != 30800.0 {
+		t.Errorf("saved subtotal %v, tax %v, total %v, want 28000, 2800 and 30800", saved[0]["subtotal"], saved[0]["tax"], saved[0]["total"])
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Orders used to live in the REST orders table. They are copied into the
+// pos_order collection by POST /orders/migrate, and an order that has not
+// been copied yet is read through from the table (and copied) when it is
+// looked up by ID.
+
+const legacyOrderRowsPath = "/orders/rows"
+
+// legacyOrderStatuses maps the free-form statuses of the orders table onto
+// the order state machine
+var legacyOrderStatuses = map[string]string{
+	"pending":   models.OrderStatusOpen,
+	"completed": models.OrderStatusPaid,
+	"done":      models.OrderStatusPaid,
+	"canceled":  models.OrderStatusCancelled,
+}
+
+// MigrateOrders copies the rows of the REST orders table into pos_order.
+// Orders already in pos_order are left alone. ?dry_run=true only counts.
+func (h *OrderHandler) MigrateOrders(c *fiber.Ctx) error {
+	dryRun := c.Query("dry_run") == "true"
+
+	orders, err := legacyOrders(h.dbClient, legacyOrderRowsPath)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+
+	result := models.OrderMigration{DryRun: dryRun, Failed: map[string]string{}}
+	for _, order := range orders {
+		existing, err := findDocuments(h.dbClient, "pos_order", map[string]interface{}{"_id": order.ID}, nil, 1)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if len(existing) > 0 {
+			result.Skipped++
+			continue
+		}
+		if dryRun {
+			result.Migrated++
+			continue
+		}
+		if _, err := copyLegacyOrder(h.dbClient, order); err != nil {
+			result.Failed[order.ID] = err.Error()
+			continue
+		}
+		result.Migrated++
+	}
+
+	return c.JSON(result)
+}
+
+// loadLegacyOrder reads an order that is not in pos_order yet from the
+// orders table and copies it over; nil if the table does not have it either
+func loadLegacyOrder(dbClient *config.AstraDBClient, id string) (*models.Order, error) {
+	orders, err := legacyOrders(dbClient, "/orders/"+url.PathEscape(id))
+	if err != nil || len(orders) == 0 {
+		return nil, err
+	}
+	order := orders[0]
+	if order.ID != id {
+		return nil, nil
+	}
+	copied, err := copyLegacyOrder(dbClient, order)
+	if err != nil {
+		return nil, err
+	}
+	if !copied {
+		// Copied by a concurrent request; read the stored one
+		stored, err := findOrders(dbClient, map[string]interface{}{"_id": id})
+		if err != nil || len(stored) == 0 {
+			return nil, err
+		}
+		return &stored[0], nil
+	}
+	return &order, nil
+}
+
+// copyLegacyOrder inserts a legacy order into pos_order, reporting false if
+// it is already there
+func copyLegacyOrder(dbClient *config.AstraDBClient, order models.Order) (bool, error) {
+	document, err := toDocument(order)
+	if err != nil {
+		return false, err
+	}
+	document["_id"] = order.ID
+	if _, err := dbClient.InsertDocument("pos_order", document); err != nil {
+		if config.IsDuplicateDocument(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// legacyOrders reads orders from the REST orders table. A missing table is
+// no orders.
+func legacyOrders(dbClient *config.AstraDBClient, path string) ([]models.Order, error) {
+	respData, err := dbClient.ExecuteQuery("GET", path, nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "status 404") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(respData, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse orders response: %v", err)
+	}
+	var rows []interface{}
+	if v, ok := raw.(map[string]interface{}); ok {
+		switch data := v["data"].(type) {
+		case []interface{}:
+			rows = data
+		case map[string]interface{}:
+			rows = []interface{}{data}
+		}
+	}
+
+	var orders []models.Order
+	for _, r := range rows {
+		if m, ok := r.(map[string]interface{}); ok {
+			if order := orderFromLegacyRow(parseRowToMap(m)); order.ID != "" {
+				orders = append(orders, order)
+			}
+		}
+	}
+	return orders, nil
+}
+
+// orderFromLegacyRow converts a row of the orders table. The table had no
+// items; its status is mapped onto the order states.
+func orderFromLegacyRow(row map[string]interface{}) models.Order {
+	order := models.Order{
+		ID:            toString(extractVal(row["id"])),
+		OrderNumber:   toString(extractVal(row["order_number"])),
+		CustomerID:    toString(extractVal(row["customer_id"])),
+		TotalAmount:   toMoney(extractVal(row["total_amount"])),
+		PaymentMethod: toString(extractVal(row["payment_method"])),
+		Items:         []models.OrderItem{},
+		CreatedAt:     legacyOrderTime(row["created_at"]),
+		UpdatedAt:     legacyOrderTime(row["updated_at"]),
+	}
+
+	legacyStatus := strings.ToLower(toString(extractVal(row["status"])))
+	order.Status = legacyOrderStatuses[legacyStatus]
+	if order.Status == "" {
+		order.Status = models.OrderStatusOpen
+		if models.IsOrderStatus(legacyStatus) {
+			order.Status = legacyStatus
+		}
+	}
+
+	at := order.UpdatedAt.In(wib).Format(time.RFC3339)
+	order.StatusTimes = map[string]string{order.Status: at}
+	order.History = []models.OrderTransition{{
+		To:     order.Status,
+		Actor:  "migration",
+		At:     at,
+		Reason: "copied from the orders table with status " + legacyStatus,
+	}}
+	return order
+}
+
+func legacyOrderTime(v interface{}) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, toString(extractVal(v)))
+	if err != nil {
+		return time.Time{}
+	}
+	return t.In(wib)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OutletHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewOutletHandler(dbClient *config.AstraDBClient) *OutletHandler {
+	return &OutletHandler{dbClient: dbClient}
+}
+
+// GetSettings returns the pricing settings of an outlet (defaults if unset)
+func (h *OutletHandler) GetSettings(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	if outletID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "outlet_id is required"})
+	}
+
+	settings, err := loadOutletSettings(h.dbClient, outletID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(settings)
+}
+
+// UpdateSettings creates or replaces the pricing settings of an outlet
+func (h *OutletHandler) UpdateSettings(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	if outletID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "outlet_id is required"})
+	}
+
+	var settings models.OutletSettings
+	if err := c.BodyParser(&settings); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	for _, rule := range []models.ChargeRule{settings.DineIn, settings.TakeAway} {
+		if rule.TaxPercent < 0 || rule.TaxPercent > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "tax_percent must be between 0 and 100"})
+		}
+		if rule.ServiceChargePercent < 0 || rule.ServiceChargePercent > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "service_charge_percent must be between 0 and 100"})
+		}
+	}
+	if settings.CashRounding.Unit < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "cash_rounding.unit must not be negative"})
+	}
+	switch settings.CashRounding.Mode {
+	case "", models.RoundNearest, models.RoundDown, models.RoundUp:
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "cash_rounding.mode must be nearest, down or up"})
+	}
+	if settings.TaxName == "" {
+		settings.TaxName = "PB1"
+	}
+	settings.OutletID = outletID
+	settings.UpdatedAt = time.Now().In(wib).Format(time.RFC3339)
+
+	update, err := toDocument(settings)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	delete(update, "_id")
+
+	if _, err := h.dbClient.UpsertDocument("outlet_settings", map[string]interface{}{"_id": outletID}, update); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	kemitraanCache.Delete(outletID)
+
+	return c.JSON(settings)
+}
+
+// defaultOutletSettings are used for outlets without stored settings:
+// TAX_PERCENT for every order type, SERVICE_CHARGE_PERCENT for dine-in only
+func defaultOutletSettings(outletID string) models.OutletSettings {
+	tax := envPercent("TAX_PERCENT", 10)
+	return models.OutletSettings{
+		OutletID: outletID,
+		TaxName:  "PB1",
+		DineIn: models.ChargeRule{
+			TaxPercent:           tax,
+			ServiceChargePercent: envPercent("SERVICE_CHARGE_PERCENT", 0),
+		},
+		TakeAway: models.ChargeRule{
+			TaxPercent: tax,
+		},
+		CashRounding: models.CashRounding{
+			Unit: models.Money(envPercent("CASH_ROUNDING_UNIT", 0)),
+			Mode: models.RoundNearest,
+		},
+	}
+}
+
+// loadOutletSettings fetches an outlet's settings, falling back to defaults
+func loadOutletSettings(dbClient *config.AstraDBClient, outletID string) (models.OutletSettings, error) {
+	respBody, err := dbClient.FindDocuments("outlet_settings", map[string]interface{}{"_id": outletID}, map[string]interface{}{"limit": 1})
+	if err != nil {
+		return models.OutletSettings{}, err
+	}
+
+	var response struct {
+		Data struct {
+			Documents []models.OutletSettings `json:"documents"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return models.OutletSettings{}, fmt.Errorf("failed to parse outlet settings: %v", err)
+	}
+
+	if len(response.Data.Documents) == 0 {
+		return defaultOutletSettings(outletID), nil
+	}
+	return response.Data.Documents[0], nil
+}
+
+// computeCharges applies a charge rule to the net amount (after discounts).
+// With exclusive pricing service charge and tax are added on top; with
+// inclusive pricing they are carved out of the net amount, which is the total.
+func computeCharges(net models.Money, rule models.ChargeRule, inclusive bool) (serviceCharge, tax, total models.Money) {
+	if inclusive {
+		t := rule.TaxPercent / 100
+		s := rule.ServiceChargePercent / 100
+		tax = net - models.NewMoney(net.Float64()/(1+t))
+		beforeTax := net - tax
+		serviceCharge = beforeTax - models.NewMoney(beforeTax.Float64()/(1+s))
+		return serviceCharge, tax, net
+	}
+
+	serviceCharge = net.Percent(rule.ServiceChargePercent)
+	tax = (net + serviceCharge).Percent(rule.TaxPercent)
+	return serviceCharge, tax, net + serviceCharge + tax
+}
+
+// checkCharges recomputes the service charge and tax of a transaction the
+// client priced itself from the outlet's settings. Its total may already be
+// cash-rounded when paid in cash. On success the transaction gets the
+// server's numbers and rates, with the total before rounding.
+func checkCharges(trx *models.Transaction, settings models.OutletSettings, cash bool) error {
+	rule := settings.RuleFor(trx.Type)
+	serviceCharge, tax, gross := computeCharges(trx.Subtotal-trx.PromoDiscount, rule, settings.TaxInclusive)
+	totalOK := trx.Total == gross || cash && trx.Total == settings.CashRounding.Apply(gross)
+	if trx.ServiceCharge != serviceCharge || trx.Tax != tax || !totalOK {
+		return &cartError{fmt.Sprintf("Charges do not match the outlet settings: expected service charge %d, tax %d and total %d, got %d, %d and %d",
+			serviceCharge, tax, gross, trx.ServiceCharge, trx.Tax, trx.Total)}
+	}
+
+	trx.Total = gross
+	setChargeRates(trx, settings)
+	return nil
+}
+
+// applyCharges prices the service charge, tax and total of a transaction
+// whose subtotal the server worked out, from the outlet's settings
+func applyCharges(trx *models.Transaction, settings models.OutletSettings) {
+	rule := settings.RuleFor(trx.Type)
+	trx.ServiceCharge, trx.Tax, trx.Total = computeCharges(trx.Subtotal-trx.PromoDiscount, rule, settings.TaxInclusive)
+	setChargeRates(trx, settings)
+}
+
+func setChargeRates(trx *models.Transaction, settings models.OutletSettings) {
+	rule := settings.RuleFor(trx.Type)
+	trx.ServiceRate = rule.ServiceChargePercent
+	trx.TaxName = settings.TaxName
+	trx.TaxRate = rule.TaxPercent
+	trx.TaxInclusive = settings.TaxInclusive
+}
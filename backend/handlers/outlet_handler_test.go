@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestComputeCharges(t *testing.T) {
+	rule := models.ChargeRule{TaxPercent: 10, ServiceChargePercent: 5}
+	tests := []struct {
+		name                string
+		net                 models.Money
+		rule                models.ChargeRule
+		inclusive           bool
+		service, tax, total models.Money
+	}{
+		{"exclusive", 100000, rule, false, 5000, 10500, 115500},
+		{"inclusive", 115500, rule, true, 5000, 10500, 115500},
+		{"no charges", 25000, models.ChargeRule{}, false, 0, 0, 25000},
+		{"tax rounds to the rupiah", 33333, models.ChargeRule{TaxPercent: 11}, false, 0, 3667, 37000},
+		{"inclusive tax only", 11100, models.ChargeRule{TaxPercent: 11}, true, 0, 1100, 11100},
+		{"nothing to charge", 0, rule, false, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		service, tax, total := computeCharges(tt.net, tt.rule, tt.inclusive)
+		if service != tt.service || tax != tt.tax || total != tt.total {
+			t.Errorf("%s: got %d, %d, %d, want %d, %d, %d", tt.name, service, tax, total, tt.service, tt.tax, tt.total)
+		}
+	}
+}
+
+func TestCheckCharges(t *testing.T) {
+	settings := models.OutletSettings{
+		TaxName:      "PB1",
+		DineIn:       models.ChargeRule{TaxPercent: 10, ServiceChargePercent: 5},
+		TakeAway:     models.ChargeRule{TaxPercent: 10},
+		CashRounding: models.CashRounding{Unit: 500},
+	}
+	tests := []struct {
+		name                string
+		typ                 string
+		subtotal, discount  models.Money
+		service, tax, total models.Money
+		cash, wantErr       bool
+	}{
+		{"dine-in", "dine_in", 100000, 0, 5000, 10500, 115500, false, false},
+		{"take-away has no service charge", "take_away", 100000, 0, 0, 10000, 110000, false, false},
+		{"after promotions", "take_away", 100000, 20000, 0, 8000, 88000, false, false},
+		{"cash-rounded total", "dine_in", 100000, 0, 5000, 10500, 115500, true, false},
+		{"rounded total", "take_away", 10100, 0, 0, 1010, 11000, true, false},
+		{"rounded total without cash", "take_away", 10100, 0, 0, 1010, 11000, false, true},
+		{"wrong tax", "take_away", 100000, 0, 0, 11000, 111000, false, true},
+		{"service charge left out", "dine_in", 100000, 0, 0, 10500, 110500, false, true},
+		{"wrong total", "take_away", 100000, 0, 0, 10000, 100000, false, true},
+	}
+	for _, tt := range tests {
+		trx := models.Transaction{Type: tt.typ, Subtotal: tt.subtotal, PromoDiscount: tt.discount, ServiceCharge: tt.service, Tax: tt.tax, Total: tt.total}
+		err := checkCharges(&trx, settings, tt.cash)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if _, ok := err.(*cartError); !ok {
+				t.Errorf("%s: %T is not a cartError", tt.name, err)
+			}
+			continue
+		}
+		_, _, gross := computeCharges(tt.subtotal-tt.discount, settings.RuleFor(tt.typ), false)
+		if trx.Total != gross || trx.TaxName != "PB1" || trx.TaxRate != 10 {
+			t.Errorf("%s: recorded total %d, tax %s %v", tt.name, trx.Total, trx.TaxName, trx.TaxRate)
+		}
+	}
+}
+
+func TestSaveTransactionChecksOutletCharges(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "10")
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Post("/orders/transaction", NewOrderHandler(client).SaveTransaction)
+
+	trx := func(trxID string, tax, total int) map[string]interface{} {
+		return map[string]interface{}{
+			"trx_id": trxID, "outlet_id": "TAXTEST", "cashier": "Ani", "type": "take_away", "method": "qris",
+			"subtotal": 20000, "tax": tax, "total": total,
+			"items": []map[string]interface{}{{"menu_name": "Mie Goreng", "qty": 1, "price": 20000, "subtotal": 20000}},
+		}
+	}
+	if status, body := do(t, app, "POST", "/orders/transaction", trx("202405151030001", 0, 20000)); status != 422 {
+		t.Errorf("untaxed sale: status %d %v, want 422", status, body)
+	}
+	if status, body := do(t, app, "POST", "/orders/transaction", trx("202405151030002", 2000, 22000)); status != 201 {
+		t.Fatalf("taxed sale: status %d %v", status, body)
+	}
+	saved := db.find("order", map[string]interface{}{"_id": "202405151030002"})[0]
+	if saved["tax"] != float64(2000) || saved["tax_name"] != "PB1" || saved["tax_rate"] != float64(10) {
+		t.Errorf("stored %v, want the outlet's tax recorded", saved)
+	}
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/gateway"
+	"sagawa_pos_backend/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// QRIS charges stay payable for this long
+const qrisExpiryMinutes = 15
+
+type PaymentHandler struct {
+	dbClient *config.AstraDBClient
+	gateway  gateway.Gateway
+}
+
+func NewPaymentHandler(dbClient *config.AstraDBClient, gw gateway.Gateway) *PaymentHandler {
+	return &PaymentHandler{dbClient: dbClient, gateway: gw}
+}
+
+// PaymentsUnavailable answers the payment routes when no gateway is
+// configured
+func PaymentsUnavailable(c *fiber.Ctx) error {
+	return c.Status(503).JSON(fiber.Map{"error": "QRIS payments are not available: no payment gateway is configured"})
+}
+
+// CreateQrisCharge creates a dynamic QRIS charge for a pending transaction
+// and returns the QR string to display to the customer
+func (h *PaymentHandler) CreateQrisCharge(c *fiber.Ctx) error {
+	var req models.CreateQrisRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.TrxID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Transaction ID is required"})
+	}
+
+	if req.QuoteID != "" {
+		quote, err := verifyQuote(req.QuoteID)
+		if err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+		}
+		if req.OutletID != "" && req.OutletID != quote.OutletID {
+			return c.Status(422).JSON(fiber.Map{"error": "Quote was issued for a different outlet"})
+		}
+		req.OutletID = quote.OutletID
+		req.Amount = quote.Total
+	}
+	if req.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Amount must be > 0"})
+	}
+
+	// Unique per attempt so a customer can retry after an expired QR
+	reference := fmt.Sprintf("%s-%s", req.TrxID, strings.Split(uuid.New().String(), "-")[0])
+
+	charge, err := h.gateway.CreateQRIS(gateway.ChargeRequest{
+		OrderID:       reference,
+		Amount:        int64(req.Amount),
+		ExpiryMinutes: qrisExpiryMinutes,
+	})
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{"error": "Failed to create QRIS charge: " + err.Error()})
+	}
+
+	record := models.PaymentCharge{
+		Reference: reference,
+		TrxID:     req.TrxID,
+		OutletID:  req.OutletID,
+		Gateway:   h.gateway.Name(),
+		GatewayID: charge.GatewayID,
+		Method:    models.PaymentQris,
+		Amount:    req.Amount,
+		Status:    charge.Status,
+		QRString:  charge.QRString,
+		ExpiresAt: charge.ExpiresAt.In(wib).Format(time.RFC3339),
+		CreatedAt: time.Now().In(wib).Format(time.RFC3339),
+	}
+
+	document, err := toDocument(record)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := h.dbClient.InsertDocument("payment_charge", document); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(record)
+}
+
+// GetCharge returns a payment charge, refreshing its status from the gateway
+// while it is still pending
+func (h *PaymentHandler) GetCharge(c *fiber.Ctx) error {
+	charge, err := loadPaymentCharge(h.dbClient, c.Params("reference"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if charge == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+
+	if charge.Status == models.PaymentStatusPending {
+		if remote, err := h.gateway.GetStatus(charge.Reference); err == nil && remote.Status != charge.Status {
+			if err := updateChargeStatus(h.dbClient, charge, remote.Status, remote.GatewayID); err != nil {
+				fmt.Printf("Warning: Failed to update payment %s: %v\n", charge.Reference, err)
+			}
+		}
+	}
+
+	return c.JSON(charge)
+}
+
+// HandleNotification receives the gateway's payment webhook, verifies its
+// signature and marks the charge paid (or failed/expired)
+func (h *PaymentHandler) HandleNotification(c *fiber.Ctx) error {
+	header := func(key string) string { return c.Get(key) }
+	notification, err := h.gateway.ParseNotification(c.Body(), header)
+	if err != nil {
+		fmt.Printf("Rejected payment notification: %v\n", err)
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	charge, err := loadPaymentCharge(h.dbClient, notification.OrderID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if charge == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+
+	if notification.Status == models.PaymentStatusPaid && notification.Amount != int64(charge.Amount) {
+		fmt.Printf("Payment %s amount mismatch: expected %d, gateway reported %d\n",
+			charge.Reference, charge.Amount, notification.Amount)
+		return c.Status(422).JSON(fiber.Map{"error": "Amount does not match the charge"})
+	}
+
+	// Notifications may be retried or arrive late; a paid charge stays paid
+	if charge.Status != notification.Status {
+		if err := updateChargeStatus(h.dbClient, charge, notification.Status, notification.GatewayID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{"message": "Notification processed", "reference": charge.Reference, "status": charge.Status})
+}
+
+// SimulatePaid pays a charge on the fake gateway and feeds the signed
+// notification through the webhook handler (development only)
+func (h *PaymentHandler) SimulatePaid(c *fiber.Ctx) error {
+	fake, ok := h.gateway.(*gateway.FakeGateway)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Only available with the fake payment gateway"})
+	}
+
+	body, signature, err := fake.Pay(c.Params("reference"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Request().SetBody(body)
+	c.Request().Header.Set(gateway.FakeSignatureHeader, signature)
+	return h.HandleNotification(c)
+}
+
+// loadPaymentCharge fetches a charge by reference; nil if it does not exist
+func loadPaymentCharge(dbClient *config.AstraDBClient, reference string) (*models.PaymentCharge, error) {
+	respBody, err := dbClient.FindDocuments("payment_charge", map[string]interface{}{"_id": reference}, map[string]interface{}{"limit": 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data struct {
+			Documents []models.PaymentCharge `json:"documents"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse payment: %v", err)
+	}
+
+	if len(response.Data.Documents) == 0 {
+		return nil, nil
+	}
+	return &response.Data.Documents[0], nil
+}
+
+// updateChargeStatus stores a new gateway status on a charge, provided it
+// still has the status it was loaded with, so a late notification or poll
+// cannot overwrite a newer status. A paid charge stays paid. When another
+// update came first, charge is reloaded with the stored state.
+func updateChargeStatus(dbClient *config.AstraDBClient, charge *models.PaymentCharge, status, gatewayID string) error {
+	if charge.Status == models.PaymentStatusPaid {
+		return nil
+	}
+	update := map[string]interface{}{"status": status}
+	if gatewayID != "" {
+		update["gateway_id"] = gatewayID
+	}
+	paidAt := ""
+	if status == models.PaymentStatusPaid {
+		paidAt = time.Now().In(wib).Format(time.RFC3339)
+		update["paid_at"] = paidAt
+	}
+
+	ok, err := updateDocumentIf(dbClient, "payment_charge", map[string]interface{}{"_id": charge.Reference, "status": charge.Status}, update)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		current, err := loadPaymentCharge(dbClient, charge.Reference)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("payment %s disappeared", charge.Reference)
+		}
+		*charge = *current
+		return nil
+	}
+
+	charge.Status = status
+	if gatewayID != "" {
+		charge.GatewayID = gatewayID
+	}
+	if paidAt != "" {
+		charge.PaidAt = paidAt
+	}
+	return nil
+}
+
+// verifyGatewayPayments checks QRIS legs that carry a gateway reference
+// against their charge: it must belong to this transaction, match the
+// amount, be paid and not already used. Legs without a reference are
+// manually confirmed payments and are left as they are.
+func verifyGatewayPayments(dbClient *config.AstraDBClient, trx *models.Transaction) ([]*models.PaymentCharge, error) {
+	var charges []*models.PaymentCharge
+	for i, p := range trx.Payments {
+		if p.Method != models.PaymentQris || p.Reference == "" {
+			continue
+		}
+
+		charge, err := loadPaymentCharge(dbClient, p.Reference)
+		if err != nil {
+			return nil, err
+		}
+		if charge == nil {
+			return nil, fmt.Errorf("QRIS payment %s not found", p.Reference)
+		}
+		if charge.TrxID != trx.TrxID {
+			return nil, fmt.Errorf("QRIS payment %s belongs to another transaction", p.Reference)
+		}
+		if charge.Amount != p.Amount {
+			return nil, fmt.Errorf("QRIS payment %s amount does not match", p.Reference)
+		}
+		if charge.FinalizedAt != "" {
+			return nil, fmt.Errorf("QRIS payment %s was already used", p.Reference)
+		}
+
+		trx.Payments[i].Status = charge.Status
+		if charge.Status != models.PaymentStatusPaid {
+			return nil, fmt.Errorf("QRIS payment %s is %s", p.Reference, charge.Status)
+		}
+		charges = append(charges, charge)
+	}
+	return charges, nil
+}
+
+// finalizeCharges marks charges as consumed by a saved transaction
+func finalizeCharges(dbClient *config.AstraDBClient, charges []*models.PaymentCharge) {
+	now := time.Now().In(wib).Format(time.RFC3339)
+	for _, charge := range charges {
+		update := map[string]interface{}{"finalized_at": now}
+		if _, err := dbClient.UpdateDocument("payment_charge", map[string]interface{}{"_id": charge.Reference}, update); err != nil {
+			fmt.Printf("Warning: Failed to finalize payment %s: %v\n", charge.Reference, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpdateChargeStatusDoesNotOverwriteNewerStatus(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.insert("payment_charge", models.PaymentCharge{Reference: "P1", TrxID: "T1", Amount: 10000, Status: models.PaymentStatusPending})
+	charge, err := loadPaymentCharge(client, "P1")
+	if err != nil || charge == nil {
+		t.Fatalf("load: %v %v", charge, err)
+	}
+	stale := *charge
+
+	if err := updateChargeStatus(client, charge, models.PaymentStatusPaid, "G1"); err != nil {
+		t.Fatal(err)
+	}
+	if charge.Status != models.PaymentStatusPaid || charge.PaidAt == "" || charge.GatewayID != "G1" {
+		t.Fatalf("paid charge %+v", charge)
+	}
+
+	// A failure read before the payment arrived loses the race
+	if err := updateChargeStatus(client, &stale, models.PaymentStatusFailed, ""); err != nil {
+		t.Fatal(err)
+	}
+	if stored := db.find("payment_charge", map[string]interface{}{"_id": "P1"})[0]; stored["status"] != models.PaymentStatusPaid {
+		t.Errorf("late failure overwrote the payment: %v", stored)
+	}
+	if stale.Status != models.PaymentStatusPaid {
+		t.Errorf("stale charge not reloaded: %+v", stale)
+	}
+
+	// A paid charge stays paid
+	if err := updateChargeStatus(client, charge, models.PaymentStatusFailed, ""); err != nil {
+		t.Fatal(err)
+	}
+	if stored := db.find("payment_charge", map[string]interface{}{"_id": "P1"})[0]; stored["status"] != models.PaymentStatusPaid {
+		t.Errorf("paid charge became %v", stored["status"])
+	}
+
+	db.failing["payment_charge"] = "SERVER_UNHANDLED_ERROR"
+	other := models.PaymentCharge{Reference: "P2", Status: models.PaymentStatusPending}
+	if err := updateChargeStatus(client, &other, models.PaymentStatusPaid, ""); err == nil || other.Status != models.PaymentStatusPending {
+		t.Errorf("DB error: err %v, status %s", err, other.Status)
+	}
+}
+
+func TestPaymentsUnavailableWithoutGateway(t *testing.T) {
+	app := fiber.New()
+	payments := app.Group("/payments")
+	payments.Use(PaymentsUnavailable)
+	payments.Post("/qris", func(c *fiber.Ctx) error { return c.SendStatus(201) })
+	if status, _ := do(t, app, "POST", "/payments/qris", map[string]interface{}{}); status != 503 {
+		t.Errorf("status %d, want 503", status)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+)
+
+// normalizePayments fills in the payment legs of a transaction. Clients that
+// still send only method/nominal/qris get legs derived from them and legacy
+// is reported. Method is set to the single leg's method, or "split" for
+// mixed payments.
+func normalizePayments(trx *models.Transaction) (legacy bool) {
+	if len(trx.Payments) == 0 && trx.Method != "" {
+		legacy = true
+		trx.Payments = legacyPayments(trx)
+	}
+
+	methods := make(map[string]bool)
+	for i := range trx.Payments {
+		trx.Payments[i].Method = strings.ToLower(strings.TrimSpace(trx.Payments[i].Method))
+		if trx.Payments[i].Status == "" {
+			trx.Payments[i].Status = models.PaymentStatusPaid
+		}
+		methods[trx.Payments[i].Method] = true
+	}
+
+	if trx.Method == "" {
+		if len(methods) == 1 {
+			trx.Method = trx.Payments[0].Method
+		} else if len(methods) > 1 {
+			trx.Method = "split"
+		}
+	}
+	return legacy
+}
+
+// legacyPayments derives payment legs from method/nominal/qris. The POS app
+// sends "voucher + cash" and "voucher + qris" for a voucher topped up with
+// cash or QRIS: the voucher leg is whatever the cash or QRIS amount leaves
+// of the total, and all of it when that amount is not sent.
+func legacyPayments(trx *models.Transaction) []models.Payment {
+	method := strings.ToLower(strings.TrimSpace(trx.Method))
+	voucherPart, rest, combined := strings.Cut(method, "+")
+	voucherPart, rest = strings.TrimSpace(voucherPart), strings.TrimSpace(rest)
+	if !combined || voucherPart != models.PaymentVoucher {
+		rest = method
+	}
+
+	var restAmount models.Money
+	switch rest {
+	case models.PaymentCash:
+		restAmount = trx.Nominal
+	case models.PaymentQris:
+		restAmount = trx.Qris
+	}
+
+	if !combined {
+		if restAmount <= 0 {
+			restAmount = trx.Total
+		}
+		payment := models.Payment{Method: rest, Amount: restAmount}
+		if rest == models.PaymentVoucher {
+			payment.Reference = trx.VoucherCode
+		}
+		return []models.Payment{payment}
+	}
+
+	var payments []models.Payment
+	if voucherAmount := trx.Total - restAmount; voucherAmount > 0 {
+		payments = append(payments, models.Payment{Method: models.PaymentVoucher, Amount: voucherAmount, Reference: trx.VoucherCode})
+	}
+	if restAmount > 0 {
+		payments = append(payments, models.Payment{Method: rest, Amount: restAmount})
+	}
+	return payments
+}
+
+// paysCash reports whether a transaction is paid partly or fully in cash,
+// by its payment legs or, for legacy clients, its method ("cash",
+// "voucher + cash")
+func paysCash(trx *models.Transaction) bool {
+	if len(trx.Payments) == 0 {
+		method := strings.ToLower(strings.TrimSpace(trx.Method))
+		if _, rest, combined := strings.Cut(method, "+"); combined {
+			method = strings.TrimSpace(rest)
+		}
+		return method == models.PaymentCash
+	}
+	for _, p := range trx.Payments {
+		if strings.EqualFold(strings.TrimSpace(p.Method), models.PaymentCash) {
+			return true
+		}
+	}
+	return false
+}
+
+// settlePayments validates that the paid legs cover the total and computes
+// change. Change is only given from cash, so non-cash legs may not exceed
+// the total on their own. Legacy payments may have vouchers without a code,
+// since older clients do not send it.
+func settlePayments(trx *models.Transaction, legacy bool) error {
+	if len(trx.Payments) == 0 {
+		return fmt.Errorf("At least one payment is required")
+	}
+
+	var paid, nonCash, qris models.Money
+	for _, p := range trx.Payments {
+		switch p.Method {
+		case models.PaymentCash, models.PaymentQris, models.PaymentVoucher, models.PaymentDebit, models.PaymentTransfer:
+		default:
+			return fmt.Errorf("Unknown payment method: %s", p.Method)
+		}
+		if p.Amount <= 0 {
+			return fmt.Errorf("Payment amount must be > 0")
+		}
+		if p.Method == models.PaymentVoucher && p.Reference == "" && !legacy {
+			return fmt.Errorf("Voucher payments require the voucher code as reference")
+		}
+		if p.Status != models.PaymentStatusPaid {
+			continue
+		}
+
+		paid += p.Amount
+		if p.Method != models.PaymentCash {
+			nonCash += p.Amount
+		}
+		if p.Method == models.PaymentQris {
+			qris += p.Amount
+		}
+	}
+
+	if paid < trx.Total {
+		return fmt.Errorf("Payments (%d) do not cover the total (%d)", paid, trx.Total)
+	}
+	if nonCash > trx.Total {
+		return fmt.Errorf("Non-cash payments exceed the total; change can only be given in cash")
+	}
+
+	trx.Nominal = paid
+	trx.Qris = qris
+	trx.Changes = paid - trx.Total
+	return nil
+}
+
+// transactionPayments returns the payment legs of a stored transaction
+// document, deriving a single leg for documents saved before split payments
+func transactionPayments(trx map[string]interface{}) []models.Payment {
+	if raw, ok := trx["payments"].([]interface{}); ok && len(raw) > 0 {
+		data, err := json.Marshal(raw)
+		if err == nil {
+			var payments []models.Payment
+			if err := json.Unmarshal(data, &payments); err == nil {
+				return payments
+			}
+		}
+	}
+
+	method, _ := trx["method"].(string)
+	if method == "" {
+		return nil
+	}
+	return []models.Payment{{
+		Method: strings.ToLower(method),
+		Amount: toMoney(trx["total"]) + toMoney(trx["changes"]),
+		Status: models.PaymentStatusPaid,
+	}}
+}
+
+// summarizePayments breaks down revenue by payment method over individual
+// legs. Change handed back is deducted from the cash legs, so amounts add
+// up to the transactions' totals.
+func summarizePayments(transactions []map[string]interface{}) []models.PaymentSummary {
+	groups := make(map[string]*models.PaymentSummary)
+
+	for _, trx := range transactions {
+		change := toMoney(trx["changes"])
+		seen := make(map[string]bool)
+
+		for _, p := range transactionPayments(trx) {
+			if p.Status != "" && p.Status != models.PaymentStatusPaid {
+				continue
+			}
+			row, ok := groups[p.Method]
+			if !ok {
+				row = &models.PaymentSummary{Method: p.Method}
+				groups[p.Method] = row
+			}
+
+			amount := p.Amount
+			if p.Method == models.PaymentCash && change > 0 {
+				deduct := change
+				if deduct > amount {
+					deduct = amount
+				}
+				amount -= deduct
+				change -= deduct
+			}
+
+			row.Legs++
+			row.Amount += amount
+			if !seen[p.Method] {
+				seen[p.Method] = true
+				row.Transactions++
+			}
+		}
+	}
+
+	breakdown := make([]models.PaymentSummary, 0, len(groups))
+	for _, row := range groups {
+		breakdown = append(breakdown, *row)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		return breakdown[i].Method < breakdown[j].Method
+	})
+	return breakdown
+}
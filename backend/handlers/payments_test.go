@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLegacyPaymentLegs(t *testing.T) {
+	tests := []struct {
+		name string
+		trx  models.Transaction
+		want []models.Payment
+	}{
+		{"cash", models.Transaction{Method: "cash", Nominal: 50000, Total: 33300},
+			[]models.Payment{{Method: "cash", Amount: 50000}}},
+		{"cash without nominal", models.Transaction{Method: "Cash", Total: 33300},
+			[]models.Payment{{Method: "cash", Amount: 33300}}},
+		{"qris", models.Transaction{Method: "qris", Qris: 33300, Total: 33300},
+			[]models.Payment{{Method: "qris", Amount: 33300}}},
+		{"voucher", models.Transaction{Method: "voucher", Total: 33300},
+			[]models.Payment{{Method: "voucher", Amount: 33300}}},
+		{"voucher with code", models.Transaction{Method: "voucher", VoucherCode: "HEMAT", Total: 33300},
+			[]models.Payment{{Method: "voucher", Amount: 33300, Reference: "HEMAT"}}},
+		{"voucher + cash", models.Transaction{Method: "voucher + cash", Nominal: 10000, Total: 33300},
+			[]models.Payment{{Method: "voucher", Amount: 23300}, {Method: "cash", Amount: 10000}}},
+		{"voucher + qris", models.Transaction{Method: "Voucher + QRIS", Qris: 8300, Total: 33300},
+			[]models.Payment{{Method: "voucher", Amount: 25000}, {Method: "qris", Amount: 8300}}},
+		{"voucher + cash without amounts", models.Transaction{Method: "voucher + cash", Total: 33300},
+			[]models.Payment{{Method: "voucher", Amount: 33300}}},
+		{"voucher + cash over the total", models.Transaction{Method: "voucher + cash", Nominal: 50000, Total: 33300},
+			[]models.Payment{{Method: "cash", Amount: 50000}}},
+	}
+	for _, tt := range tests {
+		trx := tt.trx
+		if !normalizePayments(&trx) {
+			t.Errorf("%s: not reported as legacy", tt.name)
+		}
+		if len(trx.Payments) != len(tt.want) {
+			t.Errorf("%s: payments %+v, want %+v", tt.name, trx.Payments, tt.want)
+			continue
+		}
+		for i, want := range tt.want {
+			want.Status = models.PaymentStatusPaid
+			if trx.Payments[i] != want {
+				t.Errorf("%s: leg %d = %+v, want %+v", tt.name, i, trx.Payments[i], want)
+			}
+		}
+		if err := settlePayments(&trx, true); err != nil {
+			t.Errorf("%s: settlePayments: %v", tt.name, err)
+		}
+	}
+}
+
+func TestSettlePayments(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    models.Money
+		payments []models.Payment
+		legacy   bool
+		change   models.Money
+		wantErr  bool
+	}{
+		{"exact cash", 30000, []models.Payment{{Method: "cash", Amount: 30000}}, false, 0, false},
+		{"change from cash", 30000, []models.Payment{{Method: "cash", Amount: 50000}}, false, 20000, false},
+		{"split", 30000, []models.Payment{{Method: "qris", Amount: 10000}, {Method: "cash", Amount: 25000}}, false, 5000, false},
+		{"short", 30000, []models.Payment{{Method: "cash", Amount: 20000}}, false, 0, true},
+		{"no change from qris", 30000, []models.Payment{{Method: "qris", Amount: 40000}}, false, 0, true},
+		{"unknown method", 30000, []models.Payment{{Method: "gold", Amount: 30000}}, false, 0, true},
+		{"zero leg", 30000, []models.Payment{{Method: "cash", Amount: 30000}, {Method: "qris"}}, false, 0, true},
+		{"voucher without code", 30000, []models.Payment{{Method: "voucher", Amount: 30000}}, false, 0, true},
+		{"legacy voucher without code", 30000, []models.Payment{{Method: "voucher", Amount: 30000}}, true, 0, false},
+		{"pending leg does not count", 30000, []models.Payment{{Method: "qris", Amount: 30000, Status: models.PaymentStatusPending}}, false, 0, true},
+		{"none", 30000, nil, false, 0, true},
+	}
+	for _, tt := range tests {
+		trx := models.Transaction{Total: tt.total}
+		for _, p := range tt.payments {
+			if p.Status == "" {
+				p.Status = models.PaymentStatusPaid
+			}
+			trx.Payments = append(trx.Payments, p)
+		}
+		err := settlePayments(&trx, tt.legacy)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && trx.Changes != tt.change {
+			t.Errorf("%s: change %d, want %d", tt.name, trx.Changes, tt.change)
+		}
+	}
+}
+
+// The POS app sends only method/nominal/qris, lower-casing the method it
+// shows; each of its payloads must be saved
+func TestSaveTransactionAcceptsLegacyPayloads(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "11") // the app's PPN
+	db, client := newFakeDB(t)
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Post("/orders/transaction", h.SaveTransaction)
+
+	payloads := map[string]map[string]interface{}{
+		"qris":           {"method": "qris", "nominal": 0, "qris": 33300, "changes": 0},
+		"cash":           {"method": "cash", "nominal": 50000, "qris": 0, "changes": 16700},
+		"voucher":        {"method": "voucher", "nominal": 0, "qris": 0, "changes": 0},
+		"voucher + qris": {"method": "voucher + qris", "nominal": 0, "qris": 0, "changes": 0},
+		"voucher + cash": {"method": "voucher + cash", "nominal": 0, "qris": 0, "changes": 0},
+	}
+	i := 0
+	for name, payload := range payloads {
+		i++
+		trxID := "20240515103000" + string(rune('0'+i))
+		body := map[string]interface{}{
+			"trx_id": trxID, "outlet_id": "O1", "outlet_name": "Sagawa Mampang", "cashier": "Ani", "customer": "Budi",
+			"type": "dine_in", "subtotal": 30000, "tax": 3300, "total": 33300,
+			"items": []map[string]interface{}{{"menu_name": "Nasi Goreng", "qty": 1, "price": 30000, "subtotal": 30000}},
+		}
+		for k, v := range payload {
+			body[k] = v
+		}
+
+		status, response := do(t, app, "POST", "/orders/transaction", body)
+		if status != 201 {
+			t.Errorf("%s: status %d %v", name, status, response)
+			continue
+		}
+		saved := db.find("order", map[string]interface{}{"_id": trxID})
+		if len(saved) != 1 {
+			t.Errorf("%s: transaction not stored", name)
+			continue
+		}
+		if saved[0]["method"] != payload["method"] || saved[0]["total"] != float64(33300) {
+			t.Errorf("%s: stored %v", name, saved[0])
+		}
+	}
+}
+
+func TestPaysCash(t *testing.T) {
+	tests := []struct {
+		trx  models.Transaction
+		want bool
+	}{
+		{models.Transaction{Method: "cash"}, true},
+		{models.Transaction{Method: "Cash"}, true},
+		{models.Transaction{Method: "voucher + cash"}, true},
+		{models.Transaction{Method: "voucher + qris"}, false},
+		{models.Transaction{Method: "qris"}, false},
+		{models.Transaction{Method: "split", Payments: []models.Payment{{Method: "qris"}, {Method: "cash"}}}, true},
+		{models.Transaction{Method: "cash", Payments: []models.Payment{{Method: "debit"}}}, false},
+	}
+	for _, tt := range tests {
+		if got := paysCash(&tt.trx); got != tt.want {
+			t.Errorf("paysCash(%s %v) = %v, want %v", tt.trx.Method, tt.trx.Payments, got, tt.want)
+		}
+	}
+}
+
+// Totals are rounded before legacy legs are derived from them, and for any
+// sale with a cash leg
+func TestSaveTransactionRoundsCashLegs(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "10")
+	t.Setenv("CASH_ROUNDING_UNIT", "500")
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Post("/orders/transaction", NewOrderHandler(client).SaveTransaction)
+
+	// 10300 + 10% = 11330, rounded up to 11500
+	sale := func(trxID string, payment map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{
+			"trx_id": trxID, "outlet_id": "ROUNDTEST", "cashier": "Ani", "type": "take_away",
+			"subtotal": 10300, "tax": 1030, "total": 11330,
+			"items": []map[string]interface{}{{"menu_name": "Roti Bakar", "qty": 1, "price": 10300, "subtotal": 10300}},
+		}
+		for k, v := range payment {
+			body[k] = v
+		}
+		return body
+	}
+	tests := []struct {
+		name    string
+		payment map[string]interface{}
+		total   float64
+		change  float64
+	}{
+		{"legacy cash without nominal", map[string]interface{}{"method": "cash"}, 11500, 0},
+		{"legacy cash with nominal", map[string]interface{}{"method": "cash", "nominal": 20000}, 11500, 8500},
+		{"split with a cash leg", map[string]interface{}{"payments": []models.Payment{{Method: "qris", Amount: 6330}, {Method: "cash", Amount: 6000}}}, 11500, 830},
+		{"qris only", map[string]interface{}{"method": "qris"}, 11330, 0},
+	}
+	for i, tt := range tests {
+		trxID := "20240515103000" + string(rune('1'+i))
+		if status, body := do(t, app, "POST", "/orders/transaction", sale(trxID, tt.payment)); status != 201 {
+			t.Errorf("%s: status %d %v", tt.name, status, body)
+			continue
+		}
+		saved := db.find("order", map[string]interface{}{"_id": trxID})[0]
+		if saved["total"] != tt.total || saved["changes"] != tt.change {
+			t.Errorf("%s: total %v, change %v, want %v and %v", tt.name, saved["total"], saved["changes"], tt.total, tt.change)
+		}
+	}
+}
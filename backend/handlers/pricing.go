@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Quotes are valid long enough for the customer to pay
+const quoteTTL = 15 * time.Minute
+
+// cartError is a pricing failure caused by the request rather than the server
+type cartError struct {
+	msg string
+}
+
+func (e *cartError) Error() string {
+	return e.msg
+}
+
+// envPercent reads a percentage from the environment with a default
+func envPercent(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// priceCart computes the authoritative price of a cart: menu prices from
+// menu_makanan (with the outlet's price overrides), promotions, voucher,
+// service charge, tax and rounding
+func priceCart(dbClient *config.AstraDBClient, req models.CartQuoteRequest, at time.Time) (*models.CartQuote, error) {
+	if len(req.Items) == 0 {
+		return nil, &cartError{"At least one item is required"}
+	}
+	if req.Type == "" {
+		return nil, &cartError{"Order type is required"}
+	}
+
+	menus, err := outletMenus(dbClient, req.OutletID, at)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := buildCartLines(menus, req.Items)
+	if err != nil {
+		return nil, &cartError{err.Error()}
+	}
+
+	promos, err := loadActivePromotions(dbClient)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := newPromotionContext(dbClient, req.OutletID, req.MemberID, at)
+	if err != nil {
+		return nil, err
+	}
+	lines, applied, promoDiscount := evaluatePromotions(lines, promos, ctx)
+	if applied == nil {
+		applied = []models.AppliedPromotion{}
+	}
+
+	var subtotal models.Money
+	for _, l := range lines {
+		subtotal += l.Subtotal
+	}
+	net := subtotal - promoDiscount
+
+	var voucherDiscount models.Money
+	if req.VoucherCode != "" {
+		nominal, err := lookupVoucherNominal(dbClient, req.VoucherCode)
+		if err != nil {
+			return nil, err
+		}
+		voucherDiscount = nominal
+		if voucherDiscount > net {
+			voucherDiscount = net
+		}
+		net -= voucherDiscount
+	}
+
+	settings, err := loadOutletSettings(dbClient, req.OutletID)
+	if err != nil {
+		return nil, err
+	}
+	rule := settings.RuleFor(req.Type)
+	serviceCharge, tax, gross := computeCharges(net, rule, settings.TaxInclusive)
+
+	// Cash rounding only applies when paying cash
+	total := gross
+	if strings.EqualFold(req.Method, "cash") {
+		total = settings.CashRounding.Apply(gross)
+	}
+
+	return &models.CartQuote{
+		Nonce:           uuid.New().String(),
+		OutletID:        req.OutletID,
+		Type:            req.Type,
+		Method:          strings.ToLower(req.Method),
+		MemberID:        req.MemberID,
+		Lines:           lines,
+		Promotions:      applied,
+		Subtotal:        subtotal,
+		PromoDiscount:   promoDiscount,
+		VoucherCode:     req.VoucherCode,
+		VoucherDiscount: voucherDiscount,
+		ServiceCharge:   serviceCharge,
+		ServiceRate:     rule.ServiceChargePercent,
+		TaxName:         settings.TaxName,
+		TaxRate:         rule.TaxPercent,
+		TaxInclusive:    settings.TaxInclusive,
+		Tax:             tax,
+		Rounding:        total - gross,
+		Total:           total,
+		ExpiresAt:       at.Add(quoteTTL).In(wib).Format(time.RFC3339),
+	}, nil
+}
+
+// lookupVoucherNominal returns the nominal of an unused voucher
+func lookupVoucherNominal(dbClient *config.AstraDBClient, code string) (models.Money, error) {
+	respBody, err := dbClient.FindDocuments("voucher", map[string]interface{}{"code_voucher": code}, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var response struct {
+		Data struct {
+			Documents []map[string]interface{} `json:"documents"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return 0, fmt.Errorf("failed to parse voucher: %v", err)
+	}
+
+	if len(response.Data.Documents) == 0 {
+		return 0, &cartError{"Kode voucher tidak ditemukan"}
+	}
+	voucher := response.Data.Documents[0]
+	if used, ok := voucher["used"].(bool); ok && used {
+		return 0, &cartError{"Voucher sudah pernah digunakan"}
+	}
+	return toMoney(voucher["nominal"]), nil
+}
+
+// signQuote encodes the quote and its HMAC signature into a quote ID
+func signQuote(quote *models.CartQuote) (string, error) {
+	unsigned := *quote
+	unsigned.QuoteID = ""
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", err
+	}
+
+	return signPayload(quoteKey, payload), nil
+}
+
+// verifyQuote checks a quote ID's signature and expiry and returns the quote
+func verifyQuote(quoteID string) (*models.CartQuote, error) {
+	payload, err := openSignedPayload(quoteKey, quoteID)
+	if err != nil {
+		if err == errBadSignature {
+			return nil, fmt.Errorf("Invalid quote signature")
+		}
+		return nil, fmt.Errorf("Malformed quote_id")
+	}
+
+	var quote models.CartQuote
+	if err := json.Unmarshal(payload, &quote); err != nil {
+		return nil, fmt.Errorf("Malformed quote_id")
+	}
+	expiresAt, err := time.Parse(time.RFC3339, quote.ExpiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("Quote has expired, please request a new one")
+	}
+
+	quote.QuoteID = quoteID
+	return &quote, nil
+}
+
+// applyQuote checks that a transaction matches its quote and overwrites the
+// transaction's money fields with the quoted numbers
+func applyQuote(trx *models.Transaction, quote *models.CartQuote) error {
+	if quote.OutletID != trx.OutletID {
+		return fmt.Errorf("Quote was issued for a different outlet")
+	}
+	// Service charge and tax depend on the order type, cash rounding on the
+	// payment method
+	if quote.Type != trx.Type {
+		return fmt.Errorf("Quote was issued for order type %q", quote.Type)
+	}
+	if method := paymentMethodOf(trx.Method, trx.Payments); method != quote.Method {
+		return fmt.Errorf("Quote was issued for payment method %q, not %q", quote.Method, method)
+	}
+
+	// Items are compared per menu item and choice of options
+	quoted := make(map[string]int)
+	for _, l := range quote.Lines {
+		variantID, modifierIDs := selectedIDs(l.Variant, l.Modifiers)
+		quoted[optionsKey(l.MenuID, variantID, modifierIDs)] += l.Qty
+	}
+	sent := make(map[string]int)
+	for _, item := range trx.Items {
+		variantID, modifierIDs := selectedIDs(item.Variant, item.Modifiers)
+		sent[optionsKey(item.MenuID, variantID, modifierIDs)] += item.Qty
+	}
+	if len(quoted) != len(sent) {
+		return fmt.Errorf("Transaction items do not match the quote")
+	}
+	for key, qty := range quoted {
+		if sent[key] != qty {
+			return fmt.Errorf("Transaction items do not match the quote")
+		}
+	}
+
+	items := make([]models.TransactionItem, 0, len(quote.Lines))
+	for _, l := range quote.Lines {
+		items = append(items, models.TransactionItem{
+			MenuID:    l.MenuID,
+			MenuName:  l.Name,
+			Qty:       l.Qty,
+			Price:     l.Price,
+			Subtotal:  l.Subtotal,
+			Variant:   l.Variant,
+			Modifiers: l.Modifiers,
+		})
+	}
+	trx.Items = items
+
+	trx.MemberID = quote.MemberID
+	trx.Subtotal = quote.Subtotal
+	trx.PromoDiscount = quote.PromoDiscount
+	trx.Promotions = quote.Promotions
+	trx.VoucherCode = quote.VoucherCode
+	trx.VoucherDiscount = quote.VoucherDiscount
+	trx.ServiceCharge = quote.ServiceCharge
+	trx.ServiceRate = quote.ServiceRate
+	trx.TaxName = quote.TaxName
+	trx.TaxRate = quote.TaxRate
+	trx.TaxInclusive = quote.TaxInclusive
+	trx.Tax = quote.Tax
+	trx.Rounding = quote.Rounding
+	trx.Total = quote.Total
+
+	return nil
+}
+
+// paymentMethodOf is the method a transaction is paid with, as quoted: the
+// method sent, else the method of its payment legs or "split" if they mix
+func paymentMethodOf(method string, payments []models.Payment) string {
+	if method != "" {
+		return strings.ToLower(strings.TrimSpace(method))
+	}
+	for _, p := range payments {
+		m := strings.ToLower(strings.TrimSpace(p.Method))
+		if method != "" && m != method {
+			return "split"
+		}
+		method = m
+	}
+	return method
+}
+
+// redeemQuote records a quote as used and redeems its voucher, so neither
+// pays for a second transaction. The quote is recorded first: once it is
+// bound to the transaction nothing else can fail before the voucher is
+// used, so a voucher is never burned for a sale that was not saved. A retry
+// of the transaction that already redeemed them passes. It reports whether
+// the voucher was redeemed now, and returns the HTTP status to respond with
+// on failure.
+func redeemQuote(dbClient *config.AstraDBClient, trx *models.Transaction, at time.Time) (bool, int, error) {
+	sum := sha256.Sum256([]byte(trx.QuoteID))
+	key := hex.EncodeToString(sum[:16])
+	_, err := dbClient.InsertDocument("quote_use", map[string]interface{}{
+		"_id":       key,
+		"trx_id":    trx.TrxID,
+		"outlet_id": trx.OutletID,
+		"used_at":   at.In(wib).Format(time.RFC3339),
+	})
+	if config.IsDuplicateDocument(err) {
+		used, err := findDocuments(dbClient, "quote_use", map[string]interface{}{"_id": key, "trx_id": trx.TrxID}, nil, 1)
+		if err != nil {
+			return false, 500, err
+		}
+		if len(used) == 0 {
+			return false, 409, fmt.Errorf("Quote has already been used, please request a new one")
+		}
+	} else if err != nil {
+		return false, 500, err
+	}
+
+	if trx.VoucherCode == "" {
+		return false, 0, nil
+	}
+	update := map[string]interface{}{
+		"used":   true,
+		"usedAt": at.Format(time.RFC3339),
+		"trx_id": trx.TrxID,
+	}
+	if trx.Customer != "" {
+		update["redeemedBy"] = trx.Customer
+	}
+	ok, err := updateDocumentIf(dbClient, "voucher", map[string]interface{}{
+		"code_voucher": trx.VoucherCode,
+		"used":         map[string]interface{}{"$ne": true},
+	}, update)
+	if err != nil {
+		return false, 500, err
+	}
+	if !ok {
+		mine, err := findDocuments(dbClient, "voucher", map[string]interface{}{"code_voucher": trx.VoucherCode, "trx_id": trx.TrxID}, nil, 1)
+		if err != nil {
+			return false, 500, err
+		}
+		if len(mine) == 0 {
+			return false, 409, fmt.Errorf("Voucher sudah pernah digunakan")
+		}
+	}
+	return ok, 0, nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestPaymentMethodOf(t *testing.T) {
+	tests := []struct {
+		method   string
+		payments []models.Payment
+		want     string
+	}{
+		{"Cash", nil, "cash"},
+		{"", []models.Payment{{Method: "qris"}}, "qris"},
+		{"", []models.Payment{{Method: "cash"}, {Method: "Cash"}}, "cash"},
+		{"", []models.Payment{{Method: "cash"}, {Method: "qris"}}, "split"},
+		{"", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := paymentMethodOf(tt.method, tt.payments); got != tt.want {
+			t.Errorf("paymentMethodOf(%q, %v) = %q, want %q", tt.method, tt.payments, got, tt.want)
+		}
+	}
+}
+
+func TestApplyQuoteChecksTypeAndMethod(t *testing.T) {
+	quote := &models.CartQuote{
+		OutletID: "O1", Type: "dine_in", Method: "cash",
+		Lines:    []models.CartLine{{MenuID: "M1", Name: "Es Teh", Qty: 2, Price: 5000, Subtotal: 10000}},
+		Subtotal: 10000, Total: 11100,
+	}
+	trx := func(orderType, method string, payments ...models.Payment) *models.Transaction {
+		return &models.Transaction{
+			OutletID: "O1", Type: orderType, Method: method, Payments: payments,
+			Items: []models.TransactionItem{{MenuID: "M1", Qty: 2}},
+		}
+	}
+
+	if err := applyQuote(trx("dine_in", "cash"), quote); err != nil {
+		t.Errorf("matching transaction: %v", err)
+	}
+	if err := applyQuote(trx("take_away", "cash"), quote); err == nil {
+		t.Error("other order type accepted")
+	}
+	if err := applyQuote(trx("dine_in", "qris"), quote); err == nil {
+		t.Error("other payment method accepted")
+	}
+	if err := applyQuote(trx("dine_in", "", models.Payment{Method: "cash"}, models.Payment{Method: "qris"}), quote); err == nil {
+		t.Error("split payment accepted for a cash quote")
+	}
+
+	applied := trx("dine_in", "", models.Payment{Method: "cash", Amount: 20000})
+	if err := applyQuote(applied, quote); err != nil {
+		t.Fatalf("cash leg: %v", err)
+	}
+	if applied.Total != 11100 || applied.Items[0].Price != 5000 {
+		t.Errorf("quoted numbers not applied: total %d, price %d", applied.Total, applied.Items[0].Price)
+	}
+}
+
+func TestRedeemQuote(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.insert("voucher",
+		map[string]interface{}{"_id": "V1", "code_voucher": "HEMAT10", "nominal": 10000, "used": false},
+		map[string]interface{}{"_id": "V2", "code_voucher": "BEKAS", "nominal": 5000, "used": true},
+	)
+	at := time.Date(2024, 5, 15, 10, 0, 0, 0, wib)
+	trx := &models.Transaction{TrxID: "T1", OutletID: "O1", QuoteID: "quote-a", VoucherCode: "HEMAT10", Customer: "Ani"}
+
+	redeemed, _, err := redeemQuote(client, trx, at)
+	if err != nil || !redeemed {
+		t.Fatalf("first use: redeemed %v, err %v", redeemed, err)
+	}
+	voucher := db.find("voucher", map[string]interface{}{"_id": "V1"})[0]
+	if voucher["used"] != true || voucher["trx_id"] != "T1" || voucher["redeemedBy"] != "Ani" {
+		t.Errorf("voucher not redeemed: %v", voucher)
+	}
+
+	// A retry of the same transaction passes without redeeming again
+	redeemed, _, err = redeemQuote(client, trx, at)
+	if err != nil || redeemed {
+		t.Errorf("retry: redeemed %v, err %v", redeemed, err)
+	}
+
+	// Another transaction may use neither the quote nor the voucher
+	other := *trx
+	other.TrxID = "T2"
+	if _, status, err := redeemQuote(client, &other, at); err == nil || status != 409 {
+		t.Errorf("reused quote: status %d, err %v", status, err)
+	}
+	other.QuoteID = "quote-b"
+	if _, status, err := redeemQuote(client, &other, at); err == nil || status != 409 {
+		t.Errorf("used voucher: status %d, err %v", status, err)
+	}
+
+	// Without a voucher the quote alone is recorded
+	plain := &models.Transaction{TrxID: "T3", OutletID: "O1", QuoteID: "quote-c"}
+	if _, _, err := redeemQuote(client, plain, at); err != nil {
+		t.Fatal(err)
+	}
+	plain.TrxID = "T4"
+	if _, status, _ := redeemQuote(client, plain, at); status != 409 {
+		t.Errorf("reused quote without voucher: status %d, want 409", status)
+	}
+
+	db.failing["quote_use"] = "SERVER_UNHANDLED_ERROR"
+	plain.QuoteID = "quote-d"
+	if _, status, _ := redeemQuote(client, plain, at); status != 500 {
+		t.Errorf("DB error: status %d, want 500", status)
+	}
+
+	// A quote that cannot be recorded leaves its voucher unused
+	db.insert("voucher", map[string]interface{}{"_id": "V3", "code_voucher": "BARU", "nominal": 5000, "used": false})
+	failed := &models.Transaction{TrxID: "T5", OutletID: "O1", QuoteID: "quote-e", VoucherCode: "BARU"}
+	if _, status, _ := redeemQuote(client, failed, at); status != 500 {
+		t.Errorf("DB error with voucher: status %d, want 500", status)
+	}
+	if voucher := db.find("voucher", map[string]interface{}{"_id": "V3"})[0]; voucher["used"] != false {
+		t.Errorf("voucher burned without a recorded quote: %v", voucher)
+	}
+}
+
+func TestCheckSigningKeys(t *testing.T) {
+	t.Setenv("QUOTE_SIGNING_SECRET", "")
+	t.Setenv("ENV", "production")
+	if err := CheckSigningKeys(); err == nil {
+		t.Error("started without QUOTE_SIGNING_SECRET in production")
+	}
+	t.Setenv("ENV", "development")
+	if err := CheckSigningKeys(); err != nil {
+		t.Errorf("development: %v", err)
+	}
+	t.Setenv("ENV", "production")
+	t.Setenv("QUOTE_SIGNING_SECRET", "s")
+	if err := CheckSigningKeys(); err != nil {
+		t.Errorf("with the secret: %v", err)
+	}
+}
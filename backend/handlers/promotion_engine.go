@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// promotionContext carries the cart-independent inputs of a promotion evaluation
+type promotionContext struct {
+	OutletID string
+	MemberID string
+	Member   bool // MemberID belongs to an active member
+	At       time.Time
+}
+
+// promoUnit is a single unit of a cart line, so promotions can consume
+// individual units (e.g. 2 of 3 Es Teh go into a bundle, the third does not)
+type promoUnit struct {
+	line  int
+	price models.Money
+	used  bool
+}
+
+// promotionActive reports whether a promotion applies to the given outlet,
+// member and moment in time (date range, weekday and WIB time window)
+func promotionActive(p models.Promotion, ctx promotionContext) bool {
+	if !p.Active {
+		return false
+	}
+	if (p.MemberOnly || p.Type == models.PromoTypeMemberDiscount) && !ctx.Member {
+		return false
+	}
+	if len(p.OutletIDs) > 0 && !containsString(p.OutletIDs, ctx.OutletID) {
+		return false
+	}
+
+	at := ctx.At.In(wib)
+	day := at.Format("2006-01-02")
+	if p.ValidFrom != "" && day < p.ValidFrom {
+		return false
+	}
+	if p.ValidUntil != "" && day > p.ValidUntil {
+		return false
+	}
+
+	if len(p.Days) > 0 {
+		found := false
+		for _, d := range p.Days {
+			if d == int(at.Weekday()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if p.StartTime != "" && p.EndTime != "" {
+		now := at.Format("15:04")
+		if p.StartTime <= p.EndTime {
+			if now < p.StartTime || now >= p.EndTime {
+				return false
+			}
+		} else if now < p.StartTime && now >= p.EndTime {
+			// Window wraps past midnight, e.g. 22:00 - 02:00
+			return false
+		}
+	}
+
+	return true
+}
+
+// promotionMatchesLine reports whether a cart line is eligible for a promotion.
+// A promotion without menu IDs or kategori applies to every line.
+func promotionMatchesLine(p models.Promotion, line models.CartLine) bool {
+	if len(p.MenuIDs) == 0 && len(p.Kategori) == 0 {
+		return true
+	}
+	if containsString(p.MenuIDs, line.MenuID) {
+		return true
+	}
+	for _, k := range p.Kategori {
+		if strings.EqualFold(strings.TrimSpace(k), strings.TrimSpace(line.Kategori)) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluatePromotions runs every active promotion over the cart, highest
+// priority first. Each unit can be discounted by at most one promotion.
+// It returns the lines with their Discount filled in, the applied promotions
+// with line-level allocation, and the total discount.
+func evaluatePromotions(lines []models.CartLine, promos []models.Promotion, ctx promotionContext) ([]models.CartLine, []models.AppliedPromotion, models.Money) {
+	out := make([]models.CartLine, len(lines))
+	copy(out, lines)
+
+	var units []*promoUnit
+	for i, l := range out {
+		out[i].Subtotal = l.Price.Times(l.Qty)
+		out[i].Discount = 0
+		for q := 0; q < l.Qty; q++ {
+			units = append(units, &promoUnit{line: i, price: l.Price})
+		}
+	}
+
+	sorted := make([]models.Promotion, 0, len(promos))
+	for _, p := range promos {
+		if promotionActive(p, ctx) {
+			sorted = append(sorted, p)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	var applied []models.AppliedPromotion
+	var totalDiscount models.Money
+
+	for _, p := range sorted {
+		var consumed []*promoUnit
+		var unitDiscount []float64
+
+		switch p.Type {
+		case models.PromoTypeBundle:
+			consumed, unitDiscount = applyBundle(p, out, units)
+		case models.PromoTypeBuyXGetY:
+			consumed, unitDiscount = applyBuyXGetY(p, out, units)
+		case models.PromoTypeCategoryPercent, models.PromoTypeMemberDiscount:
+			consumed, unitDiscount = applyPercent(p, out, units)
+		}
+		if len(consumed) == 0 {
+			continue
+		}
+
+		result := allocatePromotion(p, out, consumed, unitDiscount)
+		if result.Discount <= 0 {
+			continue
+		}
+		for _, u := range consumed {
+			u.used = true
+		}
+		for _, ld := range result.Lines {
+			out[ld.Line].Discount += ld.Discount
+		}
+		totalDiscount += result.Discount
+		applied = append(applied, result)
+	}
+
+	return out, applied, totalDiscount
+}
+
+// applyBundle consumes as many complete sets of the bundle's menu items as
+// possible and discounts them down to the bundle price
+func applyBundle(p models.Promotion, lines []models.CartLine, units []*promoUnit) ([]*promoUnit, []float64) {
+	if len(p.MenuIDs) == 0 || p.BundlePrice <= 0 {
+		return nil, nil
+	}
+
+	// Free units per bundle member, in the order they appear in the cart
+	perMenu := make([][]*promoUnit, len(p.MenuIDs))
+	sets := -1
+	for i, menuID := range p.MenuIDs {
+		for _, u := range units {
+			if !u.used && lines[u.line].MenuID == menuID {
+				perMenu[i] = append(perMenu[i], u)
+			}
+		}
+		if sets == -1 || len(perMenu[i]) < sets {
+			sets = len(perMenu[i])
+		}
+	}
+	if sets <= 0 {
+		return nil, nil
+	}
+
+	var consumed []*promoUnit
+	var regular models.Money
+	for i := range p.MenuIDs {
+		for _, u := range perMenu[i][:sets] {
+			consumed = append(consumed, u)
+			regular += u.price
+		}
+	}
+
+	discount := regular - p.BundlePrice.Times(sets)
+	if discount <= 0 || regular <= 0 {
+		return nil, nil
+	}
+
+	// Spread the bundle discount proportionally to each unit's price
+	unitDiscount := make([]float64, len(consumed))
+	for i, u := range consumed {
+		unitDiscount[i] = discount.Float64() * u.price.Float64() / regular.Float64()
+	}
+	return consumed, unitDiscount
+}
+
+// applyBuyXGetY groups eligible units (most expensive first) into sets of
+// BuyQty+GetQty and makes the cheapest GetQty units of each set free
+func applyBuyXGetY(p models.Promotion, lines []models.CartLine, units []*promoUnit) ([]*promoUnit, []float64) {
+	if p.BuyQty <= 0 || p.GetQty <= 0 {
+		return nil, nil
+	}
+
+	var eligible []*promoUnit
+	for _, u := range units {
+		if !u.used && promotionMatchesLine(p, lines[u.line]) {
+			eligible = append(eligible, u)
+		}
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		return eligible[i].price > eligible[j].price
+	})
+
+	groupSize := p.BuyQty + p.GetQty
+	groups := len(eligible) / groupSize
+	if groups == 0 {
+		return nil, nil
+	}
+
+	consumed := eligible[:groups*groupSize]
+	unitDiscount := make([]float64, len(consumed))
+	for g := 0; g < groups; g++ {
+		for i := g*groupSize + p.BuyQty; i < (g+1)*groupSize; i++ {
+			unitDiscount[i] = consumed[i].price.Float64()
+		}
+	}
+	return consumed, unitDiscount
+}
+
+// applyPercent discounts every eligible unit by the promotion percentage
+func applyPercent(p models.Promotion, lines []models.CartLine, units []*promoUnit) ([]*promoUnit, []float64) {
+	if p.Percent <= 0 || p.Percent > 100 {
+		return nil, nil
+	}
+
+	var consumed []*promoUnit
+	var unitDiscount []float64
+	for _, u := range units {
+		if !u.used && promotionMatchesLine(p, lines[u.line]) {
+			consumed = append(consumed, u)
+			unitDiscount = append(unitDiscount, u.price.Float64()*p.Percent/100)
+		}
+	}
+	return consumed, unitDiscount
+}
+
+// allocatePromotion rounds a promotion's per-unit discounts into whole-rupiah
+// line allocations whose sum equals the rounded promotion total
+func allocatePromotion(p models.Promotion, lines []models.CartLine, consumed []*promoUnit, unitDiscount []float64) models.AppliedPromotion {
+	var order []int
+	qty := make(map[int]int)
+	raw := make(map[int]float64)
+	var total float64
+	for i, u := range consumed {
+		if _, seen := qty[u.line]; !seen {
+			order = append(order, u.line)
+		}
+		qty[u.line]++
+		raw[u.line] += unitDiscount[i]
+		total += unitDiscount[i]
+	}
+	sort.Ints(order)
+
+	result := models.AppliedPromotion{
+		PromotionID: p.ID,
+		Name:        p.Name,
+		Type:        p.Type,
+		Discount:    models.NewMoney(total),
+	}
+
+	var allocated models.Money
+	for i, line := range order {
+		d := models.NewMoney(raw[line])
+		if i == len(order)-1 {
+			// Last line absorbs rounding so allocations add up exactly
+			d = result.Discount - allocated
+		}
+		allocated += d
+		result.Lines = append(result.Lines, models.PromotionLineDiscount{
+			Line:     line,
+			MenuID:   lines[line].MenuID,
+			Qty:      qty[line],
+			Discount: d,
+		})
+	}
+	return result
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
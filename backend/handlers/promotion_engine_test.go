@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestPromotionActive(t *testing.T) {
+	// Wednesday 2024-05-15, 10:30 WIB
+	at := time.Date(2024, 5, 15, 10, 30, 0, 0, wib)
+	member := promotionContext{OutletID: "O1", MemberID: "M1", Member: true, At: at}
+	claimed := promotionContext{OutletID: "O1", MemberID: "M1", At: at} // not an active member
+	guest := promotionContext{OutletID: "O1", At: at}
+
+	tests := []struct {
+		name  string
+		promo models.Promotion
+		ctx   promotionContext
+		want  bool
+	}{
+		{"active", models.Promotion{Active: true}, guest, true},
+		{"inactive", models.Promotion{}, guest, false},
+		{"member only for a member", models.Promotion{Active: true, MemberOnly: true}, member, true},
+		{"member only for an unknown member_id", models.Promotion{Active: true, MemberOnly: true}, claimed, false},
+		{"member discount for a guest", models.Promotion{Active: true, Type: models.PromoTypeMemberDiscount}, guest, false},
+		{"member discount for an unknown member_id", models.Promotion{Active: true, Type: models.PromoTypeMemberDiscount}, claimed, false},
+		{"other outlet", models.Promotion{Active: true, OutletIDs: []string{"O2"}}, guest, false},
+		{"listed outlet", models.Promotion{Active: true, OutletIDs: []string{"O2", "O1"}}, guest, true},
+		{"before valid_from", models.Promotion{Active: true, ValidFrom: "2024-05-16"}, guest, false},
+		{"last valid day", models.Promotion{Active: true, ValidUntil: "2024-05-15"}, guest, true},
+		{"after valid_until", models.Promotion{Active: true, ValidUntil: "2024-05-14"}, guest, false},
+		{"on a listed weekday", models.Promotion{Active: true, Days: []int{1, 3}}, guest, true},
+		{"on another weekday", models.Promotion{Active: true, Days: []int{0, 6}}, guest, false},
+		{"inside the window", models.Promotion{Active: true, StartTime: "09:00", EndTime: "11:00"}, guest, true},
+		{"window end is exclusive", models.Promotion{Active: true, StartTime: "09:00", EndTime: "10:30"}, guest, false},
+		{"before the window", models.Promotion{Active: true, StartTime: "14:00", EndTime: "17:00"}, guest, false},
+		{"window past midnight", models.Promotion{Active: true, StartTime: "22:00", EndTime: "11:00"}, guest, true},
+		{"outside a window past midnight", models.Promotion{Active: true, StartTime: "22:00", EndTime: "02:00"}, guest, false},
+	}
+	for _, tt := range tests {
+		if got := promotionActive(tt.promo, tt.ctx); got != tt.want {
+			t.Errorf("%s: promotionActive = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPromotionActiveUsesWIB(t *testing.T) {
+	// 23:30 UTC on Tuesday is 06:30 WIB on Wednesday
+	at := time.Date(2024, 5, 14, 23, 30, 0, 0, time.UTC)
+	promo := models.Promotion{Active: true, Days: []int{3}, StartTime: "06:00", EndTime: "07:00"}
+	if !promotionActive(promo, promotionContext{At: at}) {
+		t.Error("promotion not active at 06:30 WIB on Wednesday")
+	}
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type PromotionHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewPromotionHandler(dbClient *config.AstraDBClient) *PromotionHandler {
+	return &PromotionHandler{dbClient: dbClient}
+}
+
+// GetPromotions lists promotions, optionally only active ones for an outlet
+func (h *PromotionHandler) GetPromotions(c *fiber.Ctx) error {
+	outletID := c.Query("outlet_id")
+	activeOnly := c.QueryBool("active", false)
+
+	filter := map[string]interface{}{}
+	if activeOnly {
+		filter["active"] = true
+	}
+
+	promos, err := findPromotions(h.dbClient, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result := []models.Promotion{}
+	for _, p := range promos {
+		if outletID != "" && len(p.OutletIDs) > 0 && !containsString(p.OutletIDs, outletID) {
+			continue
+		}
+		result = append(result, p)
+	}
+
+	return c.JSON(fiber.Map{
+		"promotions": result,
+		"count":      len(result),
+	})
+}
+
+// CreatePromotion creates a new promotion rule
+func (h *PromotionHandler) CreatePromotion(c *fiber.Ctx) error {
+	var promo models.Promotion
+	if err := c.BodyParser(&promo); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	promo.StartTime, promo.EndTime = clockHHMM(promo.StartTime), clockHHMM(promo.EndTime)
+	if err := validatePromotion(promo); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now().In(wib).Format(time.RFC3339)
+	promo.ID = uuid.New().String()
+	promo.CreatedAt = now
+	promo.UpdatedAt = now
+
+	document, err := toDocument(promo)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if _, err := h.dbClient.InsertDocument("promotion", document); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(promo)
+}
+
+// promotionOptionalFields are the rule fields of a promotion that are
+// omitted from documents when empty
+var promotionOptionalFields = []string{
+	"outlet_ids", "menu_ids", "kategori", "bundle_price", "buy_qty", "get_qty", "percent",
+	"days", "start_time", "end_time", "valid_from", "valid_until",
+}
+
+// UpdatePromotion replaces the rule fields of an existing promotion
+func (h *PromotionHandler) UpdatePromotion(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var promo models.Promotion
+	if err := c.BodyParser(&promo); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	promo.StartTime, promo.EndTime = clockHHMM(promo.StartTime), clockHHMM(promo.EndTime)
+	if err := validatePromotion(promo); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	promo.ID = ""
+	promo.CreatedAt = ""
+	promo.UpdatedAt = time.Now().In(wib).Format(time.RFC3339)
+
+	update, err := toDocument(promo)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	delete(update, "created_at")
+	// The rule is replaced, so optional fields left out (or sent as null or
+	// empty) are cleared instead of keeping their stored value
+	for _, field := range promotionOptionalFields {
+		if _, ok := update[field]; !ok {
+			update[field] = nil
+		}
+	}
+
+	ok, err := updateDocumentIf(h.dbClient, "promotion", map[string]interface{}{"_id": id}, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Promotion not found"})
+	}
+
+	promo.ID = id
+	return c.JSON(promo)
+}
+
+// DeletePromotion deactivates a promotion (kept for historical transactions)
+func (h *PromotionHandler) DeletePromotion(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	update := map[string]interface{}{
+		"active":     false,
+		"updated_at": time.Now().In(wib).Format(time.RFC3339),
+	}
+	if _, err := h.dbClient.UpdateDocument("promotion", map[string]interface{}{"_id": id}, update); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Promotion deactivated successfully"})
+}
+
+// EvaluatePromotions prices a cart of menu items and returns the promotions
+// that apply to it with their line-level discount allocation
+func (h *PromotionHandler) EvaluatePromotions(c *fiber.Ctx) error {
+	var req models.EvaluatePromotionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "At least one item is required"})
+	}
+
+	menus, err := outletMenus(h.dbClient, req.OutletID, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	lines, err := buildCartLines(menus, req.Items)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	promos, err := loadActivePromotions(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, err := newPromotionContext(h.dbClient, req.OutletID, req.MemberID, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	lines, applied, discount := evaluatePromotions(lines, promos, ctx)
+
+	var subtotal models.Money
+	for _, l := range lines {
+		subtotal += l.Subtotal
+	}
+	if applied == nil {
+		applied = []models.AppliedPromotion{}
+	}
+
+	return c.JSON(models.EvaluatePromotionsResponse{
+		Lines:         lines,
+		Promotions:    applied,
+		Subtotal:      subtotal,
+		TotalDiscount: discount,
+	})
+}
+
+// validatePromotion checks that a promotion rule is complete for its type
+func validatePromotion(p models.Promotion) error {
+	if p.Name == "" {
+		return fmt.Errorf("Promotion name is required")
+	}
+
+	switch p.Type {
+	case models.PromoTypeBundle:
+		if len(p.MenuIDs) < 2 {
+			return fmt.Errorf("Bundle requires at least two menu_ids")
+		}
+		if p.BundlePrice <= 0 {
+			return fmt.Errorf("Bundle requires bundle_price > 0")
+		}
+	case models.PromoTypeBuyXGetY:
+		if p.BuyQty <= 0 || p.GetQty <= 0 {
+			return fmt.Errorf("buy_qty and get_qty must be > 0")
+		}
+	case models.PromoTypeCategoryPercent, models.PromoTypeMemberDiscount:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return fmt.Errorf("percent must be between 0 and 100")
+		}
+	default:
+		return fmt.Errorf("Unknown promotion type: %s", p.Type)
+	}
+
+	for _, t := range []string{p.StartTime, p.EndTime} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("Invalid time %q, expected HH:MM", t)
+		}
+	}
+	if (p.StartTime == "") != (p.EndTime == "") {
+		return fmt.Errorf("start_time and end_time must be set together")
+	}
+	for _, d := range []string{p.ValidFrom, p.ValidUntil} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("Invalid date %q, expected YYYY-MM-DD", d)
+		}
+	}
+	for _, d := range p.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("days must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+
+	return nil
+}
+
+// buildCartLines resolves requested menu IDs and options to priced cart
+// lines using the authoritative prices in menu_makanan
+func buildCartLines(menus map[string]models.Menu, items []models.CartItemRequest) ([]models.CartLine, error) {
+	lines := make([]models.CartLine, 0, len(items))
+	for _, item := range items {
+		if item.Qty <= 0 {
+			return nil, fmt.Errorf("Quantity for menu %s must be > 0", item.MenuID)
+		}
+		menu, ok := menus[item.MenuID]
+		if !ok {
+			return nil, fmt.Errorf("Menu item not found: %s", item.MenuID)
+		}
+		variant, modifiers, price, err := resolveOptions(menu, item.VariantID, item.ModifierIDs)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, models.CartLine{
+			MenuID:    menu.ID,
+			Name:      menu.Name,
+			Kategori:  menu.Kategori,
+			Variant:   variant,
+			Modifiers: modifiers,
+			Qty:       item.Qty,
+			Price:     price,
+			Subtotal:  price.Times(item.Qty),
+		})
+	}
+	return lines, nil
+}
+
+// validateTransactionPromotions recomputes the promotions for a transaction's
+// items as of at and checks the client-sent discount against the engine's
+// result. On success the transaction's promotions are replaced by the
+// server's. Errors caused by the transaction are *cartError.
+func validateTransactionPromotions(dbClient *config.AstraDBClient, trx *models.Transaction, at time.Time) error {
+	menus, err := outletMenus(dbClient, trx.OutletID, at)
+	if err != nil {
+		return err
+	}
+
+	items := make([]models.CartItemRequest, 0, len(trx.Items))
+	for _, item := range trx.Items {
+		if item.MenuID == "" {
+			return &cartError{"menu_id is required on every item when promotions are applied"}
+		}
+		variantID, modifierIDs := selectedIDs(item.Variant, item.Modifiers)
+		items = append(items, models.CartItemRequest{MenuID: item.MenuID, VariantID: variantID, ModifierIDs: modifierIDs, Qty: item.Qty})
+	}
+
+	lines, err := buildCartLines(menus, items)
+	if err != nil {
+		return &cartError{err.Error()}
+	}
+
+	promos, err := loadActivePromotions(dbClient)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := newPromotionContext(dbClient, trx.OutletID, trx.MemberID, at)
+	if err != nil {
+		return err
+	}
+	_, applied, discount := evaluatePromotions(lines, promos, ctx)
+
+	if discount != trx.PromoDiscount {
+		return &cartError{fmt.Sprintf("Promotion discount mismatch: expected %d, got %d", discount, trx.PromoDiscount)}
+	}
+
+	trx.PromoDiscount = discount
+	trx.Promotions = applied
+	return nil
+}
+
+// clockHHMM writes a time of day like "9:00" as "09:00", so times compare
+// correctly as strings. Invalid times are returned as they are.
+func clockHHMM(s string) string {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return s
+	}
+	return t.Format("15:04")
+}
+
+// newPromotionContext looks up the member of a cart, so member-only
+// promotions apply to active members only and not to any member_id sent
+func newPromotionContext(dbClient *config.AstraDBClient, outletID, memberID string, at time.Time) (promotionContext, error) {
+	member, err := isActiveMember(dbClient, memberID)
+	if err != nil {
+		return promotionContext{}, err
+	}
+	return promotionContext{OutletID: outletID, MemberID: memberID, Member: member, At: at}, nil
+}
+
+// loadActivePromotions returns every promotion flagged active; time windows
+// and outlet restrictions are applied later by the engine
+func loadActivePromotions(dbClient *config.AstraDBClient) ([]models.Promotion, error) {
+	return findPromotions(dbClient, map[string]interface{}{"active": true})
+}
+
+// findPromotions queries the promotion collection with the given filter
+func findPromotions(dbClient *config.AstraDBClient, filter map[string]interface{}) ([]models.Promotion, error) {
+	respBody, err := dbClient.FindDocuments("promotion", filter, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data struct {
+			Documents []models.Promotion `json:"documents"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse promotions: %v", err)
+	}
+
+	return response.Data.Documents, nil
+}
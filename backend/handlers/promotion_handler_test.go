@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNewPromotionContextLooksUpMember(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.insert("member",
+		map[string]interface{}{"_id": "M1", "name": "Ani", "active": true},
+		map[string]interface{}{"_id": "M2", "name": "Budi", "active": false},
+	)
+
+	for memberID, want := range map[string]bool{"M1": true, "M2": false, "M3": false, "": false} {
+		ctx, err := newPromotionContext(client, "O1", memberID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ctx.Member != want {
+			t.Errorf("member_id %q: Member = %v, want %v", memberID, ctx.Member, want)
+		}
+	}
+
+	db.failing["member"] = "SERVER_UNHANDLED_ERROR"
+	if _, err := newPromotionContext(client, "O1", "M1", time.Now()); err == nil {
+		t.Error("member lookup error was ignored")
+	}
+}
+
+func TestUpdatePromotionClearsOmittedFields(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.insert("promotion", map[string]interface{}{
+		"_id": "P1", "name": "Happy hour", "type": "category_percent", "percent": 10,
+		"kategori": []string{"Minuman"}, "outlet_ids": []string{"O1"}, "days": []int{1, 2},
+		"start_time": "14:00", "end_time": "17:00", "active": true, "created_at": "2024-05-01T10:00:00+07:00",
+	})
+	h := NewPromotionHandler(client)
+	app := fiber.New()
+	app.Put("/promotions/:id", h.UpdatePromotion)
+
+	status, body := do(t, app, "PUT", "/promotions/P1", map[string]interface{}{
+		"name": "Happy hour", "type": "category_percent", "percent": 15,
+		"kategori": []string{"Minuman"}, "outlet_ids": nil, "start_time": "9:00", "end_time": "11:00", "active": true,
+	})
+	if status != 200 {
+		t.Fatalf("status %d %v", status, body)
+	}
+
+	promo := db.find("promotion", map[string]interface{}{"_id": "P1"})[0]
+	if promo["outlet_ids"] != nil || promo["days"] != nil {
+		t.Errorf("outlet_ids/days not cleared: %v", promo)
+	}
+	if promo["percent"] != float64(15) || promo["created_at"] != "2024-05-01T10:00:00+07:00" {
+		t.Errorf("update not applied: %v", promo)
+	}
+	if promo["start_time"] != "09:00" || promo["end_time"] != "11:00" {
+		t.Errorf("times not written as HH:MM: %v - %v", promo["start_time"], promo["end_time"])
+	}
+
+	if status, _ := do(t, app, "PUT", "/promotions/P9", map[string]interface{}{"name": "x", "type": "buy_x_get_y", "buy_qty": 1, "get_qty": 1}); status != 404 {
+		t.Errorf("unknown promotion: status %d, want 404", status)
+	}
+}
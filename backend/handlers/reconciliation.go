@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Settlement rows that cannot be matched to a charge have no outlet
+const unassignedOutlet = "unassigned"
+
+// reconcileInterval reads PAYMENT_RECONCILE_INTERVAL (e.g. "2m"); "0"
+// disables the background polling job
+func reconcileInterval() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("PAYMENT_RECONCILE_INTERVAL"))
+	if raw == "" {
+		return 2 * time.Minute
+	}
+	if raw == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		fmt.Printf("Warning: Invalid PAYMENT_RECONCILE_INTERVAL %q, using 2m\n", raw)
+		return 2 * time.Minute
+	}
+	return d
+}
+
+// StartReconciliation periodically polls the gateway for charges that are
+// still pending, in case their webhook never arrived
+func (h *PaymentHandler) StartReconciliation() {
+	interval := reconcileInterval()
+	if interval == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checked, updated := h.pollPendingCharges()
+			if updated > 0 {
+				fmt.Printf("Payment reconciliation: %d of %d pending charges updated\n", updated, checked)
+			}
+		}
+	}()
+}
+
+// Reconcile runs the pending charge poll immediately
+func (h *PaymentHandler) Reconcile(c *fiber.Ctx) error {
+	checked, updated := h.pollPendingCharges()
+	return c.JSON(fiber.Map{"checked": checked, "updated": updated})
+}
+
+// pollPendingCharges queries the gateway for every pending charge and stores
+// status changes
+func (h *PaymentHandler) pollPendingCharges() (checked, updated int) {
+	filter := map[string]interface{}{
+		"status":  models.PaymentStatusPending,
+		"gateway": h.gateway.Name(),
+	}
+
+	for _, charge := range findPaymentCharges(h.dbClient, filter) {
+		checked++
+		remote, err := h.gateway.GetStatus(charge.Reference)
+		if err != nil {
+			fmt.Printf("Warning: Failed to query payment %s: %v\n", charge.Reference, err)
+			continue
+		}
+		if remote.Status == charge.Status {
+			continue
+		}
+		if remote.Status == models.PaymentStatusPaid && remote.Amount != int64(charge.Amount) {
+			fmt.Printf("Payment %s amount mismatch: expected %d, gateway reported %d\n",
+				charge.Reference, charge.Amount, remote.Amount)
+			continue
+		}
+		if err := updateChargeStatus(h.dbClient, charge, remote.Status, remote.GatewayID); err != nil {
+			fmt.Printf("Warning: Failed to update payment %s: %v\n", charge.Reference, err)
+			continue
+		}
+		updated++
+	}
+	return checked, updated
+}
+
+// ImportSettlement reconciles a gateway settlement CSV (multipart field
+// "file") against stored charges and saves one report per outlet. Rows are
+// matched by reference and amount; paid charges of the settlement date that
+// are missing from the file are flagged as unsettled. Reports are keyed by
+// gateway, date and file name, so importing the same file again replaces
+// its reports instead of adding a second set.
+func (h *PaymentHandler) ImportSettlement(c *fiber.Ctx) error {
+	date := c.FormValue("date", c.Query("date")) // format: YYYY-MM-DD
+	if date == "" {
+		date = time.Now().In(wib).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Settlement file is required"})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer file.Close()
+
+	rows, err := parseSettlementCSV(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	references := make([]string, 0, len(rows))
+	for _, row := range rows {
+		references = append(references, row.Reference)
+	}
+	charges := make(map[string]*models.PaymentCharge)
+	for _, charge := range loadPaymentCharges(h.dbClient, references) {
+		charges[charge.Reference] = charge
+	}
+
+	// Paid charges of the settlement date, to find ones the gateway did not settle
+	paidFilter := map[string]interface{}{
+		"status":  models.PaymentStatusPaid,
+		"gateway": h.gateway.Name(),
+		"paid_at": map[string]interface{}{
+			"$gte": date + "T00:00:00Z",
+			"$lte": date + "T23:59:59Z",
+		},
+	}
+	for _, charge := range findPaymentCharges(h.dbClient, paidFilter) {
+		if _, ok := charges[charge.Reference]; !ok {
+			charges[charge.Reference] = charge
+		}
+	}
+
+	settlement := settlementKey(h.gateway.Name(), date, fileHeader.Filename)
+	reports := reconcileSettlement(rows, charges, settlement)
+
+	now := time.Now().In(wib).Format(time.RFC3339)
+	settled := make(map[string]bool)
+	for _, report := range reports {
+		report.ID = settlement + ":" + report.OutletID
+		report.Gateway = h.gateway.Name()
+		report.Date = date
+		report.FileName = fileHeader.Filename
+		report.ImportedAt = now
+
+		document, err := toDocument(report)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		delete(document, "_id")
+		if _, err := h.dbClient.UpsertDocument("reconciliation_report", map[string]interface{}{"_id": report.ID}, document); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		for _, item := range report.Items {
+			if item.Status != models.ReconMatched && item.Status != models.ReconMissingTransaction {
+				continue
+			}
+			if settled[item.Reference] {
+				continue
+			}
+			settled[item.Reference] = true
+			h.markChargeSettled(charges[item.Reference], settlement, now)
+		}
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"date":    date,
+		"rows":    len(rows),
+		"reports": reports,
+	})
+}
+
+// GetReconciliationReports lists stored reports, optionally by outlet and date
+func (h *PaymentHandler) GetReconciliationReports(c *fiber.Ctx) error {
+	filter := map[string]interface{}{}
+	if outletID := c.Query("outlet_id"); outletID != "" {
+		filter["outlet_id"] = outletID
+	}
+	if date := c.Query("date"); date != "" {
+		filter["date"] = date
+	}
+
+	documents := fetchDocuments(h.dbClient, "reconciliation_report", filter, map[string]interface{}{"imported_at": -1}, 10)
+	return c.JSON(fiber.Map{
+		"count":   len(documents),
+		"reports": documents,
+	})
+}
+
+// settlementKey identifies a settlement file; its reports and the charges it
+// settled refer to it
+func settlementKey(gateway, date, fileName string) string {
+	return gateway + ":" + date + ":" + fileName
+}
+
+// markChargeSettled records the settlement on a charge. A charge that was
+// still pending here has been paid, the webhook just never arrived. Charges
+// already settled keep their first settlement time.
+func (h *PaymentHandler) markChargeSettled(charge *models.PaymentCharge, settlement, settledAt string) {
+	if charge == nil || charge.SettledAt != "" {
+		return
+	}
+	if charge.Status == models.PaymentStatusPending {
+		if err := updateChargeStatus(h.dbClient, charge, models.PaymentStatusPaid, ""); err != nil {
+			fmt.Printf("Warning: Failed to update payment %s: %v\n", charge.Reference, err)
+		}
+	}
+	update := map[string]interface{}{"settled_at": settledAt, "settlement": settlement}
+	if _, err := h.dbClient.UpdateDocument("payment_charge", map[string]interface{}{"_id": charge.Reference}, update); err != nil {
+		fmt.Printf("Warning: Failed to mark payment %s settled: %v\n", charge.Reference, err)
+	}
+}
+
+// reconcileSettlement matches settlement rows of the settlement file against
+// charges and groups the outcome per outlet. Every charge appears once;
+// repeated references in the file, and charges already settled by another
+// file, are flagged as duplicated.
+func reconcileSettlement(rows []models.SettlementRow, charges map[string]*models.PaymentCharge, settlement string) []*models.ReconciliationReport {
+	reports := make(map[string]*models.ReconciliationReport)
+	report := func(outletID string) *models.ReconciliationReport {
+		if outletID == "" {
+			outletID = unassignedOutlet
+		}
+		r, ok := reports[outletID]
+		if !ok {
+			r = &models.ReconciliationReport{OutletID: outletID, Items: []models.ReconciliationItem{}}
+			reports[outletID] = r
+		}
+		return r
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		charge := charges[row.Reference]
+		item := models.ReconciliationItem{
+			Line:          row.Line,
+			Reference:     row.Reference,
+			SettledAmount: row.Amount,
+		}
+
+		outletID := ""
+		switch {
+		case charge == nil:
+			item.Status = models.ReconUnmatched
+			item.Note = "No payment with this reference"
+		case seen[row.Reference]:
+			outletID = charge.OutletID
+			item.TrxID = charge.TrxID
+			item.ChargeAmount = charge.Amount
+			item.Status = models.ReconDuplicated
+			item.Note = "Reference already settled earlier in the file"
+		case charge.SettledAt != "" && charge.Settlement != settlement:
+			outletID = charge.OutletID
+			item.TrxID = charge.TrxID
+			item.ChargeAmount = charge.Amount
+			item.Status = models.ReconDuplicated
+			item.Note = "Reference already settled by an earlier import at " + charge.SettledAt
+		default:
+			outletID = charge.OutletID
+			item.TrxID = charge.TrxID
+			item.ChargeAmount = charge.Amount
+			switch {
+			case row.Amount != charge.Amount:
+				item.Status = models.ReconAmountMismatch
+				item.Note = fmt.Sprintf("Charged %d, settled %d", charge.Amount, row.Amount)
+			case charge.FinalizedAt == "":
+				item.Status = models.ReconMissingTransaction
+				item.Note = "Paid but no transaction was saved with this payment"
+			default:
+				item.Status = models.ReconMatched
+			}
+		}
+		seen[row.Reference] = true
+
+		r := report(outletID)
+		r.Items = append(r.Items, item)
+		r.SettledAmount += row.Amount
+		if item.Status != models.ReconUnmatched && item.Status != models.ReconDuplicated {
+			r.ChargeAmount += item.ChargeAmount
+		}
+	}
+
+	for _, charge := range charges {
+		if seen[charge.Reference] || charge.Status != models.PaymentStatusPaid || charge.SettledAt != "" {
+			continue
+		}
+		r := report(charge.OutletID)
+		r.Items = append(r.Items, models.ReconciliationItem{
+			Status:       models.ReconUnsettled,
+			Reference:    charge.Reference,
+			TrxID:        charge.TrxID,
+			ChargeAmount: charge.Amount,
+			Note:         "Paid but missing from the settlement file",
+		})
+		r.ChargeAmount += charge.Amount
+	}
+
+	result := make([]*models.ReconciliationReport, 0, len(reports))
+	for _, r := range reports {
+		for _, item := range r.Items {
+			switch item.Status {
+			case models.ReconMatched:
+				r.Matched++
+			case models.ReconUnmatched:
+				r.Unmatched++
+			case models.ReconDuplicated:
+				r.Duplicated++
+			case models.ReconAmountMismatch:
+				r.AmountMismatch++
+			case models.ReconUnsettled:
+				r.Unsettled++
+			case models.ReconMissingTransaction:
+				r.MissingTransaction++
+			}
+		}
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].OutletID < result[j].OutletID
+	})
+	return result
+}
+
+// parseSettlementCSV reads a settlement file with a header row. Column names
+// follow the common gateway exports: order_id/reference, transaction_id,
+// gross_amount/amount and settlement_time.
+func parseSettlementCSV(r io.Reader) ([]models.SettlementRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Settlement file is empty or invalid")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[strings.ReplaceAll(name, " ", "_")] = i
+	}
+	column := func(names ...string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	refCol := column("order_id", "reference", "merchant_order_id")
+	amountCol := column("gross_amount", "amount", "settlement_amount")
+	if refCol < 0 || amountCol < 0 {
+		return nil, fmt.Errorf("Settlement file needs order_id (or reference) and gross_amount (or amount) columns")
+	}
+	gatewayCol := column("transaction_id", "gateway_id")
+	settledCol := column("settlement_time", "settled_at", "transaction_time")
+
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []models.SettlementRow
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+
+		reference := field(record, refCol)
+		if reference == "" {
+			continue
+		}
+
+		var amount models.Money
+		raw := strings.ReplaceAll(field(record, amountCol), ",", "")
+		if err := json.Unmarshal([]byte(`"`+raw+`"`), &amount); err != nil {
+			return nil, fmt.Errorf("Line %d: invalid amount %q", line, raw)
+		}
+
+		rows = append(rows, models.SettlementRow{
+			Line:      line,
+			Reference: reference,
+			GatewayID: field(record, gatewayCol),
+			Amount:    amount,
+			SettledAt: field(record, settledCol),
+		})
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Settlement file has no rows")
+	}
+	return rows, nil
+}
+
+// findPaymentCharges fetches charges matching a filter
+func findPaymentCharges(dbClient *config.AstraDBClient, filter map[string]interface{}) []*models.PaymentCharge {
+	var charges []*models.PaymentCharge
+	for _, doc := range fetchDocuments(dbClient, "payment_charge", filter, nil, 20) {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		var charge models.PaymentCharge
+		if err := json.Unmarshal(data, &charge); err != nil {
+			continue
+		}
+		charges = append(charges, &charge)
+	}
+	return charges
+}
+
+// loadPaymentCharges fetches charges by reference in batches of 100
+func loadPaymentCharges(dbClient *config.AstraDBClient, references []string) []*models.PaymentCharge {
+	unique := make([]string, 0, len(references))
+	seen := make(map[string]bool)
+	for _, ref := range references {
+		if !seen[ref] {
+			seen[ref] = true
+			unique = append(unique, ref)
+		}
+	}
+
+	var charges []*models.PaymentCharge
+	for start := 0; start < len(unique); start += 100 {
+		end := start + 100
+		if end > len(unique) {
+			end = len(unique)
+		}
+		filter := map[string]interface{}{"_id": map[string]interface{}{"$in": unique[start:end]}}
+		charges = append(charges, findPaymentCharges(dbClient, filter)...)
+	}
+	return charges
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"sagawa_pos_backend/gateway"
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReconcileSettlement(t *testing.T) {
+	const file = "fake:2024-05-01:settlement.csv"
+	charges := map[string]*models.PaymentCharge{
+		"P1": {Reference: "P1", OutletID: "O1", TrxID: "T1", Amount: 10000, Status: models.PaymentStatusPaid, FinalizedAt: "x"},
+		"P2": {Reference: "P2", OutletID: "O1", TrxID: "T2", Amount: 20000, Status: models.PaymentStatusPaid, FinalizedAt: "x"},
+		"P3": {Reference: "P3", OutletID: "O2", Amount: 5000, Status: models.PaymentStatusPaid},
+		"P4": {Reference: "P4", OutletID: "O2", TrxID: "T4", Amount: 7000, Status: models.PaymentStatusPaid, FinalizedAt: "x"},
+		"P5": {Reference: "P5", OutletID: "O1", TrxID: "T5", Amount: 3000, Status: models.PaymentStatusPaid, FinalizedAt: "x",
+			SettledAt: "2024-04-30T10:00:00+07:00", Settlement: "fake:2024-04-30:earlier.csv"},
+		"P6": {Reference: "P6", OutletID: "O1", TrxID: "T6", Amount: 4000, Status: models.PaymentStatusPaid, FinalizedAt: "x",
+			SettledAt: "2024-05-01T10:00:00+07:00", Settlement: file},
+		"P7": {Reference: "P7", OutletID: "O2", TrxID: "T7", Amount: 8000, Status: models.PaymentStatusPaid, FinalizedAt: "x",
+			SettledAt: "2024-04-30T10:00:00+07:00", Settlement: "fake:2024-04-30:earlier.csv"},
+	}
+	rows := []models.SettlementRow{
+		{Line: 2, Reference: "P1", Amount: 10000},
+		{Line: 3, Reference: "P2", Amount: 19000},
+		{Line: 4, Reference: "P1", Amount: 10000},
+		{Line: 5, Reference: "P3", Amount: 5000},
+		{Line: 6, Reference: "X9", Amount: 1000},
+		{Line: 7, Reference: "P5", Amount: 3000},
+		{Line: 8, Reference: "P6", Amount: 4000},
+	}
+
+	statuses := map[int]string{}
+	unsettled := map[string]bool{}
+	reports := reconcileSettlement(rows, charges, file)
+	for _, r := range reports {
+		for _, item := range r.Items {
+			if item.Line == 0 {
+				unsettled[item.Reference] = item.Status == models.ReconUnsettled
+				continue
+			}
+			statuses[item.Line] = item.Status
+		}
+	}
+
+	want := map[int]string{
+		2: models.ReconMatched,
+		3: models.ReconAmountMismatch,
+		4: models.ReconDuplicated,
+		5: models.ReconMissingTransaction,
+		6: models.ReconUnmatched,
+		7: models.ReconDuplicated, // settled by an earlier file
+		8: models.ReconMatched,    // settled by this file, imported again
+	}
+	for line, status := range want {
+		if statuses[line] != status {
+			t.Errorf("line %d: %q, want %q", line, statuses[line], status)
+		}
+	}
+	// P7 was settled by another file, so it is not missing from this one
+	if len(unsettled) != 1 || !unsettled["P4"] {
+		t.Errorf("unsettled charges %v, want only P4", unsettled)
+	}
+
+	if len(reports) != 3 || reports[0].OutletID != "O1" || reports[1].OutletID != "O2" || reports[2].OutletID != unassignedOutlet {
+		t.Fatalf("reports not grouped per outlet: %+v", reports)
+	}
+	if o1 := reports[0]; o1.Matched != 2 || o1.AmountMismatch != 1 || o1.Duplicated != 2 {
+		t.Errorf("O1 counters %+v", o1)
+	}
+}
+
+func TestImportSettlementTwiceReplacesReports(t *testing.T) {
+	db, client := newFakeDB(t)
+	h := NewPaymentHandler(client, gateway.NewFakeGateway("secret"))
+	app := fiber.New()
+	app.Post("/settlements/import", h.ImportSettlement)
+	db.insert("payment_charge",
+		models.PaymentCharge{Reference: "P1", OutletID: "O1", TrxID: "T1", Gateway: "fake", Amount: 10000, Status: models.PaymentStatusPaid, FinalizedAt: "x", PaidAt: "2024-05-01T03:00:00Z"},
+		models.PaymentCharge{Reference: "P2", OutletID: "O1", TrxID: "T2", Gateway: "fake", Amount: 20000, Status: models.PaymentStatusPaid, FinalizedAt: "x", PaidAt: "2024-05-01T04:00:00Z"},
+	)
+
+	upload := func(name, csv string) (int, map[string]interface{}) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("date", "2024-05-01")
+		part, _ := form.CreateFormFile("file", name)
+		io.WriteString(part, csv)
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/settlements/import", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var decoded map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp.StatusCode, decoded
+	}
+	counter := func(result map[string]interface{}, field string) float64 {
+		reports, _ := result["reports"].([]interface{})
+		if len(reports) != 1 {
+			t.Fatalf("reports %v, want one", result["reports"])
+		}
+		return reports[0].(map[string]interface{})[field].(float64)
+	}
+
+	const csv = "order_id,gross_amount\nP1,10000\nP2,20000\n"
+	for i := 0; i < 2; i++ {
+		status, result := upload("day1.csv", csv)
+		if status != 201 || counter(result, "matched") != 2 || counter(result, "duplicated") != 0 {
+			t.Fatalf("import %d: status %d %v", i+1, status, result)
+		}
+	}
+	if reports := db.find("reconciliation_report", map[string]interface{}{}); len(reports) != 1 {
+		t.Fatalf("%d reports stored after importing the same file twice, want 1", len(reports))
+	}
+
+	// The same references in another file were settled already
+	status, result := upload("day1-again.csv", csv)
+	if status != 201 || counter(result, "duplicated") != 2 || counter(result, "matched") != 0 {
+		t.Fatalf("other file: status %d %v", status, result)
+	}
+	charge := db.find("payment_charge", map[string]interface{}{"_id": "P1"})[0]
+	if charge["settlement"] != "fake:2024-05-01:day1.csv" {
+		t.Errorf("charge settlement %v, want the first file", charge["settlement"])
+	}
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Sequences are counters in the sequence collection keyed by kind, outlet
+// and business day. Each number comes from an atomic server-side increment,
+// so concurrent requests and multiple server instances never get the same
+// value and numbering continues across restarts.
+//
+// Numbering is gapless: a number taken for a request that then fails, or
+// handed to a device that gives it back, is released to the
+// sequence_release collection and issued again before the counter moves on.
+// A released number can therefore be issued after higher ones.
+
+// sequenceKey identifies the counter of a kind, outlet and WIB business day
+func sequenceKey(kind, outletID, date string) string {
+	return fmt.Sprintf("%s:%s:%s", kind, outletID, date)
+}
+
+// nextSequence returns the next value of a per-outlet per-day counter,
+// reusing the lowest released value first
+func nextSequence(dbClient *config.AstraDBClient, kind, outletID string, day time.Time) (int64, error) {
+	key := sequenceKey(kind, outletID, day.In(wib).Format("2006-01-02"))
+	value, err := claimReleasedSequence(dbClient, key)
+	if err != nil || value > 0 {
+		return value, err
+	}
+	return incrementSequence(dbClient, key)
+}
+
+// incrementSequence atomically takes the next value of a sequence document
+func incrementSequence(dbClient *config.AstraDBClient, key string) (int64, error) {
+	respBody, err := dbClient.IncrementDocument("sequence", map[string]interface{}{"_id": key}, "value", 1)
+	if err != nil {
+		return 0, err
+	}
+
+	var response struct {
+		Data struct {
+			Document struct {
+				Value int64 `json:"value"`
+			} `json:"document"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return 0, fmt.Errorf("failed to parse sequence: %v", err)
+	}
+	if response.Data.Document.Value <= 0 {
+		return 0, fmt.Errorf("sequence %s not incremented: %s", key, string(respBody))
+	}
+	return response.Data.Document.Value, nil
+}
+
+// claimReleasedSequence takes the lowest released value of a counter; 0 if
+// none is waiting. Released values are claimed with a compare-and-set, so
+// concurrent requests never take the same one.
+func claimReleasedSequence(dbClient *config.AstraDBClient, key string) (int64, error) {
+	filter := map[string]interface{}{"key": key, "claimed": map[string]interface{}{"$ne": true}}
+	docs, err := findDocuments(dbClient, "sequence_release", filter, map[string]interface{}{"value": 1}, 1)
+	if err != nil {
+		return 0, err
+	}
+	for _, doc := range docs {
+		id := toString(doc["_id"])
+		claim := map[string]interface{}{"claimed": true, "claimed_at": time.Now().In(wib).Format(time.RFC3339)}
+		ok, err := updateDocumentIf(dbClient, "sequence_release", map[string]interface{}{"_id": id, "claimed": map[string]interface{}{"$ne": true}}, claim)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return int64(toFloat(doc["value"])), nil
+		}
+	}
+	return 0, nil
+}
+
+// releaseSequence gives an issued value that was not used back to its
+// counter. Failures are logged: the value is then skipped, as before.
+func releaseSequence(dbClient *config.AstraDBClient, kind, outletID, date string, value int64) {
+	key := sequenceKey(kind, outletID, date)
+	id := fmt.Sprintf("%s:%d", key, value)
+	document := map[string]interface{}{
+		"key":         key,
+		"value":       value,
+		"claimed":     false,
+		"released_at": time.Now().In(wib).Format(time.RFC3339),
+	}
+	if _, err := dbClient.UpsertDocument("sequence_release", map[string]interface{}{"_id": id}, document); err != nil {
+		fmt.Printf("Warning: Failed to release %s: %v\n", id, err)
+	}
+}
+
+// releaseNumber gives an issued number that was not used back
+func releaseNumber(dbClient *config.AstraDBClient, number *models.SequenceNumber) {
+	if number != nil {
+		releaseSequence(dbClient, number.Kind, number.OutletID, number.Date, number.Value)
+	}
+}
+
+// issueNumber takes the next number of a kind and formats it. device is
+// only part of transaction IDs.
+func issueNumber(dbClient *config.AstraDBClient, kind, outletID, device string, at time.Time) (*models.SequenceNumber, error) {
+	day := at.In(wib)
+	switch kind {
+	case models.SequenceQueue, models.SequenceOrder, models.SequenceTransaction:
+	default:
+		return nil, fmt.Errorf("unknown sequence %s", kind)
+	}
+	value, err := nextSequence(dbClient, kind, outletID, day)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SequenceNumber{
+		Kind:     kind,
+		OutletID: outletID,
+		Date:     day.Format("2006-01-02"),
+		Value:    value,
+		Number:   formatSequence(kind, outletID, device, day, value),
+	}, nil
+}
+
+// formatSequence formats a counter value as a number of its kind
+func formatSequence(kind, outletID, device string, day time.Time, value int64) string {
+	switch kind {
+	case models.SequenceQueue:
+		return fmt.Sprintf("%s%03d", queuePrefix(), value)
+	case models.SequenceOrder:
+		return fmt.Sprintf("ORD-%s-%04d", day.Format("20060102"), value)
+	}
+	return formatTrxID(outletID, device, day, value)
+}
+
+// queuePrefix is the letter in front of queue numbers (QUEUE_PREFIX, default A)
+func queuePrefix() string {
+	if p := strings.TrimSpace(os.Getenv("QUEUE_PREFIX")); p != "" {
+		return p
+	}
+	return "A"
+}
+
+// NextNumber issues the next order number, queue number or transaction ID
+// of an outlet for today. Transaction IDs take the device from ?device=.
+func (h *OutletHandler) NextNumber(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	kind := c.Params("kind")
+	switch kind {
+	case models.SequenceOrder, models.SequenceQueue, models.SequenceTransaction:
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be order, queue or transaction"})
+	}
+
+	number, err := issueNumber(h.dbClient, kind, outletID, c.Query("device"), time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(number)
+}
+
+// ReleaseNumber gives back a number issued by NextNumber (or a trx_id from
+// POST /transactions/ids) that the device will not use, so it is issued
+// again. The body is the issued number as returned; numbers already used by
+// an order or transaction are refused.
+func (h *OutletHandler) ReleaseNumber(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	kind := c.Params("kind")
+	var req models.SequenceNumber
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var filter map[string]interface{}
+	switch kind {
+	case models.SequenceOrder, models.SequenceQueue:
+		day, err := time.ParseInLocation("2006-01-02", req.Date, wib)
+		if err != nil || req.Value <= 0 || req.Number != formatSequence(kind, outletID, "", day, req.Value) {
+			return c.Status(400).JSON(fiber.Map{"error": "date, value and number must be those of the issued number"})
+		}
+		// Order numbers carry their date; queue numbers repeat every day
+		filter = map[string]interface{}{"outlet_id": outletID, "order_number": req.Number}
+		if kind == models.SequenceQueue {
+			filter = map[string]interface{}{
+				"outlet_id":    outletID,
+				"queue_number": req.Number,
+				"created_at": map[string]interface{}{
+					"$gte": day.Format(time.RFC3339),
+					"$lte": day.AddDate(0, 0, 1).Format(time.RFC3339),
+				},
+			}
+		}
+	case models.SequenceTransaction:
+		info, err := parseTrxID(req.Number)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if info.OutletCode != trxCode(outletID) {
+			return c.Status(400).JSON(fiber.Map{"error": "trx_id belongs to another outlet"})
+		}
+		req.Date, req.Value = info.Date, info.Sequence
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be order, queue or transaction"})
+	}
+
+	var used []map[string]interface{}
+	var err error
+	if kind == models.SequenceTransaction {
+		used, err = findDocuments(h.dbClient, "order", map[string]interface{}{"_id": req.Number}, nil, 1)
+	} else {
+		used, err = findDocuments(h.dbClient, "pos_order", filter, nil, 1)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(used) > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": req.Number + " is already used"})
+	}
+
+	releaseSequence(h.dbClient, kind, outletID, req.Date, req.Value)
+	return c.JSON(fiber.Map{"message": req.Number + " released", "kind": kind, "date": req.Date, "value": req.Value})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIssueNumberCountsPerOutletKindAndDay(t *testing.T) {
+	_, client := newFakeDB(t)
+	t.Setenv("QUEUE_PREFIX", "")
+	day := time.Date(2024, 5, 15, 10, 0, 0, 0, wib)
+	// 23:30 UTC is already the next business day in WIB
+	nextDay := time.Date(2024, 5, 15, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		kind, outlet string
+		at           time.Time
+		want         string
+	}{
+		{models.SequenceOrder, "O1", day, "ORD-20240515-0001"},
+		{models.SequenceOrder, "O1", day, "ORD-20240515-0002"},
+		{models.SequenceOrder, "O2", day, "ORD-20240515-0001"},
+		{models.SequenceQueue, "O1", day, "A001"},
+		{models.SequenceQueue, "O1", day, "A002"},
+		{models.SequenceOrder, "O1", nextDay, "ORD-20240516-0001"},
+		{models.SequenceTransaction, "O1", day, formatTrxID("O1", "", day, 1)},
+	}
+	for _, tt := range tests {
+		number, err := issueNumber(client, tt.kind, tt.outlet, "", tt.at)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.kind, tt.outlet, err)
+		}
+		if number.Number != tt.want {
+			t.Errorf("%s %s %s: %q, want %q", tt.kind, tt.outlet, tt.at, number.Number, tt.want)
+		}
+	}
+
+	if _, err := issueNumber(client, "receipt", "O1", "", day); err == nil {
+		t.Error("unknown kind accepted")
+	}
+}
+
+func TestIssueNumberRejectsUnknownKindsBeforeCounting(t *testing.T) {
+	db, client := newFakeDB(t)
+	if _, err := issueNumber(client, "receipt", "O1", "", time.Now()); err == nil {
+		t.Fatal("unknown kind accepted")
+	}
+	if docs := db.find("sequence", map[string]interface{}{}); len(docs) != 0 {
+		t.Errorf("counter created for an unknown kind: %v", docs)
+	}
+}
+
+func TestReleasedNumbersAreIssuedAgain(t *testing.T) {
+	_, client := newFakeDB(t)
+	day := time.Date(2024, 5, 15, 10, 0, 0, 0, wib)
+	issue := func() *models.SequenceNumber {
+		t.Helper()
+		number, err := issueNumber(client, models.SequenceOrder, "O1", "", day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return number
+	}
+
+	first, second, _ := issue(), issue(), issue()
+	releaseNumber(client, second)
+	releaseNumber(client, first)
+	for _, want := range []int64{1, 2, 4} {
+		if got := issue(); got.Value != want {
+			t.Errorf("issued %d, want %d", got.Value, want)
+		}
+	}
+}
+
+func TestFailedOrderGivesItsNumbersBack(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		return 200, `{"data":[]}`
+	}
+	app := fiber.New()
+	app.Post("/orders", NewOrderHandler(client).CreateOrder)
+	order := map[string]interface{}{"outlet_id": "SEQTEST", "created_by": "Ani"}
+
+	db.failing["pos_order insertOne"] = "SERVER_UNHANDLED_ERROR"
+	if status, _ := do(t, app, "POST", "/orders", order); status != 500 {
+		t.Fatalf("failed insert: status %d, want 500", status)
+	}
+	delete(db.failing, "pos_order insertOne")
+	status, body := do(t, app, "POST", "/orders", order)
+	if status != 201 {
+		t.Fatalf("create: status %d %v", status, body)
+	}
+	today := time.Now().In(wib).Format("20060102")
+	if body["order_number"] != "ORD-"+today+"-0001" || body["queue_number"] != queuePrefix()+"001" {
+		t.Errorf("numbers %v / %v, want the released ones", body["order_number"], body["queue_number"])
+	}
+}
+
+func TestReleaseNumberRefusesUsedNumbers(t *testing.T) {
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Post("/outlets/:outlet_id/sequences/:kind/release", NewOutletHandler(client).ReleaseNumber)
+	day := time.Now()
+
+	unused, _ := issueNumber(client, models.SequenceOrder, "O1", "", day)
+	used, _ := issueNumber(client, models.SequenceOrder, "O1", "", day)
+	db.insert("pos_order", map[string]interface{}{"_id": "P1", "outlet_id": "O1", "order_number": used.Number})
+
+	if status, body := do(t, app, "POST", "/outlets/O1/sequences/order/release", unused); status != 200 {
+		t.Errorf("release unused: status %d %v", status, body)
+	}
+	if status, _ := do(t, app, "POST", "/outlets/O1/sequences/order/release", used); status != 409 {
+		t.Errorf("release used: status %d, want 409", status)
+	}
+	forged := *unused
+	forged.Value = 7
+	if status, _ := do(t, app, "POST", "/outlets/O1/sequences/order/release", forged); status != 400 {
+		t.Errorf("release a number that does not match its value: status %d, want 400", status)
+	}
+
+	trxID, _ := allocateTrxID(client, "O1", "D1", day)
+	if status, body := do(t, app, "POST", "/outlets/O1/sequences/transaction/release", map[string]string{"number": trxID}); status != 200 {
+		t.Errorf("release trx_id: status %d %v", status, body)
+	}
+	if again, _ := allocateTrxID(client, "O1", "D2", day); again != formatTrxID("O1", "D2", day, 1) {
+		t.Errorf("trx_id %s, want the released sequence 1", again)
+	}
+
+	if number, _ := issueNumber(client, models.SequenceOrder, "O1", "", day); number.Value != unused.Value {
+		t.Errorf("issued %d, want released %d", number.Value, unused.Value)
+	}
+}
+
+func TestIssueNumberReportsDBErrors(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.failing["sequence"] = "SERVER_UNHANDLED_ERROR"
+	if _, err := issueNumber(client, models.SequenceOrder, "O1", "", time.Now()); err == nil {
+		t.Fatal("issued a number without a counter")
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/events"
+	"sagawa_pos_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CloseShift records the close of a cashier shift with the sales of the
+// outlet (and cashier, when given) since opened_at and the cash expected in
+// the drawer, and publishes shift.closed. Closing the same shift again
+// returns the stored record.
+func (h *OrderHandler) CloseShift(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	var req models.CloseShiftRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Cashier == "" && req.DeviceID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "cashier or device_id is required"})
+	}
+	opened, err := time.Parse(time.RFC3339, req.OpenedAt)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "opened_at must be an RFC3339 time"})
+	}
+	closed := time.Now().In(wib)
+	if opened.After(closed) {
+		return c.Status(400).JSON(fiber.Map{"error": "opened_at is in the future"})
+	}
+
+	shift := models.ShiftClose{
+		ID:          shiftCloseID(outletID, req.DeviceID, req.Cashier, opened),
+		OutletID:    outletID,
+		Cashier:     req.Cashier,
+		DeviceID:    req.DeviceID,
+		OpenedAt:    opened.In(wib).Format(time.RFC3339),
+		ClosedAt:    closed.Format(time.RFC3339),
+		OpeningCash: req.OpeningCash,
+		CountedCash: req.CountedCash,
+		Note:        req.Note,
+	}
+
+	filter := map[string]interface{}{
+		"outlet_id":  outletID,
+		"status":     map[string]interface{}{"$ne": "voided"},
+		"created_at": map[string]interface{}{"$gte": shift.OpenedAt, "$lte": shift.ClosedAt},
+	}
+	if req.Cashier != "" {
+		filter["cashier"] = req.Cashier
+	}
+	transactions, err := findDocuments(h.dbClient, "order", filter, nil, 50)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	summarizeShift(&shift, transactions)
+
+	document, err := toDocument(shift)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := h.dbClient.InsertDocument("shift_close", document); err != nil {
+		if !config.IsDuplicateDocument(err) {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		stored, err := loadShiftClose(h.dbClient, shift.ID)
+		if err != nil || stored == nil {
+			return c.Status(500).JSON(fiber.Map{"error": fmt.Sprintf("Shift %s is already closed but could not be read: %v", shift.ID, err)})
+		}
+		return c.JSON(fiber.Map{"shift": stored, "duplicate": true})
+	}
+
+	publishEvent(h.dbClient, events.ShiftClosed, outletID, shift)
+	return c.Status(201).JSON(fiber.Map{"shift": shift})
+}
+
+// summarizeShift fills in the sales and cash totals of a shift
+func summarizeShift(shift *models.ShiftClose, transactions []map[string]interface{}) {
+	shift.TotalTransactions = len(transactions)
+	shift.NetSales = 0
+	for _, trx := range transactions {
+		shift.NetSales += toMoney(trx["total"])
+	}
+	shift.CashSales = 0
+	for _, p := range summarizePayments(transactions) {
+		if p.Method == models.PaymentCash {
+			shift.CashSales = p.Amount
+		}
+	}
+	shift.ExpectedCash = shift.OpeningCash + shift.CashSales
+	shift.Difference = shift.CountedCash - shift.ExpectedCash
+}
+
+// shiftCloseID keys a shift by where it was worked and when it opened, so a
+// retried close is recognized
+func shiftCloseID(outletID, deviceID, cashier string, opened time.Time) string {
+	who := deviceID
+	if who == "" {
+		who = cashier
+	}
+	return fmt.Sprintf("%s:%s:%d", outletID, who, opened.Unix())
+}
+
+// loadShiftClose fetches a shift close by ID; nil if it does not exist
+func loadShiftClose(dbClient *config.AstraDBClient, id string) (*models.ShiftClose, error) {
+	docs, err := findDocuments(dbClient, "shift_close", map[string]interface{}{"_id": id}, nil, 1)
+	if err != nil || len(docs) == 0 {
+		return nil, err
+	}
+	data, err := json.Marshal(docs[0])
+	if err != nil {
+		return nil, err
+	}
+	var shift models.ShiftClose
+	if err := json.Unmarshal(data, &shift); err != nil {
+		return nil, fmt.Errorf("failed to parse shift close: %v", err)
+	}
+	return &shift, nil
+}
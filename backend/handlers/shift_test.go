@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/events"
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCloseShiftRecordsAndPublishesOnce(t *testing.T) {
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Post("/transactions/outlet/:outlet_id/shifts/close", NewOrderHandler(client).CloseShift)
+
+	opened := time.Now().In(wib).Add(-4 * time.Hour)
+	during := opened.Add(time.Hour).Format(time.RFC3339)
+	db.insert("order",
+		map[string]interface{}{"_id": "S1", "outlet_id": "SHIFTTEST", "cashier": "Ani", "created_at": during, "total": 30000, "changes": 20000,
+			"payments": []models.Payment{{Method: "cash", Amount: 50000}}},
+		map[string]interface{}{"_id": "S2", "outlet_id": "SHIFTTEST", "cashier": "Ani", "created_at": during, "total": 20000,
+			"payments": []models.Payment{{Method: "qris", Amount: 20000}}},
+		// Another cashier, a voided sale and one before the shift do not count
+		map[string]interface{}{"_id": "S3", "outlet_id": "SHIFTTEST", "cashier": "Budi", "created_at": during, "total": 10000, "method": "cash"},
+		map[string]interface{}{"_id": "S4", "outlet_id": "SHIFTTEST", "cashier": "Ani", "created_at": during, "total": 10000, "method": "cash", "status": "voided"},
+		map[string]interface{}{"_id": "S5", "outlet_id": "SHIFTTEST", "cashier": "Ani", "created_at": opened.Add(-time.Hour).Format(time.RFC3339), "total": 10000, "method": "cash"},
+	)
+
+	sub, _, _ := eventBus.Subscribe(events.Filter{OutletID: "SHIFTTEST", Types: []string{events.ShiftClosed}}, "")
+	defer eventBus.Unsubscribe(sub)
+
+	closeShift := map[string]interface{}{"cashier": "Ani", "opened_at": opened.Format(time.RFC3339), "opening_cash": 100000, "counted_cash": 129000}
+	status, body := do(t, app, "POST", "/transactions/outlet/SHIFTTEST/shifts/close", closeShift)
+	if status != 201 {
+		t.Fatalf("close: status %d %v", status, body)
+	}
+	shift := body["shift"].(map[string]interface{})
+	want := map[string]float64{"total_transactions": 2, "net_sales": 50000, "cash_sales": 30000, "expected_cash": 130000, "difference": -1000}
+	for field, value := range want {
+		if shift[field] != value {
+			t.Errorf("%s = %v, want %v", field, shift[field], value)
+		}
+	}
+	select {
+	case e := <-sub.Events:
+		if e.Data.(models.ShiftClose).ID != shift["_id"] {
+			t.Errorf("event for shift %v", e.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shift.closed not published")
+	}
+
+	// A retried close returns the stored shift and publishes nothing
+	status, body = do(t, app, "POST", "/transactions/outlet/SHIFTTEST/shifts/close", closeShift)
+	if status != 200 || body["duplicate"] != true {
+		t.Errorf("retry: status %d %v", status, body)
+	}
+	select {
+	case e := <-sub.Events:
+		t.Errorf("retry published %v", e)
+	default:
+	}
+	if n := len(db.find("shift_close", map[string]interface{}{})); n != 1 {
+		t.Errorf("%d shift records, want 1", n)
+	}
+}
+
+func TestOutletKemitraanFallsBackToKasirAccounts(t *testing.T) {
+	kemitraanCache.Delete("KEMTEST")
+	t.Cleanup(func() { kemitraanCache.Delete("KEMTEST") })
+	db, client := newFakeDB(t)
+	available := false
+	db.rest = func(method, path string, body []byte) (int, string) {
+		if path == "/kasir_pos/rows" && available {
+			return 200, `{"data":[{"id":"K0","outlet":"OTHER","kemitraan":"Lain"},{"id":"K1","outlet":"KEMTEST","kemitraan":"Sagawa"}]}`
+		}
+		return 500, `{"description":"unavailable"}`
+	}
+
+	if got := outletKemitraan(client, "KEMTEST"); got != "" {
+		t.Errorf("kemitraan %q while kasir_pos is down", got)
+	}
+	available = true
+	if got := outletKemitraan(client, "KEMTEST"); got != "Sagawa" {
+		t.Errorf("kemitraan %q, want Sagawa from the kasir account", got)
+	}
+
+	// Settings take precedence once the cached lookup is refreshed
+	db.insert("outlet_settings", map[string]interface{}{"_id": "KEMTEST", "kemitraan": "Pusat"})
+	kemitraanCache.Delete("KEMTEST")
+	if got := outletKemitraan(client, "KEMTEST"); got != "Pusat" {
+		t.Errorf("kemitraan %q, want Pusat from the settings", got)
+	}
+}
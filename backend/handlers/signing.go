@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// signingKey is an HMAC key read from the environment. Without the variable
+// a random key is used, so tokens signed with it do not survive restarts;
+// keys marked required must be set outside development.
+type signingKey struct {
+	env      string
+	required bool
+	once     sync.Once
+	key      []byte
+}
+
+func (k *signingKey) get() []byte {
+	k.once.Do(func() {
+		if s := os.Getenv(k.env); s != "" {
+			k.key = []byte(s)
+			return
+		}
+		log.Printf("%s not set, using a random key (signed tokens expire on restart)", k.env)
+		k.key = make([]byte, 32)
+		if _, err := rand.Read(k.key); err != nil {
+			log.Fatalf("Failed to generate %s: %v", k.env, err)
+		}
+	})
+	return k.key
+}
+
+// errBadSignature is returned for a well-formed token with a wrong signature
+var errBadSignature = fmt.Errorf("invalid signature")
+
+var (
+	// Quotes are redeemed on any instance and after restarts
+	quoteKey  = &signingKey{env: "QUOTE_SIGNING_SECRET", required: true}
+	streamKey = &signingKey{env: "EVENT_STREAM_SECRET"}
+)
+
+// CheckSigningKeys fails when a required signing secret is missing outside
+// development (ENV=development)
+func CheckSigningKeys() error {
+	if os.Getenv("ENV") == "development" {
+		return nil
+	}
+	for _, k := range []*signingKey{quoteKey, streamKey} {
+		if k.required && os.Getenv(k.env) == "" {
+			return fmt.Errorf("%s is not set", k.env)
+		}
+	}
+	return nil
+}
+
+// signPayload encodes a payload and its HMAC-SHA256 signature as
+// base64url(payload) + "." + base64url(signature)
+func signPayload(key *signingKey, payload []byte) string {
+	mac := hmac.New(sha256.New, key.get())
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// openSignedPayload checks a token made by signPayload and returns the payload
+func openSignedPayload(key *signingKey, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	mac := hmac.New(sha256.New, key.get())
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errBadSignature
+	}
+	return payload, nil
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Devices that lost their connection upload the transactions they rang up
+// offline in batches. Each transaction carries a device_seq (1, 2, 3, ...
+// per device); the server acknowledges every one by trx_id and keeps, per
+// device, the highest sequence up to which nothing is missing. Sequences
+// received above it are gaps the device must fill by uploading again.
+
+// maxSyncBatch caps the transactions in one upload
+const maxSyncBatch = 200
+
+// maxSyncMissing caps the gaps reported to a device at once
+const maxSyncMissing = 500
+
+type SyncHandler struct {
+	dbClient *config.AstraDBClient
+	orders   *OrderHandler
+}
+
+func NewSyncHandler(dbClient *config.AstraDBClient) *SyncHandler {
+	return &SyncHandler{dbClient: dbClient, orders: NewOrderHandler(dbClient)}
+}
+
+// UploadTransactions saves a batch of offline transactions and acknowledges
+// each of them. Uploading a transaction again is safe: it is acknowledged as
+// a duplicate without being saved twice.
+func (h *SyncHandler) UploadTransactions(c *fiber.Ctx) error {
+	var req models.SyncUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.DeviceID == "" || req.OutletID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "device_id and outlet_id are required"})
+	}
+	if len(req.Transactions) > maxSyncBatch {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("At most %d transactions per upload", maxSyncBatch)})
+	}
+
+	device, err := h.openDevice(req.DeviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if device.OutletID != "" && device.OutletID != req.OutletID {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Device %s is registered to outlet %s", req.DeviceID, device.OutletID)})
+	}
+
+	seen := make(map[int64]bool, len(device.Received))
+	for _, seq := range device.Received {
+		seen[seq] = true
+	}
+
+	now := time.Now()
+	acks := make([]models.SyncAck, 0, len(req.Transactions))
+	var received []int64
+	var lookupErr error
+	for i := range req.Transactions {
+		trx := &req.Transactions[i]
+		ack := models.SyncAck{DeviceSeq: trx.DeviceSeq, TrxID: trx.TrxID}
+
+		exists := false
+		if trx.TrxID != "" {
+			if exists, lookupErr = transactionExists(h.dbClient, trx.TrxID); lookupErr != nil {
+				break
+			}
+		}
+
+		switch {
+		case trx.DeviceSeq <= 0:
+			ack.Status, ack.Error = models.SyncRejected, "device_seq is required"
+			acks = append(acks, ack)
+			continue
+		case trx.TrxID == "":
+			// Without an ID a retried upload could not be recognized
+			ack.Status, ack.Error = models.SyncRejected, "trx_id is required for offline transactions"
+		case exists:
+			ack.Status = models.SyncDuplicate
+		case trx.DeviceSeq <= device.LastSeq || seen[trx.DeviceSeq]:
+			ack.Status, ack.Error = models.SyncRejected, fmt.Sprintf("device_seq %d was already used by another transaction", trx.DeviceSeq)
+			acks = append(acks, ack)
+			continue
+		default:
+			trx.OutletID = req.OutletID
+			if trx.DeviceID == "" {
+				trx.DeviceID = req.DeviceID
+			}
+			at := trx.CreatedAt
+			if at.IsZero() || at.After(now) {
+				at = now
+			}
+
+			status, response := h.orders.saveTransactionAt(trx, at)
+			switch {
+			case response["duplicate"] == true:
+				ack.Status = models.SyncDuplicate
+			case status < 300:
+				ack.Status = models.SyncAccepted
+				ack.ReviewFlags, _ = response["review_flags"].([]string)
+			case status >= 500:
+				ack.Status, ack.Error = models.SyncRetry, toString(response["error"])
+				acks = append(acks, ack)
+				continue
+			default:
+				ack.Status, ack.Error = models.SyncRejected, toString(response["error"])
+			}
+		}
+
+		if ack.Status == models.SyncRejected {
+			h.recordRejection(req, trx, ack.Error)
+		}
+		seen[trx.DeviceSeq] = true
+		received = append(received, trx.DeviceSeq)
+		acks = append(acks, ack)
+	}
+
+	device, err = h.markReceived(device, req.OutletID, received, now)
+	if err != nil {
+		// The transactions are saved; the next upload acks them as duplicates
+		return c.Status(500).JSON(fiber.Map{"error": err.Error(), "acks": acks})
+	}
+	if lookupErr != nil {
+		// Transactions without an ack are uploaded again
+		return c.Status(500).JSON(fiber.Map{"error": lookupErr.Error(), "acks": acks})
+	}
+
+	return c.JSON(models.SyncUploadResponse{SyncStatus: syncStatus(device), Acks: acks})
+}
+
+// GetDeviceStatus reports the sequence numbers still missing from a device
+func (h *SyncHandler) GetDeviceStatus(c *fiber.Ctx) error {
+	device, err := loadSyncDevice(h.dbClient, c.Params("device_id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if device == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device has not synced yet"})
+	}
+	return c.JSON(syncStatus(device))
+}
+
+// Pull returns what changed for a device since the token of its last pull:
+// menu items (changed and deleted), vouchers created or redeemed, and the
+// outlet settings. Without a token, or with one the server no longer
+// recognizes, everything is sent with full set.
+func (h *SyncHandler) Pull(c *fiber.Ctx) error {
+	deviceID := c.Query("device_id")
+	outletID := c.Query("outlet_id")
+	if deviceID == "" || outletID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "device_id and outlet_id are required"})
+	}
+	token := c.Query("token")
+
+	device, err := h.openDevice(deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if device.OutletID != "" && device.OutletID != outletID {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Device %s is registered to outlet %s", deviceID, device.OutletID)})
+	}
+
+	// Taken before reading so changes made during the pull come again next time
+	pulledAt := time.Now()
+	since, ok := parseSyncToken(token)
+	full := !ok || device.MenuToken != token
+
+	settings, err := loadOutletSettings(h.dbClient, outletID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	menus, err := outletMenus(h.dbClient, outletID, pulledAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	response := models.SyncPullResponse{
+		Token:    formatSyncToken(pulledAt),
+		Full:     full,
+		Menu:     models.MenuDelta{Upserted: []models.Menu{}, Deleted: []string{}},
+		Vouchers: []models.Voucher{},
+	}
+
+	categories, err := loadCategories(h.dbClient)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Devices get every item with its schedules and filter by time offline
+	hashes := make(map[string]string, len(menus))
+	for id, menu := range menus {
+		menu.CategorySchedule = categories.scheduleFor(menu)
+		// Images are sent as URLs only, inline imageData stays out
+		menu.ImageData = ""
+		if menu.Hidden || settings.Kemitraan != "" && !strings.Contains(menuKey(menu.Kemitraan), menuKey(settings.Kemitraan)) {
+			continue
+		}
+		hashes[id] = menuHash(menu)
+		if full || device.MenuHashes[id] != hashes[id] {
+			response.Menu.Upserted = append(response.Menu.Upserted, menu)
+		}
+	}
+	if !full {
+		for id := range device.MenuHashes {
+			if _, ok := hashes[id]; !ok {
+				response.Menu.Deleted = append(response.Menu.Deleted, id)
+			}
+		}
+	}
+	sort.Slice(response.Menu.Upserted, func(i, j int) bool { return response.Menu.Upserted[i].ID < response.Menu.Upserted[j].ID })
+	sort.Strings(response.Menu.Deleted)
+
+	vouchers, err := findDocuments(h.dbClient, "voucher", nil, nil, 10)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, doc := range vouchers {
+		voucher := voucherFromDocument(doc)
+		if (full && !voucher.Used) || (!full && (voucher.CreatedAt.After(since) || voucher.UsedAt.After(since))) {
+			response.Vouchers = append(response.Vouchers, voucher)
+		}
+	}
+
+	if updated, err := time.Parse(time.RFC3339, settings.UpdatedAt); full || (err == nil && updated.After(since)) {
+		response.Settings = &settings
+	}
+
+	if _, err := h.dbClient.UpdateDocument("sync_device", map[string]interface{}{"_id": deviceID}, map[string]interface{}{
+		"menu_token":   response.Token,
+		"menu_hashes":  hashes,
+		"last_pull_at": pulledAt.In(wib).Format(time.RFC3339),
+	}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(response)
+}
+
+// openDevice loads a device's sync state, creating it on first contact
+func (h *SyncHandler) openDevice(deviceID string) (*models.SyncDevice, error) {
+	// Adding 0 to version creates the document if it is missing and leaves
+	// an existing one untouched
+	if _, err := h.dbClient.IncrementDocument("sync_device", map[string]interface{}{"_id": deviceID}, "version", 0); err != nil {
+		return nil, err
+	}
+	device, err := loadSyncDevice(h.dbClient, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, fmt.Errorf("failed to register device %s", deviceID)
+	}
+	return device, nil
+}
+
+// markReceived adds sequence numbers to a device's state, retrying when a
+// concurrent upload for the same device changed it first
+func (h *SyncHandler) markReceived(device *models.SyncDevice, outletID string, seqs []int64, now time.Time) (*models.SyncDevice, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		next := *device
+		next.OutletID = outletID
+		next.Version++
+		next.LastSeq, next.Received = advanceSequences(device.LastSeq, device.Received, seqs)
+
+		ok, err := updateDocumentIf(h.dbClient, "sync_device",
+			map[string]interface{}{"_id": device.DeviceID, "version": device.Version},
+			map[string]interface{}{
+				"outlet_id":      next.OutletID,
+				"last_seq":       next.LastSeq,
+				"received":       next.Received,
+				"version":        next.Version,
+				"last_upload_at": now.In(wib).Format(time.RFC3339),
+			})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &next, nil
+		}
+
+		if device, err = loadSyncDevice(h.dbClient, device.DeviceID); err != nil {
+			return nil, err
+		}
+		if device == nil {
+			return nil, fmt.Errorf("sync state of device disappeared")
+		}
+	}
+	return nil, fmt.Errorf("sync state of device %s is changing too often, upload again", device.DeviceID)
+}
+
+// recordRejection keeps a rejected offline transaction for the back office;
+// the device has already handed over the sale and will not send it again
+func (h *SyncHandler) recordRejection(req models.SyncUploadRequest, trx *models.Transaction, reason string) {
+	id := fmt.Sprintf("%s:%d", req.DeviceID, trx.DeviceSeq)
+	if _, err := h.dbClient.UpsertDocument("sync_rejection", map[string]interface{}{"_id": id}, map[string]interface{}{
+		"device_id":   req.DeviceID,
+		"outlet_id":   req.OutletID,
+		"device_seq":  trx.DeviceSeq,
+		"trx_id":      trx.TrxID,
+		"error":       reason,
+		"transaction": trx,
+		"rejected_at": time.Now().In(wib).Format(time.RFC3339),
+	}); err != nil {
+		fmt.Printf("Warning: Failed to record rejected offline transaction %s: %v\n", id, err)
+	}
+}
+
+// advanceSequences merges newly received sequence numbers and moves the
+// high-water mark past every number that is no longer missing
+func advanceSequences(lastSeq int64, received, seqs []int64) (int64, []int64) {
+	set := make(map[int64]bool, len(received)+len(seqs))
+	for _, seq := range append(append([]int64{}, received...), seqs...) {
+		if seq > lastSeq {
+			set[seq] = true
+		}
+	}
+	for set[lastSeq+1] {
+		delete(set, lastSeq+1)
+		lastSeq++
+	}
+
+	rest := make([]int64, 0, len(set))
+	for seq := range set {
+		rest = append(rest, seq)
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i] < rest[j] })
+	return lastSeq, rest
+}
+
+// syncStatus lists the gaps below the highest sequence a device sent
+func syncStatus(device *models.SyncDevice) models.SyncStatus {
+	status := models.SyncStatus{
+		DeviceID: device.DeviceID,
+		OutletID: device.OutletID,
+		LastSeq:  device.LastSeq,
+		Missing:  []int64{},
+	}
+	next := device.LastSeq + 1
+	for _, seq := range device.Received {
+		for ; next < seq && len(status.Missing) < maxSyncMissing; next++ {
+			status.Missing = append(status.Missing, next)
+		}
+		next = seq + 1
+	}
+	return status
+}
+
+// loadSyncDevice returns a device's sync state, or nil if it never synced
+func loadSyncDevice(dbClient *config.AstraDBClient, deviceID string) (*models.SyncDevice, error) {
+	respBody, err := dbClient.FindDocuments("sync_device", map[string]interface{}{"_id": deviceID}, map[string]interface{}{"limit": 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data struct {
+			Documents []models.SyncDevice `json:"documents"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse device: %v", err)
+	}
+	if len(response.Data.Documents) == 0 {
+		return nil, nil
+	}
+	return &response.Data.Documents[0], nil
+}
+
+// transactionExists reports whether a trx_id has already been saved
+func transactionExists(dbClient *config.AstraDBClient, trxID string) (bool, error) {
+	docs, err := findDocuments(dbClient, "order", map[string]interface{}{"_id": trxID}, nil, 1)
+	return len(docs) > 0, err
+}
+
+// voucherFromDocument reads a voucher document; timestamps that cannot be
+// parsed are left zero
+func voucherFromDocument(doc map[string]interface{}) models.Voucher {
+	parse := func(v interface{}) time.Time {
+		t, _ := time.Parse(time.RFC3339, toString(v))
+		return t
+	}
+	used, _ := doc["used"].(bool)
+	return models.Voucher{
+		ID:          toString(doc["_id"]),
+		CodeVoucher: toString(doc["code_voucher"]),
+		Nominal:     int(toFloat(doc["nominal"])),
+		Used:        used,
+		CreatedAt:   parse(doc["createdAt"]),
+		UsedAt:      parse(doc["usedAt"]),
+		CreatedBy:   toString(doc["createdBy"]),
+		RedeemedBy:  toString(doc["redeemedBy"]),
+	}
+}
+
+// menuHash fingerprints a menu item so pulls can tell what changed
+func menuHash(menu models.Menu) string {
+	data, _ := json.Marshal(menu)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// menuKey lower-cases s and keeps only letters and digits, the way menu
+// kemitraan filters compare
+func menuKey(s string) string {
+	return strings.ToLower(trxCode(s))
+}
+
+// Sync tokens are opaque to devices; they carry the time of the pull
+func formatSyncToken(at time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("v1:" + strconv.FormatInt(at.UnixNano(), 10)))
+}
+
+func parseSyncToken(token string) (time.Time, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(data), "v1:") {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(strings.TrimPrefix(string(data), "v1:"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
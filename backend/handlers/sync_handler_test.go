@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdvanceSequences(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastSeq      int64
+		received     []int64
+		seqs         []int64
+		wantLast     int64
+		wantReceived []int64
+	}{
+		{"in order", 0, nil, []int64{1, 2, 3}, 3, []int64{}},
+		{"gap", 0, nil, []int64{1, 3, 4}, 1, []int64{3, 4}},
+		{"gap filled", 1, []int64{3, 4}, []int64{2}, 4, []int64{}},
+		{"out of order", 5, nil, []int64{9, 7, 6}, 7, []int64{9}},
+		{"old and repeated", 5, []int64{8}, []int64{3, 5, 8, 8}, 5, []int64{8}},
+		{"nothing new", 2, []int64{4}, nil, 2, []int64{4}},
+	}
+	for _, tt := range tests {
+		last, received := advanceSequences(tt.lastSeq, tt.received, tt.seqs)
+		if last != tt.wantLast || !reflect.DeepEqual(received, tt.wantReceived) {
+			t.Errorf("%s: got %d %v, want %d %v", tt.name, last, received, tt.wantLast, tt.wantReceived)
+		}
+	}
+}
+
+func TestOfflineUploadFlagsUnverifiedQris(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "0")
+	db, client := newFakeDB(t)
+	h := NewSyncHandler(client)
+	app := fiber.New()
+	app.Post("/sync/transactions", h.UploadTransactions)
+
+	at := time.Now().Add(-2 * time.Hour)
+	sale := func(seq int64, trxID string) models.Transaction {
+		return models.Transaction{
+			TrxID: trxID, Cashier: "Ani", Type: "take_away", Method: "qris",
+			Subtotal: 10000, Total: 10000, Qris: 10000, CreatedAt: at, DeviceSeq: seq,
+			Items:    []models.TransactionItem{{MenuName: "Es Teh", Qty: 2, Price: 5000, Subtotal: 10000}},
+			Payments: []models.Payment{{Method: models.PaymentQris, Amount: 10000, Reference: "QR-" + trxID}},
+		}
+	}
+	status, body := do(t, app, "POST", "/sync/transactions", models.SyncUploadRequest{
+		DeviceID: "POS-SYNCTEST", OutletID: "SYNCTEST",
+		Transactions: []models.Transaction{sale(1, "T-OFF-1")},
+	})
+	if status != 200 {
+		t.Fatalf("upload: status %d %v", status, body)
+	}
+	ack := body["acks"].([]interface{})[0].(map[string]interface{})
+	flags, _ := ack["review_flags"].([]interface{})
+	if ack["status"] != models.SyncAccepted || len(flags) != 1 {
+		t.Fatalf("ack %v, want accepted with one review flag", ack)
+	}
+
+	saved := db.find("order", map[string]interface{}{"_id": "T-OFF-1"})
+	if len(saved) != 1 {
+		t.Fatal("offline sale not saved")
+	}
+	if got, _ := saved[0]["review_flags"].([]interface{}); len(got) != 1 {
+		t.Errorf("saved review_flags %v", saved[0]["review_flags"])
+	}
+
+	// The same check still rejects a sale made online
+	online := sale(0, "T-ON-1")
+	if status, _ := NewOrderHandler(client).saveTransactionAt(&online, time.Now()); status != 422 {
+		t.Errorf("online sale with an unknown QRIS payment: status %d, want 422", status)
+	}
+}
+
+func TestPullLeavesOutInlineImages(t *testing.T) {
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		if path == menuRowsPath {
+			return 200, `{"data":[{"id":"M1","name":"Es Teh","price":5000,"imageData":"data:image/png;base64,iVBORw0KGgo=","imageUrl":"/images/m1.jpg"}]}`
+		}
+		return 404, `{"description":"not found"}`
+	}
+	app := fiber.New()
+	app.Get("/sync/pull", NewSyncHandler(client).Pull)
+
+	status, body := do(t, app, "GET", "/sync/pull?device_id=POS-PULLTEST&outlet_id=PULLTEST", nil)
+	if status != 200 {
+		t.Fatalf("pull: status %d %v", status, body)
+	}
+	upserted := body["menu"].(map[string]interface{})["upserted"].([]interface{})
+	if len(upserted) != 1 {
+		t.Fatalf("upserted %v, want M1", upserted)
+	}
+	menu := upserted[0].(map[string]interface{})
+	if _, ok := menu["imageData"]; ok || menu["imageUrl"] != "/images/m1.jpg" {
+		t.Errorf("pulled menu item %v, want imageUrl without imageData", menu)
+	}
+}
+
+func TestSyncReportsDBErrors(t *testing.T) {
+	inTempDir(t)
+	db, client := newFakeDB(t)
+	db.rest = func(method, path string, body []byte) (int, string) {
+		return 200, `{"data":[]}`
+	}
+	h := NewSyncHandler(client)
+	app := fiber.New()
+	app.Get("/sync/pull", h.Pull)
+	app.Post("/sync/transactions", h.UploadTransactions)
+
+	db.failing["voucher find"] = "SERVER_UNHANDLED_ERROR"
+	if status, _ := do(t, app, "GET", "/sync/pull?device_id=POS-SYNCERR&outlet_id=SYNCERR", nil); status != 500 {
+		t.Errorf("pull with failing vouchers: status %d, want 500", status)
+	}
+
+	db.failing["order find"] = "SERVER_UNHANDLED_ERROR"
+	status, body := do(t, app, "POST", "/sync/transactions", models.SyncUploadRequest{
+		DeviceID: "POS-SYNCERR", OutletID: "SYNCERR",
+		Transactions: []models.Transaction{{TrxID: "T-ERR-1", DeviceSeq: 1, Total: 5000}},
+	})
+	if status != 500 {
+		t.Errorf("upload with a failing lookup: status %d %v, want 500", status, body)
+	}
+	if saved := db.find("order", map[string]interface{}{"_id": "T-ERR-1"}); len(saved) != 0 {
+		t.Error("transaction saved although its lookup failed")
+	}
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TableHandler struct {
+	dbClient *config.AstraDBClient
+}
+
+func NewTableHandler(dbClient *config.AstraDBClient) *TableHandler {
+	return &TableHandler{dbClient: dbClient}
+}
+
+// GetFloor lists the tables of an outlet with the open bill on each table
+// and how long it has been open. Filter with ?area= and ?status=.
+func (h *TableHandler) GetFloor(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	filter := map[string]interface{}{"outlet_id": outletID, "active": true}
+	if area := c.Query("area"); area != "" {
+		filter["area"] = area
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	tables, err := findTables(h.dbClient, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	billFilter := map[string]interface{}{
+		"outlet_id":    outletID,
+		"table_number": map[string]interface{}{"$exists": true},
+		"status": map[string]interface{}{
+			"$nin": []string{models.OrderStatusPaid, models.OrderStatusCancelled},
+		},
+	}
+	bills, err := findOrders(h.dbClient, billFilter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	byTable := make(map[string]*models.Order)
+	for i := range bills {
+		byTable[bills[i].TableNumber] = &bills[i]
+	}
+
+	now := time.Now()
+	floor := make([]models.FloorTable, 0, len(tables))
+	for _, table := range tables {
+		entry := models.FloorTable{Table: table}
+		if bill, ok := byTable[table.Code]; ok {
+			items := 0
+			for _, item := range bill.Items {
+				items += item.Quantity
+			}
+			entry.Bill = &models.TableBill{
+				OrderID:     bill.ID,
+				OrderNumber: bill.OrderNumber,
+				Status:      bill.Status,
+				Items:       items,
+				TotalAmount: bill.TotalAmount,
+				OpenedAt:    bill.CreatedAt.In(wib).Format(time.RFC3339),
+				OpenMinutes: int(now.Sub(bill.CreatedAt).Minutes()),
+			}
+		}
+		floor = append(floor, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"outlet_id": outletID,
+		"count":     len(floor),
+		"tables":    floor,
+	})
+}
+
+// CreateTable registers a table for an outlet
+func (h *TableHandler) CreateTable(c *fiber.Ctx) error {
+	var table models.Table
+	if err := c.BodyParser(&table); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	table.Code = strings.TrimSpace(table.Code)
+	if table.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "code is required"})
+	}
+	if table.Capacity < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "capacity must not be negative"})
+	}
+
+	table.OutletID = c.Params("outlet_id")
+	table.ID = tableID(table.OutletID, table.Code)
+
+	existing, err := loadTable(h.dbClient, table.OutletID, table.Code)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if existing != nil && existing.Active {
+		return c.Status(409).JSON(fiber.Map{"error": "Table " + table.Code + " already exists"})
+	}
+
+	table.Status = models.TableFree
+	table.Guests = 0
+	table.SeatedAt = ""
+	table.Active = true
+	table.UpdatedAt = time.Now().In(wib).Format(time.RFC3339)
+
+	document, err := toDocument(table)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	delete(document, "_id")
+	if _, err := h.dbClient.UpsertDocument("outlet_table", map[string]interface{}{"_id": table.ID}, document); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(table)
+}
+
+// UpdateTable changes a table's area and capacity, or sets it reserved,
+// cleaning or free
+func (h *TableHandler) UpdateTable(c *fiber.Ctx) error {
+	var req struct {
+		Area     *string `json:"area"`
+		Capacity *int    `json:"capacity"`
+		Status   string  `json:"status"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	table, err := loadTable(h.dbClient, c.Params("outlet_id"), c.Params("code"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if table == nil || !table.Active {
+		return c.Status(404).JSON(fiber.Map{"error": "Table not found"})
+	}
+
+	update := map[string]interface{}{}
+	if req.Area != nil {
+		table.Area = *req.Area
+		update["area"] = table.Area
+	}
+	if req.Capacity != nil {
+		if *req.Capacity < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "capacity must not be negative"})
+		}
+		table.Capacity = *req.Capacity
+		update["capacity"] = table.Capacity
+	}
+	if req.Status != "" && req.Status != table.Status {
+		if !models.IsTableStatus(req.Status) {
+			return c.Status(400).JSON(fiber.Map{"error": "status must be free, occupied, reserved or cleaning"})
+		}
+		// Occupancy changes go through seat and release
+		if req.Status == models.TableOccupied || table.Status == models.TableOccupied {
+			return c.Status(409).JSON(fiber.Map{"error": "Use seat and release to change an occupied table", "status": table.Status})
+		}
+		table.Status = req.Status
+		update["status"] = table.Status
+	}
+
+	table.UpdatedAt = time.Now().In(wib).Format(time.RFC3339)
+	update["updated_at"] = table.UpdatedAt
+	if _, err := h.dbClient.UpdateDocument("outlet_table", map[string]interface{}{"_id": table.ID}, update); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(table)
+}
+
+// DeleteTable removes a free table from the registry (soft delete)
+func (h *TableHandler) DeleteTable(c *fiber.Ctx) error {
+	table, err := loadTable(h.dbClient, c.Params("outlet_id"), c.Params("code"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if table == nil || !table.Active {
+		return c.Status(404).JSON(fiber.Map{"error": "Table not found"})
+	}
+	if table.Status == models.TableOccupied {
+		return c.Status(409).JSON(fiber.Map{"error": "Table is occupied"})
+	}
+
+	update := map[string]interface{}{"active": false, "updated_at": time.Now().In(wib).Format(time.RFC3339)}
+	if _, err := h.dbClient.UpdateDocument("outlet_table", map[string]interface{}{"_id": table.ID}, update); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Table deleted successfully"})
+}
+
+// SeatTable marks a free or reserved table occupied by a party of guests
+func (h *TableHandler) SeatTable(c *fiber.Ctx) error {
+	var req models.SeatTableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Guests < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "guests must not be negative"})
+	}
+
+	table, err := loadTable(h.dbClient, c.Params("outlet_id"), c.Params("code"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if table == nil || !table.Active {
+		return c.Status(404).JSON(fiber.Map{"error": "Table not found"})
+	}
+	if table.Status != models.TableFree && table.Status != models.TableReserved {
+		return c.Status(409).JSON(fiber.Map{"error": "Table is " + table.Status, "status": table.Status})
+	}
+
+	ok, err := setTableStatus(h.dbClient, table, models.TableOccupied, req.Guests)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Table was changed concurrently, reload and try again"})
+	}
+
+	return c.JSON(table)
+}
+
+// ReleaseTable frees an occupied table once its bill is settled. The table
+// goes to cleaning unless status "free" is requested.
+func (h *TableHandler) ReleaseTable(c *fiber.Ctx) error {
+	var req models.ReleaseTableRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+	if req.Status == "" {
+		req.Status = models.TableCleaning
+	}
+	if req.Status != models.TableCleaning && req.Status != models.TableFree {
+		return c.Status(400).JSON(fiber.Map{"error": "status must be cleaning or free"})
+	}
+
+	table, err := loadTable(h.dbClient, c.Params("outlet_id"), c.Params("code"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if table == nil || !table.Active {
+		return c.Status(404).JSON(fiber.Map{"error": "Table not found"})
+	}
+
+	bill, err := activeBillForTable(h.dbClient, table.OutletID, table.Code)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if bill != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Table still has an unpaid bill", "order_id": bill.ID})
+	}
+
+	ok, err := setTableStatus(h.dbClient, table, req.Status, 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Table was changed concurrently, reload and try again"})
+	}
+
+	return c.JSON(table)
+}
+
+// setTableStatus changes a table's status if it has not changed since it
+// was loaded. Seating records the guests and time.
+func setTableStatus(dbClient *config.AstraDBClient, table *models.Table, status string, guests int) (bool, error) {
+	now := time.Now().In(wib).Format(time.RFC3339)
+	update := map[string]interface{}{"status": status, "guests": guests, "updated_at": now}
+	seatedAt := ""
+	if status == models.TableOccupied {
+		seatedAt = now
+	}
+	update["seated_at"] = seatedAt
+
+	ok, err := updateDocumentIf(dbClient, "outlet_table", map[string]interface{}{"_id": table.ID, "status": table.Status}, update)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	table.Status = status
+	table.Guests = guests
+	table.SeatedAt = seatedAt
+	table.UpdatedAt = now
+	return true, nil
+}
+
+// occupyTableForBill seats a registered table when a bill is opened on it.
+// Outlets without a table registry are left alone.
+func occupyTableForBill(dbClient *config.AstraDBClient, outletID, code string) error {
+	table, err := loadTable(dbClient, outletID, code)
+	if err != nil || table == nil || !table.Active {
+		return err
+	}
+	if table.Status == models.TableFree || table.Status == models.TableReserved {
+		if _, err := setTableStatus(dbClient, table, models.TableOccupied, table.Guests); err != nil {
+			return fmt.Errorf("failed to seat table %s: %v", table.ID, err)
+		}
+	}
+	return nil
+}
+
+// vacateTableForBill sends a registered table to cleaning once a bill has
+// moved off it, unless another unpaid bill is still on the table
+func vacateTableForBill(dbClient *config.AstraDBClient, outletID, code string) error {
+	if code == "" {
+		return nil
+	}
+	table, err := loadTable(dbClient, outletID, code)
+	if err != nil || table == nil || !table.Active || table.Status != models.TableOccupied {
+		return err
+	}
+	bill, err := activeBillForTable(dbClient, outletID, code)
+	if err != nil || bill != nil {
+		return err
+	}
+	if _, err := setTableStatus(dbClient, table, models.TableCleaning, 0); err != nil {
+		return fmt.Errorf("failed to release table %s: %v", table.ID, err)
+	}
+	return nil
+}
+
+// tableID is the document ID of an outlet's table
+func tableID(outletID, code string) string {
+	return outletID + ":" + code
+}
+
+// loadTable fetches a table by outlet and code; nil if it does not exist
+func loadTable(dbClient *config.AstraDBClient, outletID, code string) (*models.Table, error) {
+	tables, err := findTables(dbClient, map[string]interface{}{"_id": tableID(outletID, code)})
+	if err != nil || len(tables) == 0 {
+		return nil, err
+	}
+	return &tables[0], nil
+}
+
+// findTables fetches tables matching a filter, ordered by area and code
+func findTables(dbClient *config.AstraDBClient, filter map[string]interface{}) ([]models.Table, error) {
+	docs, err := findDocuments(dbClient, "outlet_table", filter, nil, 5)
+	if err != nil {
+		return nil, err
+	}
+	tables := []models.Table{}
+	for _, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var table models.Table
+		if err := json.Unmarshal(data, &table); err != nil {
+			return nil, fmt.Errorf("failed to parse table: %v", err)
+		}
+		tables = append(tables, table)
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Area != tables[j].Area {
+			return tables[i].Area < tables[j].Area
+		}
+		return tables[i].Code < tables[j].Code
+	})
+	return tables, nil
+}
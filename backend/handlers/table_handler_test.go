@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"testing"
+
+	"sagawa_pos_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTablesReportDBErrors(t *testing.T) {
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Post("/outlets/:outlet_id/tables", NewTableHandler(client).CreateTable)
+	db.insert("outlet_table", models.Table{ID: tableID("TABLETEST", "5"), OutletID: "TABLETEST", Code: "5", Status: models.TableOccupied, Guests: 4, Active: true})
+
+	// A failed read must not look like a missing table that can be recreated
+	db.failing["outlet_table find"] = "SERVER_UNHANDLED_ERROR"
+	if status, _ := do(t, app, "POST", "/outlets/TABLETEST/tables", map[string]interface{}{"code": "5"}); status != 500 {
+		t.Errorf("create: status %d, want 500", status)
+	}
+	if table := db.find("outlet_table", map[string]interface{}{"_id": tableID("TABLETEST", "5")})[0]; table["status"] != models.TableOccupied {
+		t.Errorf("table overwritten: %v", table)
+	}
+	if err := occupyTableForBill(client, "TABLETEST", "5"); err == nil {
+		t.Error("occupy: no error")
+	}
+	if err := vacateTableForBill(client, "TABLETEST", "5"); err == nil {
+		t.Error("vacate: no error")
+	}
+}
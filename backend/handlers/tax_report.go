@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"math"
+	"sagawa_pos_backend/models"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTaxReport summarizes tax and service charge for an outlet over a date
+// range, broken down by tax name and rate
+func (h *OrderHandler) GetTaxReport(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	startDate := c.Query("start_date") // format: YYYY-MM-DD
+	endDate := c.Query("end_date")     // format: YYYY-MM-DD
+
+	if outletID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "outlet_id is required"})
+	}
+	if startDate == "" || endDate == "" {
+		now := time.Now().In(wib)
+		startDate = now.Format("2006-01") + "-01"
+		endDate = now.Format("2006-01-02")
+	}
+
+	filter := map[string]interface{}{
+		"outlet_id": outletID,
+		"created_at": map[string]interface{}{
+			"$gte": startDate + "T00:00:00Z",
+			"$lte": endDate + "T23:59:59Z",
+		},
+	}
+
+	transactions := fetchTransactions(h.dbClient, filter, 500)
+	breakdown := summarizeTaxByRate(transactions)
+
+	var totalTax, totalService, totalTaxable models.Money
+	for _, row := range breakdown {
+		totalTax += row.Tax
+		totalService += row.ServiceCharge
+		totalTaxable += row.TaxableAmount
+	}
+
+	return c.JSON(fiber.Map{
+		"outlet_id":            outletID,
+		"start_date":           startDate,
+		"end_date":             endDate,
+		"total_transactions":   len(transactions),
+		"total_taxable_amount": totalTaxable,
+		"total_tax":            totalTax,
+		"total_service_charge": totalService,
+		"breakdown":            breakdown,
+	})
+}
+
+// summarizeTaxByRate groups transactions by tax name and rate. Older
+// transactions without a stored tax_rate get a rate derived from their
+// tax and total, rounded to one decimal.
+func summarizeTaxByRate(transactions []map[string]interface{}) []models.TaxRateSummary {
+	type rateKey struct {
+		name string
+		rate float64
+	}
+	groups := make(map[rateKey]*models.TaxRateSummary)
+
+	for _, trx := range transactions {
+		total := toMoney(trx["total"])
+		tax := toMoney(trx["tax"])
+		service := toMoney(trx["service_charge"])
+		taxable := total - tax - toMoney(trx["rounding"])
+
+		name, _ := trx["tax_name"].(string)
+		if name == "" {
+			name = "PB1"
+		}
+
+		var rate float64
+		if r, ok := trx["tax_rate"]; ok {
+			rate = toFloat(r)
+		} else if taxable > 0 {
+			rate = math.Round(tax.Float64()/taxable.Float64()*1000) / 10
+		}
+
+		key := rateKey{name: name, rate: rate}
+		row, ok := groups[key]
+		if !ok {
+			row = &models.TaxRateSummary{TaxName: name, TaxRate: rate}
+			groups[key] = row
+		}
+		row.Transactions++
+		row.TaxableAmount += taxable
+		row.Tax += tax
+		row.ServiceCharge += service
+		row.GrossSales += total
+	}
+
+	breakdown := make([]models.TaxRateSummary, 0, len(groups))
+	for _, row := range groups {
+		breakdown = append(breakdown, *row)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].TaxName != breakdown[j].TaxName {
+			return breakdown[i].TaxName < breakdown[j].TaxName
+		}
+		return breakdown[i].TaxRate < breakdown[j].TaxRate
+	})
+	return breakdown
+}
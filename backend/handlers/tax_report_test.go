@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"sagawa_pos_backend/models"
+)
+
+func TestSummarizeTaxByRate(t *testing.T) {
+	transactions := []map[string]interface{}{
+		{"total": 11000.0, "tax": 1000.0, "tax_name": "PB1", "tax_rate": 10.0},
+		{"total": 11500.0, "tax": 1000.0, "service_charge": 500.0, "tax_name": "PB1", "tax_rate": 10.0, "rounding": 0.0},
+		// Saved before tax rates were stored: 10% derived from tax and total
+		{"total": 22000.0, "tax": 2000.0},
+		// Cash rounding is not taxable
+		{"total": 11100.0, "tax": 1000.0, "rounding": 100.0, "tax_name": "PB1", "tax_rate": 10.0},
+		{"total": 33300.0, "tax": 3300.0, "tax_name": "PPN", "tax_rate": 11.0},
+		{"total": 5000.0, "tax": 0.0, "tax_name": "PB1", "tax_rate": 0.0},
+	}
+	want := []models.TaxRateSummary{
+		{TaxName: "PB1", TaxRate: 0, Transactions: 1, TaxableAmount: 5000, Tax: 0, GrossSales: 5000},
+		{TaxName: "PB1", TaxRate: 10, Transactions: 4, TaxableAmount: 50500, Tax: 5000, ServiceCharge: 500, GrossSales: 55600},
+		{TaxName: "PPN", TaxRate: 11, Transactions: 1, TaxableAmount: 30000, Tax: 3300, GrossSales: 33300},
+	}
+	if got := summarizeTaxByRate(transactions); !reflect.DeepEqual(got, want) {
+		t.Errorf("summarizeTaxByRate:\n got %+v\nwant %+v", got, want)
+	}
+	if got := summarizeTaxByRate(nil); len(got) != 0 {
+		t.Errorf("no transactions: %+v", got)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Server-format transaction IDs look like
+//
+//	TRX-<OUTLET>-<YYYYMMDD>-<DEVICE>-<NNNN>-<C>
+//
+// OUTLET is the outlet ID and DEVICE the cashier device, both upper-cased
+// with anything but letters and digits removed (device defaults to 00).
+// The date is the WIB business day and NNNN the outlet's transaction counter
+// for that day. C is a Luhn mod 36 check character over everything before it.
+
+const trxIDPrefix = "TRX"
+
+const base36 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// trxCode upper-cases s and keeps only letters and digits
+func trxCode(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// trxCheckChar computes the Luhn mod 36 check character of s, which must
+// consist of base36 characters and dashes (dashes are skipped)
+func trxCheckChar(s string) byte {
+	n := len(base36)
+	sum := 0
+	factor := 2
+	for i := len(s) - 1; i >= 0; i-- {
+		code := strings.IndexByte(base36, s[i])
+		if code < 0 {
+			continue
+		}
+		addend := factor * code
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+	return base36[(n-sum%n)%n]
+}
+
+// formatTrxID builds a server-format transaction ID
+func formatTrxID(outletID, device string, day time.Time, seq int64) string {
+	if device = trxCode(device); device == "" {
+		device = "00"
+	}
+	body := fmt.Sprintf("%s-%s-%s-%s-%04d", trxIDPrefix, trxCode(outletID), day.In(wib).Format("20060102"), device, seq)
+	return body + "-" + string(trxCheckChar(body))
+}
+
+// parseTrxID checks the format and check character of a server-format
+// transaction ID and returns its parts
+func parseTrxID(id string) (*models.TrxIDInfo, error) {
+	parts := strings.Split(id, "-")
+	if len(parts) != 6 || parts[0] != trxIDPrefix {
+		return nil, fmt.Errorf("trx_id must look like TRX-<OUTLET>-<YYYYMMDD>-<DEVICE>-<NNNN>-<C>")
+	}
+	if parts[1] == "" || trxCode(parts[1]) != parts[1] || parts[3] == "" || trxCode(parts[3]) != parts[3] {
+		return nil, fmt.Errorf("trx_id outlet and device codes must be upper-case letters and digits")
+	}
+	day, err := time.ParseInLocation("20060102", parts[2], wib)
+	if err != nil {
+		return nil, fmt.Errorf("trx_id has an invalid date")
+	}
+	seq, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil || seq <= 0 || len(parts[4]) < 4 {
+		return nil, fmt.Errorf("trx_id has an invalid sequence")
+	}
+	body := strings.Join(parts[:5], "-")
+	if len(parts[5]) != 1 || parts[5][0] != trxCheckChar(body) {
+		return nil, fmt.Errorf("trx_id check character does not match")
+	}
+
+	return &models.TrxIDInfo{
+		TrxID:      id,
+		OutletCode: parts[1],
+		Date:       day.Format("2006-01-02"),
+		Device:     parts[3],
+		Sequence:   seq,
+	}, nil
+}
+
+// validateTrxID checks a client-provided trx_id. IDs in the server format
+// must be well-formed, belong to the transaction's outlet and not be dated
+// in the future. Other IDs are accepted from older clients unless
+// TRX_ID_MODE=strict.
+func validateTrxID(trx *models.Transaction, now time.Time) error {
+	if !strings.HasPrefix(trx.TrxID, trxIDPrefix+"-") {
+		if strings.EqualFold(os.Getenv("TRX_ID_MODE"), "strict") {
+			return fmt.Errorf("trx_id must be allocated by the server (POST /transactions/ids)")
+		}
+		return nil
+	}
+
+	info, err := parseTrxID(trx.TrxID)
+	if err != nil {
+		return err
+	}
+	if info.OutletCode != trxCode(trx.OutletID) {
+		return fmt.Errorf("trx_id belongs to another outlet")
+	}
+	if info.Date > now.In(wib).Format("2006-01-02") {
+		return fmt.Errorf("trx_id is dated in the future")
+	}
+	return nil
+}
+
+// allocateTrxID issues the next server-format transaction ID of an outlet
+func allocateTrxID(dbClient *config.AstraDBClient, outletID, device string, at time.Time) (string, error) {
+	if trxCode(outletID) == "" {
+		return "", fmt.Errorf("outlet_id is required to allocate a trx_id")
+	}
+	seq, err := nextSequence(dbClient, models.SequenceTransaction, outletID, at)
+	if err != nil {
+		return "", err
+	}
+	return formatTrxID(outletID, device, at, seq), nil
+}
+
+// releaseTrxID gives back a trx_id allocated by allocateTrxID that was not
+// used
+func releaseTrxID(dbClient *config.AstraDBClient, outletID, trxID string) {
+	if info, err := parseTrxID(trxID); err == nil {
+		releaseSequence(dbClient, models.SequenceTransaction, outletID, info.Date, info.Sequence)
+	}
+}
+
+// Transactions saved without a trx_id must carry an idempotency key. The
+// trx_id allocated for a key is kept in the trx_idempotency collection, so a
+// retry after a timeout finds the transaction instead of creating a second.
+
+// idempotentTrxID returns the trx_id allocated earlier for an outlet's
+// idempotency key, or "" if there is none
+func idempotentTrxID(dbClient *config.AstraDBClient, outletID, key string) (string, error) {
+	docs, err := findDocuments(dbClient, "trx_idempotency", map[string]interface{}{"_id": outletID + ":" + key}, nil, 1)
+	if err != nil || len(docs) == 0 {
+		return "", err
+	}
+	return toString(docs[0]["trx_id"]), nil
+}
+
+// recordIdempotentTrxID stores trxID for an idempotency key and returns the
+// trx_id to use: trxID, or the one recorded first by a concurrent request
+func recordIdempotentTrxID(dbClient *config.AstraDBClient, outletID, key, trxID string) (string, error) {
+	document := map[string]interface{}{
+		"_id":        outletID + ":" + key,
+		"outlet_id":  outletID,
+		"trx_id":     trxID,
+		"created_at": time.Now().In(wib).Format(time.RFC3339),
+	}
+	if _, err := dbClient.InsertDocument("trx_idempotency", document); err != nil {
+		if !config.IsDuplicateDocument(err) {
+			return "", err
+		}
+		recorded, err := idempotentTrxID(dbClient, outletID, key)
+		if err != nil || recorded == "" {
+			return "", fmt.Errorf("failed to read the trx_id of idempotency key %s: %v", key, err)
+		}
+		return recorded, nil
+	}
+	return trxID, nil
+}
+
+// AllocateTrxID issues a transaction ID for a device to use with
+// POST /orders/transaction
+func (h *OrderHandler) AllocateTrxID(c *fiber.Ctx) error {
+	var req models.AllocateTrxIDRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if trxCode(req.OutletID) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "outlet_id is required"})
+	}
+
+	trxID, err := allocateTrxID(h.dbClient, req.OutletID, req.DeviceID, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	info, _ := parseTrxID(trxID)
+
+	return c.Status(201).JSON(info)
+}
+
+// GetTransaction looks up a transaction by trx_id. Server-format IDs are
+// checked first so typos are reported without a database round trip.
+func (h *OrderHandler) GetTransaction(c *fiber.Ctx) error {
+	trxID := c.Params("trx_id")
+
+	var info *models.TrxIDInfo
+	if strings.HasPrefix(trxID, trxIDPrefix+"-") {
+		parsed, err := parseTrxID(trxID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		info = parsed
+	}
+
+	docs, err := findDocuments(h.dbClient, "order", map[string]interface{}{"_id": trxID}, nil, 1)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(docs) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Transaction not found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"transaction": docs[0],
+		"trx_id_info": info,
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTrxCheckCharDetectsTypos(t *testing.T) {
+	body := "TRX-OUTLET1-20240515-POS2-0042"
+	check := trxCheckChar(body)
+
+	for i := range body {
+		if body[i] == '-' {
+			continue
+		}
+		for _, c := range base36 {
+			if byte(c) == body[i] {
+				continue
+			}
+			typo := body[:i] + string(c) + body[i+1:]
+			if trxCheckChar(typo) == check {
+				t.Fatalf("substituting %c at %d in %s keeps check character %c", c, i, body, check)
+			}
+		}
+	}
+
+	// Swapping two different neighbours changes the check character
+	swapped := "TRX-OUTLET1-20240515-POS2-0024"
+	if trxCheckChar(swapped) == check {
+		t.Errorf("transposed digits keep check character %c", check)
+	}
+	if trxCheckChar("TRX-OUTLET1-20240515-POS2-0042") != check {
+		t.Error("check character is not deterministic")
+	}
+}
+
+func TestParseTrxID(t *testing.T) {
+	day := time.Date(2024, 5, 15, 9, 0, 0, 0, wib)
+	valid := formatTrxID("outlet-1", "pos 2", day, 42)
+	if !strings.HasPrefix(valid, "TRX-OUTLET1-20240515-POS2-0042-") {
+		t.Fatalf("formatTrxID = %s", valid)
+	}
+
+	info, err := parseTrxID(valid)
+	if err != nil {
+		t.Fatalf("parseTrxID(%s): %v", valid, err)
+	}
+	if info.OutletCode != "OUTLET1" || info.Date != "2024-05-15" || info.Device != "POS2" || info.Sequence != 42 {
+		t.Errorf("parsed %+v", info)
+	}
+	if id := formatTrxID("O1", "", day, 1); !strings.Contains(id, "-00-0001-") {
+		t.Errorf("default device missing: %s", id)
+	}
+
+	body := valid[:len(valid)-2]
+	wrongCheck := body + "-0"
+	if valid[len(valid)-1] == '0' {
+		wrongCheck = body + "-1"
+	}
+	invalid := map[string]string{
+		"legacy ID":       "202405151030001",
+		"prefix":          strings.Replace(valid, "TRX", "TRY", 1),
+		"lower case":      strings.Replace(valid, "OUTLET1", "outlet1", 1),
+		"date":            "TRX-O1-20241315-00-0001-" + string(trxCheckChar("TRX-O1-20241315-00-0001")),
+		"short sequence":  "TRX-O1-20240515-00-001-" + string(trxCheckChar("TRX-O1-20240515-00-001")),
+		"zero sequence":   "TRX-O1-20240515-00-0000-" + string(trxCheckChar("TRX-O1-20240515-00-0000")),
+		"check character": wrongCheck,
+		"missing check":   body,
+	}
+	for name, id := range invalid {
+		if _, err := parseTrxID(id); err == nil {
+			t.Errorf("%s: parseTrxID(%s) accepted", name, id)
+		}
+	}
+}
+
+func TestSaveTransactionWithoutTrxIDIsIdempotent(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("TAX_PERCENT", "0")
+	db, client := newFakeDB(t)
+	h := NewOrderHandler(client)
+	app := fiber.New()
+	app.Post("/orders/transaction", h.SaveTransaction)
+
+	body := `{"outlet_id":"IDEMTEST","cashier":"Ani","type":"take_away","method":"cash","nominal":10000,"subtotal":10000,"total":10000,
+		"items":[{"menu_name":"Es Teh","qty":2,"price":5000,"subtotal":10000}]}`
+	post := func(key string) (int, string) {
+		req := httptest.NewRequest("POST", "/orders/transaction", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if status, response := post(""); status != 400 || !strings.Contains(response, "POST /transactions/ids") {
+		t.Fatalf("no trx_id or key: status %d %s", status, response)
+	}
+
+	status, first := post("sale-1")
+	if status != 201 {
+		t.Fatalf("first save: status %d %s", status, first)
+	}
+	saved := db.find("order", map[string]interface{}{})
+	if len(saved) != 1 {
+		t.Fatalf("%d transactions saved, want 1", len(saved))
+	}
+	trxID := saved[0]["_id"].(string)
+	if _, err := parseTrxID(trxID); err != nil {
+		t.Errorf("allocated trx_id %s: %v", trxID, err)
+	}
+
+	// The client timed out and sends the same sale again
+	status, retry := post("sale-1")
+	if status != 200 || !strings.Contains(retry, `"duplicate":true`) || !strings.Contains(retry, trxID) {
+		t.Fatalf("retry: status %d %s", status, retry)
+	}
+	if got := len(db.find("order", map[string]interface{}{})); got != 1 {
+		t.Errorf("%d transactions after a retry, want 1", got)
+	}
+
+	if status, _ := post("sale-2"); status != 201 {
+		t.Errorf("another key: status %d, want 201", status)
+	}
+	if got := len(db.find("order", map[string]interface{}{})); got != 2 {
+		t.Errorf("%d transactions for two keys, want 2", got)
+	}
+}
+
+func TestGetTransactionReportsDBErrors(t *testing.T) {
+	db, client := newFakeDB(t)
+	app := fiber.New()
+	app.Get("/transactions/:trx_id", NewOrderHandler(client).GetTransaction)
+	db.insert("order", map[string]interface{}{"_id": "T1", "trx_id": "T1", "total": 10000})
+
+	if status, body := do(t, app, "GET", "/transactions/T1", nil); status != 200 || body["transaction"] == nil {
+		t.Errorf("lookup: status %d %v", status, body)
+	}
+	if status, _ := do(t, app, "GET", "/transactions/T2", nil); status != 404 {
+		t.Errorf("missing: status %d, want 404", status)
+	}
+	db.failing["order find"] = "SERVER_UNHANDLED_ERROR"
+	if status, _ := do(t, app, "GET", "/transactions/T1", nil); status != 500 {
+		t.Errorf("DB error: status %d, want 500", status)
+	}
+}
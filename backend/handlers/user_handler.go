@@ -301,6 +301,7 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
         ProfilePhotoId:   toString(extractVal(obj["profilePhotoId"])),
         ProfilePhotoUrl:  toString(extractVal(obj["profilePhotoUrl"])),
     }
+    k.StreamToken = issueStreamToken(k)
 
     return c.JSON(k)
 }
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/events"
 	"sagawa_pos_backend/models"
 	"time"
 
@@ -303,6 +304,12 @@ func (h *VoucherHandler) UseVoucher(c *fiber.Ctx) error {
 		})
 	}
 
+	publishEvent(h.dbClient, events.VoucherRedeemed, req.OutletID, fiber.Map{
+		"code_voucher": req.CodeVoucher,
+		"nominal":      nominal,
+		"redeemed_by":  req.RedeemedBy,
+	})
+
 	// Return success response with voucher details
 	return c.Status(fiber.StatusOK).JSON(models.UseVoucherResponse{
 		Success:     true,
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"sagawa_pos_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetZReport returns the end-of-day (Z) report of an outlet for one WIB day,
+// with revenue broken down by individual payment legs
+func (h *OrderHandler) GetZReport(c *fiber.Ctx) error {
+	outletID := c.Params("outlet_id")
+	date := c.Query("date", time.Now().In(wib).Format("2006-01-02")) // format: YYYY-MM-DD
+
+	if outletID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "outlet_id is required"})
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be in YYYY-MM-DD format"})
+	}
+
+	filter := map[string]interface{}{
+		"outlet_id": outletID,
+		"created_at": map[string]interface{}{
+			"$gte": date + "T00:00:00Z",
+			"$lte": date + "T23:59:59Z",
+		},
+	}
+	transactions := fetchTransactions(h.dbClient, filter, 50)
+
+	var subtotal, promoDiscount, voucherDiscount, serviceCharge, tax, rounding, total models.Money
+	orderTypes := make(map[string]int)
+	for _, trx := range transactions {
+		subtotal += toMoney(trx["subtotal"])
+		promoDiscount += toMoney(trx["promo_discount"])
+		voucherDiscount += toMoney(trx["voucher_discount"])
+		serviceCharge += toMoney(trx["service_charge"])
+		tax += toMoney(trx["tax"])
+		rounding += toMoney(trx["rounding"])
+		total += toMoney(trx["total"])
+		if orderType, ok := trx["type"].(string); ok {
+			orderTypes[orderType]++
+		}
+	}
+
+	payments := summarizePayments(transactions)
+	var cashInDrawer models.Money
+	for _, p := range payments {
+		if p.Method == models.PaymentCash {
+			cashInDrawer = p.Amount
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"outlet_id":          outletID,
+		"date":               date,
+		"total_transactions": len(transactions),
+		"gross_sales":        subtotal,
+		"promo_discount":     promoDiscount,
+		"voucher_discount":   voucherDiscount,
+		"service_charge":     serviceCharge,
+		"tax":                tax,
+		"rounding":           rounding,
+		"net_sales":          total,
+		"cash_in_drawer":     cashInDrawer,
+		"payments":           payments,
+		"tax_breakdown":      summarizeTaxByRate(transactions),
+		"order_types":        orderTypes,
+	})
+}
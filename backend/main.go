@@ -30,14 +30,17 @@ func main() {
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		AppName: "Sagawa POS API v1.0.0",
+		// Menu images of up to 8 MB, also sent base64-encoded in JSON
+		BodyLimit: 12 << 20,
 	})
 
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: os.Getenv("ALLOWED_ORIGINS"),
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
+		AllowOrigins:  os.Getenv("ALLOWED_ORIGINS"),
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, If-None-Match",
+		AllowMethods:  "GET, POST, PUT, DELETE, OPTIONS",
+		ExposeHeaders: "ETag, Last-Modified, X-Menu-Version",
 	}))
 	
 	// Root endpoint (untuk pengecekan langsung via domain)
@@ -62,7 +65,9 @@ func main() {
 
 	// Setup routes
 	api := app.Group("/api/v1")
-	routes.SetupRoutes(api, dbClient)
+	if err := routes.SetupRoutes(api, dbClient); err != nil {
+		log.Fatalf("Failed to set up routes: %v", err)
+	}
 
 	// Start server
 	port := os.Getenv("PORT")
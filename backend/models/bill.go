@@ -0,0 +1,44 @@
+package models
+
+// TransferBillRequest is the request body for POST /orders/:id/transfer
+type TransferBillRequest struct {
+	TableNumber string `json:"table_number"`
+	Actor       string `json:"actor"`
+}
+
+// MergeBillRequest is the request body for POST /orders/:id/merge; the
+// source bill's items move into the bill in the URL
+type MergeBillRequest struct {
+	SourceID string `json:"source_id"`
+	Actor    string `json:"actor"`
+}
+
+// SplitLine moves quantity of one bill line to the new bill (0 = all)
+type SplitLine struct {
+	LineID   string `json:"line_id"`
+	Quantity int    `json:"quantity"`
+}
+
+// SplitBillRequest is the request body for POST /orders/:id/split. Either
+// items (split by items into a new bill) or ways (split equally) is set.
+type SplitBillRequest struct {
+	Items []SplitLine `json:"items,omitempty"`
+	Ways  int         `json:"ways,omitempty"`
+	Actor string      `json:"actor"`
+}
+
+// SettleBillRequest is the request body for POST /orders/:id/settle. The
+// bill's items are priced server-side and saved as a transaction.
+type SettleBillRequest struct {
+	TrxID       string    `json:"trx_id"` // allocated by the server when empty
+	DeviceID    string    `json:"device_id"`
+	OutletName  string    `json:"outlet_name"`
+	Cashier     string    `json:"cashier"`
+	Customer    string    `json:"customer"`
+	Note        string    `json:"note,omitempty"`
+	Method      string    `json:"method"`
+	Payments    []Payment `json:"payments,omitempty"`
+	VoucherCode string    `json:"voucher_code,omitempty"`
+	MemberID    string    `json:"member_id,omitempty"`
+	Actor       string    `json:"actor"`
+}
@@ -0,0 +1,37 @@
+package models
+
+// CartQuoteRequest is the request body for POST /cart/quote
+type CartQuoteRequest struct {
+	OutletID    string            `json:"outlet_id"`
+	Type        string            `json:"type"`   // dine_in / take_away
+	Method      string            `json:"method"` // cash / qris
+	VoucherCode string            `json:"voucher_code,omitempty"`
+	MemberID    string            `json:"member_id,omitempty"`
+	Items       []CartItemRequest `json:"items"`
+}
+
+// CartQuote is the authoritative server-side pricing of a cart. QuoteID is a
+// signed token of the quote itself that SaveTransaction accepts once.
+type CartQuote struct {
+	QuoteID         string             `json:"quote_id"`
+	Nonce           string             `json:"nonce"` // makes every quote ID unique
+	OutletID        string             `json:"outlet_id"`
+	Type            string             `json:"type"`
+	Method          string             `json:"method"`
+	MemberID        string             `json:"member_id,omitempty"`
+	Lines           []CartLine         `json:"lines"`
+	Promotions      []AppliedPromotion `json:"promotions"`
+	Subtotal        Money              `json:"subtotal"`
+	PromoDiscount   Money              `json:"promo_discount"`
+	VoucherCode     string             `json:"voucher_code,omitempty"`
+	VoucherDiscount Money              `json:"voucher_discount"`
+	ServiceCharge   Money              `json:"service_charge"`
+	ServiceRate     float64            `json:"service_rate"`
+	TaxName         string             `json:"tax_name"`
+	TaxRate         float64            `json:"tax_rate"`
+	TaxInclusive    bool               `json:"tax_inclusive"`
+	Tax             Money              `json:"tax"`
+	Rounding        Money              `json:"rounding"`
+	Total           Money              `json:"total"`
+	ExpiresAt       string             `json:"expires_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+// Category is a menu kategori of a subBrand (menu_category collection).
+// Menu items point at it with categoryId and keep its name in kategori for
+// older clients and kategori promotions.
+type Category struct {
+	ID        string    `json:"_id"`
+	Kemitraan string    `json:"kemitraan"`
+	SubBrand  string    `json:"subBrand,omitempty"` // empty for kemitraan without subBrands
+	Name      string    `json:"name"`
+	ParentID  string    `json:"parentId,omitempty"`
+	Order     int       `json:"order"` // display order, ascending
+	Icon      string    `json:"icon,omitempty"`
+	ImageURL  string    `json:"imageUrl,omitempty"`
+	Active    bool      `json:"active"` // items of inactive categories are not sold
+	Schedule  *Schedule `json:"schedule,omitempty"`
+	CreatedAt string    `json:"createdAt,omitempty"`
+	UpdatedAt string    `json:"updatedAt,omitempty"`
+}
+
+// CategoryRequest is the request body for creating or updating a category;
+// fields left out keep their value on update
+type CategoryRequest struct {
+	Kemitraan string  `json:"kemitraan"`
+	SubBrand  string  `json:"subBrand"`
+	Name      string  `json:"name"`
+	ParentID  *string `json:"parentId"`
+	Order     *int    `json:"order"`
+	Icon      *string `json:"icon"`
+	ImageURL  *string `json:"imageUrl"`
+	Active    *bool   `json:"active"`
+	Actor     string  `json:"actor"` // recorded in the version history of renamed items
+}
+
+// ReorderCategoriesRequest is the request body for PUT /menu/categories/order;
+// categories get their position in IDs as display order
+type ReorderCategoriesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// CategoryMigration reports what POST /menu/categories/migrate did (or would
+// do with dry_run)
+type CategoryMigration struct {
+	DryRun          bool       `json:"dry_run"`
+	Created         []Category `json:"created"`
+	Existing        int        `json:"existing"`
+	ItemsLinked     int        `json:"items_linked"`
+	SchedulesCopied int        `json:"schedules_copied"`
+}
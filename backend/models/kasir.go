@@ -16,4 +16,5 @@ type Kasir struct {
     ProfilePhotoData string    `json:"profilePhotoData"`
     ProfilePhotoId   string    `json:"profilePhotoId"`
     ProfilePhotoUrl  string    `json:"profilePhotoUrl"`
+    StreamToken      string    `json:"streamToken,omitempty"` // login response only, for /events/stream
 }
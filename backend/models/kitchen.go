@@ -0,0 +1,79 @@
+package models
+
+// Kitchen item statuses
+const (
+	KitchenQueued  = "queued"
+	KitchenStarted = "started"
+	KitchenDone    = "done"
+	KitchenVoided  = "voided" // order cancelled or line removed
+)
+
+// Kitchen feed event types
+const (
+	KitchenEventQueued  = "item_queued"
+	KitchenEventStarted = "item_started"
+	KitchenEventDone    = "item_done"
+	KitchenEventVoided  = "item_voided"
+	KitchenEventUpdated = "item_updated" // moved to another bill or split
+)
+
+// KitchenItem is one order line routed to a kitchen station (kitchen_item
+// collection, keyed by order ID and line ID)
+type KitchenItem struct {
+	ID          string `json:"_id"`
+	OrderID     string `json:"order_id"`
+	OrderNumber string `json:"order_number"`
+	OutletID    string `json:"outlet_id"`
+	Station     string `json:"station"`
+	TableNumber string `json:"table_number,omitempty"`
+	OrderType   string `json:"order_type,omitempty"`
+	LineID      string `json:"line_id"`
+	MenuID      string `json:"menu_id"`
+	Name        string `json:"name"`
+	Kategori    string `json:"kategori,omitempty"`
+	Quantity    int    `json:"quantity"`
+	Note        string `json:"note,omitempty"`
+	Status      string `json:"status"`
+	QueuedAt    string `json:"queued_at"`
+	StartedAt   string `json:"started_at,omitempty"`
+	DoneAt      string `json:"done_at,omitempty"`
+	StartedBy   string `json:"started_by,omitempty"`
+	DoneBy      string `json:"done_by,omitempty"`
+
+	// Timings in seconds, set when the item is done
+	WaitSeconds   int `json:"wait_seconds,omitempty"`   // queued until started
+	PrepSeconds   int `json:"prep_seconds,omitempty"`   // started until done
+	TicketSeconds int `json:"ticket_seconds,omitempty"` // queued until done
+}
+
+// KitchenEvent is pushed to kitchen display feeds; on the event bus it is
+// the data of a kitchen.item_changed event
+type KitchenEvent struct {
+	Type string      `json:"type"`
+	Item KitchenItem `json:"item"`
+}
+
+// BumpKitchenItemRequest is the request body for the kitchen bump endpoints
+type BumpKitchenItemRequest struct {
+	Actor string `json:"actor"`
+}
+
+// StationMetrics summarizes ticket times of one station
+type StationMetrics struct {
+	Station          string `json:"station"`
+	Items            int    `json:"items"`
+	Done             int    `json:"done"`
+	AvgWaitSeconds   int    `json:"avg_wait_seconds"`
+	AvgPrepSeconds   int    `json:"avg_prep_seconds"`
+	AvgTicketSeconds int    `json:"avg_ticket_seconds"`
+	MaxTicketSeconds int    `json:"max_ticket_seconds"`
+}
+
+// MenuTicketMetrics summarizes ticket times of one menu item
+type MenuTicketMetrics struct {
+	MenuID           string `json:"menu_id"`
+	Name             string `json:"name"`
+	Station          string `json:"station"`
+	Done             int    `json:"done"`
+	AvgTicketSeconds int    `json:"avg_ticket_seconds"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Member is a customer registered for member pricing, stored in the member
+// collection. Only active members get member-only promotions.
+type Member struct {
+	ID        string `json:"_id,omitempty"`
+	Name      string `json:"name"`
+	Phone     string `json:"phone,omitempty"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
@@ -10,9 +10,136 @@ type Menu struct {
 	Kemitraan   string    `json:"kemitraan"`
 	SubBrand    string    `json:"subBrand"`
 	Kategori    string    `json:"kategori"`
-	Price       float64   `json:"price"`
+	CategoryID  string    `json:"categoryId,omitempty"` // menu_category; kategori holds its name
+	Price       Money     `json:"price"`
 	CreatedAt   time.Time `json:"createdAt"`
 	ImageURL    string    `json:"imageUrl"`
 	ImageID     string    `json:"imageId"`
-	ImageData   string    `json:"imageData"`
+	ImageData   string    `json:"imageData,omitempty"` // inline base64, from before image uploads; not sent in menu listings
+	UpdatedAt   string    `json:"updatedAt,omitempty"`
+	Deleted     bool      `json:"deleted,omitempty"` // soft-deleted; hidden from the menu and pricing
+	DeletedAt   string    `json:"deletedAt,omitempty"`
+
+	ImageThumbURL string `json:"imageThumbUrl,omitempty"` // small version of ImageURL for menu grids
+	Version       int    `json:"version,omitempty"`       // latest menu_version of the item
+
+	// Sizes/versions priced relative to Price, and option groups such as
+	// toppings. A line picks one variant (if any) and options per group.
+	Variants       []MenuVariant   `json:"variants,omitempty"`
+	ModifierGroups []ModifierGroup `json:"modifierGroups,omitempty"`
+
+	// When the item can be sold; CategorySchedule is its kategori's schedule,
+	// included for devices that check schedules offline
+	Schedule         *Schedule `json:"schedule,omitempty"`
+	CategorySchedule *Schedule `json:"categorySchedule,omitempty"`
+	OffSchedule      bool      `json:"offSchedule,omitempty"` // not sellable now (only listed with ?all=true)
+
+	// Set when the menu is read for an outlet (?outlet_id=)
+	BasePrice    Money  `json:"basePrice,omitempty"` // menu price when the outlet overrides Price
+	SoldOut      bool   `json:"soldOut,omitempty"`
+	SoldOutUntil string `json:"soldOutUntil,omitempty"`
+	Hidden       bool   `json:"-"`
+}
+
+// MenuVariant is a version of a menu item, e.g. "Large", priced at the menu
+// price plus PriceDelta
+type MenuVariant struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	PriceDelta Money  `json:"priceDelta"`
+	Default    bool   `json:"default,omitempty"` // used when a line names no variant
+}
+
+// ModifierGroup is a set of options, e.g. "Topping". Lines pick between Min
+// and Max of its options; Max 0 means no upper limit.
+type ModifierGroup struct {
+	ID       string           `json:"id"`
+	Name     string           `json:"name"`
+	Required bool             `json:"required"`
+	Min      int              `json:"min"`
+	Max      int              `json:"max"`
+	Options  []ModifierOption `json:"options"`
+}
+
+// ModifierOption is one choice in a modifier group, e.g. "Extra keju"
+type ModifierOption struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	PriceDelta Money  `json:"priceDelta"`
+}
+
+// SelectedOption is the variant or a modifier option chosen for a line, with
+// the price it added at the time of sale
+type SelectedOption struct {
+	GroupID    string `json:"group_id,omitempty"` // modifier group; empty for the variant
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	PriceDelta Money  `json:"price_delta"`
+}
+
+// MenuImage is an uploaded menu image stored in the blob store under names
+// derived from the content, in a full and a thumbnail size
+type MenuImage struct {
+	ID          string `json:"imageId"` // hash of the uploaded file
+	URL         string `json:"imageUrl"`
+	ThumbURL    string `json:"imageThumbUrl"`
+	Width       int    `json:"width"` // of the full size
+	Height      int    `json:"height"`
+	ThumbWidth  int    `json:"thumbWidth"`
+	ThumbHeight int    `json:"thumbHeight"`
+}
+
+// ImageMigration reports what POST /menu/images/migrate did (or would do
+// with dry_run)
+type ImageMigration struct {
+	DryRun   bool              `json:"dry_run"`
+	Migrated int               `json:"migrated"`
+	Failed   map[string]string `json:"failed"` // menu ID -> error
+}
+
+// MenuListDelta is the response of GET /menu?since=: items changed or
+// removed since the version token. With full set the token was unknown and
+// the client should replace its list with Upserted.
+type MenuListDelta struct {
+	Version string `json:"version"`
+	Full    bool   `json:"full"`
+	MenuDelta
+}
+
+// MenuSearchResult is a menu item found by GET /menu/search
+type MenuSearchResult struct {
+	Menu  Menu    `json:"menu"`
+	Score float64 `json:"score"`
+	Sold  int     `json:"sold"` // quantity sold in the popularity window
+}
+
+// MenuRequest is the request body for creating or updating a menu item
+type MenuRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Kemitraan   string `json:"kemitraan"`
+	SubBrand    string `json:"subBrand"`
+	Kategori    string `json:"kategori"`
+	CategoryID  string `json:"categoryId"` // takes precedence over kategori
+	Price       Money  `json:"price"`
+	ImageURL    string `json:"imageUrl"`
+	ImageID     string `json:"imageId"`
+	ImageData   string `json:"imageData"`   // base64; stored as an uploaded image
+	NewKategori bool   `json:"newKategori"` // allow a kategori no other item of the kemitraan uses yet
+	Actor       string `json:"actor"`       // recorded in the item's version history
+	Version     int    `json:"version"`     // on update, the version the edit started from; 409 when the item has moved on
+
+	Variants       []MenuVariant   `json:"variants"`
+	ModifierGroups []ModifierGroup `json:"modifierGroups"`
+	Schedule       *Schedule       `json:"schedule"`
+}
+
+// SetCategoryScheduleRequest is the request body for
+// PUT /menu/categories/schedule; a null schedule removes it. Without
+// subBrand it applies to the kategori in every subBrand of the kemitraan.
+type SetCategoryScheduleRequest struct {
+	Kemitraan string    `json:"kemitraan"`
+	SubBrand  string    `json:"subBrand"`
+	Kategori  string    `json:"kategori"`
+	Schedule  *Schedule `json:"schedule"`
 }
@@ -0,0 +1,34 @@
+package models
+
+// What an import does with a row
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+	ImportSkip   = "skip" // the item already matches the row
+	ImportError  = "error"
+)
+
+// MenuImportRow is the plan for one row of a menu import. Line is the row
+// number in the spreadsheet, counting the header as 1.
+type MenuImportRow struct {
+	Line      int                    `json:"line"`
+	Action    string                 `json:"action"`
+	ID        string                 `json:"id,omitempty"` // item updated or created
+	Name      string                 `json:"name"`
+	Kemitraan string                 `json:"kemitraan"`
+	SubBrand  string                 `json:"subBrand,omitempty"`
+	Changes   map[string]FieldChange `json:"changes,omitempty"` // for updates
+	Errors    []string               `json:"errors,omitempty"`
+}
+
+// MenuImport reports what POST /menu/import did (or would do with
+// dry_run=true)
+type MenuImport struct {
+	DryRun  bool            `json:"dry_run"`
+	Rows    []MenuImportRow `json:"rows"`
+	Create  int             `json:"create"`
+	Update  int             `json:"update"`
+	Skip    int             `json:"skip"`
+	Errors  int             `json:"errors"`
+	Applied int             `json:"applied"` // rows written
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Availability states a cashier can set for a menu item at their outlet
+const (
+	AvailabilityAvailable    = "available"
+	AvailabilitySoldOut      = "sold_out"       // until switched back, or until "until"
+	AvailabilitySoldOutToday = "sold_out_today" // back at the start of the next WIB day
+	AvailabilityHidden       = "hidden"         // not offered at the outlet at all
+)
+
+// MenuOverride adjusts a menu item for one outlet (menu_override collection,
+// keyed by outlet ID and menu ID)
+type MenuOverride struct {
+	ID           string `json:"_id"`
+	OutletID     string `json:"outlet_id"`
+	MenuID       string `json:"menu_id"`
+	Hidden       bool   `json:"hidden"`
+	SoldOut      bool   `json:"sold_out"`
+	SoldOutUntil string `json:"sold_out_until,omitempty"` // RFC3339; empty = until switched back
+	Price        *Money `json:"price,omitempty"`          // replaces the menu price at the outlet
+	UpdatedAt    string `json:"updated_at"`
+	UpdatedBy    string `json:"updated_by,omitempty"`
+}
+
+// IsSoldOut reports whether the item is sold out at the given time
+func (o MenuOverride) IsSoldOut(now time.Time) bool {
+	if !o.SoldOut {
+		return false
+	}
+	if o.SoldOutUntil == "" {
+		return true
+	}
+	until, err := time.Parse(time.RFC3339, o.SoldOutUntil)
+	return err != nil || now.Before(until)
+}
+
+// SetAvailabilityRequest is the request body for
+// PUT /outlets/:outlet_id/menu/:menu_id/availability
+type SetAvailabilityRequest struct {
+	Status string `json:"status"`
+	Until  string `json:"until,omitempty"` // RFC3339, only for sold_out
+	Actor  string `json:"actor"`
+}
+
+// SetMenuPriceRequest is the request body for
+// PUT /outlets/:outlet_id/menu/:menu_id/price; a null price removes the override
+type SetMenuPriceRequest struct {
+	Price *Money `json:"price"`
+	Actor string `json:"actor"`
+}
@@ -0,0 +1,64 @@
+package models
+
+// Actions recorded in menu versions
+const (
+	MenuActionCreate         = "create"
+	MenuActionUpdate         = "update"
+	MenuActionDelete         = "delete"
+	MenuActionRestore        = "restore"
+	MenuActionImage          = "image"
+	MenuActionCategory       = "category"        // kategori renamed or linked through its category
+	MenuActionScheduledPrice = "scheduled_price" // a price schedule took effect
+)
+
+// Price schedule states
+const (
+	PriceSchedulePending   = "pending"
+	PriceScheduleApplying  = "applying" // claimed; the price is being written
+	PriceScheduleApplied   = "applied"
+	PriceScheduleCancelled = "cancelled"
+	PriceScheduleFailed    = "failed"
+)
+
+// MenuVersion records one write to a menu item (menu_version collection,
+// keyed by menu ID and version). Versions count up from 1 per item; items
+// written before versioning started are at version 0.
+type MenuVersion struct {
+	ID         string                 `json:"_id"`
+	MenuID     string                 `json:"menu_id"`
+	Version    int                    `json:"version"`
+	Action     string                 `json:"action"`
+	Actor      string                 `json:"actor,omitempty"`
+	At         string                 `json:"at"`
+	Changes    map[string]FieldChange `json:"changes"`
+	ScheduleID string                 `json:"schedule_id,omitempty"` // the price schedule that made the change
+}
+
+// FieldChange is the old and new value of a menu field
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// MenuPriceSchedule is a price change that takes effect at a set time
+// (menu_price_schedule collection)
+type MenuPriceSchedule struct {
+	ID          string `json:"_id"`
+	MenuID      string `json:"menu_id"`
+	Price       Money  `json:"price"`
+	EffectiveAt string `json:"effective_at"` // RFC3339
+	Status      string `json:"status"`
+	Actor       string `json:"actor,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	ClaimedAt   string `json:"claimed_at,omitempty"`
+	AppliedAt   string `json:"applied_at,omitempty"`
+	Version     int    `json:"version,omitempty"` // menu version the change created
+	Error       string `json:"error,omitempty"`
+}
+
+// SchedulePriceRequest is the request body for POST /menu/:id/price-schedules
+type SchedulePriceRequest struct {
+	Price       Money  `json:"price"`
+	EffectiveAt string `json:"effective_at"` // RFC3339, in the future
+	Actor       string `json:"actor"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in whole rupiah. It is serialized as a JSON integer but
+// also accepts the float and string values found in existing documents.
+type Money int64
+
+// NewMoney converts a float amount to Money, rounding half away from zero
+func NewMoney(f float64) Money {
+	return Money(math.Round(f))
+}
+
+// Float64 returns the amount as a float (for ratios and percentages)
+func (m Money) Float64() float64 {
+	return float64(m)
+}
+
+// Times multiplies the amount by a quantity
+func (m Money) Times(qty int) Money {
+	return m * Money(qty)
+}
+
+// Percent returns p percent of the amount, rounded to whole rupiah
+func (m Money) Percent(p float64) Money {
+	return NewMoney(float64(m) * p / 100)
+}
+
+// UnmarshalJSON accepts integers, floats (rounded), numeric strings and null
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		*m = 0
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	if s == "" {
+		*m = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid money value %s", data)
+	}
+	*m = NewMoney(f)
+	return nil
+}
+
+// Cash rounding modes
+const (
+	RoundNearest = "nearest"
+	RoundDown    = "down"
+	RoundUp      = "up"
+)
+
+// CashRounding rounds cash totals to a coin unit, e.g. the nearest Rp 100
+type CashRounding struct {
+	Unit Money  `json:"unit"` // 0 or 1 disables rounding
+	Mode string `json:"mode"` // nearest (default) / down / up
+}
+
+// Apply rounds a positive amount to the rule's unit
+func (r CashRounding) Apply(m Money) Money {
+	if r.Unit <= 1 || m <= 0 {
+		return m
+	}
+	rem := m % r.Unit
+	if rem == 0 {
+		return m
+	}
+	down := m - rem
+	switch r.Mode {
+	case RoundDown:
+		return down
+	case RoundUp:
+		return down + r.Unit
+	default:
+		if rem*2 >= r.Unit {
+			return down + r.Unit
+		}
+		return down
+	}
+}
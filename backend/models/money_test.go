@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCashRoundingApply(t *testing.T) {
+	tests := []struct {
+		rule CashRounding
+		in   Money
+		want Money
+	}{
+		{CashRounding{}, 12345, 12345},
+		{CashRounding{Unit: 1}, 12345, 12345},
+		{CashRounding{Unit: 100}, 12300, 12300},
+		{CashRounding{Unit: 100}, 12349, 12300},
+		{CashRounding{Unit: 100}, 12350, 12400}, // half rounds up
+		{CashRounding{Unit: 100, Mode: RoundNearest}, 12351, 12400},
+		{CashRounding{Unit: 500}, 12249, 12000},
+		{CashRounding{Unit: 500}, 12250, 12500},
+		{CashRounding{Unit: 100, Mode: RoundDown}, 12399, 12300},
+		{CashRounding{Unit: 100, Mode: RoundUp}, 12301, 12400},
+		{CashRounding{Unit: 100, Mode: RoundUp}, 12300, 12300},
+		{CashRounding{Unit: 1000, Mode: RoundDown}, 999, 0},
+		{CashRounding{Unit: 100}, 0, 0},
+		{CashRounding{Unit: 100}, -150, -150}, // refunds are not rounded
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Apply(tt.in); got != tt.want {
+			t.Errorf("%+v.Apply(%d) = %d, want %d", tt.rule, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCashRoundingApplyIsIdempotent(t *testing.T) {
+	for _, rule := range []CashRounding{{Unit: 100}, {Unit: 500, Mode: RoundDown}, {Unit: 500, Mode: RoundUp}} {
+		for m := Money(1); m < 2000; m += 37 {
+			once := rule.Apply(m)
+			if twice := rule.Apply(once); twice != once {
+				t.Fatalf("%+v: Apply(%d) = %d, Apply again = %d", rule, m, once, twice)
+			}
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	for in, want := range map[string]Money{`12000`: 12000, `12000.5`: 12001, `"15000"`: 15000, `null`: 0, `""`: 0} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err != nil || m != want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d", in, m, err, want)
+		}
+	}
+	var m Money
+	if err := json.Unmarshal([]byte(`"abc"`), &m); err == nil {
+		t.Error(`Unmarshal("abc") succeeded`)
+	}
+}
@@ -4,34 +4,151 @@ import (
 	"time"
 )
 
+// Order lifecycle states
+const (
+	OrderStatusOpen          = "open"
+	OrderStatusSentToKitchen = "sent_to_kitchen"
+	OrderStatusPreparing     = "preparing"
+	OrderStatusReady         = "ready"
+	OrderStatusServed        = "served"
+	OrderStatusPaid          = "paid"
+	OrderStatusCancelled     = "cancelled"
+)
+
+// orderTransitions lists the states each state may move to. An order can be
+// paid before it is served, e.g. a bill settled while the kitchen is still
+// cooking. Paid and cancelled are final.
+var orderTransitions = map[string][]string{
+	OrderStatusOpen:          {OrderStatusSentToKitchen, OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusSentToKitchen: {OrderStatusPreparing, OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPreparing:     {OrderStatusReady, OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusReady:         {OrderStatusServed, OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusServed:        {OrderStatusPaid, OrderStatusCancelled},
+}
+
+// IsOrderStatus reports whether s is a known order state
+func IsOrderStatus(s string) bool {
+	switch s {
+	case OrderStatusOpen, OrderStatusSentToKitchen, OrderStatusPreparing,
+		OrderStatusReady, OrderStatusServed, OrderStatusPaid, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransition reports whether an order may move from one state to another
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOrderStatuses returns the states an order may move to from s
+func NextOrderStatuses(s string) []string {
+	next := orderTransitions[s]
+	if next == nil {
+		return []string{}
+	}
+	return next
+}
+
+// OrderTransition records one state change of an order
+type OrderTransition struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Actor  string `json:"actor"`
+	At     string `json:"at"`
+	Reason string `json:"reason,omitempty"`
+}
+
 // Order represents an order in the POS system
 type Order struct {
-	ID            string      `json:"id"`
-	OrderNumber   string      `json:"order_number"`
-	CustomerID    string      `json:"customer_id"`
-	Items         []OrderItem `json:"items"`
-	TotalAmount   float64     `json:"total_amount"`
-	Status        string      `json:"status"` // pending, completed, cancelled
-	PaymentMethod string      `json:"payment_method"`
-	CreatedAt     time.Time   `json:"created_at"`
-	UpdatedAt     time.Time   `json:"updated_at"`
+	ID            string            `json:"id"`
+	OrderNumber   string            `json:"order_number"`           // ORD-YYYYMMDD-NNNN, per outlet per day
+	QueueNumber   string            `json:"queue_number,omitempty"` // e.g. A001, for orders without a table
+	OutletID      string            `json:"outlet_id,omitempty"`
+	CustomerID    string            `json:"customer_id"`
+	TableNumber   string            `json:"table_number,omitempty"` // open bill for a dine-in table
+	Type          string            `json:"type,omitempty"`         // dine_in / take_away
+	Note          string            `json:"note,omitempty"`
+	Items         []OrderItem       `json:"items"`
+	TotalAmount   Money             `json:"total_amount"`
+	Status        string            `json:"status"` // open, sent_to_kitchen, preparing, ready, served, paid, cancelled
+	PaymentMethod string            `json:"payment_method"`
+	StatusTimes   map[string]string `json:"status_times,omitempty"` // when each state was entered
+	History       []OrderTransition `json:"history,omitempty"`
+	CreatedBy     string            `json:"created_by,omitempty"`
+	SplitFrom     string            `json:"split_from,omitempty"`   // bill this one was split off
+	MergedInto    string            `json:"merged_into,omitempty"`  // bill this one was merged into
+	SplitShares   []Money           `json:"split_shares,omitempty"` // equal split of the bill total
+	TrxID         string            `json:"trx_id,omitempty"`       // transaction that settled the order
+	Settling      bool              `json:"settling,omitempty"`     // bill is being saved as TrxID
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
 }
 
 // OrderItem represents an item in an order
 type OrderItem struct {
-	ProductID string  `json:"product_id"`
-	Name      string  `json:"name"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
-	Subtotal  float64 `json:"subtotal"`
+	LineID    string `json:"line_id"`
+	ProductID string `json:"product_id"` // menu ID for open bills
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	Price     Money  `json:"price"`
+	Subtotal  Money  `json:"subtotal"`
+	Note      string `json:"note,omitempty"`
+	AddedAt   string `json:"added_at,omitempty"`
+
+	// Menu options, priced when the bill is settled
+	VariantID   string   `json:"variant_id,omitempty"`
+	ModifierIDs []string `json:"modifier_ids,omitempty"`
+}
+
+// IsActive reports whether the order can still change (not paid or cancelled)
+func (o *Order) IsActive() bool {
+	return o.Status != OrderStatusPaid && o.Status != OrderStatusCancelled
+}
+
+// OrderMigration reports what POST /orders/migrate did (or would do with
+// dry_run)
+type OrderMigration struct {
+	DryRun   bool              `json:"dry_run"`
+	Migrated int               `json:"migrated"`
+	Skipped  int               `json:"skipped"` // already in pos_order
+	Failed   map[string]string `json:"failed"`  // order ID -> error
+}
+
+// UpdateOrderStatusRequest is the request body for PATCH /orders/:id/status
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status"`
+	Actor  string `json:"actor"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// UpdateOrderItemsRequest is the request body for PUT /orders/:id/items
+type UpdateOrderItemsRequest struct {
+	Items []OrderItem `json:"items"`
+	Actor string      `json:"actor"`
 }
 
 // TransactionItem represents an item in a transaction
 type TransactionItem struct {
-	MenuName string  `json:"menu_name"`
-	Qty      int     `json:"qty"`
-	Price    float64 `json:"price"`
-	Subtotal float64 `json:"subtotal"`
+	MenuID      string `json:"menu_id,omitempty"`
+	MenuVersion int    `json:"menu_version,omitempty"` // version of the menu item when sold
+	MenuName    string `json:"menu_name"`
+	Qty         int    `json:"qty"`
+	Price       Money  `json:"price"` // unit price including variant and modifiers
+	Subtotal    Money  `json:"subtotal"`
+
+	// Chosen options; clients may send only the IDs, the server fills in
+	// names and price deltas from the menu
+	Variant   *SelectedOption  `json:"variant,omitempty"`
+	Modifiers []SelectedOption `json:"modifiers,omitempty"`
+
+	// Set by the server when the item was sold outside its menu schedule
+	OffSchedule bool `json:"off_schedule,omitempty"`
 }
 
 // Transaction represents a completed transaction from POS
@@ -44,14 +161,41 @@ type Transaction struct {
 	Customer   string            `json:"customer"`
 	Note       string            `json:"note,omitempty"`
 	Type       string            `json:"type"`   // dine_in / take_away
-	Method     string            `json:"method"` // cash / qris
-	Nominal    float64           `json:"nominal"`
-	Subtotal   float64           `json:"subtotal"`
-	Tax        float64           `json:"tax"`
-	Total      float64           `json:"total"`
-	Qris       float64           `json:"qris"`
-	Changes    float64           `json:"changes"`
+	Method     string            `json:"method"` // cash / qris / split
+	Nominal    Money             `json:"nominal"`
+	Subtotal   Money             `json:"subtotal"`
+	Tax        Money             `json:"tax"`
+	Total      Money             `json:"total"`
+	Qris       Money             `json:"qris"`
+	Changes    Money             `json:"changes"`
 	CreatedAt  time.Time         `json:"created_at"`
+	DeviceID   string            `json:"device_id,omitempty"`  // cashier device, part of server-allocated trx_ids
+	DeviceSeq  int64             `json:"device_seq,omitempty"` // per-device sequence of transactions uploaded by POST /sync/transactions
+
+	// Required when trx_id is empty (or as the Idempotency-Key header): the
+	// server allocates one trx_id per key, so retries are not saved twice
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// Payment legs; method/nominal/qris above are kept as a summary
+	Payments []Payment `json:"payments,omitempty"`
+
+	// Promotions applied to the items, validated server-side on save
+	MemberID      string             `json:"member_id,omitempty"`
+	PromoDiscount Money              `json:"promo_discount,omitempty"`
+	Promotions    []AppliedPromotion `json:"promotions,omitempty"`
+
+	// Server-side pricing from POST /cart/quote
+	QuoteID         string `json:"quote_id,omitempty"`
+	VoucherCode     string `json:"voucher_code,omitempty"`
+	VoucherDiscount Money  `json:"voucher_discount,omitempty"`
+	ServiceCharge   Money  `json:"service_charge,omitempty"`
+	Rounding        Money  `json:"rounding,omitempty"` // cash rounding adjustment (total - unrounded total)
+
+	// Outlet tax rules in effect when the transaction was priced
+	ServiceRate  float64 `json:"service_rate,omitempty"`
+	TaxName      string  `json:"tax_name,omitempty"`
+	TaxRate      float64 `json:"tax_rate,omitempty"`
+	TaxInclusive bool    `json:"tax_inclusive,omitempty"`
 }
 
 // CreateOrderTable creates the orders table in AstraDB
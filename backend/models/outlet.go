@@ -0,0 +1,68 @@
+package models
+
+import "strings"
+
+// ChargeRule holds the tax and service charge rates for one order type
+type ChargeRule struct {
+	TaxPercent           float64 `json:"tax_percent"`
+	ServiceChargePercent float64 `json:"service_charge_percent"`
+}
+
+// OutletSettings holds per-outlet pricing rules (outlet_settings collection,
+// keyed by outlet ID)
+type OutletSettings struct {
+	OutletID     string       `json:"_id"`
+	Kemitraan    string       `json:"kemitraan,omitempty"` // partner the outlet belongs to
+	TaxName      string       `json:"tax_name"`            // e.g. PB1
+	TaxInclusive bool         `json:"tax_inclusive"`       // menu prices already include tax and service charge
+	DineIn       ChargeRule   `json:"dine_in"`
+	TakeAway     ChargeRule   `json:"take_away"`
+	CashRounding CashRounding `json:"cash_rounding"` // applied to cash totals only
+	UpdatedAt    string       `json:"updated_at,omitempty"`
+
+	// KitchenStations routes menu kategori to a kitchen station, e.g.
+	// {"Minuman": "drinks", "Ayam": "grill"}
+	KitchenStations map[string]string `json:"kitchen_stations,omitempty"`
+}
+
+// Kitchen stations used when an outlet has no route for a kategori
+const (
+	StationKitchen = "kitchen"
+	StationDrinks  = "drinks"
+)
+
+// StationFor returns the kitchen station for a menu kategori. Without an
+// explicit route drinks go to the drinks station and the rest to the kitchen.
+func (s OutletSettings) StationFor(kategori string) string {
+	for k, station := range s.KitchenStations {
+		if strings.EqualFold(k, kategori) && station != "" {
+			return station
+		}
+	}
+	lower := strings.ToLower(kategori)
+	for _, drink := range []string{"minum", "drink", "beverage", "kopi", "coffee", "jus", "juice"} {
+		if strings.Contains(lower, drink) {
+			return StationDrinks
+		}
+	}
+	return StationKitchen
+}
+
+// RuleFor returns the charge rule for an order type (dine_in / take_away)
+func (s OutletSettings) RuleFor(orderType string) ChargeRule {
+	if orderType == "take_away" {
+		return s.TakeAway
+	}
+	return s.DineIn
+}
+
+// TaxRateSummary is one row of a tax report, grouped by tax name and rate
+type TaxRateSummary struct {
+	TaxName       string  `json:"tax_name"`
+	TaxRate       float64 `json:"tax_rate"`
+	Transactions  int     `json:"transactions"`
+	TaxableAmount Money   `json:"taxable_amount"`
+	Tax           Money   `json:"tax"`
+	ServiceCharge Money   `json:"service_charge"`
+	GrossSales    Money   `json:"gross_sales"`
+}
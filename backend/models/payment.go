@@ -0,0 +1,62 @@
+package models
+
+// Payment methods accepted on a payment leg
+const (
+	PaymentCash     = "cash"
+	PaymentQris     = "qris"
+	PaymentVoucher  = "voucher"
+	PaymentDebit    = "debit"
+	PaymentTransfer = "transfer"
+)
+
+// Payment leg statuses
+const (
+	PaymentStatusPaid    = "paid"
+	PaymentStatusPending = "pending"
+	PaymentStatusFailed  = "failed"
+)
+
+// Payment is one leg of a (possibly split) payment on a transaction
+type Payment struct {
+	Method    string `json:"method"`
+	Amount    Money  `json:"amount"`
+	Reference string `json:"reference,omitempty"` // voucher code, QRIS / EDC reference
+	Status    string `json:"status"`
+}
+
+// PaymentSummary is revenue collected through one payment method
+type PaymentSummary struct {
+	Method       string `json:"method"`
+	Transactions int    `json:"transactions"`
+	Legs         int    `json:"legs"`
+	Amount       Money  `json:"amount"`
+}
+
+// PaymentCharge is a gateway payment (e.g. dynamic QRIS) created for a
+// pending transaction (payment_charge collection, keyed by reference)
+type PaymentCharge struct {
+	Reference   string `json:"_id"` // order ID sent to the gateway
+	TrxID       string `json:"trx_id"`
+	OutletID    string `json:"outlet_id"`
+	Gateway     string `json:"gateway"`
+	GatewayID   string `json:"gateway_id,omitempty"`
+	Method      string `json:"method"`
+	Amount      Money  `json:"amount"`
+	Status      string `json:"status"` // pending / paid / failed / expired
+	QRString    string `json:"qr_string,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	PaidAt      string `json:"paid_at,omitempty"`
+	FinalizedAt string `json:"finalized_at,omitempty"` // set once SaveTransaction used it
+	SettledAt   string `json:"settled_at,omitempty"`   // from the gateway settlement file
+	Settlement  string `json:"settlement,omitempty"`   // settlement file that settled it
+}
+
+// CreateQrisRequest is the request body for POST /payments/qris. With a
+// quote_id the amount is taken from the signed quote.
+type CreateQrisRequest struct {
+	TrxID    string `json:"trx_id"`
+	OutletID string `json:"outlet_id"`
+	Amount   Money  `json:"amount"`
+	QuoteID  string `json:"quote_id,omitempty"`
+}
@@ -9,7 +9,7 @@ type Product struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	Price       float64   `json:"price"`
+	Price       Money     `json:"price"`
 	Category    string    `json:"category"`
 	Stock       int       `json:"stock"`
 	ImageURL    string    `json:"image_url"`
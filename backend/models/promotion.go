@@ -0,0 +1,86 @@
+package models
+
+// Promotion types supported by the promotions engine
+const (
+	PromoTypeBundle          = "bundle"           // fixed price for a set of menu items
+	PromoTypeBuyXGetY        = "buy_x_get_y"      // buy X units, get Y units free
+	PromoTypeCategoryPercent = "category_percent" // % off kategori / items (happy hour)
+	PromoTypeMemberDiscount  = "member_discount"  // % off for members only
+)
+
+// Promotion represents a discount rule in the promotion collection
+type Promotion struct {
+	ID          string   `json:"_id,omitempty"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	OutletIDs   []string `json:"outlet_ids,omitempty"` // empty = every outlet
+	MenuIDs     []string `json:"menu_ids,omitempty"`   // bundle members / eligible items
+	Kategori    []string `json:"kategori,omitempty"`   // eligible categories
+	BundlePrice Money    `json:"bundle_price,omitempty"`
+	BuyQty      int      `json:"buy_qty,omitempty"`
+	GetQty      int      `json:"get_qty,omitempty"`
+	Percent     float64  `json:"percent,omitempty"`
+	MemberOnly  bool     `json:"member_only"`
+	Days        []int    `json:"days,omitempty"`        // 0 = Sunday ... 6 = Saturday (WIB)
+	StartTime   string   `json:"start_time,omitempty"`  // HH:MM WIB
+	EndTime     string   `json:"end_time,omitempty"`    // HH:MM WIB
+	ValidFrom   string   `json:"valid_from,omitempty"`  // YYYY-MM-DD
+	ValidUntil  string   `json:"valid_until,omitempty"` // YYYY-MM-DD
+	Priority    int      `json:"priority"`              // higher is evaluated first
+	Active      bool     `json:"active"`
+	CreatedAt   string   `json:"created_at,omitempty"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+}
+
+// CartLine is a single priced menu line evaluated by the promotions engine
+type CartLine struct {
+	MenuID    string           `json:"menu_id"`
+	Name      string           `json:"name"`
+	Kategori  string           `json:"kategori"`
+	Variant   *SelectedOption  `json:"variant,omitempty"`
+	Modifiers []SelectedOption `json:"modifiers,omitempty"`
+	Qty       int              `json:"qty"`
+	Price     Money            `json:"price"` // unit price including variant and modifiers
+	Subtotal  Money            `json:"subtotal"`
+	Discount  Money            `json:"discount"`
+}
+
+// PromotionLineDiscount is the share of a promotion allocated to one cart line
+type PromotionLineDiscount struct {
+	Line     int    `json:"line"` // index into the cart lines
+	MenuID   string `json:"menu_id"`
+	Qty      int    `json:"qty"` // units consumed by the promotion
+	Discount Money  `json:"discount"`
+}
+
+// AppliedPromotion is a promotion that matched the cart
+type AppliedPromotion struct {
+	PromotionID string                  `json:"promotion_id"`
+	Name        string                  `json:"name"`
+	Type        string                  `json:"type"`
+	Discount    Money                   `json:"discount"`
+	Lines       []PromotionLineDiscount `json:"lines"`
+}
+
+// CartItemRequest is a menu reference sent by the POS client
+type CartItemRequest struct {
+	MenuID      string   `json:"menu_id"`
+	VariantID   string   `json:"variant_id,omitempty"`
+	ModifierIDs []string `json:"modifier_ids,omitempty"`
+	Qty         int      `json:"qty"`
+}
+
+// EvaluatePromotionsRequest is the request body for POST /promotions/evaluate
+type EvaluatePromotionsRequest struct {
+	OutletID string            `json:"outlet_id"`
+	MemberID string            `json:"member_id,omitempty"`
+	Items    []CartItemRequest `json:"items"`
+}
+
+// EvaluatePromotionsResponse is the result of running the engine over a cart
+type EvaluatePromotionsResponse struct {
+	Lines         []CartLine         `json:"lines"`
+	Promotions    []AppliedPromotion `json:"promotions"`
+	Subtotal      Money              `json:"subtotal"`
+	TotalDiscount Money              `json:"total_discount"`
+}
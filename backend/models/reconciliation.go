@@ -0,0 +1,51 @@
+package models
+
+// Reconciliation outcomes for a single settlement row or charge
+const (
+	ReconMatched            = "matched"
+	ReconUnmatched          = "unmatched"           // settlement row without a known charge
+	ReconDuplicated         = "duplicated"          // reference settled more than once
+	ReconAmountMismatch     = "amount_mismatch"     // settled amount differs from the charge
+	ReconUnsettled          = "unsettled"           // paid charge missing from the settlement file
+	ReconMissingTransaction = "missing_transaction" // settled charge never finalized into a transaction
+)
+
+// SettlementRow is one line of a gateway's daily settlement file
+type SettlementRow struct {
+	Line      int    `json:"line"`
+	Reference string `json:"reference"`
+	GatewayID string `json:"gateway_id,omitempty"`
+	Amount    Money  `json:"amount"`
+	SettledAt string `json:"settled_at,omitempty"`
+}
+
+// ReconciliationItem is a flagged (or matched) settlement row or charge
+type ReconciliationItem struct {
+	Status        string `json:"status"`
+	Line          int    `json:"line,omitempty"` // settlement file line, 0 for unsettled charges
+	Reference     string `json:"reference"`
+	TrxID         string `json:"trx_id,omitempty"`
+	ChargeAmount  Money  `json:"charge_amount"`
+	SettledAmount Money  `json:"settled_amount"`
+	Note          string `json:"note,omitempty"`
+}
+
+// ReconciliationReport is the result of reconciling one settlement file for
+// one outlet (reconciliation_report collection)
+type ReconciliationReport struct {
+	ID                 string               `json:"_id"`
+	OutletID           string               `json:"outlet_id"`
+	Gateway            string               `json:"gateway"`
+	Date               string               `json:"date"` // settlement date, YYYY-MM-DD
+	FileName           string               `json:"file_name"`
+	ImportedAt         string               `json:"imported_at"`
+	Matched            int                  `json:"matched"`
+	Unmatched          int                  `json:"unmatched"`
+	Duplicated         int                  `json:"duplicated"`
+	AmountMismatch     int                  `json:"amount_mismatch"`
+	Unsettled          int                  `json:"unsettled"`
+	MissingTransaction int                  `json:"missing_transaction"`
+	ChargeAmount       Money                `json:"charge_amount"`
+	SettledAmount      Money                `json:"settled_amount"`
+	Items              []ReconciliationItem `json:"items"`
+}
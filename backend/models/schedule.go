@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Schedule limits when a menu item or kategori can be sold. Empty fields
+// do not restrict; all times are WIB.
+type Schedule struct {
+	Days       []int        `json:"days,omitempty"`       // 0 = Sunday ... 6 = Saturday
+	Windows    []TimeWindow `json:"windows,omitempty"`    // sellable during any of them
+	ValidFrom  string       `json:"validFrom,omitempty"`  // YYYY-MM-DD, e.g. start of a seasonal menu
+	ValidUntil string       `json:"validUntil,omitempty"` // YYYY-MM-DD, inclusive
+}
+
+// TimeWindow is a daily HH:MM range; End before Start wraps past midnight
+// (e.g. 22:00 - 02:00)
+type TimeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Allows reports whether the schedule permits selling at a moment, which
+// the caller passes in WIB. A nil schedule always allows. The part of an
+// overnight window after midnight belongs to the day it started on, so a
+// Friday 22:00 - 02:00 window still allows Saturday 01:00.
+func (s *Schedule) Allows(at time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	if len(s.Windows) == 0 {
+		return s.onDay(at)
+	}
+	now := at.Hour()*60 + at.Minute()
+	for _, w := range s.Windows {
+		start, ok := clockMinutes(w.Start)
+		if !ok {
+			continue
+		}
+		end, ok := clockMinutes(w.End)
+		if !ok {
+			continue
+		}
+		switch {
+		case start <= end:
+			if now >= start && now < end && s.onDay(at) {
+				return true
+			}
+		case now >= start:
+			if s.onDay(at) {
+				return true
+			}
+		case now < end:
+			if s.onDay(at.AddDate(0, 0, -1)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// onDay reports whether the schedule's dates and weekdays include a day
+func (s *Schedule) onDay(at time.Time) bool {
+	day := at.Format("2006-01-02")
+	if s.ValidFrom != "" && day < s.ValidFrom {
+		return false
+	}
+	if s.ValidUntil != "" && day > s.ValidUntil {
+		return false
+	}
+
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if d == int(at.Weekday()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clockMinutes reads an H:MM or HH:MM time of day as minutes after midnight
+func clockMinutes(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// CategorySchedule is the schedule of a kategori within a kemitraan in the
+// category_schedule collection, used before categories existed. The
+// category migration copies these onto the categories.
+type CategorySchedule struct {
+	ID        string    `json:"_id"`
+	Kemitraan string    `json:"kemitraan"`
+	Kategori  string    `json:"kategori"`
+	Schedule  *Schedule `json:"schedule"`
+	UpdatedAt string    `json:"updated_at,omitempty"`
+}
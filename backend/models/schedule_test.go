@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleAllows(t *testing.T) {
+	wib := time.FixedZone("WIB", 7*3600)
+	// 2024-05-15 is a Wednesday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, wib)
+	}
+	breakfast := []TimeWindow{{Start: "06:00", End: "10:30"}}
+	late := []TimeWindow{{Start: "22:00", End: "02:00"}}
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		at       time.Time
+		want     bool
+	}{
+		{"nil", nil, at(15, 3, 0), true},
+		{"empty", &Schedule{}, at(15, 3, 0), true},
+		{"window start", &Schedule{Windows: breakfast}, at(15, 6, 0), true},
+		{"window end is exclusive", &Schedule{Windows: breakfast}, at(15, 10, 30), false},
+		{"before window", &Schedule{Windows: breakfast}, at(15, 5, 59), false},
+		{"wraps before midnight", &Schedule{Windows: late}, at(15, 23, 15), true},
+		{"wraps after midnight", &Schedule{Windows: late}, at(16, 1, 59), true},
+		{"wrap end is exclusive", &Schedule{Windows: late}, at(16, 2, 0), false},
+		{"outside wrap", &Schedule{Windows: late}, at(15, 12, 0), false},
+		{"single digit hour", &Schedule{Windows: []TimeWindow{{Start: "9:00", End: "17:00"}}}, at(15, 10, 0), true},
+		{"single digit hour after", &Schedule{Windows: []TimeWindow{{Start: "9:00", End: "17:00"}}}, at(15, 18, 0), false},
+		{"any window", &Schedule{Windows: append(append([]TimeWindow{}, breakfast...), late...)}, at(15, 22, 30), true},
+		{"invalid window is skipped", &Schedule{Windows: []TimeWindow{{Start: "soon", End: "later"}}}, at(15, 12, 0), false},
+		{"weekday", &Schedule{Days: []int{1, 2, 3, 4, 5}}, at(15, 12, 0), true},
+		{"weekend only", &Schedule{Days: []int{0, 6}}, at(15, 12, 0), false},
+		{"Sunday", &Schedule{Days: []int{0}}, at(19, 12, 0), true},
+		{"day and window", &Schedule{Days: []int{3}, Windows: breakfast}, at(15, 7, 0), true},
+		{"day but not window", &Schedule{Days: []int{3}, Windows: breakfast}, at(15, 11, 0), false},
+		{"before validFrom", &Schedule{ValidFrom: "2024-05-16"}, at(15, 12, 0), false},
+		{"on validUntil", &Schedule{ValidUntil: "2024-05-15"}, at(15, 23, 59), true},
+		{"after validUntil", &Schedule{ValidUntil: "2024-05-15"}, at(16, 0, 0), false},
+		{"after midnight counts as the day before", &Schedule{Days: []int{5}, Windows: late}, at(18, 1, 0), true},
+		{"after midnight of the day before", &Schedule{Days: []int{6}, Windows: late}, at(18, 1, 0), false},
+		{"before midnight on the day", &Schedule{Days: []int{5}, Windows: late}, at(17, 23, 0), true},
+		{"after midnight of the last valid day", &Schedule{ValidUntil: "2024-05-15", Windows: late}, at(16, 1, 0), true},
+		{"after midnight before validFrom", &Schedule{ValidFrom: "2024-05-16", Windows: late}, at(16, 1, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.Allows(tt.at); got != tt.want {
+			t.Errorf("%s: Allows(%s) = %v, want %v", tt.name, tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+// Sequence kinds, each counted per outlet per day
+const (
+	SequenceOrder       = "order"
+	SequenceQueue       = "queue"
+	SequenceTransaction = "transaction"
+)
+
+// SequenceNumber is a number issued by the sequence service
+type SequenceNumber struct {
+	Kind     string `json:"kind"`
+	OutletID string `json:"outlet_id"`
+	Date     string `json:"date"`   // business day in WIB, YYYY-MM-DD
+	Value    int64  `json:"value"`  // 1, 2, 3, ... per outlet per day
+	Number   string `json:"number"` // formatted, e.g. A001 or ORD-20250101-0001
+}
@@ -0,0 +1,30 @@
+package models
+
+// CloseShiftRequest is the request body for closing a cashier shift
+type CloseShiftRequest struct {
+	Cashier     string `json:"cashier"`
+	DeviceID    string `json:"device_id"`
+	OpenedAt    string `json:"opened_at"` // RFC3339
+	OpeningCash Money  `json:"opening_cash"`
+	CountedCash Money  `json:"counted_cash"` // cash counted in the drawer at close
+	Note        string `json:"note,omitempty"`
+}
+
+// ShiftClose records a closed cashier shift (shift_close collection, keyed
+// by outlet, device or cashier, and opening time)
+type ShiftClose struct {
+	ID                string `json:"_id"`
+	OutletID          string `json:"outlet_id"`
+	Cashier           string `json:"cashier,omitempty"`
+	DeviceID          string `json:"device_id,omitempty"`
+	OpenedAt          string `json:"opened_at"`
+	ClosedAt          string `json:"closed_at"`
+	TotalTransactions int    `json:"total_transactions"`
+	NetSales          Money  `json:"net_sales"`
+	OpeningCash       Money  `json:"opening_cash"`
+	CashSales         Money  `json:"cash_sales"`    // cash taken less change given
+	ExpectedCash      Money  `json:"expected_cash"` // opening cash plus cash sales
+	CountedCash       Money  `json:"counted_cash"`
+	Difference        Money  `json:"difference"` // counted less expected
+	Note              string `json:"note,omitempty"`
+}
@@ -0,0 +1,75 @@
+package models
+
+// Ack statuses for transactions uploaded by a device
+const (
+	SyncAccepted  = "accepted"  // saved now
+	SyncDuplicate = "duplicate" // already saved by an earlier upload
+	SyncRejected  = "rejected"  // invalid; the sequence number is used up, see sync_rejection
+	SyncRetry     = "retry"     // server-side failure; upload it again
+)
+
+// SyncDevice is the sync state of a POS device (sync_device collection,
+// keyed by device ID)
+type SyncDevice struct {
+	DeviceID     string  `json:"_id"`
+	OutletID     string  `json:"outlet_id"`
+	LastSeq      int64   `json:"last_seq"` // every device_seq up to here has been received
+	Received     []int64 `json:"received"` // received device_seqs above last_seq
+	LastUploadAt string  `json:"last_upload_at,omitempty"`
+	LastPullAt   string  `json:"last_pull_at,omitempty"`
+	Version      int64   `json:"version"` // bumped on every upload, for compare-and-set
+
+	// Menu item hashes as of the token of the last pull, so the next pull
+	// can send only changed and deleted items
+	MenuToken  string            `json:"menu_token,omitempty"`
+	MenuHashes map[string]string `json:"menu_hashes,omitempty"`
+}
+
+// SyncUploadRequest is the request body for POST /sync/transactions.
+// Every transaction carries the device_seq the device gave it.
+type SyncUploadRequest struct {
+	DeviceID     string        `json:"device_id"`
+	OutletID     string        `json:"outlet_id"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// SyncAck is the server's answer for one uploaded transaction
+type SyncAck struct {
+	DeviceSeq int64  `json:"device_seq"`
+	TrxID     string `json:"trx_id"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+
+	// Checks that failed for an accepted transaction, left for review
+	ReviewFlags []string `json:"review_flags,omitempty"`
+}
+
+// SyncStatus tells a device which of its sequence numbers are still missing
+type SyncStatus struct {
+	DeviceID string  `json:"device_id"`
+	OutletID string  `json:"outlet_id"`
+	LastSeq  int64   `json:"last_seq"`
+	Missing  []int64 `json:"missing"` // gaps below the highest received device_seq
+}
+
+// SyncUploadResponse is the response of POST /sync/transactions
+type SyncUploadResponse struct {
+	SyncStatus
+	Acks []SyncAck `json:"acks"`
+}
+
+// MenuDelta lists menu items changed or removed since a sync token
+type MenuDelta struct {
+	Upserted []Menu   `json:"upserted"`
+	Deleted  []string `json:"deleted"`
+}
+
+// SyncPullResponse is the response of GET /sync/pull. With full set the
+// device should replace its local data instead of applying a delta.
+type SyncPullResponse struct {
+	Token    string          `json:"token"`
+	Full     bool            `json:"full"`
+	Menu     MenuDelta       `json:"menu"`
+	Vouchers []Voucher       `json:"vouchers"`
+	Settings *OutletSettings `json:"settings,omitempty"` // only when changed
+}
@@ -0,0 +1,62 @@
+package models
+
+// Table statuses
+const (
+	TableFree     = "free"
+	TableOccupied = "occupied"
+	TableReserved = "reserved"
+	TableCleaning = "cleaning"
+)
+
+// IsTableStatus reports whether s is a known table status
+func IsTableStatus(s string) bool {
+	switch s {
+	case TableFree, TableOccupied, TableReserved, TableCleaning:
+		return true
+	}
+	return false
+}
+
+// Table is a dine-in table of an outlet (outlet_table collection, keyed by
+// outlet ID and table code)
+type Table struct {
+	ID        string `json:"_id"`
+	OutletID  string `json:"outlet_id"`
+	Code      string `json:"code"` // matches table_number on open bills
+	Area      string `json:"area"` // e.g. indoor, outdoor, lantai 2
+	Capacity  int    `json:"capacity"`
+	Status    string `json:"status"`
+	Guests    int    `json:"guests,omitempty"`
+	SeatedAt  string `json:"seated_at,omitempty"`
+	Active    bool   `json:"active"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// TableBill summarizes the open bill on a table for the floor view
+type TableBill struct {
+	OrderID     string `json:"order_id"`
+	OrderNumber string `json:"order_number"`
+	Status      string `json:"status"`
+	Items       int    `json:"items"`
+	TotalAmount Money  `json:"total_amount"`
+	OpenedAt    string `json:"opened_at"`
+	OpenMinutes int    `json:"open_minutes"`
+}
+
+// FloorTable is one table in the floor view
+type FloorTable struct {
+	Table
+	Bill *TableBill `json:"bill,omitempty"`
+}
+
+// SeatTableRequest is the request body for POST /outlets/:outlet_id/tables/:code/seat
+type SeatTableRequest struct {
+	Guests int    `json:"guests"`
+	Actor  string `json:"actor,omitempty"`
+}
+
+// ReleaseTableRequest is the request body for POST /outlets/:outlet_id/tables/:code/release
+type ReleaseTableRequest struct {
+	Status string `json:"status"` // cleaning (default) or free
+	Actor  string `json:"actor,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// TrxIDInfo is a server-format transaction ID broken into its parts:
+// TRX-<outlet code>-<YYYYMMDD>-<device>-<sequence>-<check>
+type TrxIDInfo struct {
+	TrxID      string `json:"trx_id"`
+	OutletCode string `json:"outlet_code"`
+	Date       string `json:"date"` // WIB business day, YYYY-MM-DD
+	Device     string `json:"device"`
+	Sequence   int64  `json:"sequence"`
+}
+
+// AllocateTrxIDRequest is the request body for POST /transactions/ids
+type AllocateTrxIDRequest struct {
+	OutletID string `json:"outlet_id"`
+	DeviceID string `json:"device_id"`
+}
@@ -31,6 +31,7 @@ type VerifyVoucherResponse struct {
 type UseVoucherRequest struct {
 	CodeVoucher string `json:"code_voucher"`
 	RedeemedBy  string `json:"redeemed_by,omitempty"`
+	OutletID    string `json:"outlet_id,omitempty"` // outlet that redeemed it, for the event stream
 }
 
 // UseVoucherResponse represents the response for using a voucher
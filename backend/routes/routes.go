@@ -1,20 +1,49 @@
 package routes
 
 import (
+	"errors"
+	"log"
+	"sagawa_pos_backend/blobstore"
 	"sagawa_pos_backend/config"
+	"sagawa_pos_backend/gateway"
 	"sagawa_pos_backend/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// SetupRoutes configures all API routes
-func SetupRoutes(api fiber.Router, dbClient *config.AstraDBClient) {
+// SetupRoutes configures all API routes. It fails when an adapter is
+// misconfigured or a required secret is missing; without a payment gateway
+// the QRIS payment routes answer 503.
+func SetupRoutes(api fiber.Router, dbClient *config.AstraDBClient) error {
+	if err := handlers.CheckSigningKeys(); err != nil {
+		return err
+	}
+	paymentGateway, err := gateway.NewFromEnv()
+	if errors.Is(err, gateway.ErrNotConfigured) {
+		log.Printf("QRIS payments disabled: %v", err)
+	} else if err != nil {
+		return err
+	}
+
 	// Initialize handlers
 	productHandler := handlers.NewProductHandler(dbClient)
-	menuHandler := handlers.NewMenuHandler(dbClient)
+	menuHandler := handlers.NewMenuHandler(dbClient, blobstore.NewFromEnv())
 	orderHandler := handlers.NewOrderHandler(dbClient)
 	userHandler := handlers.NewUserHandler(dbClient)
 	voucherHandler := handlers.NewVoucherHandler(dbClient)
+	promotionHandler := handlers.NewPromotionHandler(dbClient)
+	memberHandler := handlers.NewMemberHandler(dbClient)
+	cartHandler := handlers.NewCartHandler(dbClient)
+	outletHandler := handlers.NewOutletHandler(dbClient)
+	tableHandler := handlers.NewTableHandler(dbClient)
+	kitchenHandler := handlers.NewKitchenHandler(dbClient)
+	eventHandler := handlers.NewEventHandler(dbClient)
+	syncHandler := handlers.NewSyncHandler(dbClient)
+	paymentHandler := handlers.NewPaymentHandler(dbClient, paymentGateway)
+	if paymentGateway != nil {
+		paymentHandler.StartReconciliation()
+	}
+	menuHandler.StartPriceScheduler()
 
 	// Product routes
 	products := api.Group("/products")
@@ -28,9 +57,32 @@ func SetupRoutes(api fiber.Router, dbClient *config.AstraDBClient) {
 	menu := api.Group("/menu")
 	menu.Get("/", menuHandler.GetAllMenu)
 	menu.Get("/raw", menuHandler.GetRaw)
+	menu.Get("/search", menuHandler.SearchMenu)
 	menu.Get("/categories", menuHandler.GetCategories)
+	menu.Get("/categories/schedules", menuHandler.GetCategorySchedules)
+	menu.Put("/categories/schedule", menuHandler.SetCategorySchedule)
+	menu.Post("/categories", menuHandler.CreateCategory)
+	menu.Put("/categories/order", menuHandler.ReorderCategories)
+	menu.Post("/categories/migrate", menuHandler.MigrateCategories) // ?dry_run=true
+	menu.Post("/images/migrate", menuHandler.MigrateMenuImages)     // ?dry_run=true
+	menu.Post("/price-schedules/apply", menuHandler.ApplyPriceSchedules)
+	menu.Get("/export", menuHandler.ExportMenu)  // ?format=csv|xlsx
+	menu.Post("/import", menuHandler.ImportMenu) // multipart, field "file"; ?dry_run=false applies
+	menu.Put("/categories/:id", menuHandler.UpdateCategory)
 	menu.Get("/:id", menuHandler.GetMenu)
 	menu.Post("/refresh-cache", menuHandler.RefreshMenuCache)
+	menu.Post("/", menuHandler.CreateMenu)
+	menu.Put("/:id", menuHandler.UpdateMenu)
+	menu.Delete("/:id", menuHandler.DeleteMenu) // Soft delete
+	menu.Post("/:id/restore", menuHandler.RestoreMenu)
+	menu.Post("/:id/image", menuHandler.UploadMenuImage) // multipart, field "image"
+	menu.Get("/:id/history", menuHandler.GetMenuHistory)
+	menu.Get("/:id/price-schedules", menuHandler.GetPriceSchedules) // ?status=pending
+	menu.Post("/:id/price-schedules", menuHandler.SchedulePrice)
+	menu.Delete("/:id/price-schedules/:schedule_id", menuHandler.CancelPriceSchedule)
+
+	// Uploaded images, named by content hash
+	api.Get("/images/:name", menuHandler.ServeImage)
 
 	// Kasir (users) routes
 	kasir := api.Group("/kasir")
@@ -47,18 +99,107 @@ func SetupRoutes(api fiber.Router, dbClient *config.AstraDBClient) {
 	orders.Get("/", orderHandler.GetAllOrders)
 	orders.Get("/:id", orderHandler.GetOrder)
 	orders.Post("/", orderHandler.CreateOrder)
+	orders.Post("/migrate", orderHandler.MigrateOrders)     // ?dry_run=true
+	orders.Put("/:id/items", orderHandler.UpdateOrderItems) // Only while open
 	orders.Patch("/:id/status", orderHandler.UpdateOrderStatus)
+
+	// Open bills - dine-in orders tied to a table, settled into a transaction
+	orders.Post("/:id/items", orderHandler.AppendBillItems)
+	orders.Delete("/:id/items/:line_id", orderHandler.RemoveBillItem)
+	orders.Post("/:id/transfer", orderHandler.TransferBill)
+	orders.Post("/:id/merge", orderHandler.MergeBill)
+	orders.Post("/:id/split", orderHandler.SplitBill)
+	orders.Post("/:id/settle", orderHandler.SettleBill)
 	orders.Post("/transaction", orderHandler.SaveTransaction)
+	orders.Post("/transaction/:trx_id/void", orderHandler.VoidTransaction)
 
 	// Transaction routes - get by outlet
 	transactions := api.Group("/transactions")
 	transactions.Get("/outlet/:outlet_id", orderHandler.GetTransactionsByOutlet)
 	transactions.Get("/outlet/:outlet_id/range", orderHandler.GetTransactionsByOutletAndDateRange)
 	transactions.Get("/outlet/:outlet_id/recap", orderHandler.GetYearlyRecap) // Rekap tahunan
+	transactions.Get("/outlet/:outlet_id/tax-report", orderHandler.GetTaxReport) // Pajak per tarif
+	transactions.Get("/outlet/:outlet_id/z-report", orderHandler.GetZReport)     // Tutup kasir harian
+	transactions.Post("/outlet/:outlet_id/shifts/close", orderHandler.CloseShift)
+	transactions.Post("/ids", orderHandler.AllocateTrxID)
+	transactions.Get("/:trx_id", orderHandler.GetTransaction)
 
 	// Voucher routes
 	vouchers := api.Group("/vouchers")
 	vouchers.Post("/verify", voucherHandler.VerifyVoucher) // Verify voucher (check validity and get nominal)
 	vouchers.Post("/use", voucherHandler.UseVoucher)       // Use voucher (mark as used with customer name)
 	vouchers.Get("/check", voucherHandler.GetVoucherByCode) // Preview voucher without using it
+
+	// Promotion routes
+	promotions := api.Group("/promotions")
+	promotions.Get("/", promotionHandler.GetPromotions)
+	promotions.Post("/", promotionHandler.CreatePromotion)
+	promotions.Post("/evaluate", promotionHandler.EvaluatePromotions) // Price a cart against active promotions
+	promotions.Put("/:id", promotionHandler.UpdatePromotion)
+	promotions.Delete("/:id", promotionHandler.DeletePromotion) // Soft delete (deactivate)
+
+	// Member routes - member-only promotions need an active member
+	members := api.Group("/members")
+	members.Get("/", memberHandler.GetMembers)
+	members.Get("/:id", memberHandler.GetMember)
+	members.Post("/", memberHandler.CreateMember)
+	members.Delete("/:id", memberHandler.DeleteMember) // Soft delete (deactivate)
+
+	// Cart routes - authoritative server-side pricing
+	cart := api.Group("/cart")
+	cart.Post("/quote", cartHandler.Quote)
+
+	// Outlet routes - pricing settings (tax, service charge)
+	outlets := api.Group("/outlets")
+	outlets.Get("/:outlet_id/settings", outletHandler.GetSettings)
+	outlets.Put("/:outlet_id/settings", outletHandler.UpdateSettings)
+	outlets.Post("/:outlet_id/sequences/:kind", outletHandler.NextNumber) // order / queue / transaction
+	outlets.Post("/:outlet_id/sequences/:kind/release", outletHandler.ReleaseNumber)
+
+	// Per-outlet menu availability and prices
+	outlets.Get("/:outlet_id/menu/overrides", outletHandler.GetMenuOverrides)
+	outlets.Put("/:outlet_id/menu/:menu_id/availability", outletHandler.SetMenuAvailability)
+	outlets.Put("/:outlet_id/menu/:menu_id/price", outletHandler.SetMenuPrice)
+
+	// Table registry and floor view
+	outlets.Get("/:outlet_id/tables", tableHandler.GetFloor)
+	outlets.Post("/:outlet_id/tables", tableHandler.CreateTable)
+	outlets.Put("/:outlet_id/tables/:code", tableHandler.UpdateTable)
+	outlets.Delete("/:outlet_id/tables/:code", tableHandler.DeleteTable)
+	outlets.Post("/:outlet_id/tables/:code/seat", tableHandler.SeatTable)
+	outlets.Post("/:outlet_id/tables/:code/release", tableHandler.ReleaseTable)
+
+	// Kitchen display routes - items routed to stations by menu kategori
+	kitchenRoutes := api.Group("/kitchen")
+	kitchenRoutes.Get("/:outlet_id/items", kitchenHandler.GetItems)
+	kitchenRoutes.Get("/:outlet_id/stream", kitchenHandler.Stream) // Server-Sent Events, ?station=
+	kitchenRoutes.Get("/:outlet_id/metrics", kitchenHandler.GetMetrics)
+	kitchenRoutes.Post("/items/:id/start", kitchenHandler.StartItem)
+	kitchenRoutes.Post("/items/:id/done", kitchenHandler.DoneItem)
+
+	// Live domain events for outlet dashboards (Server-Sent Events)
+	api.Get("/events/stream", eventHandler.Stream)
+
+	// Offline sync for POS devices
+	sync := api.Group("/sync")
+	sync.Post("/transactions", syncHandler.UploadTransactions)
+	sync.Get("/devices/:device_id", syncHandler.GetDeviceStatus)
+	sync.Get("/pull", syncHandler.Pull)
+
+	// Payment routes - dynamic QRIS through the payment gateway
+	payments := api.Group("/payments")
+	if paymentGateway == nil {
+		payments.Use(handlers.PaymentsUnavailable)
+	}
+	payments.Post("/qris", paymentHandler.CreateQrisCharge)
+	payments.Post("/notification", paymentHandler.HandleNotification) // Gateway webhook (signed)
+	payments.Post("/reconcile", paymentHandler.Reconcile)             // Poll pending charges now
+	payments.Post("/settlements/import", paymentHandler.ImportSettlement)
+	payments.Get("/reconciliation", paymentHandler.GetReconciliationReports)
+	payments.Get("/:reference", paymentHandler.GetCharge)
+	if _, fake := paymentGateway.(*gateway.FakeGateway); fake {
+		payments.Post("/:reference/simulate-paid", paymentHandler.SimulatePaid) // Development only
+	}
+
+	return nil
 }
@@ -0,0 +1,120 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// workbook zips the given parts into an XLSX file
+func workbook(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const sheetNS = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"`
+
+func TestReadXLSXCells(t *testing.T) {
+	data := workbook(t, map[string]string{
+		"xl/sharedStrings.xml": `<sst ` + sheetNS + `><si><t>name</t></si><si><t>price</t></si>` +
+			`<si><r><t>Es </t></r><r><t>Teh</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet ` + sheetNS + `><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>5000</v></c><c r="D2" t="b"><v>1</v></c></row>` +
+			`<row r="4"><c r="B4" t="inlineStr"><is><t>Kopi</t></is></c><c r="C4" t="str"><f>A2</f><v>cached</v></c></row>` +
+			`</sheetData></worksheet>`,
+	})
+
+	rows, err := readXLSX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "price"},
+		{"Es Teh", "5000", "", "true"}, // skipped cells are empty
+		nil,                            // missing rows too
+		{"", "Kopi", "cached"},         // formulas give their cached value
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+}
+
+func TestReadXLSXFindsTheFirstSheet(t *testing.T) {
+	data := workbook(t, map[string]string{
+		"xl/workbook.xml": `<workbook ` + sheetNS + ` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Menu" sheetId="2" r:id="rId7"/><sheet name="Old" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId7" Target="/xl/worksheets/menu.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": `<worksheet ` + sheetNS + `><sheetData><row r="1"><c r="A1"><v>1</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/menu.xml":   `<worksheet ` + sheetNS + `><sheetData><row r="1"><c r="A1"><v>2</v></c></row></sheetData></worksheet>`,
+	})
+	rows, err := readXLSX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows, [][]string{{"2"}}) {
+		t.Errorf("rows %q, want the sheet named Menu", rows)
+	}
+}
+
+func TestReadXLSXRejectsBrokenWorkbooks(t *testing.T) {
+	sheet := func(rows string) []byte {
+		return workbook(t, map[string]string{
+			"xl/worksheets/sheet1.xml": `<worksheet ` + sheetNS + `><sheetData>` + rows + `</sheetData></worksheet>`,
+		})
+	}
+	tests := map[string][]byte{
+		"not a zip":         []byte("PK\x03\x04 not really"),
+		"no sheet":          workbook(t, map[string]string{"xl/styles.xml": "<styleSheet/>"}),
+		"bad XML":           sheet(`<row r="1"><c r="A1"><v>1</v></row>`),
+		"rows out of order": sheet(`<row r="2"/><row r="1"/>`),
+		"bad reference":     sheet(`<row r="1"><c r="1A"><v>1</v></c></row>`),
+		"column too far":    sheet(`<row r="1"><c r="ZZZZ1"><v>1</v></c></row>`),
+		"shared string":     sheet(`<row r="1"><c r="A1" t="s"><v>3</v></c></row>`),
+	}
+	for name, data := range tests {
+		if rows, err := readXLSX(data); err == nil {
+			t.Errorf("%s: read %q", name, rows)
+		}
+	}
+}
+
+func TestWriteAndReadXLSX(t *testing.T) {
+	rows := [][]string{
+		{"id", "name", "price", "description"},
+		{"M1", "Es Teh <Manis> & Dingin", "5000", ""},
+		{"M2", "Kopi", "0812345678901234567", "  spasi  "},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatXLSX, "Menu: [Outlet 1]", rows); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		rows[0],
+		{"M1", "Es Teh <Manis> & Dingin", "5000"}, // empty cells are not written
+		{"M2", "Kopi", "0812345678901234567", "spasi"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read back %q, want %q", got, want)
+	}
+}